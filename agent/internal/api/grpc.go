@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"winmanager-agent/internal/config"
 	pb "winmanager-agent/protos"
 	"winmanager-agent/pkg/screen"
 	"winmanager-agent/pkg/input"
@@ -26,6 +27,10 @@ func (s *GRPCServer) Mouse(ctx context.Context, req *pb.MouseRequest) (*pb.Mouse
 		"ts":     req.Ts,
 	}).Debug("Received mouse event")
 
+	if !config.GetGlobalConfig().IsMouseEnabled() {
+		return nil, fmt.Errorf("mouse input is disabled")
+	}
+
 	// Validate coordinates
 	if req.X < 0 || req.Y < 0 {
 		return nil, fmt.Errorf("invalid coordinates: x=%d, y=%d", req.X, req.Y)
@@ -50,6 +55,10 @@ func (s *GRPCServer) Key(ctx context.Context, req *pb.KeyRequest) (*pb.KeyReply,
 		"ts":     req.Ts,
 	}).Debug("Received key event")
 
+	if !config.GetGlobalConfig().IsKeyboardEnabled() {
+		return nil, fmt.Errorf("keyboard input is disabled")
+	}
+
 	// Execute keyboard action
 	if err := input.HandleKeyEvent(int(req.Key), int(req.Method)); err != nil {
 		log.WithError(err).Error("Failed to handle key event")
@@ -83,6 +92,10 @@ func (s *GRPCServer) Screenshot(ctx context.Context, req *pb.ScreenshotRequest)
 func (s *GRPCServer) Paste(ctx context.Context, req *pb.PasteRequest) (*pb.PasteReply, error) {
 	log.WithField("data_length", len(req.Data)).Debug("Received paste request")
 
+	if !config.GetGlobalConfig().IsPasteEnabled() {
+		return nil, fmt.Errorf("paste input is disabled")
+	}
+
 	// Validate input
 	if req.Data == "" {
 		return nil, fmt.Errorf("paste data cannot be empty")
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"winmanager-agent/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 保存注册得到的实例ID的文件，与配置文件在同一目录
+const identityFileName = "agent_id.json"
+
+// agentIdentity 本地保存的注册信息，重启后注册时沿用实例ID
+type agentIdentity struct {
+	ID           int       `json:"id"`
+	ServerURL    string    `json:"server_url"`
+	Secret       string    `json:"secret,omitempty"`      // 后端在首次注册时签发，重新注册时证明是同一个Agent
+	PendingKey   string    `json:"pending_key,omitempty"` // 等待管理员审批时后端签发，审批通过后凭它完成注册
+	RegisteredAt time.Time `json:"registered_at"`
+}
+
+// identityPath 注册信息文件路径
+func identityPath() string {
+	dir := "."
+	if configPath := config.GetGlobalConfig().GetConfigPath(); configPath != "" {
+		dir = filepath.Dir(configPath)
+	}
+	return filepath.Join(dir, identityFileName)
+}
+
+// loadIdentity 读取本地保存的注册信息，没有保存或不是向serverURL及配置的其他后端注册的返回空
+func loadIdentity(serverURL string) agentIdentity {
+	data, err := os.ReadFile(identityPath())
+	if err != nil {
+		return agentIdentity{}
+	}
+	var identity agentIdentity
+	if err := json.Unmarshal(data, &identity); err != nil {
+		log.WithError(err).Warn("本地保存的注册信息格式错误，忽略")
+		return agentIdentity{}
+	}
+	if identity.ServerURL == serverURL {
+		return identity
+	}
+	for _, url := range config.GetGlobalConfig().GetServerURLs() {
+		if identity.ServerURL == url {
+			return identity
+		}
+	}
+	return agentIdentity{}
+}
+
+// saveIdentity 保存注册信息
+func saveIdentity(identity agentIdentity) {
+	if identity.RegisteredAt.IsZero() {
+		identity.RegisteredAt = time.Now()
+	}
+	data, err := json.MarshalIndent(identity, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(identityPath(), data, 0600); err != nil {
+		log.WithError(err).Warn("保存注册信息失败")
+	}
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"winmanager-agent/internal/config"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 正在获取集中配置，避免心跳重复触发
+var managedConfigSyncing int32
+
+// managedConfigResponse 后端返回的设备生效配置
+type managedConfigResponse struct {
+	Code int    `json:"code"`
+	Msg  string `json:"msg"`
+	Data *struct {
+		Version string                     `json:"version"`
+		Config  map[string]json.RawMessage `json:"config"`
+	} `json:"data"`
+}
+
+// SyncManagedConfig fetches the effective centrally managed configuration and applies it
+func SyncManagedConfig(serverURL string) error {
+	if registeredAgentID == 0 {
+		return fmt.Errorf("agent not registered, cannot fetch managed config")
+	}
+
+	url := fmt.Sprintf("%s/api/instances/%d/config", serverURL, registeredAgentID)
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch managed config: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result managedConfigResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode managed config: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || result.Code != 0 || result.Data == nil {
+		return fmt.Errorf("获取集中配置失败，状态码: %d, %s", resp.StatusCode, result.Msg)
+	}
+
+	cfg := config.GetGlobalConfig()
+	previous := cfg.GetManagedState().Version
+	if err := cfg.ApplyManagedConfig(result.Data.Version, result.Data.Config); err != nil {
+		return fmt.Errorf("应用集中配置失败: %w", err)
+	}
+
+	if previous != result.Data.Version {
+		log.WithFields(log.Fields{
+			"version":  result.Data.Version,
+			"previous": previous,
+			"sections": cfg.GetManagedState().Sections,
+		}).Info("已应用集中配置")
+	}
+	return nil
+}
+
+// syncManagedConfigAsync 在后台获取集中配置，已有获取在进行时跳过
+func syncManagedConfigAsync(serverURL string) {
+	if !atomic.CompareAndSwapInt32(&managedConfigSyncing, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&managedConfigSyncing, 0)
+		if err := SyncManagedConfig(serverURL); err != nil {
+			log.WithError(err).Warn("同步集中配置失败")
+		}
+	}()
+}
@@ -3,11 +3,16 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
+	"winmanager-agent/internal/config"
 	"winmanager-agent/pkg/device"
+	"winmanager-agent/pkg/proxy"
+	"winmanager-agent/pkg/updater"
+	"winmanager-agent/pkg/watchdog"
 
 	"github.com/shirou/gopsutil/v3/host"
 	log "github.com/sirupsen/logrus"
@@ -16,11 +21,36 @@ import (
 // 全局变量保存注册的Agent ID
 var registeredAgentID int
 
+// updateHandler 心跳响应中包含更新信息时调用
+var updateHandler func(updater.Release)
+
+// SetUpdateHandler sets the callback for updates offered in heartbeat responses
+func SetUpdateHandler(fn func(updater.Release)) {
+	updateHandler = fn
+}
+
+// 后端注册接口的错误码（controllers.ErrEnrollment、controllers.ErrEnrollmentPending）
+const (
+	serverCodeEnrollment        = 1006
+	serverCodeEnrollmentPending = 1007
+)
+
+// 注册准入协议版本，1起支持保存后端签发的Agent密钥
+const enrollmentVersion = 1
+
+var (
+	// ErrEnrollmentRequired 后端要求注册令牌或令牌无效，需要管理员签发令牌或审批
+	ErrEnrollmentRequired = errors.New("enrollment rejected by server")
+	// ErrEnrollmentPending 注册申请等待管理员审批
+	ErrEnrollmentPending = errors.New("registration is pending approval")
+)
+
 // RegisterResponse represents the response from agent registration
 type RegisterResponse struct {
 	Code    int         `json:"code"`
 	Data    interface{} `json:"data"` // 使用 interface{} 来处理不同的响应格式
 	Message string      `json:"message"`
+	Msg     string      `json:"msg"`
 }
 
 // RegisterAgent registers the agent with the server
@@ -36,9 +66,28 @@ func RegisterAgent(serverURL string) (int, error) {
 	if err != nil {
 		return 0, fmt.Errorf("failed to get device info: %w", err)
 	}
+	deviceInfo.Version = config.GetGlobalConfig().GetVersion()
+	deviceInfo.WatchdogVersion = watchdogVersion()
+
+	// 沿用之前注册得到的实例ID，后端据此更新原有实例，LAN地址变化后不会注册成新设备；
+	// 后端只在不认识当前Agent（首次注册或实例已被删除）时使用注册令牌
+	identity := loadIdentity(serverURL)
+	if registeredAgentID != 0 {
+		identity.ID = registeredAgentID
+	}
+	token := config.GetGlobalConfig().GetEnrollmentToken()
+	payload := struct {
+		*device.Device
+		ID              int    `json:"id,omitempty"`
+		ServerURL       string `json:"server_url"` // 注册的后端地址，后端据此显示Agent当前连接的后端
+		AgentSecret     string `json:"agent_secret,omitempty"`
+		EnrollmentToken string `json:"enrollment_token,omitempty"`
+		PendingKey      string `json:"pending_key,omitempty"`
+		Enrollment      int    `json:"enrollment_version"` // 告知后端会保存签发的密钥
+	}{deviceInfo, identity.ID, serverURL, identity.Secret, token, identity.PendingKey, enrollmentVersion}
 
 	// Marshal device info to JSON
-	jsonData, err := json.Marshal(deviceInfo)
+	jsonData, err := json.Marshal(payload)
 	if err != nil {
 		return 0, fmt.Errorf("failed to marshal device info: %w", err)
 	}
@@ -55,7 +104,7 @@ func RegisterAgent(serverURL string) (int, error) {
 
 	// Send request
 	client := &http.Client{
-		Timeout: 30 * time.Second,
+		Timeout: serverTimeout(),
 	}
 
 	resp, err := client.Do(req)
@@ -70,8 +119,27 @@ func RegisterAgent(serverURL string) (int, error) {
 		return 0, fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	if regResp.Code != 0 {
-		return 0, fmt.Errorf("registration failed: %s", regResp.Message)
+	message := regResp.Message
+	if message == "" {
+		message = regResp.Msg
+	}
+	data, _ := regResp.Data.(map[string]interface{})
+
+	switch regResp.Code {
+	case 0:
+	case serverCodeEnrollmentPending:
+		// 保存审批凭据，审批通过后凭它完成注册
+		if key, ok := data["pending_key"].(string); ok && key != "" && key != identity.PendingKey {
+			identity.PendingKey = key
+			identity.ServerURL = serverURL
+			saveIdentity(identity)
+		}
+		log.WithField("request_id", data["request_id"]).Warn("注册申请等待管理员审批")
+		return 0, fmt.Errorf("%w: %s", ErrEnrollmentPending, message)
+	case serverCodeEnrollment:
+		return 0, fmt.Errorf("%w: %s", ErrEnrollmentRequired, message)
+	default:
+		return 0, fmt.Errorf("registration failed: %s", message)
 	}
 
 	// 处理不同的 data 格式
@@ -87,40 +155,24 @@ func RegisterAgent(serverURL string) (int, error) {
 				agentID = int(idFloat)
 			}
 		}
+		// 后端首次注册时签发密钥，之后重新注册时提交
+		if secret, ok := data["agent_secret"].(string); ok && secret != "" {
+			identity.Secret = secret
+		}
 	default:
 		log.WithField("data_type", fmt.Sprintf("%T", data)).Warn("Unknown data format in registration response")
 		agentID = 1 // 使用默认值
 	}
 
-	log.WithField("Agent ID", agentID).Info("成功向服务器注册")
+	log.WithFields(log.Fields{"Agent ID": agentID, "previous": identity.ID}).Info("成功向服务器注册")
 
-	// 保存Agent ID用于心跳
+	// 保存Agent ID用于心跳，并保存到本地供重启后沿用
 	registeredAgentID = agentID
+	saveIdentity(agentIdentity{ID: agentID, ServerURL: serverURL, Secret: identity.Secret})
 
 	return agentID, nil
 }
 
-// StartHeartbeat starts sending periodic heartbeats to the server
-func StartHeartbeat(serverURL string) {
-	if serverURL == "" {
-		log.Warn("Server URL not provided, heartbeat disabled")
-		return
-	}
-
-	log.Info("正在启动心跳服务")
-
-	go func() {
-		ticker := time.NewTicker(30 * time.Second)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			if err := sendHeartbeat(serverURL); err != nil {
-				log.WithError(err).Error("Failed to send heartbeat")
-			}
-		}
-	}()
-}
-
 // sendHeartbeat sends a heartbeat to the server
 func sendHeartbeat(serverURL string) error {
 	// Get current WAN IP
@@ -139,9 +191,35 @@ func sendHeartbeat(serverURL string) error {
 
 	// Create heartbeat data
 	heartbeatData := map[string]interface{}{
-		"wan":       wanIP,
-		"uptime":    uptime,
-		"timestamp": time.Now().Unix(),
+		"wan":              wanIP,
+		"uptime":           uptime,
+		"version":          config.GetGlobalConfig().GetVersion(),
+		"watchdog_version": watchdogVersion(),
+		"server_url":       serverURL,
+		"timestamp":        time.Now().Unix(),
+	}
+
+	// 上报已应用的集中配置版本，后端据此判断配置漂移
+	managedState := config.GetGlobalConfig().GetManagedState()
+	heartbeatData["config"] = map[string]interface{}{
+		"version":    managedState.Version,
+		"error":      managedState.Error,
+		"applied_at": managedState.AppliedAt,
+	}
+
+	// 上报最近一次自动更新的结果，成功后不再重复上报
+	var statePath string
+	var updateState *updater.State
+	if exe, err := updater.Executable(); err == nil {
+		statePath = updater.StatePath(exe)
+		if state, err := updater.LoadState(statePath); err == nil && state != nil && !state.Reported {
+			updateState = state
+			heartbeatData["update"] = map[string]interface{}{
+				"version": state.Version,
+				"status":  state.Status,
+				"error":   state.Error,
+			}
+		}
 	}
 
 	jsonData, err := json.Marshal(heartbeatData)
@@ -163,7 +241,7 @@ func sendHeartbeat(serverURL string) error {
 	req.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{
-		Timeout: 10 * time.Second,
+		Timeout: serverTimeout(),
 	}
 
 	resp, err := client.Do(req)
@@ -172,10 +250,49 @@ func sendHeartbeat(serverURL string) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotRegistered
+	}
 	if resp.StatusCode != http.StatusOK {
 		return fmt.Errorf("心跳失败，状态码: %d", resp.StatusCode)
 	}
 
+	// 心跳响应中包含更新信息时交给更新模块处理；集中配置版本变化时重新获取配置
+	var heartbeatResp struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+		Data *struct {
+			Update        *updater.Release `json:"update"`
+			ConfigVersion *string          `json:"config_version"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&heartbeatResp); err != nil {
+		return fmt.Errorf("failed to decode heartbeat response: %w", err)
+	}
+	if heartbeatResp.Code == serverCodeNotFound {
+		return ErrNotRegistered
+	}
+	if heartbeatResp.Code != 0 {
+		return fmt.Errorf("心跳失败: %s", heartbeatResp.Msg)
+	}
+
+	if updateState != nil && updateState.Status != updater.StatusTrial {
+		updateState.Reported = true
+		if err := updater.SaveState(statePath, updateState); err != nil {
+			log.WithError(err).Warn("保存更新状态失败")
+		}
+	}
+
+	if heartbeatResp.Data != nil {
+		if heartbeatResp.Data.Update != nil && updateHandler != nil {
+			go updateHandler(*heartbeatResp.Data.Update)
+		}
+		if version := heartbeatResp.Data.ConfigVersion; version != nil && *version != managedState.Version {
+			log.WithFields(log.Fields{"version": *version, "applied": managedState.Version}).Info("集中配置已变化，重新获取")
+			syncManagedConfigAsync(serverURL)
+		}
+	}
+
 	log.WithFields(log.Fields{
 		"Agent ID": registeredAgentID,
 		"WAN IP":   wanIP,
@@ -183,10 +300,61 @@ func sendHeartbeat(serverURL string) error {
 	return nil
 }
 
-// UpdateProxyStatus updates the proxy status on the server
-func UpdateProxyStatus() {
-	// TODO: Implement proxy status update logic
-	// This would involve checking current proxy configuration
-	// and reporting it to the server
-	log.Debug("Proxy status update not implemented yet")
+// watchdogVersion 获取运行中的看门狗版本，看门狗未运行时返回空字符串
+func watchdogVersion() string {
+	status, err := watchdog.GetStatus(config.GetGlobalConfig().GetWatchdogConfig().Port)
+	if err != nil || status == nil {
+		return ""
+	}
+	return status.Version
+}
+
+// UpdateProxyStatus reports the active proxy and its latest health check to the server
+func UpdateProxyStatus(status proxy.Status) error {
+	if registeredAgentID == 0 {
+		return fmt.Errorf("agent not registered, cannot report proxy status")
+	}
+
+	report := map[string]interface{}{
+		"enabled": status.Enabled,
+		"url":     status.URL,
+	}
+	if health := status.Health; health != nil {
+		report["ok"] = health.OK
+		report["latency_ms"] = health.Latency
+		report["exit_ip"] = health.ExitIP
+		report["error"] = health.Error
+		report["checked_at"] = health.CheckedAt
+	}
+
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to marshal proxy status: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/api/proxy/%d", config.GetGlobalConfig().GetServerURL(), registeredAgentID)
+	req, err := http.NewRequest("PATCH", url, bytes.NewReader(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create proxy status request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to report proxy status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("上报代理状态失败，状态码: %d", resp.StatusCode)
+	}
+
+	log.WithFields(log.Fields{
+		"enabled": status.Enabled,
+		"url":     status.URL,
+	}).Debug("代理状态上报成功")
+	return nil
 }
@@ -0,0 +1,249 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"winmanager-agent/internal/config"
+	"winmanager-agent/pkg/backoff"
+	"winmanager-agent/pkg/failover"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 后端响应中表示资源不存在的错误码（controllers.ErrNotFound）
+const serverCodeNotFound = 1004
+
+// 未配置时的默认值
+const (
+	defaultHeartbeatInterval = 30 * time.Second
+	defaultServerTimeout     = 30 * time.Second
+	defaultFailbackInterval  = time.Minute
+)
+
+// 心跳连续失败多少次后切换到下一个后端
+const heartbeatFailoverAfter = 2
+
+// 后端健康检查的超时
+const backendCheckTimeout = 5 * time.Second
+
+// ErrNotRegistered 后端找不到当前Agent（实例被删除或数据库重建），需要重新注册
+var ErrNotRegistered = errors.New("agent is not registered on server")
+
+// 按优先级排列的后端，StartSession时创建，通过局域网发现后端时在找到后创建
+var serverPool atomic.Pointer[failover.Pool]
+
+// StartSession registers the agent in the background and keeps sending heartbeats.
+// Registration is retried with exponential backoff until it succeeds, so an agent that
+// boots before the server eventually comes online. With several backends configured,
+// registration and heartbeat errors fail over to the next backend in the list, and the
+// agent fails back once a higher priority backend is healthy again. When a heartbeat
+// reports that the server no longer knows the agent, it registers again.
+// Without configured backends the agent keeps looking for one on the LAN if discovery is enabled.
+// onRegistered is called after every successful registration.
+func StartSession(serverURLs []string, onRegistered func(id int, serverURL string)) {
+	pool := failover.New(serverURLs, checkBackend)
+	if pool.Len() > 0 {
+		serverPool.Store(pool)
+		go runSession(pool, onRegistered)
+		return
+	}
+	if !config.GetGlobalConfig().IsDiscoveryEnabled() {
+		log.Warn("Server URL not provided, registration and heartbeat disabled")
+		return
+	}
+	go func() {
+		pool := failover.New(discoverLoop(), checkBackend)
+		serverPool.Store(pool)
+		runSession(pool, onRegistered)
+	}()
+}
+
+// GetServerStatus returns the health of the configured backends, checking them first if check is set
+func GetServerStatus(ctx context.Context, check bool) []failover.Backend {
+	pool := serverPool.Load()
+	if pool == nil {
+		return []failover.Backend{}
+	}
+	if check {
+		return pool.CheckAll(ctx)
+	}
+	return pool.Status()
+}
+
+// discoverLoop 在局域网中查找后端直到找到，没有后端回复时按指数退避重试
+func discoverLoop() []string {
+	cfg := config.GetGlobalConfig()
+	retry := newRetryBackoff()
+	for {
+		urls, err := cfg.DiscoverServers(context.Background())
+		if err == nil {
+			cfg.SetServerURLs(urls)
+			return urls
+		}
+		wait := retry.Next()
+		log.WithError(err).WithFields(log.Fields{
+			"attempt":  retry.Attempt(),
+			"retry_in": wait.Round(time.Second).String(),
+		}).Warn("局域网中没有找到后端，稍后重试")
+		time.Sleep(wait)
+	}
+}
+
+// runSession 注册后循环发送心跳，失败时切换后端并按指数退避重试
+func runSession(pool *failover.Pool, onRegistered func(id int, serverURL string)) {
+	retry := newRetryBackoff()
+
+	for {
+		serverURL := registerLoop(pool, retry, onRegistered)
+		retry = newRetryBackoff()
+
+		log.WithFields(log.Fields{
+			"server":   serverURL,
+			"interval": heartbeatInterval().String(),
+		}).Info("正在启动心跳服务")
+
+		failures := 0
+		lastFailbackCheck := time.Now()
+		for {
+			// 心跳失败后按退避时间提前重试，但不超过正常的心跳间隔
+			wait := heartbeatInterval()
+			if failures > 0 {
+				if next := retry.Next(); next < wait {
+					wait = next
+				}
+			}
+			time.Sleep(wait)
+
+			// 当前不是优先级最高的后端时，定期检查优先级更高的后端是否已恢复
+			if interval := failbackInterval(); interval > 0 && !pool.Primary() && time.Since(lastFailbackCheck) >= interval {
+				lastFailbackCheck = time.Now()
+				ctx, cancel := context.WithTimeout(context.Background(), backendCheckTimeout)
+				pool.CheckAll(ctx)
+				cancel()
+				if url, switched := pool.Failback(); switched {
+					log.WithFields(log.Fields{"from": serverURL, "to": url}).Info("优先级更高的后端已恢复，切回")
+					break
+				}
+			}
+
+			err := sendHeartbeat(serverURL)
+			if err == nil {
+				if failures > 0 {
+					log.WithField("failures", failures).Info("心跳已恢复")
+				}
+				failures = 0
+				retry.Reset()
+				pool.Succeeded()
+				continue
+			}
+			if errors.Is(err, ErrNotRegistered) {
+				log.WithField("Agent ID", registeredAgentID).Warn("服务器上找不到当前Agent，重新注册")
+				break
+			}
+			failures++
+			log.WithError(err).WithFields(log.Fields{"server": serverURL, "failures": failures}).Error("Failed to send heartbeat")
+
+			if pool.Len() > 1 && failures >= heartbeatFailoverAfter {
+				next, _ := pool.Failover(err)
+				log.WithFields(log.Fields{"from": serverURL, "to": next}).Warn("后端心跳连续失败，切换到下一个后端")
+				break
+			}
+		}
+	}
+}
+
+// registerLoop 向当前后端注册直到成功，失败时切换到下一个后端，所有后端都失败后退避等待，返回注册成功的后端
+func registerLoop(pool *failover.Pool, retry *backoff.Backoff, onRegistered func(id int, serverURL string)) string {
+	for {
+		serverURL := pool.Current()
+		id, err := RegisterAgent(serverURL)
+		if err == nil {
+			pool.Succeeded()
+			config.GetGlobalConfig().SetServerURL(serverURL)
+			if onRegistered != nil {
+				onRegistered(id, serverURL)
+			}
+			return serverURL
+		}
+
+		next, wrapped := pool.Failover(err)
+		if !wrapped {
+			log.WithError(err).WithFields(log.Fields{"server": serverURL, "next": next}).Warn("向服务器注册失败，尝试下一个后端")
+			continue
+		}
+		wait := retry.Next()
+		log.WithError(err).WithFields(log.Fields{
+			"server":   serverURL,
+			"attempt":  retry.Attempt(),
+			"retry_in": wait.Round(time.Second).String(),
+		}).Warn("向服务器注册失败，稍后重试")
+		time.Sleep(wait)
+	}
+}
+
+// checkBackend 检查后端的健康检查接口
+func checkBackend(ctx context.Context, serverURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"/api/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code int `json:"code"`
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("健康检查失败，状态码: %d", resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Code != 0 {
+		return fmt.Errorf("健康检查响应无效")
+	}
+	return nil
+}
+
+// newRetryBackoff 按server配置创建退避，每次重新开始重试时读取，配置修改后生效
+func newRetryBackoff() *backoff.Backoff {
+	cfg := config.GetGlobalConfig().GetServerConfig()
+	return backoff.New(
+		time.Duration(cfg.RetryInterval)*time.Second,
+		time.Duration(cfg.MaxRetryInterval)*time.Second,
+	)
+}
+
+// heartbeatInterval 配置的心跳间隔
+func heartbeatInterval() time.Duration {
+	if seconds := config.GetGlobalConfig().GetServerConfig().HeartbeatInterval; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultHeartbeatInterval
+}
+
+// failbackInterval 配置的切回检查间隔，不切回时返回0
+func failbackInterval() time.Duration {
+	seconds := config.GetGlobalConfig().GetServerConfig().FailbackInterval
+	if seconds < 0 {
+		return 0
+	}
+	if seconds == 0 {
+		return defaultFailbackInterval
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// serverTimeout 配置的请求超时
+func serverTimeout() time.Duration {
+	if seconds := config.GetGlobalConfig().GetServerConfig().Timeout; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultServerTimeout
+}
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -8,6 +10,7 @@ import (
 	"time"
 
 	"winmanager-agent/pkg/device"
+	"winmanager-agent/pkg/discovery"
 
 	"github.com/patrickmn/go-cache"
 	"github.com/robfig/cron"
@@ -25,12 +28,39 @@ type FileConfig struct {
 	Proxy      ProxyConfig      `json:"proxy"`
 	Monitoring MonitoringConfig `json:"monitoring"`
 	System     SystemConfig     `json:"system"`
+	Update     UpdateConfig     `json:"update"`
+	Watchdog   WatchdogConfig   `json:"watchdog"`
 }
 
 type ServerConfig struct {
-	URL           string `json:"url"`
-	Timeout       int    `json:"timeout"`
-	RetryInterval int    `json:"retry_interval"`
+	URL               string          `json:"url"`
+	URLs              []string        `json:"urls"`               // 按优先级排列的多个后端地址，配置后忽略url
+	Timeout           int             `json:"timeout"`            // 请求超时秒数
+	RetryInterval     int             `json:"retry_interval"`     // 注册或心跳失败后首次重试的等待秒数，连续失败时翻倍
+	MaxRetryInterval  int             `json:"max_retry_interval"` // 重试的最长等待秒数
+	HeartbeatInterval int             `json:"heartbeat_interval"` // 心跳间隔秒数
+	FailbackInterval  int             `json:"failback_interval"`  // 检查优先级更高的后端是否恢复的间隔秒数，0使用默认值，负数不切回
+	EnrollmentToken   string          `json:"enrollment_token"`   // 管理员签发的注册令牌，首次注册时提交
+	Discovery         DiscoveryConfig `json:"discovery"`          // 未配置url和urls时在局域网中查找后端
+}
+
+// DiscoveryConfig 局域网发现配置，Agent广播查询，后端回复自己的地址
+type DiscoveryConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Port      int    `json:"port"`      // 后端监听的发现端口
+	Multicast string `json:"multicast"` // 组播地址，与后端配置一致时同时发送组播查询
+	Timeout   int    `json:"timeout"`   // 等待后端回复的秒数
+}
+
+// ServerURLs 按优先级返回后端地址：配置了urls时使用urls，否则使用url
+func (s *ServerConfig) ServerURLs() []string {
+	if len(s.URLs) > 0 {
+		return append([]string(nil), s.URLs...)
+	}
+	if s.URL != "" {
+		return []string{s.URL}
+	}
+	return nil
 }
 
 type AgentConfig struct {
@@ -74,11 +104,14 @@ type InputConfig struct {
 }
 
 type ProxyConfig struct {
-	Enabled    bool   `json:"enabled"`
-	AutoDetect bool   `json:"auto_detect"`
-	URL        string `json:"url"`
-	Username   string `json:"username"`
-	Password   string `json:"password"`
+	Enabled       bool     `json:"enabled"`     // 启动时应用url指定的代理
+	AutoDetect    bool     `json:"auto_detect"` // 检测到的系统代理加入候选列表
+	URL           string   `json:"url"`         // 代理地址，支持http、https、socks5、socks5h
+	Username      string   `json:"username"`
+	Password      string   `json:"password"`
+	Candidates    []string `json:"candidates"`     // 候选代理地址，可包含认证信息
+	CheckURL      string   `json:"check_url"`      // 连通性检查地址，需返回出口IP
+	CheckInterval int      `json:"check_interval"` // 定期检查候选代理的间隔秒数，0使用默认值，负数不检查
 }
 
 type MonitoringConfig struct {
@@ -94,10 +127,37 @@ type SystemConfig struct {
 	CommandsEnabled bool `json:"commands_enabled"` // 是否启用系统命令执行
 }
 
+// UpdateConfig 自动更新配置
+type UpdateConfig struct {
+	Enabled      bool   `json:"enabled"`       // 是否接受心跳中下发的更新（推送更新不受影响）
+	PublicKey    string `json:"public_key"`    // Ed25519公钥(base64)，配置后只安装签名有效的版本
+	TrialTimeout int    `json:"trial_timeout"` // 新版本重新注册的超时秒数，超时回滚
+}
+
+// WatchdogConfig 看门狗配置，看门狗通过 watchdog 子命令启动
+type WatchdogConfig struct {
+	Port           int `json:"port"`            // 控制接口端口，只监听127.0.0.1
+	HealthInterval int `json:"health_interval"` // 健康检查间隔秒数
+	HealthFailures int `json:"health_failures"` // 连续失败多少次视为无响应并重启
+	MaxBackoff     int `json:"max_backoff"`     // 连续重启的最长等待秒数
+}
+
+// BuildVersion 编译时通过 -ldflags "-X winmanager-agent/internal/config.BuildVersion=x.y.z" 写入的版本号
+// 自动更新依赖它区分新旧版本，未设置时使用配置文件中的version
+var BuildVersion string
+
 // Config holds the application configuration
 type Config struct {
 	fileConfig    *FileConfig
-	serverURL     string
+	localConfig   *FileConfig                // 配置文件中的配置，集中配置在它的基础上覆盖
+	managed       map[string]json.RawMessage // 后端下发的集中配置
+	managedState  ManagedState
+	configPath    string           // 配置文件路径，接口修改配置时写回该文件
+	fileHash      [32]byte         // 最近一次读取或写入的配置文件内容摘要
+	listeners     []ChangeListener // 配置变化的回调
+	serverURL     string           // 当前连接的后端地址
+	serverURLs    []string         // 按优先级排列的后端地址
+	enrollToken   string           // 命令行指定的注册令牌，优先于配置文件
 	autoMonitor   bool
 	localIP       string
 	mutex         sync.RWMutex
@@ -118,10 +178,13 @@ func (c *Config) LoadConfigFile(configPath string) error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
+	c.configPath = configPath
+
 	// Check if config file exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		log.WithField("config_path", configPath).Info("Config file not found, using defaults")
 		c.fileConfig = getDefaultConfig()
+		c.applyManagedLocked()
 		return nil
 	}
 
@@ -131,13 +194,17 @@ func (c *Config) LoadConfigFile(configPath string) error {
 		return fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	// Parse JSON
-	var fileConfig FileConfig
-	if err := json.Unmarshal(data, &fileConfig); err != nil {
-		return fmt.Errorf("failed to parse config file: %w", err)
+	fileConfig, err := parseConfigFile(data)
+	if err != nil {
+		return err
+	}
+	if err := fileConfig.Validate(); err != nil {
+		log.WithError(err).Warn("配置文件中有不合法的配置项")
 	}
 
-	c.fileConfig = &fileConfig
+	c.fileConfig = fileConfig
+	c.fileHash = sha256.Sum256(data)
+	c.applyManagedLocked()
 
 	log.WithFields(log.Fields{
 		"config_path":          configPath,
@@ -149,14 +216,44 @@ func (c *Config) LoadConfigFile(configPath string) error {
 	return nil
 }
 
+// parseConfigFile 解析配置文件内容，旧版本缺少的配置段使用默认值
+func parseConfigFile(data []byte) (*FileConfig, error) {
+	var fileConfig FileConfig
+	if err := json.Unmarshal(data, &fileConfig); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	fillLegacyDefaults(&fileConfig)
+	return &fileConfig, nil
+}
+
+// fillLegacyDefaults 旧版本的配置文件没有update、watchdog、server.discovery段，使用默认值
+func fillLegacyDefaults(fileConfig *FileConfig) {
+	if fileConfig.Update == (UpdateConfig{}) {
+		fileConfig.Update = getDefaultConfig().Update
+	}
+	if fileConfig.Watchdog == (WatchdogConfig{}) {
+		fileConfig.Watchdog = getDefaultConfig().Watchdog
+	}
+	if fileConfig.Server.Discovery == (DiscoveryConfig{}) {
+		fileConfig.Server.Discovery = getDefaultConfig().Server.Discovery
+	}
+}
+
 // getDefaultConfig returns default configuration
 func getDefaultConfig() *FileConfig {
 	return &FileConfig{
 		Version: "1.0.0",
 		Server: ServerConfig{
-			URL:           "http://172.17.1.242:9090",
-			Timeout:       30,
-			RetryInterval: 5,
+			Timeout:           30,
+			RetryInterval:     5,
+			MaxRetryInterval:  300,
+			HeartbeatInterval: 30,
+			FailbackInterval:  60,
+			Discovery: DiscoveryConfig{
+				Enabled: true,
+				Port:    discovery.DefaultPort,
+				Timeout: 3,
+			},
 		},
 		Agent: AgentConfig{
 			HTTPPort: 50052,
@@ -198,6 +295,7 @@ func getDefaultConfig() *FileConfig {
 			URL:        "",
 			Username:   "",
 			Password:   "",
+			CheckURL:   "https://www.icanhazip.com",
 		},
 		Monitoring: MonitoringConfig{
 			MetricsEnabled:     true,
@@ -210,6 +308,17 @@ func getDefaultConfig() *FileConfig {
 			ShutdownEnabled: true,
 			CommandsEnabled: true,
 		},
+		Update: UpdateConfig{
+			Enabled:      true,
+			PublicKey:    "",
+			TrialTimeout: 120,
+		},
+		Watchdog: WatchdogConfig{
+			Port:           50053,
+			HealthInterval: 10,
+			HealthFailures: 3,
+			MaxBackoff:     60,
+		},
 	}
 }
 
@@ -233,15 +342,19 @@ func (c *Config) Initialize(serverURL string) error {
 
 	// Set server URL (command line overrides config file)
 	if serverURL != "" {
-		c.serverURL = serverURL
-	} else if c.fileConfig.Server.URL != "" {
-		c.serverURL = c.fileConfig.Server.URL
-	} else {
-		// Try to get server config from remote or use default
-		c.serverURL = c.getServerConfig(localIP)
+		c.serverURLs = []string{serverURL}
+	} else if urls := c.fileConfig.Server.ServerURLs(); len(urls) > 0 {
+		c.serverURLs = urls
+	} else if discovered := c.getServerConfig(localIP); len(discovered) > 0 {
+		// 未配置后端地址时使用局域网中发现的后端
+		c.serverURLs = discovered
+	}
+	if len(c.serverURLs) > 0 {
+		c.serverURL = c.serverURLs[0]
 	}
 
-	if c.serverURL == "" {
+	// 启用发现时注册前继续在局域网中查找后端
+	if c.serverURL == "" && !c.fileConfig.Server.Discovery.Enabled {
 		return fmt.Errorf("server URL not configured")
 	}
 
@@ -251,6 +364,7 @@ func (c *Config) Initialize(serverURL string) error {
 	log.WithFields(log.Fields{
 		"本地IP":  localIP,
 		"服务器地址": c.serverURL,
+		"后端列表":  c.serverURLs,
 		"版本":    c.fileConfig.Version,
 	}).Info("配置初始化完成")
 
@@ -264,13 +378,61 @@ func (c *Config) GetServerURL() string {
 	return c.serverURL
 }
 
-// SetServerURL updates the server URL
+// GetServerURLs returns the configured backend URLs in priority order
+func (c *Config) GetServerURLs() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return append([]string(nil), c.serverURLs...)
+}
+
+// SetServerURL updates the server URL the agent is currently attached to
 func (c *Config) SetServerURL(url string) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	c.serverURL = url
 }
 
+// SetServerURLs sets the backend URLs found by discovery
+func (c *Config) SetServerURLs(urls []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.serverURLs = append([]string(nil), urls...)
+	if c.serverURL == "" && len(urls) > 0 {
+		c.serverURL = urls[0]
+	}
+}
+
+// SetEnrollmentToken sets the enrollment token given on the command line, overriding the config file
+func (c *Config) SetEnrollmentToken(token string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.enrollToken = token
+}
+
+// GetEnrollmentToken returns the enrollment token presented on first registration
+func (c *Config) GetEnrollmentToken() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.enrollToken != "" {
+		return c.enrollToken
+	}
+	if c.fileConfig != nil {
+		return c.fileConfig.Server.EnrollmentToken
+	}
+	return ""
+}
+
+// GetServerConfig returns the server connection configuration
+func (c *Config) GetServerConfig() *ServerConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.fileConfig != nil {
+		return &c.fileConfig.Server
+	}
+	defaultConfig := getDefaultConfig()
+	return &defaultConfig.Server
+}
+
 // GetLocalIP returns the local IP address
 func (c *Config) GetLocalIP() string {
 	c.mutex.RLock()
@@ -302,8 +464,11 @@ func (c *Config) GetCronScheduler() *cron.Cron {
 	return c.cronScheduler
 }
 
-// GetVersion returns the version from config
+// GetVersion returns the build version, or the version from config if not set
 func (c *Config) GetVersion() string {
+	if BuildVersion != "" {
+		return BuildVersion
+	}
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 	if c.fileConfig != nil {
@@ -458,6 +623,32 @@ func (c *Config) GetDebugSavePath() string {
 	return debugConfig.SavePath
 }
 
+// GetInputConfig returns the input configuration
+func (c *Config) GetInputConfig() *InputConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.fileConfig != nil {
+		return &c.fileConfig.Input
+	}
+	defaultConfig := getDefaultConfig()
+	return &defaultConfig.Input
+}
+
+// IsMouseEnabled returns whether remote mouse input is allowed
+func (c *Config) IsMouseEnabled() bool {
+	return c.GetInputConfig().MouseEnabled
+}
+
+// IsKeyboardEnabled returns whether remote keyboard input is allowed
+func (c *Config) IsKeyboardEnabled() bool {
+	return c.GetInputConfig().KeyboardEnabled
+}
+
+// IsPasteEnabled returns whether remote clipboard paste is allowed
+func (c *Config) IsPasteEnabled() bool {
+	return c.GetInputConfig().PasteEnabled
+}
+
 // GetSystemConfig returns the system configuration
 func (c *Config) GetSystemConfig() *SystemConfig {
 	c.mutex.RLock()
@@ -494,6 +685,39 @@ func (c *Config) IsCommandsEnabled() bool {
 	return systemConfig.CommandsEnabled
 }
 
+// GetUpdateConfig returns the auto update configuration
+func (c *Config) GetUpdateConfig() *UpdateConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.fileConfig != nil {
+		return &c.fileConfig.Update
+	}
+	defaultConfig := getDefaultConfig()
+	return &defaultConfig.Update
+}
+
+// GetProxyConfig returns the proxy configuration
+func (c *Config) GetProxyConfig() *ProxyConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.fileConfig != nil {
+		return &c.fileConfig.Proxy
+	}
+	defaultConfig := getDefaultConfig()
+	return &defaultConfig.Proxy
+}
+
+// GetWatchdogConfig returns the watchdog configuration
+func (c *Config) GetWatchdogConfig() *WatchdogConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.fileConfig != nil {
+		return &c.fileConfig.Watchdog
+	}
+	defaultConfig := getDefaultConfig()
+	return &defaultConfig.Watchdog
+}
+
 // Shutdown gracefully shuts down the configuration
 func (c *Config) Shutdown() {
 	c.mutex.Lock()
@@ -506,24 +730,20 @@ func (c *Config) Shutdown() {
 	log.Info("Configuration shutdown completed")
 }
 
-// getServerConfig attempts to determine the server configuration
-// This is a placeholder for the original logic that might involve
-// remote configuration discovery
-func (c *Config) getServerConfig(localIP string) string {
-	// TODO: Implement server discovery logic based on local IP
-	// For now, return a default or empty string
-
-	// This could involve:
-	// - Checking local configuration files
-	// - DNS-based service discovery
-	// - Multicast discovery
-	// - Default server addresses based on network segments
-
-	log.WithField("local_ip", localIP).Debug("Attempting to discover server configuration")
+// getServerConfig 未配置后端地址时在局域网中查找后端，未启用发现或没有找到时返回空
+func (c *Config) getServerConfig(localIP string) []string {
+	discoveryConfig := c.fileConfig.Server.Discovery
+	if !discoveryConfig.Enabled {
+		return nil
+	}
 
-	// Return empty string to indicate no server found
-	// The caller should handle this case appropriately
-	return ""
+	log.WithField("local_ip", localIP).Info("未配置服务器地址，在局域网中查找后端")
+	urls, err := discoverServers(context.Background(), discoveryConfig)
+	if err != nil {
+		log.WithError(err).Warn("局域网中没有找到后端，注册前继续查找")
+		return nil
+	}
+	return urls
 }
 
 // Global configuration instance (for backward compatibility)
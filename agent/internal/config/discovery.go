@@ -0,0 +1,57 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"winmanager-agent/pkg/discovery"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// IsDiscoveryEnabled returns whether the agent looks for a backend on the LAN when no server URL is configured
+func (c *Config) IsDiscoveryEnabled() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.fileConfig != nil && c.fileConfig.Server.Discovery.Enabled
+}
+
+// DiscoverServers 在局域网中查找后端，返回按回复顺序排列的后端地址
+func (c *Config) DiscoverServers(ctx context.Context) ([]string, error) {
+	c.mutex.RLock()
+	discoveryConfig := getDefaultConfig().Server.Discovery
+	if c.fileConfig != nil {
+		discoveryConfig = c.fileConfig.Server.Discovery
+	}
+	c.mutex.RUnlock()
+	return discoverServers(ctx, discoveryConfig)
+}
+
+// discoverServers 按配置广播查询，记录后端给出的注册提示
+func discoverServers(ctx context.Context, cfg DiscoveryConfig) ([]string, error) {
+	hostname, _ := os.Hostname()
+	servers, err := discovery.Discover(ctx, discovery.Options{
+		Port:      cfg.Port,
+		Multicast: cfg.Multicast,
+		Timeout:   time.Duration(cfg.Timeout) * time.Second,
+		Hostname:  hostname,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]string, 0, len(servers))
+	for _, server := range servers {
+		fields := log.Fields{"url": server.URL, "from": server.From}
+		if server.Name != "" {
+			fields["name"] = server.Name
+		}
+		if server.EnrollmentHint != "" {
+			fields["enrollment_hint"] = server.EnrollmentHint
+		}
+		log.WithFields(fields).Info("在局域网中发现后端")
+		urls = append(urls, server.URL)
+	}
+	return urls, nil
+}
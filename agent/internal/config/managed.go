@@ -0,0 +1,151 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ManagedSections 可由后端集中管理的配置段，与后端models.ManagedConfigSections一致
+var ManagedSections = []string{"screen", "encoder", "input", "monitoring", "system"}
+
+// ManagedState 集中配置的应用情况，在心跳中上报
+type ManagedState struct {
+	Version   string     `json:"version"`    // 已应用的配置版本，未应用集中配置时为空
+	Error     string     `json:"error"`      // 最近一次应用失败的原因
+	AppliedAt *time.Time `json:"applied_at"` // 应用时间
+	Sections  []string   `json:"sections"`   // 被集中配置覆盖的配置段
+}
+
+// isManagedSection 判断配置段是否可集中管理
+func isManagedSection(section string) bool {
+	for _, name := range ManagedSections {
+		if name == section {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeMaps 将overlay逐层合并到base上
+func mergeMaps(base, overlay map[string]interface{}) map[string]interface{} {
+	if base == nil {
+		base = make(map[string]interface{}, len(overlay))
+	}
+	for key, value := range overlay {
+		if overlayMap, ok := value.(map[string]interface{}); ok {
+			if baseMap, ok := base[key].(map[string]interface{}); ok {
+				base[key] = mergeMaps(baseMap, overlayMap)
+				continue
+			}
+		}
+		base[key] = value
+	}
+	return base
+}
+
+// mergeManaged 在本地配置的基础上覆盖集中配置，返回新的配置，不修改local；
+// 合并结果严格解析并校验，包含未知字段、类型不符或取值不合法时返回错误
+func mergeManaged(local *FileConfig, managed map[string]json.RawMessage) (*FileConfig, error) {
+	data, err := json.Marshal(local)
+	if err != nil {
+		return nil, err
+	}
+	var base map[string]interface{}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+
+	for section, raw := range managed {
+		if !isManagedSection(section) {
+			return nil, fmt.Errorf("不支持集中管理的配置段: %s", section)
+		}
+		var overlay map[string]interface{}
+		if err := json.Unmarshal(raw, &overlay); err != nil {
+			return nil, fmt.Errorf("配置段%s格式错误: %w", section, err)
+		}
+		baseSection, _ := base[section].(map[string]interface{})
+		base[section] = mergeMaps(baseSection, overlay)
+	}
+
+	if data, err = json.Marshal(base); err != nil {
+		return nil, err
+	}
+	merged, err := DecodeFileConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("集中配置格式错误: %w", err)
+	}
+	if err := merged.Validate(); err != nil {
+		return nil, fmt.Errorf("应用集中配置后的配置不合法: %w", err)
+	}
+	return merged, nil
+}
+
+// applyManagedLocked 重新加载配置文件后调用：记录本地配置，并在其基础上重新覆盖已下发的集中配置
+func (c *Config) applyManagedLocked() {
+	c.localConfig = c.fileConfig
+	if len(c.managed) == 0 {
+		return
+	}
+	merged, err := mergeManaged(c.localConfig, c.managed)
+	if err != nil {
+		log.WithError(err).Error("重新应用集中配置失败，使用本地配置")
+		c.managedState.Error = err.Error()
+		return
+	}
+	c.fileConfig = merged
+}
+
+// ApplyManagedConfig 应用后端下发的集中配置：在配置文件的基础上覆盖各配置段，
+// 下发的配置为空时恢复使用配置文件；应用失败时保持当前配置并记录错误。
+// 生效配置有变化时通知OnChange注册的回调
+func (c *Config) ApplyManagedConfig(version string, managed map[string]json.RawMessage) error {
+	c.mutex.Lock()
+
+	local := c.localConfig
+	if local == nil {
+		local = c.fileConfig
+	}
+	if local == nil {
+		local = getDefaultConfig()
+	}
+
+	merged, err := mergeManaged(local, managed)
+	if err != nil {
+		c.managedState.Error = err.Error()
+		c.mutex.Unlock()
+		return err
+	}
+
+	sections := make([]string, 0, len(managed))
+	for section := range managed {
+		sections = append(sections, section)
+	}
+	sort.Strings(sections)
+
+	now := time.Now()
+	changes := diffConfig(c.fileConfig, merged)
+	c.localConfig = local
+	c.fileConfig = merged
+	c.managed = managed
+	c.managedState = ManagedState{
+		Version:   version,
+		AppliedAt: &now,
+		Sections:  sections,
+	}
+	listeners := c.listeners
+	c.mutex.Unlock()
+
+	notifyListeners(listeners, changes)
+	return nil
+}
+
+// GetManagedState returns the state of the centrally managed configuration
+func (c *Config) GetManagedState() ManagedState {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.managedState
+}
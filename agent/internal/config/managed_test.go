@@ -0,0 +1,178 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// managedSections 构造后端下发的集中配置
+func managedSections(t *testing.T, raw string) map[string]json.RawMessage {
+	t.Helper()
+	var managed map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &managed); err != nil {
+		t.Fatal(err)
+	}
+	return managed
+}
+
+// newTestConfig 使用默认配置创建配置实例
+func newTestConfig() *Config {
+	c := NewConfig()
+	c.fileConfig = getDefaultConfig()
+	return c
+}
+
+func TestMergeManaged(t *testing.T) {
+	local := getDefaultConfig()
+	local.Encoder.JPEGQuality = 60
+
+	merged, err := mergeManaged(local, managedSections(t, `{"encoder": {"frame_rate": 30}, "input": {"paste_enabled": false}}`))
+	if err != nil {
+		t.Fatalf("mergeManaged: %v", err)
+	}
+	if merged.Encoder.FrameRate != 30 || merged.Input.PasteEnabled {
+		t.Fatalf("managed values not applied: %+v %+v", merged.Encoder, merged.Input)
+	}
+	// 未下发的字段保留本地配置
+	if merged.Encoder.JPEGQuality != 60 || merged.Encoder.DefaultCodec != local.Encoder.DefaultCodec {
+		t.Fatalf("local values lost: %+v", merged.Encoder)
+	}
+	if local.Encoder.FrameRate == 30 {
+		t.Fatal("mergeManaged modified local config")
+	}
+
+	if _, err := mergeManaged(local, managedSections(t, `{"agent": {"http_port": 1}}`)); err == nil {
+		t.Fatal("unmanaged section accepted")
+	}
+}
+
+func TestApplyManagedConfigRejectsInvalid(t *testing.T) {
+	invalid := map[string]string{
+		"unknown field":  `{"encoder": {"framerate": 30}}`,
+		"wrong type":     `{"encoder": {"frame_rate": "30"}}`,
+		"not an object":  `{"encoder": 30}`,
+		"frame rate":     `{"encoder": {"frame_rate": 500}}`,
+		"codec":          `{"encoder": {"default_codec": "h265"}}`,
+		"capture method": `{"screen": {"capture_method": "gdi"}}`,
+	}
+	for name, raw := range invalid {
+		c := newTestConfig()
+		var notified bool
+		c.OnChange(func([]Change) { notified = true })
+		if err := c.ApplyManagedConfig("v1", managedSections(t, raw)); err == nil {
+			t.Errorf("%s: invalid managed config accepted", name)
+			continue
+		}
+
+		// 保持当前配置，并在状态中记录错误
+		if got := c.GetFileConfig(); got.Encoder.FrameRate != 20 || got.Encoder.DefaultCodec != "h264" || got.Screen.CaptureMethod != "robotgo" {
+			t.Errorf("%s: running config changed: %+v", name, got.Encoder)
+		}
+		state := c.GetManagedState()
+		if state.Error == "" || state.Version != "" {
+			t.Errorf("%s: unexpected state %+v", name, state)
+		}
+		if notified {
+			t.Errorf("%s: listeners notified for rejected config", name)
+		}
+	}
+}
+
+func TestApplyManagedConfig(t *testing.T) {
+	c := newTestConfig()
+	var changes []Change
+	c.OnChange(func(got []Change) { changes = got })
+
+	if err := c.ApplyManagedConfig("v1", managedSections(t, `{"encoder": {"frame_rate": 30}}`)); err != nil {
+		t.Fatalf("ApplyManagedConfig: %v", err)
+	}
+	if c.GetFileConfig().Encoder.FrameRate != 30 {
+		t.Fatal("managed config not applied")
+	}
+	if state := c.GetManagedState(); state.Version != "v1" || state.Error != "" || len(state.Sections) != 1 {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	if len(changes) != 1 || changes[0].Field != "encoder.frame_rate" {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+
+	// 失败后保留上次成功应用的集中配置
+	if err := c.ApplyManagedConfig("v2", managedSections(t, `{"encoder": {"frame_rate": 0}}`)); err == nil {
+		t.Fatal("invalid managed config accepted")
+	}
+	if c.GetFileConfig().Encoder.FrameRate != 30 || c.GetManagedState().Version != "v1" {
+		t.Fatal("previous managed config not kept")
+	}
+
+	// 下发空配置时恢复本地配置
+	if err := c.ApplyManagedConfig("", nil); err != nil {
+		t.Fatalf("ApplyManagedConfig: %v", err)
+	}
+	if c.GetFileConfig().Encoder.FrameRate != 20 {
+		t.Fatal("local config not restored")
+	}
+}
+
+func TestReloadConfigFileStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	c := newTestConfig()
+	c.configPath = path
+
+	data, _ := json.Marshal(getDefaultConfig())
+	typo := strings.Replace(string(data), `"paste_enabled"`, `"pasteenabled"`, 1)
+	if err := os.WriteFile(path, []byte(typo), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ReloadConfigFile(); err == nil {
+		t.Fatal("config file with unknown field accepted")
+	}
+
+	local := getDefaultConfig()
+	local.Encoder.FrameRate = 25
+	data, _ = json.Marshal(local)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := c.ReloadConfigFile()
+	if err != nil {
+		t.Fatalf("ReloadConfigFile: %v", err)
+	}
+	if len(changes) != 1 || c.GetFileConfig().Encoder.FrameRate != 25 {
+		t.Fatalf("unexpected reload result %+v", changes)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	previous := getDefaultConfig()
+	current := copyFileConfig(previous)
+	current.Encoder.FrameRate = 30
+	current.Encoder.CustomSettings = map[string]string{"crf": "23"}
+	current.Screen.CaptureMethod = "dxgi"
+	current.Proxy.Password = "secret"
+
+	changes := diffConfig(previous, current)
+	fields := ChangedFields(changes)
+	want := []string{"encoder.custom_settings", "encoder.frame_rate", "proxy.password", "screen.capture_method"}
+	if strings.Join(fields, ",") != strings.Join(want, ",") {
+		t.Fatalf("changed fields = %v, want %v", fields, want)
+	}
+
+	restart := RestartRequiredFields(changes)
+	if strings.Join(restart, ",") != "proxy.password,screen.capture_method" {
+		t.Fatalf("restart required = %v", restart)
+	}
+	for _, change := range changes {
+		if change.Field == "proxy.password" && (change.Old != RedactedSecret || change.New != RedactedSecret) {
+			t.Fatalf("password not redacted: %+v", change)
+		}
+	}
+	if !HasChange(changes, "encoder") || HasChange(changes, "input") {
+		t.Fatal("HasChange mismatch")
+	}
+	if len(diffConfig(previous, copyFileConfig(previous))) != 0 {
+		t.Fatal("identical configs reported changes")
+	}
+}
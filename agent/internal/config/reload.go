@@ -0,0 +1,373 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// RedactedSecret 接口返回配置时替换密码和注册令牌，提交的值为它时保留原值
+const RedactedSecret = "******"
+
+// 修改后需要重启Agent才能生效的配置项，以"."结尾的表示整个配置段
+var restartFields = []string{
+	"server.url",
+	"server.urls",
+	"agent.http_port",
+	"agent.grpc_port",
+	"agent.debug",
+	"screen.capture_method",
+	"proxy.",
+	"monitoring.",
+	"watchdog.",
+}
+
+// Change 一项配置的变化
+type Change struct {
+	Field           string      `json:"field"`
+	Old             interface{} `json:"old"`
+	New             interface{} `json:"new"`
+	RestartRequired bool        `json:"restart_required"`
+}
+
+// ChangeListener 配置生效后的回调，changes按字段名排序
+type ChangeListener func(changes []Change)
+
+// OnChange 注册配置变化的回调，通过接口修改或配置文件重新加载后调用
+func (c *Config) OnChange(listener ChangeListener) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+// GetConfigPath returns the path of the loaded configuration file
+func (c *Config) GetConfigPath() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.configPath
+}
+
+// GetLocalConfig returns a copy of the configuration file content, without centrally managed overrides
+func (c *Config) GetLocalConfig() *FileConfig {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	local := c.localConfig
+	if local == nil {
+		local = getDefaultConfig()
+	}
+	return copyFileConfig(local)
+}
+
+// GetLogLevel returns the configured log level
+func (c *Config) GetLogLevel() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if c.fileConfig != nil && c.fileConfig.Agent.LogLevel != "" {
+		return c.fileConfig.Agent.LogLevel
+	}
+	return "info"
+}
+
+// UpdateLocalConfig 校验并保存新的配置文件内容，随后立即生效，返回生效配置的变化
+func (c *Config) UpdateLocalConfig(update *FileConfig) ([]Change, error) {
+	c.mutex.Lock()
+	if update.Proxy.Password == RedactedSecret && c.localConfig != nil {
+		update.Proxy.Password = c.localConfig.Proxy.Password
+	}
+	if update.Server.EnrollmentToken == RedactedSecret && c.localConfig != nil {
+		update.Server.EnrollmentToken = c.localConfig.Server.EnrollmentToken
+	}
+	c.mutex.Unlock()
+	if err := update.Validate(); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	if err := c.saveLocked(update); err != nil {
+		c.mutex.Unlock()
+		return nil, err
+	}
+	changes := c.replaceLocalLocked(update)
+	listeners := c.listeners
+	c.mutex.Unlock()
+
+	notifyListeners(listeners, changes)
+	return changes, nil
+}
+
+// PatchLocalConfig 将JSON片段逐层合并到配置文件内容上，校验并保存后生效
+func (c *Config) PatchLocalConfig(patch []byte) ([]Change, error) {
+	var overlay map[string]interface{}
+	if err := json.Unmarshal(patch, &overlay); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+
+	data, err := json.Marshal(c.GetLocalConfig())
+	if err != nil {
+		return nil, err
+	}
+	var base map[string]interface{}
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+	if data, err = json.Marshal(mergeMaps(base, overlay)); err != nil {
+		return nil, err
+	}
+
+	update, err := DecodeFileConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	return c.UpdateLocalConfig(update)
+}
+
+// ReloadConfigFile 重新读取配置文件，内容没有变化时不做处理，校验失败时保持当前配置
+func (c *Config) ReloadConfigFile() ([]Change, error) {
+	c.mutex.RLock()
+	configPath := c.configPath
+	lastHash := c.fileHash
+	c.mutex.RUnlock()
+
+	if configPath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	hash := sha256.Sum256(data)
+	if hash == lastHash {
+		return nil, nil
+	}
+
+	// 运行中重新加载时严格解析，拼错的字段或类型不符的值不会被静默忽略
+	fileConfig, err := DecodeFileConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	fillLegacyDefaults(fileConfig)
+	if err := fileConfig.Validate(); err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	c.fileHash = hash
+	changes := c.replaceLocalLocked(fileConfig)
+	listeners := c.listeners
+	c.mutex.Unlock()
+
+	notifyListeners(listeners, changes)
+	return changes, nil
+}
+
+// WatchConfigFile 定期检查配置文件，内容变化时重新加载
+func (c *Config) WatchConfigFile(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			changes, err := c.ReloadConfigFile()
+			if err != nil {
+				log.WithError(err).Warn("配置文件已修改，但重新加载失败，继续使用当前配置")
+				continue
+			}
+			if len(changes) > 0 {
+				log.WithFields(log.Fields{
+					"changes":          ChangedFields(changes),
+					"restart_required": RestartRequiredFields(changes),
+				}).Info("配置文件已重新加载")
+			}
+		}
+	}()
+}
+
+// ChangedFields 返回变化的字段名
+func ChangedFields(changes []Change) []string {
+	fields := make([]string, 0, len(changes))
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	return fields
+}
+
+// RestartRequiredFields 返回需要重启才能生效的字段名
+func RestartRequiredFields(changes []Change) []string {
+	fields := make([]string, 0)
+	for _, change := range changes {
+		if change.RestartRequired {
+			fields = append(fields, change.Field)
+		}
+	}
+	return fields
+}
+
+// HasChange 判断changes中是否有以prefix开头的字段
+func HasChange(changes []Change, prefix string) bool {
+	for _, change := range changes {
+		if change.Field == prefix || strings.HasPrefix(change.Field, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted 返回隐藏了密码的配置副本
+func (f *FileConfig) Redacted() *FileConfig {
+	redacted := copyFileConfig(f)
+	if redacted.Proxy.Password != "" {
+		redacted.Proxy.Password = RedactedSecret
+	}
+	if redacted.Server.EnrollmentToken != "" {
+		redacted.Server.EnrollmentToken = RedactedSecret
+	}
+	return redacted
+}
+
+// replaceLocalLocked 替换配置文件内容并重新覆盖集中配置，返回生效配置的变化
+func (c *Config) replaceLocalLocked(local *FileConfig) []Change {
+	previous := c.fileConfig
+	c.fileConfig = local
+	c.applyManagedLocked()
+	return diffConfig(previous, c.fileConfig)
+}
+
+// saveLocked 将配置写入配置文件：先写临时文件再替换，避免写到一半时被读取
+func (c *Config) saveLocked(fileConfig *FileConfig) error {
+	if c.configPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(fileConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.configPath), ".config-*.json")
+	if err != nil {
+		return fmt.Errorf("保存配置文件失败: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("保存配置文件失败: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("保存配置文件失败: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.configPath); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("保存配置文件失败: %w", err)
+	}
+
+	// 记录写入的内容，文件监听不会把自己的修改当作外部修改再加载一次
+	c.fileHash = sha256.Sum256(data)
+	return nil
+}
+
+// notifyListeners 在锁外调用回调，回调中可以读取配置
+func notifyListeners(listeners []ChangeListener, changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	for _, listener := range listeners {
+		listener(changes)
+	}
+}
+
+// diffConfig 按字段比较两份配置，数组和map整体比较
+func diffConfig(previous, current *FileConfig) []Change {
+	before := flattenConfig(previous)
+	after := flattenConfig(current)
+
+	fields := make(map[string]struct{}, len(after))
+	for field := range before {
+		fields[field] = struct{}{}
+	}
+	for field := range after {
+		fields[field] = struct{}{}
+	}
+
+	changes := make([]Change, 0)
+	for field := range fields {
+		if reflect.DeepEqual(before[field], after[field]) {
+			continue
+		}
+		change := Change{
+			Field:           field,
+			Old:             before[field],
+			New:             after[field],
+			RestartRequired: isRestartRequired(field),
+		}
+		if field == "proxy.password" || field == "server.enrollment_token" {
+			change.Old, change.New = RedactedSecret, RedactedSecret
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// flattenConfig 将配置展开为"段.字段"形式的键值
+func flattenConfig(fileConfig *FileConfig) map[string]interface{} {
+	result := make(map[string]interface{})
+	if fileConfig == nil {
+		return result
+	}
+	data, err := json.Marshal(fileConfig)
+	if err != nil {
+		return result
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return result
+	}
+	flattenInto(result, "", values)
+	return result
+}
+
+// flattenInto 递归展开嵌套的对象，custom_settings等map类型的字段整体比较
+func flattenInto(result map[string]interface{}, prefix string, values map[string]interface{}) {
+	for key, value := range values {
+		field := key
+		if prefix != "" {
+			field = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok && field != "encoder.custom_settings" {
+			flattenInto(result, field, nested)
+			continue
+		}
+		result[field] = value
+	}
+}
+
+// isRestartRequired 判断配置项修改后是否需要重启
+func isRestartRequired(field string) bool {
+	for _, name := range restartFields {
+		if field == name || (strings.HasSuffix(name, ".") && strings.HasPrefix(field, name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// copyFileConfig 深拷贝配置，调用者可以随意修改返回值
+func copyFileConfig(fileConfig *FileConfig) *FileConfig {
+	data, err := json.Marshal(fileConfig)
+	if err != nil {
+		return getDefaultConfig()
+	}
+	var result FileConfig
+	if err := json.Unmarshal(data, &result); err != nil {
+		return getDefaultConfig()
+	}
+	return &result
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"winmanager-agent/pkg/proxy"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 配置取值范围，与Agent各模块支持的取值一致
+var (
+	SupportedCodecs         = []string{"h264", "jpeg", "jpeg-turbo", "vp8"}
+	SupportedCaptureMethods = []string{"auto", "dxgi", "wgc", "robotgo"}
+)
+
+// ErrInvalidConfig 配置格式或取值不合法
+var ErrInvalidConfig = errors.New("配置不合法")
+
+const (
+	MaxFrameRate = 120
+	maxPort      = 65535
+)
+
+// DecodeFileConfig 严格解析配置：拒绝未知字段和类型不符的值
+func DecodeFileConfig(data []byte) (*FileConfig, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	var fileConfig FileConfig
+	if err := decoder.Decode(&fileConfig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	return &fileConfig, nil
+}
+
+// Validate 检查配置取值，返回所有不合法的字段
+func (f *FileConfig) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	if f.Server.URL != "" {
+		check(isHTTPURL(f.Server.URL), "server.url 必须是http或https地址")
+	}
+	for _, raw := range f.Server.URLs {
+		check(isHTTPURL(raw), "server.urls 包含无效地址: %s", raw)
+	}
+	check(f.Server.Timeout >= 0, "server.timeout 不能为负数")
+	check(f.Server.RetryInterval >= 0, "server.retry_interval 不能为负数")
+	check(f.Server.MaxRetryInterval >= 0, "server.max_retry_interval 不能为负数")
+	check(f.Server.HeartbeatInterval >= 0, "server.heartbeat_interval 不能为负数")
+	check(f.Server.Discovery.Port >= 0 && f.Server.Discovery.Port <= maxPort, "server.discovery.port 必须在0到%d之间", maxPort)
+	check(f.Server.Discovery.Timeout >= 0, "server.discovery.timeout 不能为负数")
+	if f.Server.Discovery.Multicast != "" {
+		ip := net.ParseIP(f.Server.Discovery.Multicast)
+		check(ip != nil && ip.To4() != nil && ip.IsMulticast(), "server.discovery.multicast 必须是IPv4组播地址")
+	}
+
+	check(f.Agent.HTTPPort >= 1 && f.Agent.HTTPPort <= maxPort, "agent.http_port 必须在1到%d之间", maxPort)
+	check(f.Agent.GRPCPort >= 1 && f.Agent.GRPCPort <= maxPort, "agent.grpc_port 必须在1到%d之间", maxPort)
+	check(f.Agent.HTTPPort != f.Agent.GRPCPort, "agent.http_port 与 agent.grpc_port 不能相同")
+	if f.Agent.LogLevel != "" {
+		_, err := log.ParseLevel(f.Agent.LogLevel)
+		check(err == nil, "agent.log_level 不支持: %s", f.Agent.LogLevel)
+	}
+
+	check(f.Screen.JPEGQuality >= 1 && f.Screen.JPEGQuality <= 100, "screen.jpeg_quality 必须在1到100之间")
+	check(contains(SupportedCaptureMethods, f.Screen.CaptureMethod),
+		"screen.capture_method 必须是 %s 之一", strings.Join(SupportedCaptureMethods, ", "))
+
+	check(contains(SupportedCodecs, f.Encoder.DefaultCodec),
+		"encoder.default_codec 必须是 %s 之一", strings.Join(SupportedCodecs, ", "))
+	check(f.Encoder.JPEGQuality >= 1 && f.Encoder.JPEGQuality <= 100, "encoder.jpeg_quality 必须在1到100之间")
+	check(f.Encoder.FrameRate >= 1 && f.Encoder.FrameRate <= MaxFrameRate, "encoder.frame_rate 必须在1到%d之间", MaxFrameRate)
+	check(f.Encoder.H264Bitrate >= 0, "encoder.h264_bitrate 不能为负数")
+	check(f.Encoder.VP8Bitrate >= 0, "encoder.vp8_bitrate 不能为负数")
+	check(f.Encoder.NVENCBitrate >= 0, "encoder.nvenc_bitrate 不能为负数")
+	for _, codec := range f.Encoder.EnabledCodecs {
+		check(contains(SupportedCodecs, codec), "encoder.enabled_codecs 包含不支持的编码器: %s", codec)
+	}
+	for _, codec := range f.Encoder.CodecPriority {
+		check(contains(SupportedCodecs, codec), "encoder.codec_priority 包含不支持的编码器: %s", codec)
+	}
+	check(f.Encoder.Debug.SaveVideoDuration >= 0, "encoder.debug.save_video_duration 不能为负数")
+
+	if f.Proxy.URL != "" {
+		_, err := proxy.Parse(f.Proxy.URL, f.Proxy.Username, f.Proxy.Password)
+		check(err == nil, "proxy.url 无效: %v", err)
+	}
+	for _, raw := range f.Proxy.Candidates {
+		_, err := proxy.Parse(raw, "", "")
+		check(err == nil, "proxy.candidates 包含无效地址: %v", err)
+	}
+	check(!f.Proxy.Enabled || f.Proxy.URL != "", "proxy.enabled 为true时必须配置 proxy.url")
+
+	check(f.Monitoring.MetricsInterval >= 0, "monitoring.metrics_interval 不能为负数")
+	check(f.System.RebootDelay >= 0, "system.reboot_delay 不能为负数")
+	check(f.Update.TrialTimeout >= 0, "update.trial_timeout 不能为负数")
+
+	check(f.Watchdog.Port >= 1 && f.Watchdog.Port <= maxPort, "watchdog.port 必须在1到%d之间", maxPort)
+	check(f.Watchdog.Port != f.Agent.HTTPPort && f.Watchdog.Port != f.Agent.GRPCPort, "watchdog.port 不能与Agent端口相同")
+	check(f.Watchdog.HealthInterval >= 0, "watchdog.health_interval 不能为负数")
+	check(f.Watchdog.HealthFailures >= 0, "watchdog.health_failures 不能为负数")
+	check(f.Watchdog.MaxBackoff >= 0, "watchdog.max_backoff 不能为负数")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// isHTTPURL 判断是否为http或https地址
+func isHTTPURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// contains 判断values中是否包含value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
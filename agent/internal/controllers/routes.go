@@ -20,6 +20,7 @@ func SetupRoutes(router *gin.RouterGroup) {
 	{
 		// System information
 		apiGroup.GET("/info", handlers.InfoHandler)              // ✅ 获取系统信息（设备信息、运行时状态、屏幕信息）
+		apiGroup.GET("/servers", handlers.ServersHandler)        // ✅ 获取配置的后端、当前连接的后端及健康状态
 		apiGroup.GET("/screenshot", handlers.ScreenshotHandler)  // ✅ 获取屏幕截图（GET方式，URL参数）
 		apiGroup.POST("/screenshot", handlers.ScreenshotHandler) // ✅ 获取屏幕截图（POST方式，JSON参数）
 
@@ -43,22 +44,67 @@ func SetupRoutes(router *gin.RouterGroup) {
 		apiGroup.POST("/execscript", handlers.ExecScriptHandler) //
 
 		// File operations
-		apiGroup.GET("/download", handlers.DownloadHandler) // ✅ 文件下载（已实现）
-		apiGroup.POST("/upload", handlers.UploadHandler)    // ✅ 文件上传（已实现）
+		apiGroup.GET("/download", handlers.DownloadHandler)  // ✅ 文件下载（支持Range断点续传）
+		apiGroup.HEAD("/download", handlers.DownloadHandler) // ✅ 获取下载文件的大小和ETag
+		apiGroup.POST("/upload", handlers.UploadHandler)     // ✅ 文件上传（已实现）
+
+		// Resumable chunked upload
+		apiGroup.POST("/uploads", handlers.UploadSessionCreateHandler)                // ✅ 创建分块上传会话
+		apiGroup.GET("/uploads/:id", handlers.UploadSessionStatusHandler)             // ✅ 查询已接收的区间（断点续传）
+		apiGroup.PUT("/uploads/:id/chunks", handlers.UploadChunkHandler)              // ✅ 上传分块（offset参数+X-Chunk-SHA256校验）
+		apiGroup.POST("/uploads/:id/complete", handlers.UploadSessionCompleteHandler) // ✅ 校验整个文件SHA-256并完成上传
+		apiGroup.DELETE("/uploads/:id", handlers.UploadSessionAbortHandler)           // ✅ 取消上传
+		apiGroup.POST("/fetch", handlers.FetchHandler)                                // ✅ 从服务器拉取文件并校验SHA-256（批量分发）
+
+		// File manager
+		apiGroup.GET("/files", handlers.FileListHandler)           // ✅ 列出目录（未指定路径时返回磁盘分区）
+		apiGroup.GET("/files/stat", handlers.FileStatHandler)      // ✅ 获取文件信息
+		apiGroup.GET("/files/drives", handlers.FileDrivesHandler)  // ✅ 列出磁盘分区/挂载点
+		apiGroup.GET("/files/search", handlers.FileSearchHandler)  // ✅ 搜索文件（名称/大小/时间/内容，NDJSON流式返回）
+		apiGroup.GET("/files/hash", handlers.FileHashHandler)      // ✅ 计算文件/目录树的SHA-256（可选MD5）清单
+		apiGroup.POST("/files/mkdir", handlers.FileMkdirHandler)   // ✅ 创建目录
+		apiGroup.POST("/files/move", handlers.FileMoveHandler)     // ✅ 移动/重命名
+		apiGroup.POST("/files/copy", handlers.FileCopyHandler)     // ✅ 复制
+		apiGroup.POST("/files/delete", handlers.FileDeleteHandler) // ✅ 删除（递归删除需确认）
+		apiGroup.GET("/archive", handlers.ArchiveHandler)          // ✅ 目录打包下载（zip/tar.gz流式输出，支持include/exclude）
+		apiGroup.POST("/extract", handlers.ExtractHandler)         // ✅ 上传压缩包并解压到目标目录
+
+		// Directory watch
+		apiGroup.POST("/watches", handlers.WatchCreateHandler)       // ✅ 创建目录监听（轮询+防抖，事件通过/wscontrol推送）
+		apiGroup.GET("/watches", handlers.WatchListHandler)          // ✅ 目录监听列表
+		apiGroup.GET("/watches/events", handlers.WatchEventsHandler) // ✅ 获取已记录的监听事件（按序号增量拉取）
+		apiGroup.DELETE("/watches/:id", handlers.WatchDeleteHandler) // ✅ 取消目录监听
+
+		// Agent configuration
+		apiGroup.GET("/config", handlers.GetConfigHandler)     // ✅ 获取当前配置（生效配置、配置文件内容、集中配置状态）
+		apiGroup.PUT("/config", handlers.PutConfigHandler)     // ✅ 替换整个配置（校验后写回配置文件并热加载）
+		apiGroup.PATCH("/config", handlers.PatchConfigHandler) // ✅ 修改部分配置（JSON片段逐层合并），返回需要重启的配置项
+
+		// Agent self-update
+		apiGroup.POST("/update", handlers.UpdateHandler)      // ✅ 下载指定版本、校验并替换后重启（失败自动回滚）
+		apiGroup.GET("/update", handlers.UpdateStatusHandler) // ✅ 当前版本和最近一次更新的结果
 
 		// Proxy management
-		apiGroup.GET("/startip", handlers.StartProxyHandler)     // ❌ 启动代理IP（未实现）
-		apiGroup.GET("/stopip", handlers.StopProxyHandler)       // ❌ 停止代理IP（未实现）
-		apiGroup.GET("/checkproxy", handlers.CheckProxyHandler)  // ❌ 检查代理状态（未实现）
-		apiGroup.GET("/proxylist", handlers.GetProxyListHandler) // ❌ 获取代理列表（未实现）
+		apiGroup.GET("/startip", handlers.StartProxyHandler)       // ✅ 应用代理（未指定时选择延迟最低的可用候选代理）
+		apiGroup.POST("/startip", handlers.StartProxyHandler)      // ✅ 应用代理（JSON参数）
+		apiGroup.GET("/stopip", handlers.StopProxyHandler)         // ✅ 停止代理并恢复系统设置
+		apiGroup.POST("/stopip", handlers.StopProxyHandler)        // ✅ 停止代理并恢复系统设置
+		apiGroup.GET("/checkproxy", handlers.CheckProxyHandler)    // ✅ 检查代理连通性、延迟和出口IP
+		apiGroup.GET("/proxylist", handlers.GetProxyListHandler)   // ✅ 获取候选代理列表及健康状态
+		apiGroup.POST("/proxylist", handlers.AddProxyHandler)      // ✅ 添加候选代理
+		apiGroup.DELETE("/proxylist", handlers.RemoveProxyHandler) // ✅ 移除候选代理
 	}
 
-	// Watchdog routes (for compatibility)
+	// Watchdog routes
 	watchdogGroup := router.Group("/watchdog")
 	{
-		watchdogGroup.GET("/start", handlers.WatchdogStartHandler)   // ❌ 启动看门狗服务（未实现，兼容性接口）
-		watchdogGroup.GET("/stop", handlers.WatchdogStopHandler)     // ❌ 停止看门狗服务（未实现，兼容性接口）
-		watchdogGroup.GET("/update", handlers.WatchdogUpdateHandler) // ❌ 更新看门狗配置（未实现，兼容性接口）
+		watchdogGroup.GET("/status", handlers.WatchdogStatusHandler)  // ✅ 获取看门狗状态
+		watchdogGroup.GET("/start", handlers.WatchdogStartHandler)    // ✅ 启动看门狗并接管当前Agent
+		watchdogGroup.POST("/start", handlers.WatchdogStartHandler)   // ✅ 启动看门狗并接管当前Agent
+		watchdogGroup.GET("/stop", handlers.WatchdogStopHandler)      // ✅ 停止看门狗（Agent保持运行）
+		watchdogGroup.POST("/stop", handlers.WatchdogStopHandler)     // ✅ 停止看门狗（Agent保持运行）
+		watchdogGroup.GET("/update", handlers.WatchdogUpdateHandler)  // ✅ 更新看门狗参数（查询参数）
+		watchdogGroup.POST("/update", handlers.WatchdogUpdateHandler) // ✅ 更新看门狗参数（JSON）
 	}
 
 	// Metrics endpoint
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"winmanager-agent/pkg/archive"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 打包/解压默认限制，可通过max_size_mb/max_files参数调整
+const (
+	archiveDefaultMaxBytes = 10 << 30 // 打包的文件总大小上限
+	extractDefaultMaxBytes = 20 << 30 // 解压后的总大小上限
+	archiveDefaultMaxFiles = 200000   // 文件数上限
+)
+
+// queryList 读取可重复或逗号分隔的查询参数
+func queryList(c *gin.Context, key string) []string {
+	var values []string
+	for _, value := range c.QueryArray(key) {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+	}
+	return values
+}
+
+// archiveLimits 读取大小和文件数限制参数
+func archiveLimits(c *gin.Context, defaultBytes int64) (int64, int, error) {
+	maxBytes := defaultBytes
+	if value := c.Query("max_size_mb"); value != "" {
+		mb, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || mb <= 0 {
+			return 0, 0, errors.New("max_size_mb参数错误")
+		}
+		maxBytes = mb << 20
+	}
+
+	maxFiles := archiveDefaultMaxFiles
+	if value := c.Query("max_files"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return 0, 0, errors.New("max_files参数错误")
+		}
+		maxFiles = n
+	}
+	return maxBytes, maxFiles, nil
+}
+
+// archiveErrorResponse 将打包/解压错误转换为对应的HTTP状态码
+func archiveErrorResponse(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case os.IsNotExist(err):
+		status = http.StatusNotFound
+	case os.IsPermission(err):
+		status = http.StatusForbidden
+	case errors.Is(err, archive.ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, archive.ErrUnsafePath), errors.Is(err, archive.ErrFormat):
+		status = http.StatusBadRequest
+	}
+
+	c.JSON(status, gin.H{
+		"code":    status,
+		"message": message,
+		"error":   err.Error(),
+	})
+}
+
+// ArchiveHandler 将目录打包为zip或tar.gz并流式返回
+// 参数: path 目录或文件, format zip(默认)/tar.gz, include/exclude 通配符(可重复或逗号分隔), max_size_mb, max_files
+func ArchiveHandler(c *gin.Context) {
+	root := c.Query("path")
+	if root == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少path参数"})
+		return
+	}
+	format, err := archive.NormalizeFormat(c.Query("format"))
+	if err != nil {
+		archiveErrorResponse(c, "format参数错误", err)
+		return
+	}
+	maxBytes, maxFiles, err := archiveLimits(c, archiveDefaultMaxBytes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	// 先遍历筛选并检查限制，超出时还能返回错误响应
+	entries, result, err := archive.Collect(root, archive.Options{
+		Include:  queryList(c, "include"),
+		Exclude:  queryList(c, "exclude"),
+		MaxBytes: maxBytes,
+		MaxFiles: maxFiles,
+	})
+	if err != nil {
+		log.WithFields(log.Fields{"path": root, "error": err.Error()}).Warn("打包目录失败")
+		archiveErrorResponse(c, "打包目录失败", err)
+		return
+	}
+
+	name := filepath.Base(filepath.Clean(root))
+	if name == "" || name == "." || name == string(filepath.Separator) || strings.HasSuffix(name, ":\\") {
+		name = "archive"
+	}
+	contentType := "application/zip"
+	if format == archive.FormatTarGz {
+		contentType = "application/gzip"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name + "." + format}))
+	c.Header("X-Archive-Files", strconv.Itoa(result.Files))
+	c.Header("X-Archive-Bytes", strconv.FormatInt(result.Bytes, 10))
+	c.Status(http.StatusOK)
+
+	if err := archive.Write(c.Writer, format, entries); err != nil {
+		// 响应已开始发送，只能中断连接
+		log.WithFields(log.Fields{"path": root, "error": err.Error()}).Error("打包输出中断")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"path":   root,
+		"format": format,
+		"files":  result.Files,
+		"bytes":  result.Bytes,
+	}).Info("目录打包下载完成")
+}
+
+// ExtractHandler 上传压缩包并解压到目标目录
+// 请求体可以是multipart表单(file字段)或压缩包原始数据；参数: dir 目标目录, format zip/tar.gz(默认按文件名判断),
+// overwrite 覆盖已存在的文件, max_size_mb, max_files
+func ExtractHandler(c *gin.Context) {
+	dest := c.Query("dir")
+	if dest == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少dir参数"})
+		return
+	}
+	overwrite := c.Query("overwrite") == "true" || c.Query("overwrite") == "1"
+	maxBytes, maxFiles, err := archiveLimits(c, extractDefaultMaxBytes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	body := io.Reader(c.Request.Body)
+	filename := ""
+	if reader, err := c.Request.MultipartReader(); err == nil {
+		// 找到file字段后直接从流中读取，不缓存整个表单
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少file字段"})
+				return
+			}
+			if part.FormName() == "file" {
+				body = part
+				filename = part.FileName()
+				break
+			}
+			part.Close()
+		}
+	}
+
+	format := c.Query("format")
+	if format != "" {
+		format, err = archive.NormalizeFormat(format)
+	} else {
+		format, err = archive.DetectFormat(filename)
+	}
+	if err != nil {
+		archiveErrorResponse(c, "无法确定压缩格式，请指定format参数", err)
+		return
+	}
+
+	opts := archive.Options{MaxBytes: maxBytes, MaxFiles: maxFiles}
+	var result *archive.Result
+	if format == archive.FormatTarGz {
+		result, err = archive.ExtractTarGz(body, dest, overwrite, opts)
+	} else {
+		result, err = extractZipStream(body, dest, overwrite, opts)
+	}
+	if err != nil {
+		log.WithFields(log.Fields{"dir": dest, "format": format, "error": err.Error()}).Error("解压失败")
+		archiveErrorResponse(c, "解压失败", err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"dir":     dest,
+		"format":  format,
+		"files":   result.Files,
+		"bytes":   result.Bytes,
+		"skipped": result.Skipped,
+	}).Info("压缩包解压完成")
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "解压完成", "data": result})
+}
+
+// extractZipStream zip需要随机读取，先将上传内容写入临时文件再解压
+func extractZipStream(r io.Reader, dest string, overwrite bool, opts archive.Options) (*archive.Result, error) {
+	temp, err := os.CreateTemp("", "wm-extract-*.zip")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		temp.Close()
+		os.Remove(temp.Name())
+	}()
+
+	size, err := io.Copy(temp, r)
+	if err != nil {
+		return nil, fmt.Errorf("接收压缩包失败: %v", err)
+	}
+	return archive.ExtractZip(temp, size, dest, overwrite, opts)
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"winmanager-agent/internal/config"
+	"winmanager-agent/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 配置文件的检查间隔
+const configWatchInterval = 5 * time.Second
+
+// InitConfigReload 监听配置文件并在配置变化时通知运行中的模块：
+// 编码器在下一帧按新配置重建，日志级别立即生效（debugMode时保持调试级别），
+// 帧率、输入开关和系统开关在使用时读取配置，不需要额外处理
+func InitConfigReload(debugMode bool) {
+	cfg := config.GetGlobalConfig()
+	cfg.OnChange(func(changes []config.Change) {
+		if config.HasChange(changes, "encoder") {
+			RequestEncoderReload()
+		}
+		if config.HasChange(changes, "agent.log_level") && !debugMode {
+			if err := logger.SetLevel(cfg.GetLogLevel()); err != nil {
+				log.WithError(err).Warn("设置日志级别失败")
+			}
+		}
+		if restart := config.RestartRequiredFields(changes); len(restart) > 0 {
+			log.WithField("fields", restart).Warn("部分配置需要重启 Agent 后生效")
+		}
+	})
+
+	if cfg.GetConfigPath() != "" {
+		cfg.WatchConfigFile(configWatchInterval)
+	}
+}
+
+// GetConfigHandler 获取当前配置：config为生效的配置（含集中配置），local为配置文件内容，密码已隐藏
+func GetConfigHandler(c *gin.Context) {
+	cfg := config.GetGlobalConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"path":    cfg.GetConfigPath(),
+			"config":  cfg.GetFileConfig().Redacted(),
+			"local":   cfg.GetLocalConfig().Redacted(),
+			"managed": cfg.GetManagedState(),
+		},
+	})
+}
+
+// PutConfigHandler 用请求内容替换整个配置文件，校验通过后保存并立即生效
+func PutConfigHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "读取请求失败", "error": err.Error()})
+		return
+	}
+	update, err := config.DecodeFileConfig(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "配置格式错误", "error": err.Error()})
+		return
+	}
+	changes, err := config.GetGlobalConfig().UpdateLocalConfig(update)
+	respondConfigUpdate(c, changes, err)
+}
+
+// PatchConfigHandler 将请求中的配置片段合并到配置文件，如 {"encoder": {"frame_rate": 15}}
+func PatchConfigHandler(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "读取请求失败", "error": err.Error()})
+		return
+	}
+	changes, err := config.GetGlobalConfig().PatchLocalConfig(body)
+	respondConfigUpdate(c, changes, err)
+}
+
+// respondConfigUpdate 返回修改结果，区分已生效和需要重启才能生效的配置项
+func respondConfigUpdate(c *gin.Context, changes []config.Change, err error) {
+	if errors.Is(err, config.ErrInvalidConfig) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "配置校验失败", "error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.WithError(err).Error("保存配置失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存配置失败", "error": err.Error()})
+		return
+	}
+
+	applied := make([]string, 0, len(changes))
+	for _, change := range changes {
+		if !change.RestartRequired {
+			applied = append(applied, change.Field)
+		}
+	}
+	restart := config.RestartRequiredFields(changes)
+	if len(changes) > 0 {
+		log.WithFields(log.Fields{"applied": applied, "restart_required": restart}).Info("配置已通过接口修改")
+	}
+
+	cfg := config.GetGlobalConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "配置已保存",
+		"data": gin.H{
+			"changes":          changes,
+			"applied":          applied,
+			"restart_required": restart,
+			"managed_sections": cfg.GetManagedState().Sections, // 这些配置段由集中配置覆盖，本地修改暂不生效
+			"config":           cfg.GetFileConfig().Redacted(),
+		},
+	})
+}
@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+
+	"winmanager-agent/pkg/fsutil"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// FileMkdirRequest 创建目录请求
+type FileMkdirRequest struct {
+	Path    string `json:"path" binding:"required"`
+	Parents bool   `json:"parents"` // 同时创建不存在的上级目录
+}
+
+// FileTransferRequest 移动/复制请求
+type FileTransferRequest struct {
+	Src       string `json:"src" binding:"required"`
+	Dst       string `json:"dst" binding:"required"`
+	Overwrite bool   `json:"overwrite"` // 目标已存在时是否覆盖
+}
+
+// FileDeleteRequest 删除请求
+type FileDeleteRequest struct {
+	Path      string `json:"path" binding:"required"`
+	Recursive bool   `json:"recursive"` // 递归删除非空目录
+	Confirm   string `json:"confirm"`   // 递归删除时必须再次填写要删除的路径
+}
+
+// fileErrorResponse 将文件操作错误转换为对应的HTTP状态码
+func fileErrorResponse(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case os.IsNotExist(err):
+		status = http.StatusNotFound
+	case os.IsPermission(err):
+		status = http.StatusForbidden
+	case os.IsExist(err), errors.Is(err, fsutil.ErrExists), errors.Is(err, fsutil.ErrNotEmpty):
+		status = http.StatusConflict
+	case errors.Is(err, fsutil.ErrRootPath), errors.Is(err, fsutil.ErrIntoSelf), errors.Is(err, fsutil.ErrIsAncestor), errors.Is(err, fsutil.ErrSameFile):
+		status = http.StatusBadRequest
+	}
+
+	c.JSON(status, gin.H{
+		"code":    status,
+		"message": message,
+		"error":   err.Error(),
+	})
+}
+
+// FileListHandler 列出目录内容；未指定路径时返回磁盘分区列表
+func FileListHandler(c *gin.Context) {
+	dir := c.Query("path")
+	if dir == "" {
+		FileDrivesHandler(c)
+		return
+	}
+
+	showHidden := c.Query("hidden") == "true" || c.Query("hidden") == "1"
+	items, err := fsutil.List(dir, showHidden)
+	if err != nil {
+		log.WithFields(log.Fields{"path": dir, "error": err.Error()}).Warn("列出目录失败")
+		fileErrorResponse(c, "列出目录失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"path":   filepath.Clean(dir),
+			"parent": filepath.Dir(filepath.Clean(dir)),
+			"items":  items,
+		},
+	})
+}
+
+// FileStatHandler 获取文件或目录信息
+func FileStatHandler(c *gin.Context) {
+	path := c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "路径参数缺失"})
+		return
+	}
+
+	info, err := fsutil.Stat(path)
+	if err != nil {
+		fileErrorResponse(c, "获取文件信息失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": info})
+}
+
+// FileDrivesHandler 列出磁盘分区或挂载点
+func FileDrivesHandler(c *gin.Context) {
+	drives, err := fsutil.Drives()
+	if err != nil {
+		log.WithError(err).Error("获取磁盘分区失败")
+		fileErrorResponse(c, "获取磁盘分区失败", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": drives})
+}
+
+// FileMkdirHandler 创建目录
+func FileMkdirHandler(c *gin.Context) {
+	var req FileMkdirRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+
+	if err := fsutil.Mkdir(req.Path, req.Parents); err != nil {
+		fileErrorResponse(c, "创建目录失败", err)
+		return
+	}
+
+	log.WithField("path", req.Path).Info("创建目录成功")
+	info, _ := fsutil.Stat(req.Path)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "创建目录成功", "data": info})
+}
+
+// FileMoveHandler 移动或重命名文件/目录
+func FileMoveHandler(c *gin.Context) {
+	var req FileTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+
+	if err := fsutil.Move(req.Src, req.Dst, req.Overwrite); err != nil {
+		log.WithFields(log.Fields{"src": req.Src, "dst": req.Dst, "error": err.Error()}).Warn("移动文件失败")
+		fileErrorResponse(c, "移动失败", err)
+		return
+	}
+
+	log.WithFields(log.Fields{"src": req.Src, "dst": req.Dst}).Info("移动文件成功")
+	info, _ := fsutil.Stat(req.Dst)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "移动成功", "data": info})
+}
+
+// FileCopyHandler 复制文件/目录
+func FileCopyHandler(c *gin.Context) {
+	var req FileTransferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+
+	if err := fsutil.Copy(req.Src, req.Dst, req.Overwrite); err != nil {
+		log.WithFields(log.Fields{"src": req.Src, "dst": req.Dst, "error": err.Error()}).Warn("复制文件失败")
+		fileErrorResponse(c, "复制失败", err)
+		return
+	}
+
+	log.WithFields(log.Fields{"src": req.Src, "dst": req.Dst}).Info("复制文件成功")
+	info, _ := fsutil.Stat(req.Dst)
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "复制成功", "data": info})
+}
+
+// FileDeleteHandler 删除文件/目录
+// 非空目录需要recursive=true，且confirm必须与path一致，防止误删
+func FileDeleteHandler(c *gin.Context) {
+	var req FileDeleteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+
+	if req.Recursive && filepath.Clean(req.Confirm) != filepath.Clean(req.Path) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "递归删除需要在confirm中再次填写完整路径",
+		})
+		return
+	}
+
+	if err := fsutil.Remove(req.Path, req.Recursive); err != nil {
+		log.WithFields(log.Fields{"path": req.Path, "recursive": req.Recursive, "error": err.Error()}).Warn("删除文件失败")
+		fileErrorResponse(c, "删除失败", err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"event_type": "FILE_DELETE",
+		"path":       req.Path,
+		"recursive":  req.Recursive,
+	}).Info("删除文件成功")
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "删除成功"})
+}
+
+// 文件搜索超时限制(秒)
+const (
+	fileSearchDefaultTimeout = 30
+	fileSearchMaxTimeout     = 600
+)
+
+// parseSearchTime 解析时间参数，支持RFC3339和Unix时间戳(秒)
+func parseSearchTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t := time.Unix(seconds, 0)
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseSearchOptions 从查询参数构建搜索条件
+func parseSearchOptions(c *gin.Context) (fsutil.SearchOptions, int, error) {
+	opts := fsutil.SearchOptions{
+		Root:       c.Query("root"),
+		Names:      queryList(c, "name"),
+		Type:       c.Query("type"),
+		Content:    c.Query("content"),
+		Regex:      c.Query("regex") == "true" || c.Query("regex") == "1",
+		IgnoreCase: c.Query("ignore_case") == "true" || c.Query("ignore_case") == "1",
+		ShowHidden: c.Query("hidden") == "true" || c.Query("hidden") == "1",
+	}
+	if opts.Root == "" {
+		return opts, 0, errors.New("缺少root参数")
+	}
+	if opts.Type != "" && opts.Type != "file" && opts.Type != "dir" {
+		return opts, 0, errors.New("type只能是file或dir")
+	}
+
+	ints := map[string]*int{"max_depth": &opts.MaxDepth, "max_results": &opts.MaxResults}
+	for key, target := range ints {
+		if value := c.Query(key); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return opts, 0, fmt.Errorf("%s参数错误", key)
+			}
+			*target = n
+		}
+	}
+	sizes := map[string]*int64{"min_size": &opts.MinSize, "max_size": &opts.MaxSize}
+	for key, target := range sizes {
+		if value := c.Query(key); value != "" {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return opts, 0, fmt.Errorf("%s参数错误", key)
+			}
+			*target = n
+		}
+	}
+
+	var err error
+	if opts.ModifiedAfter, err = parseSearchTime(c.Query("modified_after")); err != nil {
+		return opts, 0, errors.New("modified_after参数错误")
+	}
+	if opts.ModifiedBefore, err = parseSearchTime(c.Query("modified_before")); err != nil {
+		return opts, 0, errors.New("modified_before参数错误")
+	}
+
+	timeout := fileSearchDefaultTimeout
+	if value := c.Query("timeout"); value != "" {
+		if timeout, err = strconv.Atoi(value); err != nil || timeout <= 0 {
+			return opts, 0, errors.New("timeout参数错误")
+		}
+	}
+	if timeout > fileSearchMaxTimeout {
+		timeout = fileSearchMaxTimeout
+	}
+	return opts, timeout, nil
+}
+
+// FileSearchHandler 按名称通配符、大小、修改时间和内容搜索文件
+// 结果以NDJSON流式返回：每个匹配一行 {"type":"match",...}，最后一行 {"type":"done","stats":{...}}
+func FileSearchHandler(c *gin.Context) {
+	opts, timeout, err := parseSearchOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+	if info, err := os.Stat(opts.Root); err != nil {
+		fileErrorResponse(c, "搜索根路径无效", err)
+		return
+	} else if !info.IsDir() {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "搜索根路径不是目录"})
+		return
+	}
+	if opts.Regex {
+		if _, err := regexp.Compile(opts.Content); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "正则表达式错误", "error": err.Error()})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+
+	stats, err := fsutil.Search(ctx, opts, func(match fsutil.SearchMatch) error {
+		if err := encoder.Encode(struct {
+			Type string `json:"type"`
+			fsutil.SearchMatch
+		}{"match", match}); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+
+	done := gin.H{"type": "done", "stats": stats}
+	if err != nil {
+		done["error"] = err.Error()
+	}
+	encoder.Encode(done)
+	c.Writer.Flush()
+
+	log.WithFields(log.Fields{
+		"root":    opts.Root,
+		"name":    opts.Names,
+		"content": opts.Content,
+		"stats":   stats,
+	}).Info("文件搜索完成")
+}
+
+// FileHashHandler 计算文件或目录树中所有文件的SHA-256（可选MD5），用于完整性核对
+// 参数: path 文件或目录, md5 是否同时计算MD5, exclude 排除的通配符(可重复或逗号分隔), max_files 文件数上限
+func FileHashHandler(c *gin.Context) {
+	root := c.Query("path")
+	if root == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "路径参数缺失"})
+		return
+	}
+
+	opts := fsutil.HashOptions{
+		MD5:     c.Query("md5") == "true" || c.Query("md5") == "1",
+		Exclude: queryList(c, "exclude"),
+	}
+	if value := c.Query("max_files"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "max_files参数错误"})
+			return
+		}
+		opts.MaxFiles = n
+	}
+
+	manifest, err := fsutil.HashTree(c.Request.Context(), root, opts)
+	if err != nil {
+		log.WithFields(log.Fields{"path": root, "error": err.Error()}).Warn("计算文件哈希失败")
+		if errors.Is(err, fsutil.ErrHashLimit) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"code": http.StatusRequestEntityTooLarge, "message": "计算文件哈希失败", "error": err.Error()})
+			return
+		}
+		fileErrorResponse(c, "计算文件哈希失败", err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"path":    manifest.Root,
+		"files":   len(manifest.Files),
+		"bytes":   manifest.TotalBytes,
+		"errors":  len(manifest.Errors),
+		"elapsed": manifest.Elapsed,
+	}).Info("文件哈希计算完成")
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": manifest})
+}
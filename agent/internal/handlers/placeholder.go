@@ -281,8 +281,8 @@ func DownloadHandler(c *gin.Context) {
 		return
 	}
 
-	// 检查文件是否存在
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+	file, err := os.Open(filePath)
+	if os.IsNotExist(err) {
 		c.JSON(http.StatusNotFound, gin.H{
 			"code":    404,
 			"message": "文件不存在",
@@ -291,7 +291,11 @@ func DownloadHandler(c *gin.Context) {
 	}
 
 	// 获取文件信息
-	fileInfo, err := os.Stat(filePath)
+	var fileInfo os.FileInfo
+	if err == nil {
+		defer file.Close()
+		fileInfo, err = file.Stat()
+	}
 	if err != nil {
 		log.WithFields(log.Fields{
 			"file_path": filePath,
@@ -303,20 +307,30 @@ func DownloadHandler(c *gin.Context) {
 		})
 		return
 	}
+	if fileInfo.IsDir() {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "不能下载目录",
+		})
+		return
+	}
 
-	// 设置响应头
+	// 设置响应头；Content-Length和Range由ServeContent处理，支持断点续传
+	// ETag由大小和修改时间组成，客户端续传时通过If-Range确认文件未变化
 	filename := filepath.Base(filePath)
 	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 	c.Header("Content-Type", "application/octet-stream")
-	c.Header("Content-Length", fmt.Sprintf("%d", fileInfo.Size()))
+	c.Header("ETag", fmt.Sprintf("\"%x-%x\"", fileInfo.Size(), fileInfo.ModTime().UnixNano()))
 
 	// 发送文件
-	c.File(filePath)
+	http.ServeContent(c.Writer, c.Request, filename, fileInfo.ModTime(), file)
 
 	log.WithFields(log.Fields{
 		"file_path": filePath,
 		"file_size": fileInfo.Size(),
 		"filename":  filename,
+		"range":     c.GetHeader("Range"),
+		"status":    c.Writer.Status(),
 	}).Info("文件下载成功")
 }
 
@@ -413,26 +427,6 @@ func UploadHandler(c *gin.Context) {
 	}).Info("文件上传成功")
 }
 
-func StartProxyHandler(c *gin.Context) {
-	log.Debug("StartProxy handler called")
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Not implemented yet"})
-}
-
-func StopProxyHandler(c *gin.Context) {
-	log.Debug("StopProxy handler called")
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Not implemented yet"})
-}
-
-func CheckProxyHandler(c *gin.Context) {
-	log.Debug("CheckProxy handler called")
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Not implemented yet"})
-}
-
-func GetProxyListHandler(c *gin.Context) {
-	log.Debug("GetProxyList handler called")
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Not implemented yet"})
-}
-
 func GetAccountHandler(c *gin.Context) {
 	log.Debug("GetAccount handler called")
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Not implemented yet"})
@@ -457,18 +451,3 @@ func SessionHandler(c *gin.Context) {
 	log.Debug("Session handler called")
 	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Not implemented yet"})
 }
-
-func WatchdogStartHandler(c *gin.Context) {
-	log.Debug("WatchdogStart handler called")
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Not implemented yet"})
-}
-
-func WatchdogStopHandler(c *gin.Context) {
-	log.Debug("WatchdogStop handler called")
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Not implemented yet"})
-}
-
-func WatchdogUpdateHandler(c *gin.Context) {
-	log.Debug("WatchdogUpdate handler called")
-	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "Not implemented yet"})
-}
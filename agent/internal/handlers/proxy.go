@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"winmanager-agent/internal/config"
+	"winmanager-agent/pkg/proxy"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 默认的候选代理检查间隔
+const proxyDefaultCheckInterval = 5 * time.Minute
+
+var (
+	proxyManager     *proxy.Manager
+	proxyManagerOnce sync.Once
+	proxyReporter    func(proxy.Status) error // 向后端上报代理状态
+)
+
+// proxyRequest 启动、检查或添加代理的参数
+type proxyRequest struct {
+	URL      string `json:"url" form:"url"`
+	Username string `json:"username" form:"username"`
+	Password string `json:"password" form:"password"`
+	Force    bool   `json:"force" form:"force"` // 连通性检查失败时仍然应用
+}
+
+// getProxyManager 按配置创建代理管理器，加入配置的候选代理和检测到的系统代理
+func getProxyManager() *proxy.Manager {
+	proxyManagerOnce.Do(func() {
+		cfg := config.GetGlobalConfig().GetProxyConfig()
+		proxyManager = proxy.NewManager(cfg.CheckURL, proxy.DefaultCheckTimeout)
+
+		for _, raw := range cfg.Candidates {
+			u, err := proxy.Parse(raw, "", "")
+			if err != nil {
+				log.WithError(err).WithField("proxy", raw).Warn("忽略无效的候选代理")
+				continue
+			}
+			proxyManager.Add(u, proxy.SourceConfig)
+		}
+		if cfg.URL != "" {
+			if u, err := proxy.Parse(cfg.URL, cfg.Username, cfg.Password); err == nil {
+				proxyManager.Add(u, proxy.SourceConfig)
+			} else {
+				log.WithError(err).Warn("配置的代理地址无效")
+			}
+		}
+		if cfg.AutoDetect {
+			if raw := proxy.SystemProxy(); raw != "" {
+				if u, err := proxy.Parse(raw, "", ""); err == nil {
+					proxyManager.Add(u, proxy.SourceSystem)
+				}
+			}
+		}
+	})
+	return proxyManager
+}
+
+// InitProxyService 应用配置中启用的代理并定期检查候选代理，状态变化时通过report上报后端
+func InitProxyService(report func(proxy.Status) error) {
+	proxyReporter = report
+	manager := getProxyManager()
+	cfg := config.GetGlobalConfig().GetProxyConfig()
+
+	if cfg.Enabled && cfg.URL != "" {
+		if u, err := proxy.Parse(cfg.URL, cfg.Username, cfg.Password); err == nil {
+			result := manager.Check(context.Background(), u)
+			if !result.OK {
+				log.WithField("error", result.Error).Warn("配置的代理连通性检查失败，仍然应用")
+			}
+			if err := manager.Activate(u, &result); err != nil {
+				log.WithError(err).Error("应用配置的代理失败")
+			} else {
+				log.WithFields(log.Fields{"proxy": proxy.Redact(u), "exit_ip": result.ExitIP}).Info("已应用配置的代理")
+			}
+		}
+	}
+
+	interval := time.Duration(cfg.CheckInterval) * time.Second
+	if cfg.CheckInterval == 0 {
+		interval = proxyDefaultCheckInterval
+	}
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			manager.CheckAll(context.Background())
+			if status := manager.Status(); status.Enabled {
+				if status.Health != nil && !status.Health.OK {
+					log.WithFields(log.Fields{"proxy": status.URL, "error": status.Health.Error}).Warn("当前代理连通性检查失败")
+				}
+				ReportProxyStatus()
+			}
+		}
+	}()
+}
+
+// ReportProxyStatus 在后台上报当前代理状态，注册成功后也会调用
+func ReportProxyStatus() {
+	if proxyReporter == nil {
+		return
+	}
+	status := getProxyManager().Status()
+	go func() {
+		if err := proxyReporter(status); err != nil {
+			log.WithError(err).Warn("上报代理状态失败")
+		}
+	}()
+}
+
+// StartProxyHandler 应用代理：检查连通性后设为当前代理，未指定地址时选择延迟最低的可用候选代理
+func StartProxyHandler(c *gin.Context) {
+	var req proxyRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	manager := getProxyManager()
+	var u *url.URL
+	if req.URL != "" {
+		parsed, err := proxy.Parse(req.URL, req.Username, req.Password)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "代理地址错误", "error": err.Error()})
+			return
+		}
+		u = parsed
+	} else if u = manager.Best(); u == nil {
+		// 候选代理还没有检查过或都不可用时重新检查一次
+		manager.CheckAll(c.Request.Context())
+		if u = manager.Best(); u == nil {
+			c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "没有可用的候选代理"})
+			return
+		}
+	}
+
+	result := manager.Check(c.Request.Context(), u)
+	if !result.OK && !req.Force {
+		c.JSON(http.StatusBadGateway, gin.H{"code": 502, "message": "代理连通性检查失败", "error": result.Error, "data": result})
+		return
+	}
+	if err := manager.Activate(u, &result); err != nil {
+		log.WithError(err).WithField("proxy", proxy.Redact(u)).Error("应用代理失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "应用代理失败", "error": err.Error()})
+		return
+	}
+
+	log.WithFields(log.Fields{"proxy": proxy.Redact(u), "latency_ms": result.Latency, "exit_ip": result.ExitIP}).Info("已应用代理")
+	ReportProxyStatus()
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "代理已启动", "data": manager.Status()})
+}
+
+// StopProxyHandler 停止使用代理并恢复系统设置
+func StopProxyHandler(c *gin.Context) {
+	manager := getProxyManager()
+	previous := manager.Status()
+	if err := manager.Deactivate(); err != nil {
+		log.WithError(err).Error("停止代理失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "停止代理失败", "error": err.Error()})
+		return
+	}
+
+	if previous.Enabled {
+		log.WithField("proxy", previous.URL).Info("已停止代理")
+		ReportProxyStatus()
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "代理已停止", "data": manager.Status()})
+}
+
+// CheckProxyHandler 检查代理连通性：指定url时检查该代理，all=true时检查全部候选代理，否则检查当前代理
+func CheckProxyHandler(c *gin.Context) {
+	manager := getProxyManager()
+
+	if c.Query("all") == "true" {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": manager.CheckAll(c.Request.Context())})
+		return
+	}
+
+	if raw := c.Query("url"); raw != "" {
+		u, err := proxy.Parse(raw, c.Query("username"), c.Query("password"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "代理地址错误", "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"code": 0, "data": manager.Check(c.Request.Context(), u)})
+		return
+	}
+
+	active := manager.Active()
+	if active == nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "当前未使用代理", "data": manager.Status()})
+		return
+	}
+	manager.Check(c.Request.Context(), active)
+	ReportProxyStatus()
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": manager.Status()})
+}
+
+// GetProxyListHandler 获取候选代理列表及最近一次检查结果
+func GetProxyListHandler(c *gin.Context) {
+	manager := getProxyManager()
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"active":     manager.Status(),
+			"candidates": manager.List(),
+		},
+	})
+}
+
+// AddProxyHandler 添加候选代理并立即检查连通性
+func AddProxyHandler(c *gin.Context) {
+	var req proxyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	u, err := proxy.Parse(req.URL, req.Username, req.Password)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "代理地址错误", "error": err.Error()})
+		return
+	}
+
+	manager := getProxyManager()
+	manager.Add(u, proxy.SourceAPI)
+	result := manager.Check(c.Request.Context(), u)
+	log.WithFields(log.Fields{"proxy": proxy.Redact(u), "ok": result.OK}).Info("已添加候选代理")
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "候选代理已添加", "data": result})
+}
+
+// RemoveProxyHandler 移除候选代理
+func RemoveProxyHandler(c *gin.Context) {
+	u, err := proxy.Parse(c.Query("url"), "", "")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "代理地址错误", "error": err.Error()})
+		return
+	}
+	if err := getProxyManager().Remove(u); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "候选代理已移除"})
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"net/http"
+
+	"winmanager-agent/internal/api"
+	"winmanager-agent/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServersHandler 返回配置的后端及健康状态，check=true时先检查所有后端
+func ServersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"current":  config.GetGlobalConfig().GetServerURL(),
+			"backends": api.GetServerStatus(c.Request.Context(), c.Query("check") == "true"),
+		},
+	})
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"encoding/json"
 	"net/http"
 	"time"
 
@@ -266,12 +267,21 @@ func (c *Connection) readPump() {
 	})
 
 	for {
-		_, _, err := c.ws.ReadMessage()
+		messageType, message, err := c.ws.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.WithError(err).Error("WebSocket读取错误")
 			}
 			break
 		}
+
+		// 客户端（或后端代理重连后）可请求立即生成关键帧
+		if messageType == websocket.TextMessage {
+			var msg ControlMessage
+			if err := json.Unmarshal(message, &msg); err == nil && msg.Type == MSG_REQUEST_KEYFRAME {
+				log.Infof("客户端请求关键帧: %s", c.key)
+				c.hub.requestKeyFrame()
+			}
+		}
 	}
 }
@@ -53,6 +53,9 @@ type ScreenshotRequest struct {
 	Y       int    `json:"y"`
 	Width   int    `json:"width"`
 	Height  int    `json:"height"`
+
+	MaxWidth  int `json:"max_width"`  // 输出最大宽度，用于缩略图
+	MaxHeight int `json:"max_height"` // 输出最大高度，用于缩略图
 }
 
 // ScreenshotHandler captures and returns a screenshot
@@ -63,6 +66,7 @@ func ScreenshotHandler(c *gin.Context) {
 	format := "jpeg"
 	quality := 85
 	x, y, width, height := 0, 0, 0, 0
+	maxWidth, maxHeight := 0, 0
 
 	// 根据请求方法解析参数
 	if c.Request.Method == "POST" {
@@ -76,6 +80,7 @@ func ScreenshotHandler(c *gin.Context) {
 				quality = req.Quality
 			}
 			x, y, width, height = req.X, req.Y, req.Width, req.Height
+			maxWidth, maxHeight = req.MaxWidth, req.MaxHeight
 
 			log.Infof("POST参数解析: Format=%s, Quality=%d, X=%d, Y=%d, Width=%d, Height=%d",
 				format, quality, x, y, width, height)
@@ -117,6 +122,17 @@ func ScreenshotHandler(c *gin.Context) {
 			}
 		}
 
+		if maxWidthStr := c.Query("max_width"); maxWidthStr != "" {
+			if parsedMaxWidth, err := strconv.Atoi(maxWidthStr); err == nil {
+				maxWidth = parsedMaxWidth
+			}
+		}
+		if maxHeightStr := c.Query("max_height"); maxHeightStr != "" {
+			if parsedMaxHeight, err := strconv.Atoi(maxHeightStr); err == nil {
+				maxHeight = parsedMaxHeight
+			}
+		}
+
 		log.Infof("GET参数解析: Format=%s, Quality=%d, X=%d, Y=%d, Width=%d, Height=%d",
 			format, quality, x, y, width, height)
 	}
@@ -129,6 +145,9 @@ func ScreenshotHandler(c *gin.Context) {
 		Y:       y,
 		Width:   width,
 		Height:  height,
+
+		MaxWidth:  maxWidth,
+		MaxHeight: maxHeight,
 	}
 
 	if opts.Width > 0 || opts.Height > 0 {
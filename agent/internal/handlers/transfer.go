@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"winmanager-agent/internal/config"
+	"winmanager-agent/pkg/transfer"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 分块上传参数
+const (
+	uploadSessionDir    = "./uploads/.sessions" // 会话索引目录，Agent重启后据此恢复未完成的上传
+	uploadSessionExpire = 24 * time.Hour        // 会话空闲过期时间
+	uploadChunkSize     = 8 << 20               // 建议的分块大小
+	uploadMaxChunkSize  = 64 << 20              // 单个分块的最大大小
+)
+
+var uploadManager = transfer.NewManager(uploadSessionDir, uploadSessionExpire)
+
+// UploadSessionRequest 创建分块上传会话请求
+type UploadSessionRequest struct {
+	Path      string `json:"path"`     // 目标文件完整路径，与dir/filename二选一
+	Dir       string `json:"dir"`      // 目标目录
+	Filename  string `json:"filename"` // 目标文件名
+	Size      int64  `json:"size"`     // 文件总大小
+	SHA256    string `json:"sha256"`   // 整个文件的SHA-256，完成时校验
+	Overwrite bool   `json:"overwrite"`
+}
+
+// uploadErrorResponse 将分块上传错误转换为对应的HTTP状态码
+func uploadErrorResponse(c *gin.Context, message string, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, transfer.ErrSessionNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, transfer.ErrTargetExists):
+		status = http.StatusConflict
+	case errors.Is(err, transfer.ErrOutOfRange):
+		status = http.StatusRequestedRangeNotSatisfiable
+	case errors.Is(err, transfer.ErrChunkChecksum), errors.Is(err, transfer.ErrFileChecksum), errors.Is(err, transfer.ErrIncomplete):
+		status = http.StatusUnprocessableEntity
+	}
+
+	c.JSON(status, gin.H{
+		"code":    status,
+		"message": message,
+		"error":   err.Error(),
+	})
+}
+
+// UploadSessionCreateHandler 创建分块上传会话
+func UploadSessionCreateHandler(c *gin.Context) {
+	var req UploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+
+	path := req.Path
+	if path == "" {
+		// 与普通上传一致，文件名中的路径分隔符替换掉，防止目录遍历
+		filename := strings.NewReplacer("/", "_", "\\", "_").Replace(req.Filename)
+		if filename == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "缺少path或filename参数"})
+			return
+		}
+		dir := req.Dir
+		if dir == "" {
+			dir = "./uploads"
+		}
+		path = filepath.Join(dir, filename)
+	}
+
+	status, err := uploadManager.Create(path, req.Size, req.SHA256, req.Overwrite)
+	if err != nil {
+		log.WithFields(log.Fields{"path": path, "size": req.Size, "error": err.Error()}).Error("创建上传会话失败")
+		uploadErrorResponse(c, "创建上传会话失败", err)
+		return
+	}
+
+	log.WithFields(log.Fields{"id": status.ID, "path": status.Path, "size": status.Size}).Info("创建上传会话")
+	c.JSON(http.StatusOK, gin.H{
+		"code":    0,
+		"message": "success",
+		"data": gin.H{
+			"session":        status,
+			"chunk_size":     uploadChunkSize,
+			"max_chunk_size": uploadMaxChunkSize,
+		},
+	})
+}
+
+// UploadSessionStatusHandler 查询上传会话状态，用于断点续传
+func UploadSessionStatusHandler(c *gin.Context) {
+	status, err := uploadManager.Status(c.Param("id"))
+	if err != nil {
+		uploadErrorResponse(c, "获取上传会话失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": status})
+}
+
+// UploadChunkHandler 上传一个分块
+// 请求体为分块原始数据，offset查询参数指定写入位置，X-Chunk-SHA256请求头为分块的SHA-256
+func UploadChunkHandler(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.Query("offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "offset参数错误"})
+		return
+	}
+	length := c.Request.ContentLength
+	if length < 0 {
+		c.JSON(http.StatusLengthRequired, gin.H{"code": 411, "message": "分块必须指定Content-Length"})
+		return
+	}
+	if length > uploadMaxChunkSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"code": 413, "message": "分块过大", "max_chunk_size": uploadMaxChunkSize})
+		return
+	}
+
+	status, err := uploadManager.WriteChunk(c.Param("id"), offset, length, c.GetHeader("X-Chunk-SHA256"), c.Request.Body)
+	if err != nil {
+		log.WithFields(log.Fields{"id": c.Param("id"), "offset": offset, "length": length, "error": err.Error()}).Warn("写入分块失败")
+		uploadErrorResponse(c, "写入分块失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": status})
+}
+
+// UploadSessionCompleteHandler 校验整个文件并完成上传
+func UploadSessionCompleteHandler(c *gin.Context) {
+	status, err := uploadManager.Complete(c.Param("id"))
+	if err != nil {
+		log.WithFields(log.Fields{"id": c.Param("id"), "error": err.Error()}).Error("完成上传失败")
+		uploadErrorResponse(c, "完成上传失败", err)
+		return
+	}
+
+	log.WithFields(log.Fields{"id": status.ID, "path": status.Path, "size": status.Size}).Info("分块上传完成")
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "上传完成", "data": status})
+}
+
+// UploadSessionAbortHandler 取消上传并删除临时文件
+func UploadSessionAbortHandler(c *gin.Context) {
+	if err := uploadManager.Abort(c.Param("id")); err != nil {
+		uploadErrorResponse(c, "取消上传失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "上传已取消"})
+}
+
+// fetchClient 拉取文件使用的客户端，大文件下载不设置整体超时，由服务器请求的超时控制
+var fetchClient = &http.Client{}
+
+// FetchHandler 从服务器拉取文件并校验SHA-256，用于批量分发
+// url为相对路径时基于Agent配置的服务器地址
+func FetchHandler(c *gin.Context) {
+	var req transfer.FetchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+	switch req.Overwrite {
+	case "", transfer.OverwriteAlways, transfer.OverwriteSkip, transfer.OverwriteFail:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "overwrite参数错误"})
+		return
+	}
+
+	if target, err := url.Parse(req.URL); err == nil && !target.IsAbs() {
+		base, err := url.Parse(config.GetGlobalConfig().GetServerURL())
+		if err != nil || base.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "服务器地址未配置，无法解析相对url"})
+			return
+		}
+		req.URL = base.ResolveReference(target).String()
+	}
+
+	started := time.Now()
+	result, err := transfer.Fetch(c.Request.Context(), fetchClient, req)
+	if err != nil {
+		log.WithFields(log.Fields{"url": req.URL, "path": req.Path, "error": err.Error()}).Error("拉取文件失败")
+		uploadErrorResponse(c, "拉取文件失败", err)
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"url":      req.URL,
+		"path":     result.Path,
+		"status":   result.Status,
+		"bytes":    result.Bytes,
+		"duration": time.Since(started).String(),
+	}).Info("拉取文件完成")
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "success", "data": result})
+}
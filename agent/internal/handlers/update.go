@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"winmanager-agent/internal/config"
+	"winmanager-agent/pkg/transfer"
+	"winmanager-agent/pkg/updater"
+	"winmanager-agent/pkg/watchdog"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 下载新版本的超时
+const updateDownloadTimeout = 30 * time.Minute
+
+// 新版本默认的重新注册超时
+const updateDefaultTrialTimeout = 120 * time.Second
+
+var (
+	updateMutex   sync.Mutex
+	updateRunning *updater.Release                // 正在下载的版本
+	updateReady   = make(chan updater.Release, 1) // 已替换程序文件，等待主进程交接
+)
+
+// UpdateReady 返回已完成替换的更新，主进程收到后释放端口并调用HandoverUpdate
+func UpdateReady() <-chan updater.Release {
+	return updateReady
+}
+
+// OfferUpdate 处理心跳响应中下发的更新，配置禁用自动更新或该版本已回滚过时忽略
+func OfferUpdate(release updater.Release) {
+	if !config.GetGlobalConfig().GetUpdateConfig().Enabled {
+		log.WithField("version", release.Version).Debug("自动更新已禁用，忽略心跳下发的更新")
+		return
+	}
+	if exe, err := updater.Executable(); err == nil {
+		state, _ := updater.LoadState(updater.StatePath(exe))
+		if state != nil && state.Version == release.Version &&
+			(state.Status == updater.StatusRolledBack || state.Status == updater.StatusFailed) {
+			log.WithField("version", release.Version).Debug("该版本更新失败过，等待手动推送")
+			return
+		}
+	}
+	if err := startUpdate(release); err != nil {
+		log.WithError(err).WithField("version", release.Version).Debug("忽略下发的更新")
+	}
+}
+
+// startUpdate 校验后在后台下载并替换程序文件，同一时间只执行一个更新
+func startUpdate(release updater.Release) error {
+	current := config.GetGlobalConfig().GetVersion()
+	if release.Version == current {
+		return fmt.Errorf("已是版本%s", current)
+	}
+
+	updateMutex.Lock()
+	defer updateMutex.Unlock()
+	if updateRunning != nil {
+		return fmt.Errorf("正在更新到版本%s", updateRunning.Version)
+	}
+	updateRunning = &release
+
+	go func() {
+		// 成功时保持updateRunning，进程即将重启，不再接受其他更新
+		if err := prepareUpdate(release, current); err != nil {
+			log.WithError(err).WithField("version", release.Version).Error("Agent更新失败")
+			updateMutex.Lock()
+			updateRunning = nil
+			updateMutex.Unlock()
+			return
+		}
+		updateReady <- release
+	}()
+	return nil
+}
+
+// prepareUpdate 下载新版本、校验SHA-256和签名并替换程序文件，失败时记录状态供心跳上报
+func prepareUpdate(release updater.Release, current string) (err error) {
+	exe, err := updater.Executable()
+	if err != nil {
+		return err
+	}
+	statePath := updater.StatePath(exe)
+	defer func() {
+		if err != nil {
+			updater.SaveState(statePath, &updater.State{
+				Version:         release.Version,
+				PreviousVersion: current,
+				Status:          updater.StatusFailed,
+				Error:           err.Error(),
+			})
+		}
+	}()
+
+	target, err := url.Parse(release.URL)
+	if err != nil {
+		return fmt.Errorf("更新地址错误: %w", err)
+	}
+	if !target.IsAbs() {
+		base, err := url.Parse(config.GetGlobalConfig().GetServerURL())
+		if err != nil || base.Host == "" {
+			return errors.New("服务器地址未配置，无法解析相对url")
+		}
+		target = base.ResolveReference(target)
+	}
+
+	log.WithFields(log.Fields{"version": release.Version, "current": current, "url": target.String()}).Info("开始下载Agent新版本")
+
+	ctx, cancel := context.WithTimeout(context.Background(), updateDownloadTimeout)
+	defer cancel()
+	newPath := updater.NewPath(exe)
+	if _, err := transfer.Fetch(ctx, fetchClient, transfer.FetchRequest{
+		URL:       target.String(),
+		Path:      newPath,
+		SHA256:    release.SHA256,
+		Size:      release.Size,
+		Overwrite: transfer.OverwriteAlways,
+	}); err != nil {
+		return fmt.Errorf("下载新版本失败: %w", err)
+	}
+
+	if key := config.GetGlobalConfig().GetUpdateConfig().PublicKey; key != "" {
+		if err := updater.VerifySignature(key, release.SHA256, release.Signature); err != nil {
+			os.Remove(newPath)
+			return err
+		}
+	}
+	if err := os.Chmod(newPath, 0755); err != nil {
+		return err
+	}
+	if err := updater.Replace(exe, newPath); err != nil {
+		return fmt.Errorf("替换程序文件失败: %w", err)
+	}
+
+	log.WithField("version", release.Version).Info("程序文件已替换，准备重启到新版本")
+	return updater.SaveState(statePath, &updater.State{
+		Version:         release.Version,
+		PreviousVersion: current,
+		Status:          updater.StatusTrial,
+	})
+}
+
+// HandoverUpdate 启动新版本并等待其重新注册，失败时回滚并启动旧版本；
+// 看门狗运行时交由看门狗重启和回滚。调用前需要关闭HTTP和gRPC服务释放端口，返回后当前进程应退出
+func HandoverUpdate(release updater.Release) error {
+	exe, err := updater.Executable()
+	if err != nil {
+		return err
+	}
+
+	if _, err := watchdog.Call(watchdogPort(), "/update", struct{}{}); err == nil {
+		log.WithField("version", release.Version).Info("已通知看门狗启动新版本")
+		return nil
+	}
+
+	timeout := time.Duration(config.GetGlobalConfig().GetUpdateConfig().TrialTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = updateDefaultTrialTimeout
+	}
+
+	log.WithFields(log.Fields{"version": release.Version, "timeout": timeout.String()}).Info("启动新版本")
+	if err := updater.RunTrial(exe, os.Args[1:], updater.StatePath(exe), timeout); err != nil {
+		log.WithError(err).Error("新版本启动失败，已回滚到旧版本")
+		return err
+	}
+	log.WithField("version", release.Version).Info("新版本已重新注册，旧版本退出")
+	return nil
+}
+
+// ConfirmUpdate 注册成功后调用：当前进程是更新后的新版本时确认更新，并清理旧版本
+func ConfirmUpdate() {
+	exe, err := updater.Executable()
+	if err != nil {
+		return
+	}
+	statePath := updater.StatePath(exe)
+	state, err := updater.LoadState(statePath)
+	if err != nil || state == nil || state.Status != updater.StatusTrial {
+		return
+	}
+
+	current := config.GetGlobalConfig().GetVersion()
+	if state.Version != current {
+		log.WithFields(log.Fields{"expected": state.Version, "current": current}).Warn("新版本的版本号与下发的版本不一致")
+	}
+	state.Status = updater.StatusConfirmed
+	state.Reported = false
+	if err := updater.SaveState(statePath, state); err != nil {
+		log.WithError(err).Error("保存更新状态失败")
+		return
+	}
+	log.WithFields(log.Fields{"version": current, "previous": state.PreviousVersion}).Info("Agent更新完成")
+
+	// 旧进程确认后才会退出，稍后再删除旧版本
+	go func() {
+		if err := updater.RemoveOld(exe, 2*time.Minute); err != nil {
+			log.WithError(err).Warn("删除旧版本失败")
+		}
+	}()
+}
+
+// UpdateHandler 后端推送更新：下载指定版本并重启，不受update.enabled配置限制
+func UpdateHandler(c *gin.Context) {
+	var release updater.Release
+	if err := c.ShouldBindJSON(&release); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+
+	if err := startUpdate(release); err != nil {
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "开始更新", "data": release})
+}
+
+// UpdateStatusHandler 获取当前版本、正在进行的更新和最近一次更新的结果
+func UpdateStatusHandler(c *gin.Context) {
+	var state *updater.State
+	if exe, err := updater.Executable(); err == nil {
+		state, _ = updater.LoadState(updater.StatePath(exe))
+	}
+
+	updateMutex.Lock()
+	running := updateRunning
+	updateMutex.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"version":  config.GetGlobalConfig().GetVersion(),
+			"updating": running,
+			"last":     state,
+		},
+	})
+}
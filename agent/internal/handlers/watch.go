@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"winmanager-agent/pkg/fsutil"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	uuid "github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+)
+
+// 目录监听限制
+const (
+	watchMaxSubscriptions  = 32
+	watchEventHistory      = 1000 // 保留的最近事件数，供后端按序号拉取
+	watchDefaultDebounceMs = 2000
+	watchMinIntervalMs     = 500
+)
+
+// WatchRequest 创建监听请求，HTTP接口和WATCH_SUBSCRIBE消息共用
+type WatchRequest struct {
+	Path       string   `json:"path" binding:"required"`
+	Recursive  bool     `json:"recursive"`   // 递归监听子目录
+	Exclude    []string `json:"exclude"`     // 排除的文件或目录通配符
+	DebounceMs int      `json:"debounce_ms"` // 最后一次变化后静默多久再通知，默认2000
+	IntervalMs int      `json:"interval_ms"` // 扫描间隔，默认2000，最小500
+}
+
+// WatchSubscription 目录监听
+type WatchSubscription struct {
+	ID          string     `json:"id"`
+	Path        string     `json:"path"`
+	Recursive   bool       `json:"recursive"`
+	Exclude     []string   `json:"exclude"`
+	DebounceMs  int        `json:"debounce_ms"`
+	IntervalMs  int        `json:"interval_ms"`
+	Source      string     `json:"source"` // api: HTTP接口创建，事件推送给所有控制连接; control: 控制连接创建，只推送给该连接，断开时自动取消
+	CreatedAt   time.Time  `json:"created_at"`
+	Events      int64      `json:"events"`
+	LastEventAt *time.Time `json:"last_event_at"`
+	Error       string     `json:"error,omitempty"` // 监听异常结束的原因
+
+	owner  *websocket.Conn
+	cancel context.CancelFunc
+}
+
+// RecordedWatchEvent 已记录的监听事件，Seq单调递增
+type RecordedWatchEvent struct {
+	Seq     int64  `json:"seq"`
+	WatchID string `json:"watch_id"`
+	fsutil.WatchEvent
+}
+
+// WatchManager 管理目录监听并记录最近的事件
+type WatchManager struct {
+	mutex   sync.Mutex
+	watches map[string]*WatchSubscription
+	events  []RecordedWatchEvent
+	seq     int64
+}
+
+var watchManager = &WatchManager{watches: make(map[string]*WatchSubscription)}
+
+// Subscribe 创建监听，owner不为nil时事件只推送给该控制连接
+func (m *WatchManager) Subscribe(req WatchRequest, owner *websocket.Conn) (*WatchSubscription, error) {
+	if req.Path == "" {
+		return nil, errors.New("路径参数缺失")
+	}
+	if _, err := os.Stat(req.Path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if req.DebounceMs <= 0 {
+		req.DebounceMs = watchDefaultDebounceMs
+	}
+	if req.IntervalMs <= 0 {
+		req.IntervalMs = int(fsutil.DefaultWatchInterval / time.Millisecond)
+	}
+	if req.IntervalMs < watchMinIntervalMs {
+		req.IntervalMs = watchMinIntervalMs
+	}
+
+	m.mutex.Lock()
+	if len(m.watches) >= watchMaxSubscriptions {
+		m.mutex.Unlock()
+		return nil, fmt.Errorf("监听数量已达上限(%d)", watchMaxSubscriptions)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &WatchSubscription{
+		ID:         uuid.NewV4().String(),
+		Path:       filepath.Clean(req.Path),
+		Recursive:  req.Recursive,
+		Exclude:    req.Exclude,
+		DebounceMs: req.DebounceMs,
+		IntervalMs: req.IntervalMs,
+		Source:     "api",
+		CreatedAt:  time.Now(),
+		owner:      owner,
+		cancel:     cancel,
+	}
+	if owner != nil {
+		sub.Source = "control"
+	}
+	m.watches[sub.ID] = sub
+	m.mutex.Unlock()
+
+	go m.run(ctx, sub)
+
+	log.WithFields(log.Fields{
+		"id":          sub.ID,
+		"path":        sub.Path,
+		"recursive":   sub.Recursive,
+		"debounce_ms": sub.DebounceMs,
+		"source":      sub.Source,
+	}).Info("创建目录监听")
+	return sub, nil
+}
+
+// run 执行监听直到取消，异常结束时保留记录并通知订阅方
+func (m *WatchManager) run(ctx context.Context, sub *WatchSubscription) {
+	err := fsutil.Watch(ctx, fsutil.WatchOptions{
+		Root:      sub.Path,
+		Recursive: sub.Recursive,
+		Exclude:   sub.Exclude,
+		Interval:  time.Duration(sub.IntervalMs) * time.Millisecond,
+		Debounce:  time.Duration(sub.DebounceMs) * time.Millisecond,
+	}, func(events []fsutil.WatchEvent) {
+		m.publish(sub, events)
+	})
+	if err == nil {
+		return
+	}
+
+	log.WithFields(log.Fields{"id": sub.ID, "path": sub.Path, "error": err.Error()}).Error("目录监听异常结束")
+	m.mutex.Lock()
+	sub.Error = err.Error()
+	m.mutex.Unlock()
+	m.push(sub, ControlMessage{
+		Type:      MSG_WATCH_STATUS,
+		Data:      map[string]interface{}{"watch_id": sub.ID, "state": "error", "error": err.Error()},
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// publish 记录一批事件并推送给控制连接
+func (m *WatchManager) publish(sub *WatchSubscription, events []fsutil.WatchEvent) {
+	m.mutex.Lock()
+	now := time.Now()
+	sub.Events += int64(len(events))
+	sub.LastEventAt = &now
+	for _, event := range events {
+		m.seq++
+		m.events = append(m.events, RecordedWatchEvent{Seq: m.seq, WatchID: sub.ID, WatchEvent: event})
+	}
+	if overflow := len(m.events) - watchEventHistory; overflow > 0 {
+		m.events = append(m.events[:0:0], m.events[overflow:]...)
+	}
+	m.mutex.Unlock()
+
+	log.WithFields(log.Fields{"id": sub.ID, "path": sub.Path, "count": len(events)}).Info("目录发生变化")
+	m.push(sub, ControlMessage{
+		Type: MSG_WATCH_EVENT,
+		Data: map[string]interface{}{
+			"watch_id": sub.ID,
+			"path":     sub.Path,
+			"events":   events,
+		},
+		Timestamp: now.Unix(),
+	})
+}
+
+// push 推送给创建监听的控制连接；HTTP接口创建的监听推送给所有控制连接
+func (m *WatchManager) push(sub *WatchSubscription, msg ControlMessage) {
+	if sub.owner != nil {
+		sendControlMessage(sub.owner, msg)
+		return
+	}
+	broadcastControlMessage(msg)
+}
+
+// Unsubscribe 取消监听
+func (m *WatchManager) Unsubscribe(id string) bool {
+	m.mutex.Lock()
+	sub, ok := m.watches[id]
+	delete(m.watches, id)
+	m.mutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	sub.cancel()
+	log.WithFields(log.Fields{"id": id, "path": sub.Path}).Info("取消目录监听")
+	return true
+}
+
+// UnsubscribeOwner 控制连接断开时取消其创建的监听
+// 连接已断开无法再通知，由后端代理在上游断开时向客户端发送WATCH_STATUS(unsubscribed)
+func (m *WatchManager) UnsubscribeOwner(owner *websocket.Conn) {
+	m.mutex.Lock()
+	var ids []string
+	for id, sub := range m.watches {
+		if sub.owner == owner {
+			ids = append(ids, id)
+		}
+	}
+	m.mutex.Unlock()
+
+	for _, id := range ids {
+		m.Unsubscribe(id)
+	}
+}
+
+// List 获取全部监听
+func (m *WatchManager) List() []WatchSubscription {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	items := make([]WatchSubscription, 0, len(m.watches))
+	for _, sub := range m.watches {
+		items = append(items, *sub)
+	}
+	return items
+}
+
+// EventsSince 获取序号大于since的事件，watchID为空时返回所有监听的事件
+// 返回的truncated表示since之后的部分事件已超出保留数量被丢弃
+func (m *WatchManager) EventsSince(since int64, watchID string, limit int) ([]RecordedWatchEvent, int64, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// 序号大于当前值说明Agent重启过，从头返回
+	restarted := since > m.seq
+	if restarted {
+		since = 0
+	}
+	truncated := restarted || (len(m.events) > 0 && m.events[0].Seq > since+1)
+	events := []RecordedWatchEvent{}
+	for _, event := range m.events {
+		if event.Seq <= since || (watchID != "" && event.WatchID != watchID) {
+			continue
+		}
+		if len(events) >= limit {
+			break
+		}
+		events = append(events, event)
+	}
+	return events, m.seq, truncated
+}
+
+// handleWatchSubscribe 处理WATCH_SUBSCRIBE消息，监听归属于当前控制连接
+func handleWatchSubscribe(ws *websocket.Conn, msg ControlMessage) error {
+	var req WatchRequest
+	data, _ := json.Marshal(msg.Data)
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fmt.Errorf("监听参数错误: %w", err)
+	}
+
+	sub, err := watchManager.Subscribe(req, ws)
+	if err != nil {
+		return err
+	}
+	return sendControlMessage(ws, ControlMessage{
+		Type:      MSG_WATCH_STATUS,
+		Data:      map[string]interface{}{"watch_id": sub.ID, "state": "subscribed", "watch": sub},
+		Timestamp: time.Now().Unix(),
+		ID:        msg.ID,
+	})
+}
+
+// handleWatchUnsubscribe 处理WATCH_UNSUBSCRIBE消息
+func handleWatchUnsubscribe(ws *websocket.Conn, msg ControlMessage) error {
+	id, _ := msg.Data["watch_id"].(string)
+	if !watchManager.Unsubscribe(id) {
+		return fmt.Errorf("监听不存在: %s", id)
+	}
+	return sendControlMessage(ws, ControlMessage{
+		Type:      MSG_WATCH_STATUS,
+		Data:      map[string]interface{}{"watch_id": id, "state": "unsubscribed"},
+		Timestamp: time.Now().Unix(),
+		ID:        msg.ID,
+	})
+}
+
+// WatchCreateHandler 创建目录监听，事件通过/wscontrol推送给所有控制连接并记录
+func WatchCreateHandler(c *gin.Context) {
+	var req WatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+
+	sub, err := watchManager.Subscribe(req, nil)
+	if err != nil {
+		fileErrorResponse(c, "创建监听失败", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "监听已创建", "data": sub})
+}
+
+// WatchListHandler 获取目录监听列表
+func WatchListHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": watchManager.List()})
+}
+
+// WatchDeleteHandler 取消目录监听
+func WatchDeleteHandler(c *gin.Context) {
+	if !watchManager.Unsubscribe(c.Param("id")) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "监听不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "监听已取消"})
+}
+
+// WatchEventsHandler 获取已记录的监听事件，参数: since 上次获取到的最大序号, watch_id, limit(默认100，最大1000)
+func WatchEventsHandler(c *gin.Context) {
+	since, _ := strconv.ParseInt(c.Query("since"), 10, 64)
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	if limit <= 0 {
+		limit = 100
+	}
+	if limit > watchEventHistory {
+		limit = watchEventHistory
+	}
+
+	events, latest, truncated := watchManager.EventsSince(since, c.Query("watch_id"), limit)
+	c.JSON(http.StatusOK, gin.H{
+		"code": 0,
+		"data": gin.H{
+			"events":    events,
+			"latest":    latest,
+			"truncated": truncated,
+		},
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"winmanager-agent/internal/config"
+	"winmanager-agent/pkg/updater"
+	"winmanager-agent/pkg/watchdog"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+// 启动看门狗后等待其控制接口就绪的时间
+const watchdogStartTimeout = 5 * time.Second
+
+// watchdogPort 看门狗控制接口端口
+func watchdogPort() int {
+	return config.GetGlobalConfig().GetWatchdogConfig().Port
+}
+
+// WatchdogStatusHandler 获取看门狗状态
+func WatchdogStatusHandler(c *gin.Context) {
+	status, err := watchdog.GetStatus(watchdogPort())
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "看门狗未运行", "data": gin.H{"running": false}})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "data": gin.H{"running": true, "status": status}})
+}
+
+// WatchdogStartHandler 启动看门狗并接管当前Agent进程，看门狗已运行时直接返回其状态
+func WatchdogStartHandler(c *gin.Context) {
+	port := watchdogPort()
+	if status, err := watchdog.GetStatus(port); err == nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "看门狗已在运行", "data": status})
+		return
+	}
+
+	exe, err := updater.Executable()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取程序路径失败", "error": err.Error()})
+		return
+	}
+
+	// Agent以全局参数启动，看门狗使用相同参数加上watchdog子命令
+	args := append(append([]string{}, os.Args[1:]...), "watchdog", "--attach-pid", strconv.Itoa(os.Getpid()))
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir, _ = os.Getwd()
+	if err := cmd.Start(); err != nil {
+		log.WithError(err).Error("启动看门狗失败")
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "启动看门狗失败", "error": err.Error()})
+		return
+	}
+	pid := cmd.Process.Pid
+	go cmd.Wait()
+
+	deadline := time.Now().Add(watchdogStartTimeout)
+	for time.Now().Before(deadline) {
+		time.Sleep(200 * time.Millisecond)
+		if status, err := watchdog.GetStatus(port); err == nil {
+			log.WithField("pid", pid).Info("看门狗已启动")
+			c.JSON(http.StatusOK, gin.H{"code": 0, "message": "看门狗已启动", "data": status})
+			return
+		}
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "看门狗未在规定时间内就绪", "data": gin.H{"pid": pid}})
+}
+
+// WatchdogStopHandler 停止看门狗，Agent保持运行
+func WatchdogStopHandler(c *gin.Context) {
+	status, err := watchdog.Call(watchdogPort(), "/stop", struct{}{})
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{"code": 0, "message": "看门狗未运行"})
+		return
+	}
+	log.WithField("pid", status.PID).Info("已停止看门狗")
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "看门狗已停止", "data": status})
+}
+
+// WatchdogUpdateHandler 调整看门狗的健康检查间隔、失败次数和最长退避时间（秒）
+// GET时从查询参数读取，POST时从JSON读取，未指定的参数保持不变
+func WatchdogUpdateHandler(c *gin.Context) {
+	var settings watchdog.Settings
+	if err := c.ShouldBind(&settings); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
+		return
+	}
+	if settings.HealthInterval < 0 || settings.HealthFailures < 0 || settings.MaxBackoff < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数不能为负数"})
+		return
+	}
+
+	status, err := watchdog.Call(watchdogPort(), "/settings", settings)
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": 503, "message": "看门狗未运行", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 0, "message": "看门狗参数已更新", "data": status})
+}
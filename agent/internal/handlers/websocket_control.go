@@ -68,6 +68,15 @@ const (
 
 	// 坐标映射查询消息类型
 	MSG_COORDINATE_MAPPING_STATUS = "COORDINATE_MAPPING_STATUS" // 查询坐标映射状态
+
+	// 目录监听消息类型
+	MSG_WATCH_SUBSCRIBE   = "WATCH_SUBSCRIBE"   // 创建目录监听，监听随当前连接断开自动取消
+	MSG_WATCH_UNSUBSCRIBE = "WATCH_UNSUBSCRIBE" // 取消目录监听
+	MSG_WATCH_STATUS      = "WATCH_STATUS"      // Agent->客户端：监听已创建/已取消/异常结束
+	MSG_WATCH_EVENT       = "WATCH_EVENT"       // Agent->客户端：目录变化通知（防抖后批量发送）
+
+	// 视频流消息（通过 /wsstream 发送）
+	MSG_REQUEST_KEYFRAME = "REQUEST_KEYFRAME" // 请求编码器立即生成关键帧（如代理重连后）
 )
 
 // 控制消息结构
@@ -126,6 +135,9 @@ var controlUpgrader = websocket.Upgrader{
 	},
 }
 
+// controlConns 当前的控制连接及其写锁，监听事件等异步推送与请求响应可能同时写入同一连接
+var controlConns sync.Map // *websocket.Conn -> *sync.Mutex
+
 // 全局坐标映射实例
 var globalCoordinateMapping *CoordinateMapping
 var coordinateMappingMutex sync.RWMutex
@@ -141,8 +153,11 @@ func WebSocketControlHandler(c *gin.Context) {
 		return
 	}
 
+	controlConns.Store(ws, &sync.Mutex{})
 	defer func() {
 		log.Info("关闭WebSocket控制连接")
+		controlConns.Delete(ws)
+		watchManager.UnsubscribeOwner(ws)
 		ws.Close()
 	}()
 
@@ -160,7 +175,7 @@ func WebSocketControlHandler(c *gin.Context) {
 		defer ticker.Stop()
 
 		for range ticker.C {
-			if err := ws.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
+			if err := ws.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(10*time.Second)); err != nil {
 				log.WithError(err).Debug("发送心跳失败，连接可能已断开")
 				return
 			}
@@ -252,9 +267,23 @@ func sendControlMessage(ws *websocket.Conn, msg ControlMessage) error {
 	if err != nil {
 		return fmt.Errorf("序列化消息失败: %w", err)
 	}
+	if lock, ok := controlConns.Load(ws); ok {
+		lock.(*sync.Mutex).Lock()
+		defer lock.(*sync.Mutex).Unlock()
+	}
 	return ws.WriteMessage(websocket.TextMessage, data)
 }
 
+// broadcastControlMessage 发送消息给所有控制连接
+func broadcastControlMessage(msg ControlMessage) {
+	controlConns.Range(func(key, _ interface{}) bool {
+		if err := sendControlMessage(key.(*websocket.Conn), msg); err != nil {
+			log.WithError(err).Debug("推送控制消息失败")
+		}
+		return true
+	})
+}
+
 // sendErrorResponse 发送错误响应
 func sendErrorResponse(ws *websocket.Conn, message, details string) {
 	errorMsg := ControlMessage{
@@ -283,6 +312,20 @@ func sendSuccessResponse(ws *websocket.Conn, message string, data map[string]int
 	sendControlMessage(ws, successMsg)
 }
 
+// checkInputEnabled 按配置的input开关检查是否允许鼠标、键盘和粘贴输入，配置修改后立即生效
+func checkInputEnabled(msgType string) error {
+	cfg := config.GetGlobalConfig()
+	switch {
+	case strings.HasPrefix(msgType, "MOUSE_") && !cfg.IsMouseEnabled():
+		return fmt.Errorf("鼠标控制已禁用")
+	case strings.HasPrefix(msgType, "KEY_") && !cfg.IsKeyboardEnabled():
+		return fmt.Errorf("键盘控制已禁用")
+	case msgType == MSG_CLIPBOARD_PASTE && !cfg.IsPasteEnabled():
+		return fmt.Errorf("粘贴输入已禁用")
+	}
+	return nil
+}
+
 // handleNewControlMessage 处理新格式控制消息
 func handleNewControlMessage(ws *websocket.Conn, msg ControlMessage) error {
 	log.WithField("type", msg.Type).Debug("处理新格式控制消息")
@@ -296,6 +339,10 @@ func handleNewControlMessage(ws *websocket.Conn, msg ControlMessage) error {
 		}).Info("📋 [Agent] 收到剪贴板消息")
 	}
 
+	if err := checkInputEnabled(msg.Type); err != nil {
+		return err
+	}
+
 	switch msg.Type {
 	// 鼠标事件
 	case MSG_MOUSE_MOVE:
@@ -351,6 +398,12 @@ func handleNewControlMessage(ws *websocket.Conn, msg ControlMessage) error {
 	case MSG_SYSTEM_REBOOT:
 		return handleNewSystemReboot()
 
+	// 目录监听
+	case MSG_WATCH_SUBSCRIBE:
+		return handleWatchSubscribe(ws, msg)
+	case MSG_WATCH_UNSUBSCRIBE:
+		return handleWatchUnsubscribe(ws, msg)
+
 	// 坐标映射状态查询
 	case MSG_COORDINATE_MAPPING_STATUS:
 		return handleCoordinateMappingStatus(ws, msg)
@@ -374,10 +427,19 @@ func handleLegacyControlMessage(message string) error {
 	switch msgType {
 	case "5": // 鼠标事件或特殊操作
 		if len(params) > 0 && params[0] == "paste" {
+			if err := checkInputEnabled(MSG_CLIPBOARD_PASTE); err != nil {
+				return err
+			}
 			return handlePasteMessage(params)
 		}
+		if err := checkInputEnabled(MSG_MOUSE_MOVE); err != nil {
+			return err
+		}
 		return handleMouseMessage(params)
 	case "3": // 键盘事件或命令
+		if err := checkInputEnabled(MSG_KEY_PRESS); err != nil {
+			return err
+		}
 		return handleKeyboardOrCommand(params)
 	default:
 		return fmt.Errorf("unknown message type: %s", msgType)
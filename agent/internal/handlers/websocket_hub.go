@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"image"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"winmanager-agent/internal/config"
@@ -28,6 +29,8 @@ var (
 	hubMutex         sync.Mutex
 	running          bool
 	stop             chan struct{}
+
+	encoderReloadPending int32 // 编码器配置已修改，等待流媒体循环重新创建编码器
 )
 
 // Hub 管理所有WebSocket连接
@@ -476,6 +479,24 @@ func initGlobalEncoder() error {
 	return nil
 }
 
+// RequestEncoderReload 编码器配置变化后调用，流媒体循环在下一帧关闭当前编码器并按新配置重新创建
+func RequestEncoderReload() {
+	atomic.StoreInt32(&encoderReloadPending, 1)
+}
+
+// closeGlobalEncoderLocked 关闭当前编码器和视频录制，需持有hubMutex
+func closeGlobalEncoderLocked() {
+	log.Info("编码器配置已修改，重新创建编码器")
+	if globalVideoSaver != nil {
+		globalVideoSaver.StopRecording()
+		globalVideoSaver = nil
+	}
+	if err := globalEncoder.Close(); err != nil {
+		log.WithError(err).Warn("关闭编码器时出现警告")
+	}
+	globalEncoder = nil
+}
+
 // StartGlobalStreaming 启动全局视频流
 func StartGlobalStreaming() error {
 	log.Info("开始启动全局视频流...")
@@ -588,6 +609,8 @@ func globalStreamingLoop() {
 			log.Info("收到停止信号，退出流媒体循环")
 			return
 		default:
+			// 帧率可能已通过配置接口或配置文件修改
+			limiter.SetFPS(cfg.GetFrameRate())
 			limiter.Wait()
 		}
 
@@ -673,6 +696,9 @@ func globalStreamingLoop() {
 
 		// 检查encoder是否可用，如果没有则初始化（线程安全）
 		hubMutex.Lock()
+		if atomic.CompareAndSwapInt32(&encoderReloadPending, 1, 0) && globalEncoder != nil {
+			closeGlobalEncoderLocked()
+		}
 		encoder := globalEncoder
 		encoderJustCreated := false
 		if encoder == nil {
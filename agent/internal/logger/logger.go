@@ -149,6 +149,19 @@ func SetupProductionLogger() {
 	}).Info("生产环境日志已启用")
 }
 
+// SetLevel 按名称设置日志级别（如debug、info、warn），为空时使用info
+func SetLevel(level string) error {
+	if level == "" {
+		level = "info"
+	}
+	parsed, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	log.SetLevel(parsed)
+	return nil
+}
+
 // SetupTestLogger configures logging for testing
 func SetupTestLogger() {
 	log.SetOutput(os.Stdout)
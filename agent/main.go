@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -15,6 +17,8 @@ import (
 	"winmanager-agent/internal/controllers"
 	"winmanager-agent/internal/handlers"
 	"winmanager-agent/internal/logger"
+	"winmanager-agent/pkg/updater"
+	"winmanager-agent/pkg/watchdog"
 	pb "winmanager-agent/protos"
 
 	"github.com/gin-contrib/pprof"
@@ -55,6 +59,11 @@ func main() {
 				Value:   "",
 				Usage:   "Server address for registration",
 			},
+			&cli.StringFlag{
+				Name:  "token",
+				Value: "",
+				Usage: "Enrollment token for first registration (overrides server.enrollment_token)",
+			},
 			&cli.StringFlag{
 				Name:    "grpc",
 				Aliases: []string{"g"},
@@ -69,6 +78,20 @@ func main() {
 			},
 		},
 		Action: runAgent,
+		Commands: []*cli.Command{
+			{
+				Name:  "watchdog",
+				Usage: "Run as watchdog: start the agent and restart it on crash, hang or update",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "attach-pid",
+						Value: 0,
+						Usage: "PID of an already running agent to supervise first",
+					},
+				},
+				Action: runWatchdog,
+			},
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -100,6 +123,9 @@ func runAgent(c *cli.Context) error {
 		logger.SetupDebugLogger()
 	} else {
 		logger.SetupProductionLogger()
+		if err := logger.SetLevel(cfg.GetLogLevel()); err != nil {
+			log.WithError(err).Warn("Invalid log level in config")
+		}
 	}
 
 	log.WithFields(log.Fields{
@@ -110,18 +136,22 @@ func runAgent(c *cli.Context) error {
 	}).Info("正在启动 WinManager Agent")
 
 	// Initialize configuration
+	cfg.SetEnrollmentToken(c.String("token"))
 	if err := cfg.Initialize(c.String("server")); err != nil {
 		log.WithError(err).Fatal("Failed to initialize configuration")
 	}
 
-	// Register with server
-	if err := registerWithServer(cfg); err != nil {
-		log.WithError(err).Fatal("Failed to register with server")
-	}
+	api.SetUpdateHandler(handlers.OfferUpdate)
 
 	// Initialize encoder service
 	handlers.InitEncoderService()
 
+	// 监听配置文件，配置通过接口或文件修改后热加载
+	handlers.InitConfigReload(debugMode)
+
+	// 应用配置的代理并定期检查候选代理，状态上报后端
+	handlers.InitProxyService(api.UpdateProxyStatus)
+
 	// Start metrics recording
 	controllers.StartMetricsRecording()
 
@@ -142,39 +172,171 @@ func runAgent(c *cli.Context) error {
 
 	// Start gRPC server
 	grpcServer := startGRPCServer(grpcAddr)
-	defer grpcServer.GracefulStop()
 
 	// Start HTTP server
 	httpServer := startHTTPServer(httpAddr)
-	defer func() {
+
+	// Register with server in background, retrying until the server is reachable
+	registerWithServer(cfg)
+
+	// Wait for shutdown signal or a downloaded update
+	release, updating := waitForShutdown()
+
+	if grpcServer != nil {
+		if updating {
+			grpcServer.Stop()
+		} else {
+			grpcServer.GracefulStop()
+		}
+	}
+	if httpServer != nil {
 		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer shutdownCancel()
 		if err := httpServer.Shutdown(shutdownCtx); err != nil {
 			log.WithError(err).Error("HTTP server shutdown error")
 		}
-	}()
+		shutdownCancel()
+	}
 
-	// Wait for shutdown signal
-	waitForShutdown()
+	// 端口释放后启动新版本，新版本未能重新注册时回滚并启动旧版本
+	if updating {
+		if err := handlers.HandoverUpdate(release); err != nil {
+			log.WithError(err).Error("Agent 更新失败")
+		}
+		log.Info("Agent 已退出，由新启动的进程接管")
+		return nil
+	}
 
 	log.Info("Agent 已完全关闭")
 	return nil
 }
 
-func registerWithServer(cfg *config.Config) error {
-	log.Info("Registering with server...")
+// runWatchdog 看门狗模式：以相同的全局参数启动Agent并监控，控制接口只监听本机
+func runWatchdog(c *cli.Context) error {
+	cfg := config.GetGlobalConfig()
+	configPath := c.String("config")
+	if err := cfg.LoadConfigFile(configPath); err != nil {
+		log.WithError(err).Fatal("Failed to load configuration file")
+	}
+	if c.Bool("debug") || cfg.IsDebugMode() {
+		logger.SetupDebugLogger()
+	} else {
+		logger.SetupProductionLogger()
+	}
 
-	id, err := api.RegisterAgent(cfg.GetServerURL())
+	exe, err := updater.Executable()
 	if err != nil {
-		return fmt.Errorf("registration failed: %w", err)
+		return fmt.Errorf("获取程序路径失败: %w", err)
 	}
 
-	log.WithField("id", id).Info("Successfully registered with server")
+	// 传递给Agent的全局参数
+	var args []string
+	for _, name := range []string{"config", "server", "grpc", "http"} {
+		if c.IsSet(name) {
+			args = append(args, "--"+name, c.String(name))
+		}
+	}
+	if c.Bool("debug") {
+		args = append(args, "--debug")
+	}
 
-	// Start heartbeat
-	api.StartHeartbeat(cfg.GetServerURL())
+	httpPort := cfg.GetHTTPPort()
+	if addr := c.String("http"); addr != "" {
+		if _, port, err := net.SplitHostPort(addr); err == nil {
+			if p, err := strconv.Atoi(port); err == nil {
+				httpPort = p
+			}
+		}
+	}
 
-	return nil
+	wdCfg := cfg.GetWatchdogConfig()
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+
+	attachPID := c.Int("attach-pid")
+	for {
+		w := watchdog.New(watchdog.Options{
+			Exe:            exe,
+			Args:           args,
+			HealthURL:      fmt.Sprintf("http://127.0.0.1:%d/health", httpPort),
+			HealthInterval: time.Duration(wdCfg.HealthInterval) * time.Second,
+			HealthFailures: wdCfg.HealthFailures,
+			MaxBackoff:     time.Duration(wdCfg.MaxBackoff) * time.Second,
+			TrialTimeout:   time.Duration(cfg.GetUpdateConfig().TrialTimeout) * time.Second,
+			StatePath:      updater.StatePath(exe),
+			AttachPID:      attachPID,
+			Version:        cfg.GetVersion(),
+		})
+
+		listener, err := net.Listen("tcp", watchdog.ControlAddr(wdCfg.Port))
+		if err != nil {
+			return fmt.Errorf("看门狗控制端口监听失败: %w", err)
+		}
+		server := &http.Server{Handler: w.Handler()}
+		go func() {
+			if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Error("看门狗控制接口异常退出")
+			}
+		}()
+
+		done := make(chan struct{})
+		go func() {
+			select {
+			case <-quit:
+				log.Info("收到关闭信号，停止看门狗和Agent")
+				w.Stop(false)
+			case <-done:
+			}
+		}()
+
+		log.WithFields(log.Fields{
+			"版本":   cfg.GetVersion(),
+			"控制地址": watchdog.ControlAddr(wdCfg.Port),
+			"接管进程": attachPID,
+		}).Info("看门狗已启动")
+
+		err = w.Run()
+		close(done)
+		shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 2*time.Second)
+		server.Shutdown(shutdownCtx)
+		shutdownCancel()
+		if !errors.Is(err, watchdog.ErrUpgraded) {
+			log.Info("看门狗已退出")
+			return err
+		}
+
+		// 看门狗仍运行旧版本的程序映像（已重命名为.old），Windows下会占用该文件导致无法删除，
+		// 也会继续报告旧版本号；用新版本重新启动看门狗并接管正在运行的Agent
+		attachPID = w.Status().AgentPID
+		reexecArgs := append(append([]string{}, args...), "watchdog", "--attach-pid", strconv.Itoa(attachPID))
+		log.WithField("agent_pid", attachPID).Info("Agent已更新，切换到新版本看门狗")
+		if err := watchdog.Reexec(exe, reexecArgs); err != nil {
+			log.WithError(err).Error("启动新版本看门狗失败，继续使用当前看门狗")
+			continue
+		}
+		log.Info("看门狗已退出")
+		return nil
+	}
+}
+
+// registerWithServer 在后台注册并发送心跳，服务器不可用时切换后端并按指数退避重试，
+// 心跳发现服务器上没有当前Agent时重新注册
+func registerWithServer(cfg *config.Config) {
+	log.Info("Registering with server...")
+
+	api.StartSession(cfg.GetServerURLs(), func(id int, serverURL string) {
+		log.WithFields(log.Fields{"id": id, "server": serverURL}).Info("Successfully registered with server")
+
+		// 获取并应用后端集中管理的配置，失败时使用本地配置，心跳时重试
+		if err := api.SyncManagedConfig(serverURL); err != nil {
+			log.WithError(err).Warn("Failed to sync managed config")
+		}
+
+		// 重新注册的实例没有代理状态，重新上报
+		handlers.ReportProxyStatus()
+
+		// 更新后的新版本在注册成功后确认更新，旧版本进程随后退出
+		handlers.ConfirmUpdate()
+	})
 }
 
 func startGRPCServer(address string) *grpc.Server {
@@ -250,9 +412,16 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
-func waitForShutdown() {
+// waitForShutdown 等待关闭信号或已完成替换的更新，收到更新时返回true
+func waitForShutdown() (updater.Release, bool) {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Info("收到关闭信号，正在优雅关闭...")
+	select {
+	case <-quit:
+		log.Info("收到关闭信号，正在优雅关闭...")
+		return updater.Release{}, false
+	case release := <-handlers.UpdateReady():
+		log.WithField("version", release.Version).Info("新版本已就绪，正在关闭服务...")
+		return release, true
+	}
 }
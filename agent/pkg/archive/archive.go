@@ -0,0 +1,496 @@
+// Package archive 将目录以zip或tar.gz格式流式打包，以及将上传的压缩包解压到目标目录
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// 支持的压缩格式
+const (
+	FormatZip   = "zip"
+	FormatTarGz = "tar.gz"
+)
+
+var (
+	// ErrTooLarge 超出大小或文件数限制
+	ErrTooLarge = errors.New("超出大小或文件数限制")
+	// ErrUnsafePath 压缩包中包含指向目标目录之外的路径
+	ErrUnsafePath = errors.New("压缩包中包含不安全的路径")
+	// ErrFormat 不支持的压缩格式
+	ErrFormat = errors.New("不支持的压缩格式")
+)
+
+// Options 打包/解压选项
+type Options struct {
+	Include  []string // 包含的文件通配符，为空时包含全部；不含/的模式匹配文件名，含/的模式匹配相对路径
+	Exclude  []string // 排除的文件或目录通配符，匹配规则同Include，目录被排除时跳过整个子树
+	MaxBytes int64    // 文件总大小上限（解压时为解压后的大小），0表示不限制
+	MaxFiles int      // 文件数上限，0表示不限制
+}
+
+// Entry 打包的文件条目
+type Entry struct {
+	Path string // 绝对路径
+	Name string // 压缩包内的相对路径，使用/分隔
+	Info os.FileInfo
+}
+
+// Result 打包或解压统计
+type Result struct {
+	Files   int   `json:"files"`
+	Dirs    int   `json:"dirs"`
+	Bytes   int64 `json:"bytes"`
+	Skipped int   `json:"skipped"` // 解压时跳过的条目（符号链接、已存在且不覆盖的文件等）
+}
+
+// NormalizeFormat 规范化格式名称，支持zip、tar.gz、tgz
+func NormalizeFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "", "zip":
+		return FormatZip, nil
+	case "tar.gz", "tgz", "targz":
+		return FormatTarGz, nil
+	}
+	return "", ErrFormat
+}
+
+// DetectFormat 根据文件名判断压缩格式
+func DetectFormat(filename string) (string, error) {
+	lower := strings.ToLower(filename)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	}
+	return "", ErrFormat
+}
+
+// matchAny 判断相对路径是否匹配任一通配符
+func matchAny(patterns []string, name string) bool {
+	base := path.Base(name)
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		target := base
+		if strings.Contains(pattern, "/") {
+			target = name
+		}
+		if ok, _ := path.Match(pattern, target); ok {
+			return true
+		}
+		// Windows文件名不区分大小写
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(target)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Collect 遍历目录，按通配符筛选要打包的条目并检查大小限制
+// 打包前先完成检查，超出限制时在开始输出之前就能返回错误
+func Collect(root string, opts Options) ([]Entry, *Result, error) {
+	root = filepath.Clean(root)
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &Result{}
+	if !info.IsDir() {
+		// 单个文件打包
+		entry := Entry{Path: root, Name: info.Name(), Info: info}
+		result.Files = 1
+		result.Bytes = info.Size()
+		if opts.MaxBytes > 0 && result.Bytes > opts.MaxBytes {
+			return nil, result, ErrTooLarge
+		}
+		return []Entry{entry}, result, nil
+	}
+
+	var entries []Entry
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			// 无权限读取的子目录跳过，不影响其他文件
+			if p != root && os.IsPermission(err) {
+				result.Skipped++
+				return nil
+			}
+			return err
+		}
+		if p == root {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if matchAny(opts.Exclude, name) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case info.IsDir():
+			entries = append(entries, Entry{Path: p, Name: name, Info: info})
+			result.Dirs++
+		case info.Mode().IsRegular():
+			if len(opts.Include) > 0 && !matchAny(opts.Include, name) {
+				return nil
+			}
+			entries = append(entries, Entry{Path: p, Name: name, Info: info})
+			result.Files++
+			result.Bytes += info.Size()
+			if (opts.MaxBytes > 0 && result.Bytes > opts.MaxBytes) || (opts.MaxFiles > 0 && result.Files > opts.MaxFiles) {
+				return ErrTooLarge
+			}
+		default:
+			// 符号链接和特殊文件不打包
+			result.Skipped++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, result, err
+	}
+
+	if len(opts.Include) > 0 {
+		entries = pruneEmptyDirs(entries, result)
+	}
+	return entries, result, nil
+}
+
+// pruneEmptyDirs 使用Include筛选时去掉不包含任何文件的目录
+func pruneEmptyDirs(entries []Entry, result *Result) []Entry {
+	used := make(map[string]bool)
+	for _, entry := range entries {
+		if entry.Info.IsDir() {
+			continue
+		}
+		for dir := path.Dir(entry.Name); dir != "." && !used[dir]; dir = path.Dir(dir) {
+			used[dir] = true
+		}
+	}
+
+	kept := entries[:0]
+	for _, entry := range entries {
+		if entry.Info.IsDir() && !used[entry.Name] {
+			result.Dirs--
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// Write 将条目按指定格式写入w
+// 打包过程中文件被删除或无法读取时跳过该文件
+func Write(w io.Writer, format string, entries []Entry) error {
+	switch format {
+	case FormatZip:
+		return writeZip(w, entries)
+	case FormatTarGz:
+		return writeTarGz(w, entries)
+	}
+	return ErrFormat
+}
+
+func writeZip(w io.Writer, entries []Entry) error {
+	zw := zip.NewWriter(w)
+	for _, entry := range entries {
+		header, err := zip.FileInfoHeader(entry.Info)
+		if err != nil {
+			return err
+		}
+		header.Name = entry.Name
+		if entry.Info.IsDir() {
+			header.Name += "/"
+			header.Method = zip.Store
+			if _, err := zw.CreateHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+
+		file, err := os.Open(entry.Path)
+		if err != nil {
+			continue
+		}
+		header.Method = zip.Deflate
+		writer, err := zw.CreateHeader(header)
+		if err == nil {
+			_, err = io.Copy(writer, file)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+func writeTarGz(w io.Writer, entries []Entry) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for _, entry := range entries {
+		header, err := tar.FileInfoHeader(entry.Info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = entry.Name
+		if entry.Info.IsDir() {
+			header.Name += "/"
+			if err := tw.WriteHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+
+		file, err := os.Open(entry.Path)
+		if err != nil {
+			continue
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			file.Close()
+			return err
+		}
+		// 文件在打包过程中变短时用0补齐，变长时只写入头部声明的大小，保证tar结构完整
+		n, err := io.Copy(tw, io.LimitReader(file, header.Size))
+		file.Close()
+		if err == nil && n < header.Size {
+			_, err = io.CopyN(tw, zeroReader{}, header.Size-n)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// safeJoin 将压缩包内的路径拼接到目标目录，拒绝绝对路径和指向目录之外的路径
+func safeJoin(dest, name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || filepath.VolumeName(name) != "" || strings.Contains(name, ":") {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+		}
+	}
+
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dest, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return target, nil
+}
+
+// extractor 解压状态
+type extractor struct {
+	dest      string
+	overwrite bool
+	opts      Options
+	result    Result
+}
+
+// dir 创建目录
+func (e *extractor) dir(name string) error {
+	target, err := safeJoin(e.dest, name)
+	if err != nil {
+		return err
+	}
+	if err := e.checkParents(target); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	e.result.Dirs++
+	return nil
+}
+
+// checkParents 确认目标路径的上级目录中没有符号链接，防止借助已有的符号链接写到目标目录之外
+func (e *extractor) checkParents(target string) error {
+	for dir := filepath.Dir(target); dir != e.dest && len(dir) > len(e.dest); dir = filepath.Dir(dir) {
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("%w: %s", ErrUnsafePath, target)
+		}
+	}
+	return nil
+}
+
+// file 写入普通文件，目标已存在且不覆盖时跳过
+func (e *extractor) file(name string, mode os.FileMode, r io.Reader) error {
+	target, err := safeJoin(e.dest, name)
+	if err != nil {
+		return err
+	}
+	if err := e.checkParents(target); err != nil {
+		return err
+	}
+
+	if info, err := os.Lstat(target); err == nil {
+		if !e.overwrite || info.IsDir() {
+			e.result.Skipped++
+			return nil
+		}
+		// 删除已有文件（包括符号链接本身），不跟随链接写入
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+
+	e.result.Files++
+	if e.opts.MaxFiles > 0 && e.result.Files > e.opts.MaxFiles {
+		return ErrTooLarge
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	perm := mode.Perm()
+	if perm == 0 {
+		perm = 0644
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm|0600)
+	if err != nil {
+		return err
+	}
+
+	// 按解压后的实际大小限制，防止压缩炸弹
+	limit := int64(-1)
+	if e.opts.MaxBytes > 0 {
+		limit = e.opts.MaxBytes - e.result.Bytes
+		r = io.LimitReader(r, limit+1)
+	}
+	n, err := io.Copy(out, r)
+	e.result.Bytes += n
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && limit >= 0 && n > limit {
+		err = ErrTooLarge
+	}
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	return nil
+}
+
+// ExtractTarGz 从流中解压tar.gz到目标目录，符号链接、硬链接和特殊文件会被跳过
+func ExtractTarGz(r io.Reader, dest string, overwrite bool, opts Options) (*Result, error) {
+	e, err := newExtractor(dest, overwrite, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	defer gr.Close()
+
+	tr := tar.NewReader(gr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return &e.result, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = e.dir(header.Name)
+		case tar.TypeReg, tar.TypeRegA:
+			err = e.file(header.Name, header.FileInfo().Mode(), tr)
+		default:
+			e.result.Skipped++
+		}
+		if err != nil {
+			return &e.result, err
+		}
+	}
+	return &e.result, nil
+}
+
+// ExtractZip 解压zip文件到目标目录，符号链接和特殊文件会被跳过
+func ExtractZip(r io.ReaderAt, size int64, dest string, overwrite bool, opts Options) (*Result, error) {
+	e, err := newExtractor(dest, overwrite, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+
+	// 先检查所有路径，避免解压到一半才发现不安全的条目
+	for _, file := range zr.File {
+		if _, err := safeJoin(e.dest, file.Name); err != nil {
+			return &e.result, err
+		}
+	}
+
+	for _, file := range zr.File {
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			err = e.dir(file.Name)
+		case mode.IsRegular():
+			var rc io.ReadCloser
+			rc, err = file.Open()
+			if err == nil {
+				err = e.file(file.Name, mode, rc)
+				rc.Close()
+			}
+		default:
+			e.result.Skipped++
+		}
+		if err != nil {
+			return &e.result, err
+		}
+	}
+	return &e.result, nil
+}
+
+func newExtractor(dest string, overwrite bool, opts Options) (*extractor, error) {
+	dest, err := filepath.Abs(dest)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+	return &extractor{dest: dest, overwrite: overwrite, opts: opts}, nil
+}
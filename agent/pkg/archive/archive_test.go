@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// listFiles 列出目录下的所有文件（相对路径）
+func listFiles(t *testing.T, root string) []string {
+	t.Helper()
+	var files []string
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			rel, _ := filepath.Rel(root, p)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files
+}
+
+func TestRoundTripWithFilters(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "app.log"), "log1")
+	writeFile(t, filepath.Join(src, "old", "app.log.1"), "log2")
+	writeFile(t, filepath.Join(src, "sub", "b.LOG"), "log3")
+	writeFile(t, filepath.Join(src, "sub", "data.bin"), "data")
+	writeFile(t, filepath.Join(src, "cache", "x.log"), "cached")
+
+	opts := Options{Include: []string{"*.log"}, Exclude: []string{"cache"}}
+	entries, result, err := Collect(src, opts)
+	if err != nil {
+		t.Fatalf("Collect failed: %v", err)
+	}
+	if result.Files != 2 || result.Bytes != 8 {
+		t.Errorf("Collect result = %+v", result)
+	}
+
+	for _, format := range []string{FormatZip, FormatTarGz} {
+		var buf bytes.Buffer
+		if err := Write(&buf, format, entries); err != nil {
+			t.Fatalf("Write %s failed: %v", format, err)
+		}
+
+		dest := t.TempDir()
+		if format == FormatZip {
+			_, err = ExtractZip(bytes.NewReader(buf.Bytes()), int64(buf.Len()), dest, false, Options{})
+		} else {
+			_, err = ExtractTarGz(&buf, dest, false, Options{})
+		}
+		if err != nil {
+			t.Fatalf("Extract %s failed: %v", format, err)
+		}
+
+		got := listFiles(t, dest)
+		want := []string{"app.log", "sub/b.LOG"}
+		if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("%s extracted %v, want %v", format, got, want)
+		}
+		if _, err := os.Stat(filepath.Join(dest, "old")); !os.IsNotExist(err) {
+			t.Errorf("%s: empty directory not pruned", format)
+		}
+	}
+
+	if _, _, err := Collect(src, Options{MaxBytes: 10}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Collect over limit = %v, want ErrTooLarge", err)
+	}
+}
+
+// tarGz 构造包含指定条目的tar.gz
+func tarGz(t *testing.T, headers ...*tar.Header) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, header := range headers {
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			tw.Write(bytes.Repeat([]byte("x"), int(header.Size)))
+		}
+	}
+	tw.Close()
+	gw.Close()
+	return &buf
+}
+
+func TestExtractRejectsUnsafeEntries(t *testing.T) {
+	dest := t.TempDir()
+
+	for _, name := range []string{"../evil.txt", "/etc/evil.txt", "a/../../evil.txt", "C:/evil.txt"} {
+		buf := tarGz(t, &tar.Header{Name: name, Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+		if _, err := ExtractTarGz(buf, dest, true, Options{}); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("extract %q = %v, want ErrUnsafePath", name, err)
+		}
+	}
+
+	// 符号链接条目被跳过，不会被后续条目利用
+	buf := tarGz(t,
+		&tar.Header{Name: "link", Linkname: "/tmp", Typeflag: tar.TypeSymlink},
+		&tar.Header{Name: "ok.txt", Mode: 0644, Size: 3, Typeflag: tar.TypeReg},
+	)
+	result, err := ExtractTarGz(buf, dest, true, Options{})
+	if err != nil || result.Files != 1 || result.Skipped != 1 {
+		t.Errorf("extract with symlink = %+v, %v", result, err)
+	}
+
+	// 已存在的符号链接目录不能被用来写到目标目录之外
+	outside := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(dest, "escape")); err == nil {
+		buf = tarGz(t, &tar.Header{Name: "escape/evil.txt", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+		if _, err := ExtractTarGz(buf, dest, true, Options{}); !errors.Is(err, ErrUnsafePath) {
+			t.Errorf("extract through symlink = %v, want ErrUnsafePath", err)
+		}
+		if files := listFiles(t, outside); len(files) != 0 {
+			t.Errorf("files written outside destination: %v", files)
+		}
+	}
+
+	// 解压后大小超过限制
+	buf = tarGz(t, &tar.Header{Name: "big.bin", Mode: 0644, Size: 1000, Typeflag: tar.TypeReg})
+	if _, err := ExtractTarGz(buf, dest, true, Options{MaxBytes: 100}); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("extract over limit = %v, want ErrTooLarge", err)
+	}
+	if _, err := os.Stat(filepath.Join(dest, "big.bin")); !os.IsNotExist(err) {
+		t.Error("partial file left after limit exceeded")
+	}
+}
@@ -0,0 +1,82 @@
+package backoff
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 默认参数
+const (
+	DefaultInitial = 5 * time.Second
+	DefaultMax     = 5 * time.Minute
+	DefaultFactor  = 2.0
+	DefaultJitter  = 0.2
+)
+
+// Backoff 指数退避：每次失败后的等待时间按Factor增长到Max为止，
+// 并随机减少最多Jitter比例，避免大量Agent在服务器恢复时同时重试
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+	Factor  float64
+	Jitter  float64 // 0到1之间
+
+	mu      sync.Mutex
+	attempt int
+	rand    func() float64
+}
+
+// New 创建指数退避，参数不大于0时使用默认值
+func New(initial, max time.Duration) *Backoff {
+	if initial <= 0 {
+		initial = DefaultInitial
+	}
+	if max <= 0 {
+		max = DefaultMax
+	}
+	if max < initial {
+		max = initial
+	}
+	return &Backoff{
+		Initial: initial,
+		Max:     max,
+		Factor:  DefaultFactor,
+		Jitter:  DefaultJitter,
+		rand:    rand.Float64,
+	}
+}
+
+// Next 返回下一次重试前的等待时间并增加失败次数
+func (b *Backoff) Next() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delay := float64(b.Initial)
+	for i := 0; i < b.attempt && delay < float64(b.Max); i++ {
+		delay *= b.Factor
+	}
+	if delay > float64(b.Max) {
+		delay = float64(b.Max)
+	}
+	b.attempt++
+
+	if b.Jitter > 0 && b.rand != nil {
+		delay -= delay * b.Jitter * b.rand()
+	}
+	return time.Duration(delay)
+}
+
+// Attempt 返回连续失败的次数
+func (b *Backoff) Attempt() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.attempt
+}
+
+// Reset 成功后调用，下一次失败重新从Initial开始
+func (b *Backoff) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.attempt = 0
+}
@@ -0,0 +1,55 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextWithoutJitter(t *testing.T) {
+	b := New(time.Second, 10*time.Second)
+	b.Jitter = 0
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, expected := range want {
+		if got := b.Next(); got != expected {
+			t.Errorf("attempt %d: got %v, want %v", i, got, expected)
+		}
+	}
+	if b.Attempt() != len(want) {
+		t.Errorf("Attempt() = %d, want %d", b.Attempt(), len(want))
+	}
+
+	b.Reset()
+	if got := b.Next(); got != time.Second {
+		t.Errorf("after Reset: got %v, want 1s", got)
+	}
+}
+
+func TestJitterStaysWithinBounds(t *testing.T) {
+	b := New(time.Second, time.Minute)
+	for i := 0; i < 100; i++ {
+		b.Reset()
+		for j := 0; j < 8; j++ {
+			ceiling := time.Second << uint(j)
+			if ceiling > time.Minute {
+				ceiling = time.Minute
+			}
+			floor := time.Duration(float64(ceiling) * (1 - DefaultJitter))
+			if got := b.Next(); got < floor || got > ceiling {
+				t.Fatalf("attempt %d: %v not in [%v, %v]", j, got, floor, ceiling)
+			}
+		}
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	b := New(0, 0)
+	if b.Initial != DefaultInitial || b.Max != DefaultMax {
+		t.Errorf("defaults = %v/%v, want %v/%v", b.Initial, b.Max, DefaultInitial, DefaultMax)
+	}
+
+	b = New(time.Minute, time.Second)
+	if b.Max != time.Minute {
+		t.Errorf("Max smaller than Initial should be raised, got %v", b.Max)
+	}
+}
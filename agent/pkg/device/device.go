@@ -13,6 +13,8 @@ import (
 	"strings"
 	"time"
 
+	"winmanager-agent/pkg/proxy"
+
 	"github.com/denisbrodbeck/machineid"
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/host"
@@ -212,19 +214,7 @@ func GetRAMInfo() (uint64, error) {
 }
 
 // HasProxy checks if the system is configured to use a proxy
+// 检查代理环境变量，Windows上还检查系统代理设置
 func HasProxy() bool {
-	// Check common proxy environment variables
-	proxyVars := []string{"HTTP_PROXY", "HTTPS_PROXY", "http_proxy", "https_proxy"}
-	for _, envVar := range proxyVars {
-		if os.Getenv(envVar) != "" {
-			return true
-		}
-	}
-
-	// TODO: Add platform-specific proxy detection
-	// For Windows: check registry settings
-	// For macOS: check system preferences
-	// For Linux: check various config files
-
-	return false
+	return proxy.SystemProxy() != ""
 }
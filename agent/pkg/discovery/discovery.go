@@ -0,0 +1,208 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"time"
+)
+
+// 发现协议的消息类型，与后端的services/discovery.go一致
+const (
+	QueryType = "winmanager.discover"
+	ReplyType = "winmanager.server"
+)
+
+// DefaultPort 后端默认监听的发现端口
+const DefaultPort = 9099
+
+// DefaultTimeout 未指定时等待回复的时间
+const DefaultTimeout = 3 * time.Second
+
+// 回复报文的最大长度
+const maxPacket = 2048
+
+// ErrNoServer 等待时间内没有后端回复
+var ErrNoServer = errors.New("no server answered the discovery query")
+
+// Query Agent广播的查询
+type Query struct {
+	Type     string `json:"type"`
+	Hostname string `json:"hostname"`
+}
+
+// Server 回复查询的后端
+type Server struct {
+	URL            string `json:"url"`
+	Name           string `json:"name,omitempty"`
+	EnrollmentHint string `json:"enrollment_hint,omitempty"` // 后端给出的注册提示
+	From           string `json:"-"`                         // 回复的来源地址
+}
+
+// reply 后端的回复报文
+type reply struct {
+	Type string `json:"type"`
+	Server
+}
+
+// Options 发现参数
+type Options struct {
+	Port      int           // 后端监听的发现端口，0使用DefaultPort
+	Multicast string        // 组播地址，设置后同时向该组播组发送查询
+	Targets   []string      // 额外的查询目标地址(IP)，为空时只使用广播和组播
+	Timeout   time.Duration // 等待回复的时间，0使用DefaultTimeout
+	Hostname  string
+}
+
+// Discover 向局域网广播（及组播）查询，在超时前收集所有后端的回复，
+// 按回复的先后顺序返回，相同地址只保留一次；没有回复时返回ErrNoServer
+func Discover(ctx context.Context, opts Options) ([]Server, error) {
+	port := opts.Port
+	if port <= 0 {
+		port = DefaultPort
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	query, err := json.Marshal(Query{Type: QueryType, Hostname: opts.Hostname})
+	if err != nil {
+		return nil, err
+	}
+
+	var sent int
+	var sendErr error
+	for _, ip := range targets(opts) {
+		if _, err := conn.WriteToUDP(query, &net.UDPAddr{IP: ip, Port: port}); err != nil {
+			sendErr = err
+			continue
+		}
+		sent++
+	}
+	if sent == 0 {
+		if sendErr == nil {
+			sendErr = ErrNoServer
+		}
+		return nil, sendErr
+	}
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+
+	// ctx取消时立即结束读取
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	var servers []Server
+	seen := make(map[string]bool)
+	buf := make([]byte, maxPacket)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			break
+		}
+		var r reply
+		if err := json.Unmarshal(buf[:n], &r); err != nil || r.Type != ReplyType || r.URL == "" || seen[r.URL] {
+			continue
+		}
+		seen[r.URL] = true
+		r.Server.From = from.IP.String()
+		servers = append(servers, r.Server)
+	}
+
+	if len(servers) == 0 {
+		return nil, ErrNoServer
+	}
+	return servers, nil
+}
+
+// targets 查询的目标地址：受限广播、各网卡的子网广播、组播地址和指定的地址
+func targets(opts Options) []net.IP {
+	var result []net.IP
+	seen := make(map[string]bool)
+	add := func(ip net.IP) {
+		if ip == nil || seen[ip.String()] {
+			return
+		}
+		seen[ip.String()] = true
+		result = append(result, ip)
+	}
+
+	for _, target := range opts.Targets {
+		add(net.ParseIP(target).To4())
+	}
+	if len(opts.Targets) > 0 {
+		return result
+	}
+
+	add(net.IPv4bcast)
+	for _, ip := range interfaceBroadcasts() {
+		add(ip)
+	}
+	if opts.Multicast != "" {
+		if group := net.ParseIP(opts.Multicast); group != nil && group.IsMulticast() {
+			add(group.To4())
+		}
+	}
+	return result
+}
+
+// interfaceBroadcasts 返回已启用的IPv4网卡的子网广播地址，
+// 受限广播只从默认路由的网卡发出，多网卡时需要逐个子网发送
+func interfaceBroadcasts() []net.IP {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	var result []net.IP
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			if b := Broadcast(ipNet); b != nil {
+				result = append(result, b)
+			}
+		}
+	}
+	return result
+}
+
+// Broadcast 计算IPv4子网的广播地址，不是IPv4时返回nil
+func Broadcast(ipNet *net.IPNet) net.IP {
+	ip := ipNet.IP.To4()
+	if ip == nil || len(ipNet.Mask) != net.IPv4len {
+		return nil
+	}
+	b := make(net.IP, net.IPv4len)
+	for i := range ip {
+		b[i] = ip[i] | ^ipNet.Mask[i]
+	}
+	return b
+}
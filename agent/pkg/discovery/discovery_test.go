@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// startResponder 在本机启动一个回复固定地址的后端，返回监听端口
+func startResponder(t *testing.T, urls ...string) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, maxPacket)
+		for {
+			n, from, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			var q Query
+			if err := json.Unmarshal(buf[:n], &q); err != nil || q.Type != QueryType {
+				continue
+			}
+			conn.WriteToUDP([]byte(`not json`), from)
+			for _, url := range urls {
+				data, _ := json.Marshal(reply{Type: ReplyType, Server: Server{URL: url, Name: q.Hostname, EnrollmentHint: "token"}})
+				conn.WriteToUDP(data, from)
+			}
+		}
+	}()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestDiscover(t *testing.T) {
+	port := startResponder(t, "http://10.0.0.1:9090", "http://10.0.0.1:9090", "http://10.0.0.2:9090")
+
+	servers, err := Discover(context.Background(), Options{
+		Port:     port,
+		Targets:  []string{"127.0.0.1"},
+		Timeout:  300 * time.Millisecond,
+		Hostname: "pc-01",
+	})
+	if err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	if len(servers) != 2 {
+		t.Fatalf("got %d servers, want 2 (duplicates removed): %+v", len(servers), servers)
+	}
+	if servers[0].URL != "http://10.0.0.1:9090" || servers[1].URL != "http://10.0.0.2:9090" {
+		t.Errorf("servers should keep reply order, got %+v", servers)
+	}
+	if servers[0].Name != "pc-01" || servers[0].EnrollmentHint != "token" || servers[0].From != "127.0.0.1" {
+		t.Errorf("unexpected server fields: %+v", servers[0])
+	}
+}
+
+func TestDiscoverNoServer(t *testing.T) {
+	// 绑定后立即关闭，得到一个没有监听的端口
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+	conn.Close()
+
+	_, err = Discover(context.Background(), Options{Port: port, Targets: []string{"127.0.0.1"}, Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, ErrNoServer) {
+		t.Errorf("Discover() error = %v, want ErrNoServer", err)
+	}
+}
+
+func TestDiscoverContextCanceled(t *testing.T) {
+	port := startResponder(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	_, err := Discover(ctx, Options{Port: port, Targets: []string{"127.0.0.1"}, Timeout: 5 * time.Second})
+	if !errors.Is(err, ErrNoServer) {
+		t.Errorf("Discover() error = %v, want ErrNoServer", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("Discover should return as soon as the context is canceled")
+	}
+}
+
+func TestBroadcast(t *testing.T) {
+	_, ipNet, _ := net.ParseCIDR("192.168.10.37/24")
+	ipNet.IP = net.ParseIP("192.168.10.37")
+	if got := Broadcast(ipNet); !got.Equal(net.ParseIP("192.168.10.255")) {
+		t.Errorf("Broadcast() = %v, want 192.168.10.255", got)
+	}
+
+	_, ipNet, _ = net.ParseCIDR("172.17.0.0/20")
+	if got := Broadcast(ipNet); !got.Equal(net.ParseIP("172.17.15.255")) {
+		t.Errorf("Broadcast() = %v, want 172.17.15.255", got)
+	}
+
+	_, ipNet, _ = net.ParseCIDR("fd00::/64")
+	if got := Broadcast(ipNet); got != nil {
+		t.Errorf("Broadcast() of IPv6 = %v, want nil", got)
+	}
+}
+
+func TestTargets(t *testing.T) {
+	got := targets(Options{Targets: []string{"10.0.0.5", "bad", "10.0.0.5"}})
+	if len(got) != 1 || !got[0].Equal(net.ParseIP("10.0.0.5")) {
+		t.Errorf("explicit targets = %v, want only 10.0.0.5", got)
+	}
+
+	got = targets(Options{Multicast: "239.255.90.90"})
+	if !got[0].Equal(net.IPv4bcast) {
+		t.Errorf("first target = %v, want limited broadcast", got[0])
+	}
+	if last := got[len(got)-1]; !last.Equal(net.ParseIP("239.255.90.90")) {
+		t.Errorf("last target = %v, want multicast group", last)
+	}
+}
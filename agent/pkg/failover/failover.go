@@ -0,0 +1,161 @@
+package failover
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultFailbackAfter 高优先级后端连续多少次健康检查成功后切回
+const DefaultFailbackAfter = 2
+
+// CheckFunc 检查后端是否可用
+type CheckFunc func(ctx context.Context, url string) error
+
+// Backend 一个后端的健康状态
+type Backend struct {
+	URL       string     `json:"url"`
+	Priority  int        `json:"priority"` // 在配置列表中的位置，0优先级最高
+	Current   bool       `json:"current"`  // 当前连接的后端
+	Healthy   bool       `json:"healthy"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+	successes int
+}
+
+// Pool 按优先级排列的后端列表：当前后端出错时切换到下一个，
+// 优先级更高的后端恢复后切回
+type Pool struct {
+	mu            sync.Mutex
+	backends      []*Backend
+	current       int
+	check         CheckFunc
+	failbackAfter int
+}
+
+// New 创建后端列表，urls按优先级排列，重复的地址只保留第一个
+func New(urls []string, check CheckFunc) *Pool {
+	p := &Pool{check: check, failbackAfter: DefaultFailbackAfter}
+	seen := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		p.backends = append(p.backends, &Backend{URL: url, Priority: len(p.backends), Healthy: true})
+	}
+	return p
+}
+
+// Len 返回后端数量
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.backends)
+}
+
+// Current 返回当前连接的后端地址，列表为空时返回空字符串
+func (p *Pool) Current() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.backends) == 0 {
+		return ""
+	}
+	return p.backends[p.current].URL
+}
+
+// Primary 当前是否连接优先级最高的后端
+func (p *Pool) Primary() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.current == 0
+}
+
+// Succeeded 当前后端请求成功
+func (p *Pool) Succeeded() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.backends) == 0 {
+		return
+	}
+	p.markLocked(p.backends[p.current], nil)
+}
+
+// Failover 当前后端请求失败：标记为不可用并切换到下一个后端，
+// 返回新的后端地址；wrapped表示从最后一个回到了第一个，即所有后端都已尝试过一轮
+func (p *Pool) Failover(err error) (url string, wrapped bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.backends) == 0 {
+		return "", true
+	}
+	p.markLocked(p.backends[p.current], err)
+	p.current = (p.current + 1) % len(p.backends)
+	return p.backends[p.current].URL, p.current == 0
+}
+
+// CheckAll 检查所有后端的健康状态
+func (p *Pool) CheckAll(ctx context.Context) []Backend {
+	p.mu.Lock()
+	backends := make([]*Backend, len(p.backends))
+	copy(backends, p.backends)
+	p.mu.Unlock()
+
+	errs := make([]error, len(backends))
+	var wg sync.WaitGroup
+	for i, backend := range backends {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			errs[i] = p.check(ctx, url)
+		}(i, backend.URL)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	for i, backend := range backends {
+		p.markLocked(backend, errs[i])
+	}
+	p.mu.Unlock()
+	return p.Status()
+}
+
+// Failback 优先级比当前后端高且连续健康检查成功的后端存在时切换过去，返回是否切换
+func (p *Pool) Failback() (url string, switched bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i < p.current; i++ {
+		if backend := p.backends[i]; backend.Healthy && backend.successes >= p.failbackAfter {
+			p.current = i
+			return backend.URL, true
+		}
+	}
+	return "", false
+}
+
+// Status 返回所有后端的状态
+func (p *Pool) Status() []Backend {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	result := make([]Backend, len(p.backends))
+	for i, backend := range p.backends {
+		result[i] = *backend
+		result[i].Current = i == p.current
+	}
+	return result
+}
+
+// markLocked 记录一次请求或健康检查的结果
+func (p *Pool) markLocked(backend *Backend, err error) {
+	now := time.Now()
+	backend.CheckedAt = &now
+	if err != nil {
+		backend.Healthy = false
+		backend.Error = err.Error()
+		backend.successes = 0
+		return
+	}
+	backend.Healthy = true
+	backend.Error = ""
+	backend.successes++
+}
@@ -0,0 +1,118 @@
+package failover
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// fakeChecker 按地址返回预设的检查结果
+type fakeChecker struct {
+	mu   sync.Mutex
+	down map[string]bool
+}
+
+func (f *fakeChecker) set(url string, down bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.down[url] = down
+}
+
+func (f *fakeChecker) check(ctx context.Context, url string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down[url] {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+
+func TestNewDeduplicates(t *testing.T) {
+	p := New([]string{"http://a", "", "http://b", "http://a"}, nil)
+	if p.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", p.Len())
+	}
+	if p.Current() != "http://a" {
+		t.Errorf("Current() = %q, want first url", p.Current())
+	}
+
+	empty := New(nil, nil)
+	if empty.Current() != "" {
+		t.Errorf("empty pool Current() = %q", empty.Current())
+	}
+	if _, wrapped := empty.Failover(errors.New("x")); !wrapped {
+		t.Error("empty pool Failover should report wrapped")
+	}
+}
+
+func TestFailoverCycles(t *testing.T) {
+	p := New([]string{"http://a", "http://b", "http://c"}, nil)
+
+	url, wrapped := p.Failover(errors.New("down"))
+	if url != "http://b" || wrapped {
+		t.Errorf("first failover = %q/%v, want http://b/false", url, wrapped)
+	}
+	url, wrapped = p.Failover(errors.New("down"))
+	if url != "http://c" || wrapped {
+		t.Errorf("second failover = %q/%v, want http://c/false", url, wrapped)
+	}
+	url, wrapped = p.Failover(errors.New("down"))
+	if url != "http://a" || !wrapped {
+		t.Errorf("third failover = %q/%v, want http://a/true", url, wrapped)
+	}
+
+	status := p.Status()
+	if status[1].Healthy || status[1].Error != "down" {
+		t.Errorf("failed backend should be unhealthy with error, got %+v", status[1])
+	}
+	if !status[0].Current {
+		t.Error("status should mark the current backend")
+	}
+}
+
+func TestFailback(t *testing.T) {
+	checker := &fakeChecker{down: map[string]bool{"http://a": true}}
+	p := New([]string{"http://a", "http://b"}, checker.check)
+
+	p.Failover(errors.New("down"))
+	if p.Current() != "http://b" {
+		t.Fatalf("Current() = %q, want http://b", p.Current())
+	}
+
+	p.CheckAll(context.Background())
+	if _, switched := p.Failback(); switched {
+		t.Fatal("should not fail back to an unhealthy backend")
+	}
+
+	checker.set("http://a", false)
+	p.CheckAll(context.Background())
+	if _, switched := p.Failback(); switched {
+		t.Fatal("should wait for consecutive successful checks before failing back")
+	}
+
+	p.CheckAll(context.Background())
+	url, switched := p.Failback()
+	if !switched || url != "http://a" {
+		t.Fatalf("Failback() = %q/%v, want http://a/true", url, switched)
+	}
+	if !p.Primary() {
+		t.Error("Primary() should be true after failing back")
+	}
+	if _, switched := p.Failback(); switched {
+		t.Error("already on the highest priority backend")
+	}
+}
+
+func TestSucceededResetsHealth(t *testing.T) {
+	p := New([]string{"http://a", "http://b"}, nil)
+	p.Failover(errors.New("down"))
+	p.Failover(errors.New("down"))
+	if p.Status()[0].Healthy {
+		t.Fatal("backend should be unhealthy after failure")
+	}
+	p.Succeeded()
+	if status := p.Status()[0]; !status.Healthy || status.Error != "" {
+		t.Errorf("backend should be healthy after success, got %+v", status)
+	}
+}
@@ -0,0 +1,416 @@
+// Package fsutil 提供远程文件管理所需的文件系统操作
+package fsutil
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+var (
+	// ErrExists 目标已存在且未允许覆盖
+	ErrExists = errors.New("目标已存在")
+	// ErrNotEmpty 目录非空且未指定递归删除
+	ErrNotEmpty = errors.New("目录非空")
+	// ErrRootPath 不允许对根目录或盘符根目录执行的操作
+	ErrRootPath = errors.New("不允许操作根目录")
+	// ErrIntoSelf 不能将目录复制或移动到自身内部
+	ErrIntoSelf = errors.New("不能将目录复制或移动到自身内部")
+	// ErrSameFile 源和目标是同一个文件
+	ErrSameFile = errors.New("源和目标是同一个文件")
+	// ErrIsAncestor 目标是源的上级目录，覆盖目标会删除源
+	ErrIsAncestor = errors.New("不能将文件或目录复制或移动到它的上级目录")
+)
+
+// FileInfo 文件或目录信息
+type FileInfo struct {
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	Size       int64     `json:"size"`
+	IsDir      bool      `json:"is_dir"`
+	IsSymlink  bool      `json:"is_symlink"`
+	LinkTarget string    `json:"link_target,omitempty"`
+	Mode       string    `json:"mode"` // 例如 drwxr-xr-x
+	Perm       string    `json:"perm"` // 八进制权限，例如 0755
+	ModTime    time.Time `json:"mod_time"`
+	Hidden     bool      `json:"hidden"`
+}
+
+// Drive 磁盘分区或挂载点
+type Drive struct {
+	Path       string  `json:"path"`
+	Device     string  `json:"device"`
+	FSType     string  `json:"fs_type"`
+	Total      uint64  `json:"total"`
+	Free       uint64  `json:"free"`
+	Used       uint64  `json:"used"`
+	UsedPct    float64 `json:"used_percent"`
+	ReadOnly   bool    `json:"read_only"`
+	Accessible bool    `json:"accessible"`
+}
+
+// newFileInfo 根据Lstat结果构建文件信息，符号链接同时给出目标的类型和大小
+func newFileInfo(path string, info os.FileInfo) FileInfo {
+	item := FileInfo{
+		Name:    info.Name(),
+		Path:    path,
+		Size:    info.Size(),
+		IsDir:   info.IsDir(),
+		Mode:    info.Mode().String(),
+		Perm:    fmt.Sprintf("%04o", info.Mode().Perm()),
+		ModTime: info.ModTime(),
+		Hidden:  isHidden(path, info),
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		item.IsSymlink = true
+		if target, err := os.Readlink(path); err == nil {
+			item.LinkTarget = target
+		}
+		if targetInfo, err := os.Stat(path); err == nil {
+			item.IsDir = targetInfo.IsDir()
+			item.Size = targetInfo.Size()
+		}
+	}
+	return item
+}
+
+// Stat 获取文件或目录信息
+func Stat(path string) (*FileInfo, error) {
+	path = filepath.Clean(path)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	item := newFileInfo(path, info)
+	return &item, nil
+}
+
+// List 列出目录内容，目录在前，按名称排序
+// 单个条目读取失败（例如权限不足）时跳过该条目，不影响整个目录
+func List(dir string, showHidden bool) ([]FileInfo, error) {
+	dir = filepath.Clean(dir)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		item := newFileInfo(path, info)
+		if item.Hidden && !showHidden {
+			continue
+		}
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if items[i].IsDir != items[j].IsDir {
+			return items[i].IsDir
+		}
+		return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
+	})
+	return items, nil
+}
+
+// Mkdir 创建目录，parents为true时同时创建上级目录
+func Mkdir(path string, parents bool) error {
+	path = filepath.Clean(path)
+	if parents {
+		return os.MkdirAll(path, 0755)
+	}
+	return os.Mkdir(path, 0755)
+}
+
+// isRoot 判断路径是否为根目录或盘符根目录
+func isRoot(path string) bool {
+	path = filepath.Clean(path)
+	return filepath.Dir(path) == path
+}
+
+// isWithin 判断target是否位于dir内部（含dir本身）
+func isWithin(dir, target string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(target))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// prepareTarget 检查目标路径，目标已存在时按overwrite决定报错或移到备份，返回备份路径；
+// 目标是源的上级目录时拒绝，避免删除目标时连同源一起删除
+func prepareTarget(src, dst string, overwrite bool) (string, error) {
+	if isRoot(src) || isRoot(dst) {
+		return "", ErrRootPath
+	}
+
+	if _, err := os.Lstat(dst); err == nil {
+		if sameFile(src, dst) {
+			return "", ErrSameFile
+		}
+		if isWithin(dst, src) {
+			return "", ErrIsAncestor
+		}
+		if !overwrite {
+			return "", ErrExists
+		}
+		return backupTarget(dst)
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	return "", nil
+}
+
+// backupTarget 将要覆盖的目标移到同目录下的临时备份目录中，操作完成前不删除
+func backupTarget(dst string) (string, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".backup-")
+	if err != nil {
+		return "", err
+	}
+	backup := filepath.Join(dir, filepath.Base(dst))
+	if err := os.Rename(dst, backup); err != nil {
+		os.Remove(dir)
+		return "", err
+	}
+	return backup, nil
+}
+
+// finishTarget 操作成功时删除备份；失败时删除不完整的目标并恢复备份
+func finishTarget(dst, backup string, err error) error {
+	if backup == "" {
+		return err
+	}
+	if err == nil {
+		os.RemoveAll(filepath.Dir(backup))
+		return nil
+	}
+
+	os.RemoveAll(dst)
+	if restoreErr := os.Rename(backup, dst); restoreErr != nil {
+		return fmt.Errorf("%w（恢复原目标失败: %v，原目标保存在 %s）", err, restoreErr, backup)
+	}
+	os.Remove(filepath.Dir(backup))
+	return err
+}
+
+// sameFile 判断两个路径是否指向同一个文件
+func sameFile(a, b string) bool {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ai, bi)
+}
+
+// Move 移动或重命名文件或目录；跨分区时退化为复制后删除
+// 覆盖已存在的目标时，移动成功后才删除原目标，失败时恢复原目标
+func Move(src, dst string, overwrite bool) error {
+	src, dst = filepath.Clean(src), filepath.Clean(dst)
+	if src == dst {
+		return nil
+	}
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && isWithin(src, dst) {
+		return ErrIntoSelf
+	}
+	backup, err := prepareTarget(src, dst, overwrite)
+	if err != nil {
+		if errors.Is(err, ErrSameFile) {
+			// 不区分大小写的文件系统上仅修改大小写的重命名
+			return os.Rename(src, dst)
+		}
+		return err
+	}
+
+	err = os.Rename(src, dst)
+	if err == nil || !isCrossDevice(err) {
+		return finishTarget(dst, backup, err)
+	}
+
+	if err := Copy(src, dst, false); err != nil {
+		os.RemoveAll(dst)
+		return finishTarget(dst, backup, err)
+	}
+	if err := finishTarget(dst, backup, nil); err != nil {
+		return err
+	}
+	return os.RemoveAll(src)
+}
+
+// Copy 复制文件或目录（递归），保留权限和修改时间；符号链接按链接本身复制
+// 覆盖已存在的目标时，复制成功后才删除原目标，失败时恢复原目标
+func Copy(src, dst string, overwrite bool) error {
+	src, dst = filepath.Clean(src), filepath.Clean(dst)
+
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() && isWithin(src, dst) {
+		return ErrIntoSelf
+	}
+	backup, err := prepareTarget(src, dst, overwrite)
+	if err != nil {
+		return err
+	}
+	return finishTarget(dst, backup, copyPath(src, dst, info))
+}
+
+// copyPath 复制单个路径，目录时递归复制子项
+func copyPath(src, dst string, info os.FileInfo) error {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+
+	case info.IsDir():
+		if err := os.Mkdir(dst, info.Mode().Perm()|0700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			childInfo, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			if err := copyPath(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()), childInfo); err != nil {
+				return err
+			}
+		}
+		os.Chmod(dst, info.Mode().Perm())
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+
+	case info.Mode().IsRegular():
+		return copyFile(src, dst, info)
+
+	default:
+		return fmt.Errorf("不支持复制特殊文件: %s", src)
+	}
+}
+
+// copyFile 复制普通文件
+func copyFile(src, dst string, info os.FileInfo) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
+// Remove 删除文件或目录；非空目录必须指定recursive，根目录不允许删除
+func Remove(path string, recursive bool) error {
+	path = filepath.Clean(path)
+	if isRoot(path) {
+		return ErrRootPath
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	if info.IsDir() && !recursive {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 {
+			return ErrNotEmpty
+		}
+	}
+
+	if recursive {
+		return os.RemoveAll(path)
+	}
+	return os.Remove(path)
+}
+
+// 不在盘符列表中显示的伪文件系统
+var pseudoFSTypes = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true,
+	"cgroup": true, "cgroup2": true, "securityfs": true, "pstore": true, "debugfs": true,
+	"tracefs": true, "configfs": true, "fusectl": true, "mqueue": true, "hugetlbfs": true,
+	"bpf": true, "autofs": true, "overlay": true, "squashfs": true, "nsfs": true,
+	"binfmt_misc": true, "rpc_pipefs": true, "efivarfs": true, "devfs": true,
+}
+
+// Drives 列出磁盘分区（Windows下为盘符，其他系统为挂载点）
+func Drives() ([]Drive, error) {
+	partitions, err := disk.Partitions(false)
+	if err != nil {
+		return nil, err
+	}
+
+	drives := make([]Drive, 0, len(partitions))
+	seen := make(map[string]bool)
+	for _, partition := range partitions {
+		if pseudoFSTypes[partition.Fstype] || seen[partition.Mountpoint] {
+			continue
+		}
+		seen[partition.Mountpoint] = true
+
+		drive := Drive{
+			Path:   partition.Mountpoint,
+			Device: partition.Device,
+			FSType: partition.Fstype,
+		}
+		for _, opt := range partition.Opts {
+			if opt == "ro" {
+				drive.ReadOnly = true
+			}
+		}
+		// 光驱等未就绪的盘符获取容量会失败，仍然列出但标记为不可访问
+		if usage, err := disk.Usage(partition.Mountpoint); err == nil {
+			drive.Total = usage.Total
+			drive.Free = usage.Free
+			drive.Used = usage.Used
+			drive.UsedPct = usage.UsedPercent
+			drive.Accessible = true
+		}
+		drives = append(drives, drive)
+	}
+
+	sort.Slice(drives, func(i, j int) bool { return drives[i].Path < drives[j].Path })
+	return drives, nil
+}
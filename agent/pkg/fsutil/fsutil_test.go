@@ -0,0 +1,178 @@
+package fsutil
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// writeFile 创建测试文件
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+}
+
+func TestListSortsDirectoriesFirst(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "b.txt"), "b")
+	writeFile(t, filepath.Join(dir, "A.txt"), "aa")
+	writeFile(t, filepath.Join(dir, ".hidden"), "h")
+	if err := os.Mkdir(filepath.Join(dir, "zdir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := List(dir, false)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+	}
+	want := []string{"zdir", "A.txt", "b.txt"}
+	if len(names) != len(want) {
+		t.Fatalf("List = %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("List = %v, want %v", names, want)
+		}
+	}
+	if items[1].Size != 2 {
+		t.Errorf("A.txt size = %d, want 2", items[1].Size)
+	}
+
+	items, err = List(dir, true)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(items) != 4 {
+		t.Errorf("List with hidden returned %d items, want 4", len(items))
+	}
+}
+
+func TestCopyDirectory(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "hello")
+	writeFile(t, filepath.Join(src, "sub", "b.txt"), "world")
+
+	dst := filepath.Join(dir, "dst")
+	if err := Copy(src, dst, false); err != nil {
+		t.Fatalf("Copy failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dst, "sub", "b.txt"))
+	if err != nil || string(data) != "world" {
+		t.Fatalf("copied file = %q, %v", data, err)
+	}
+
+	if err := Copy(src, dst, false); !errors.Is(err, ErrExists) {
+		t.Errorf("Copy onto existing target = %v, want ErrExists", err)
+	}
+	if err := Copy(src, filepath.Join(src, "sub", "inner"), false); !errors.Is(err, ErrIntoSelf) {
+		t.Errorf("Copy into itself = %v, want ErrIntoSelf", err)
+	}
+
+	writeFile(t, filepath.Join(src, "a.txt"), "changed")
+	if err := Copy(src, dst, true); err != nil {
+		t.Fatalf("Copy with overwrite failed: %v", err)
+	}
+	data, _ = os.ReadFile(filepath.Join(dst, "a.txt"))
+	if string(data) != "changed" {
+		t.Errorf("overwritten file = %q, want changed", data)
+	}
+}
+
+func TestCopyAndMoveOntoAncestor(t *testing.T) {
+	dir := t.TempDir()
+	parent := filepath.Join(dir, "a")
+	src := filepath.Join(parent, "b")
+	writeFile(t, filepath.Join(src, "c.txt"), "keep")
+
+	if err := Copy(src, parent, true); !errors.Is(err, ErrIsAncestor) {
+		t.Errorf("Copy onto ancestor = %v, want ErrIsAncestor", err)
+	}
+	if err := Move(src, parent, true); !errors.Is(err, ErrIsAncestor) {
+		t.Errorf("Move onto ancestor = %v, want ErrIsAncestor", err)
+	}
+	if err := Copy(filepath.Join(src, "c.txt"), dir, true); !errors.Is(err, ErrIsAncestor) {
+		t.Errorf("Copy file onto ancestor = %v, want ErrIsAncestor", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(src, "c.txt"))
+	if err != nil || string(data) != "keep" {
+		t.Fatalf("source after rejected copy = %q, %v", data, err)
+	}
+}
+
+func TestCopyOverwriteFailureRestoresTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("unix socket as special file")
+	}
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "a.txt"), "new")
+	// 特殊文件无法复制，复制会在中途失败
+	listener, err := net.Listen("unix", filepath.Join(src, "z.sock"))
+	if err != nil {
+		t.Skipf("unix socket unavailable: %v", err)
+	}
+	defer listener.Close()
+
+	dst := filepath.Join(dir, "dst")
+	writeFile(t, filepath.Join(dst, "old.txt"), "old")
+
+	if err := Copy(src, dst, true); err == nil {
+		t.Fatal("Copy with special file succeeded, want error")
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "old.txt"))
+	if err != nil || string(data) != "old" {
+		t.Fatalf("target after failed copy = %q, %v, want restored", data, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "a.txt")); !os.IsNotExist(err) {
+		t.Errorf("partial copy left in target: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("backup left behind: %d entries in parent, want 2", len(entries))
+	}
+}
+
+func TestMoveAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "folder")
+	writeFile(t, filepath.Join(src, "a.txt"), "a")
+
+	dst := filepath.Join(dir, "renamed")
+	if err := Move(src, dst, false); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("source still exists after move: %v", err)
+	}
+
+	if err := Remove(dst, false); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("Remove non-empty dir = %v, want ErrNotEmpty", err)
+	}
+	if err := Remove(dst, true); err != nil {
+		t.Fatalf("recursive Remove failed: %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("directory still exists after remove: %v", err)
+	}
+
+	root := filepath.VolumeName(dir) + string(filepath.Separator)
+	if err := Remove(root, true); !errors.Is(err, ErrRootPath) {
+		t.Errorf("Remove root = %v, want ErrRootPath", err)
+	}
+}
@@ -0,0 +1,189 @@
+package fsutil
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultHashMaxFiles 计算哈希清单时默认的文件数上限
+const DefaultHashMaxFiles = 200000
+
+// ErrHashLimit 文件数超过上限
+var ErrHashLimit = errors.New("文件数超过上限")
+
+// HashOptions 计算哈希清单的选项
+type HashOptions struct {
+	MD5      bool     // 同时计算MD5
+	Exclude  []string // 排除的文件或目录通配符；不含/的模式匹配名称，含/的模式匹配相对路径
+	MaxFiles int      // 文件数上限
+}
+
+// HashEntry 单个文件的哈希
+type HashEntry struct {
+	Path   string `json:"path"` // 相对根目录的路径，使用/分隔；根路径是文件时为文件名
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+	MD5    string `json:"md5,omitempty"`
+}
+
+// HashError 无法读取的文件
+type HashError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// HashManifest 文件或目录树的哈希清单，Files按路径排序
+type HashManifest struct {
+	Root       string      `json:"root"`
+	IsDir      bool        `json:"is_dir"`
+	Files      []HashEntry `json:"files"`
+	Errors     []HashError `json:"errors,omitempty"`
+	TotalBytes int64       `json:"total_bytes"`
+	Elapsed    int64       `json:"elapsed_ms"`
+}
+
+// matchPattern 判断相对路径是否匹配任一通配符，忽略大小写
+func matchPattern(patterns []string, name string) bool {
+	base := path.Base(name)
+	for _, pattern := range patterns {
+		pattern = filepath.ToSlash(pattern)
+		target := base
+		if strings.Contains(pattern, "/") {
+			target = name
+		}
+		if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(target)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// HashFile 计算文件的SHA-256，withMD5为true时同时计算MD5
+func HashFile(ctx context.Context, name string, withMD5 bool) (*HashEntry, error) {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	sha := sha256.New()
+	var writer io.Writer = sha
+	var md5Hash hash.Hash
+	if withMD5 {
+		md5Hash = md5.New()
+		writer = io.MultiWriter(sha, md5Hash)
+	}
+
+	size, err := io.Copy(writer, &contextReader{ctx: ctx, r: file})
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &HashEntry{Size: size, SHA256: hex.EncodeToString(sha.Sum(nil))}
+	if md5Hash != nil {
+		entry.MD5 = hex.EncodeToString(md5Hash.Sum(nil))
+	}
+	return entry, nil
+}
+
+// contextReader 读取大文件时响应取消
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// HashTree 计算文件或目录下所有普通文件的哈希清单
+// 包含隐藏文件；符号链接和特殊文件不计入，无权限读取的文件和目录记录在Errors中
+func HashTree(ctx context.Context, root string, opts HashOptions) (*HashManifest, error) {
+	started := time.Now()
+	root = filepath.Clean(root)
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = DefaultHashMaxFiles
+	}
+
+	manifest := &HashManifest{Root: root, IsDir: info.IsDir(), Files: []HashEntry{}}
+	if !info.IsDir() {
+		entry, err := HashFile(ctx, root, opts.MD5)
+		if err != nil {
+			return nil, err
+		}
+		entry.Path = info.Name()
+		manifest.Files = append(manifest.Files, *entry)
+		manifest.TotalBytes = entry.Size
+		manifest.Elapsed = time.Since(started).Milliseconds()
+		return manifest, nil
+	}
+
+	err = filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if p == root {
+			return err
+		}
+
+		rel, relErr := filepath.Rel(root, p)
+		if relErr != nil {
+			return relErr
+		}
+		name := filepath.ToSlash(rel)
+		if err != nil {
+			manifest.Errors = append(manifest.Errors, HashError{Path: name, Error: err.Error()})
+			return nil
+		}
+		if matchPattern(opts.Exclude, name) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if len(manifest.Files) >= opts.MaxFiles {
+			return ErrHashLimit
+		}
+		entry, err := HashFile(ctx, p, opts.MD5)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return ctxErr
+			}
+			manifest.Errors = append(manifest.Errors, HashError{Path: name, Error: err.Error()})
+			return nil
+		}
+		entry.Path = name
+		manifest.Files = append(manifest.Files, *entry)
+		manifest.TotalBytes += entry.Size
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	manifest.Elapsed = time.Since(started).Milliseconds()
+	return manifest, nil
+}
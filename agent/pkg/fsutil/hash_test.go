@@ -0,0 +1,47 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestHashTree(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "b.txt"), "hello")
+	writeFile(t, filepath.Join(dir, "sub", "a.txt"), "")
+	writeFile(t, filepath.Join(dir, "logs", "app.log"), "ignored")
+	writeFile(t, filepath.Join(dir, "sub", "x.tmp"), "ignored")
+
+	manifest, err := HashTree(context.Background(), dir, HashOptions{MD5: true, Exclude: []string{"logs", "*.TMP"}})
+	if err != nil {
+		t.Fatalf("HashTree failed: %v", err)
+	}
+	if !manifest.IsDir || len(manifest.Files) != 2 || manifest.TotalBytes != 5 {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+
+	b, a := manifest.Files[0], manifest.Files[1]
+	if b.Path != "b.txt" || a.Path != "sub/a.txt" {
+		t.Errorf("paths = %q, %q", b.Path, a.Path)
+	}
+	if b.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" || b.MD5 != "5d41402abc4b2a76b9719d911017c592" {
+		t.Errorf("hello hashes = %s, %s", b.SHA256, b.MD5)
+	}
+	if a.SHA256 != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		t.Errorf("empty sha256 = %s", a.SHA256)
+	}
+
+	single, err := HashTree(context.Background(), filepath.Join(dir, "b.txt"), HashOptions{})
+	if err != nil {
+		t.Fatalf("HashTree file failed: %v", err)
+	}
+	if single.IsDir || len(single.Files) != 1 || single.Files[0].Path != "b.txt" || single.Files[0].MD5 != "" {
+		t.Errorf("single = %+v", single)
+	}
+
+	if _, err := HashTree(context.Background(), dir, HashOptions{MaxFiles: 1}); !errors.Is(err, ErrHashLimit) {
+		t.Errorf("MaxFiles err = %v", err)
+	}
+}
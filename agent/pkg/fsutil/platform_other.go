@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// isHidden 判断文件是否隐藏：以点开头
+func isHidden(path string, info os.FileInfo) bool {
+	return strings.HasPrefix(info.Name(), ".")
+}
+
+// isCrossDevice 判断重命名失败是否因为源和目标不在同一分区
+func isCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
@@ -0,0 +1,30 @@
+//go:build windows
+// +build windows
+
+package fsutil
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// isHidden 判断文件是否隐藏：带隐藏属性或以点开头
+func isHidden(path string, info os.FileInfo) bool {
+	if strings.HasPrefix(info.Name(), ".") {
+		return true
+	}
+	if data, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		return data.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+	}
+	return false
+}
+
+// ERROR_NOT_SAME_DEVICE
+const errNotSameDevice = syscall.Errno(17)
+
+// isCrossDevice 判断重命名失败是否因为源和目标不在同一分区
+func isCrossDevice(err error) bool {
+	return errors.Is(err, errNotSameDevice)
+}
@@ -0,0 +1,262 @@
+package fsutil
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 搜索默认限制
+const (
+	DefaultSearchMaxResults     = 1000
+	DefaultSearchMaxContentSize = 50 << 20 // 内容搜索时跳过超过此大小的文件
+	maxSnippetLength            = 200
+)
+
+// ErrSearchLimit 搜索结果达到上限
+var ErrSearchLimit = errors.New("搜索结果达到上限")
+
+// SearchOptions 文件搜索条件
+type SearchOptions struct {
+	Root           string
+	Names          []string   // 文件名通配符，任一匹配即可，为空时不限制
+	Type           string     // file 或 dir，为空时不限制
+	MinSize        int64      // 最小文件大小，0表示不限制
+	MaxSize        int64      // 最大文件大小，0表示不限制
+	ModifiedAfter  *time.Time // 修改时间下限
+	ModifiedBefore *time.Time // 修改时间上限
+	Content        string     // 内容包含的字符串或正则表达式，为空时不搜索内容
+	Regex          bool       // Content按正则表达式匹配
+	IgnoreCase     bool       // 文件名和内容匹配忽略大小写
+	MaxDepth       int        // 最大搜索深度，Root下的直接子项深度为1，0表示不限制
+	MaxResults     int        // 最多返回的结果数
+	MaxContentSize int64      // 内容搜索的文件大小上限
+	ShowHidden     bool       // 是否搜索隐藏文件和目录
+}
+
+// SearchMatch 搜索结果
+type SearchMatch struct {
+	FileInfo
+	Line    int    `json:"line,omitempty"`    // 内容匹配的行号
+	Snippet string `json:"snippet,omitempty"` // 内容匹配的行
+}
+
+// SearchStats 搜索统计
+type SearchStats struct {
+	Matched   int    `json:"matched"`
+	Scanned   int    `json:"scanned"`   // 检查过的文件和目录数
+	Skipped   int    `json:"skipped"`   // 无权限等原因跳过的条目数
+	Truncated bool   `json:"truncated"` // 因达到结果上限或超时而提前结束
+	Reason    string `json:"reason,omitempty"`
+	Elapsed   int64  `json:"elapsed_ms"`
+}
+
+// contentMatcher 返回按行匹配内容的函数
+func contentMatcher(opts SearchOptions) (func(line []byte) bool, error) {
+	if opts.Regex {
+		pattern := opts.Content
+		if opts.IgnoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		return re.Match, nil
+	}
+
+	needle := []byte(opts.Content)
+	if opts.IgnoreCase {
+		needle = bytes.ToLower(needle)
+		return func(line []byte) bool { return bytes.Contains(bytes.ToLower(line), needle) }, nil
+	}
+	return func(line []byte) bool { return bytes.Contains(line, needle) }, nil
+}
+
+// matchName 判断文件名是否匹配任一通配符
+func matchName(patterns []string, name string, ignoreCase bool) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	if ignoreCase {
+		name = strings.ToLower(name)
+	}
+	for _, pattern := range patterns {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+		}
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// searchContent 逐行查找内容，返回第一处匹配的行号和内容；二进制文件跳过
+func searchContent(path string, match func([]byte) bool) (int, string, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", false
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	if head, _ := reader.Peek(8000); bytes.IndexByte(head, 0) >= 0 {
+		return 0, "", false
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if match(scanner.Bytes()) {
+			snippet := strings.TrimSpace(scanner.Text())
+			if len(snippet) > maxSnippetLength {
+				snippet = snippet[:maxSnippetLength]
+			}
+			return line, snippet, true
+		}
+	}
+	return 0, "", false
+}
+
+// Search 在Root下按条件搜索文件，每找到一个结果调用一次fn
+// ctx超时或结果达到上限时提前结束并在统计中标记Truncated；fn返回错误时停止搜索（例如客户端断开）
+func Search(ctx context.Context, opts SearchOptions, fn func(SearchMatch) error) (*SearchStats, error) {
+	started := time.Now()
+	stats := &SearchStats{}
+
+	root := filepath.Clean(opts.Root)
+	if info, err := os.Stat(root); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, errors.New("搜索根路径不是目录")
+	}
+
+	if opts.MaxResults <= 0 {
+		opts.MaxResults = DefaultSearchMaxResults
+	}
+	if opts.MaxContentSize <= 0 {
+		opts.MaxContentSize = DefaultSearchMaxContentSize
+	}
+	var matchContent func([]byte) bool
+	if opts.Content != "" {
+		var err error
+		if matchContent, err = contentMatcher(opts); err != nil {
+			return nil, err
+		}
+		// 只有文件才有内容
+		opts.Type = "file"
+	}
+
+	rootDepth := strings.Count(root, string(filepath.Separator))
+	if strings.HasSuffix(root, string(filepath.Separator)) {
+		rootDepth--
+	}
+
+	err := filepath.WalkDir(root, func(path string, entry os.DirEntry, err error) error {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if err != nil {
+			if path != root {
+				stats.Skipped++
+				return nil
+			}
+			return err
+		}
+		if path == root {
+			return nil
+		}
+
+		stats.Scanned++
+		depth := strings.Count(path, string(filepath.Separator)) - rootDepth
+
+		info, err := entry.Info()
+		if err != nil {
+			stats.Skipped++
+			return nil
+		}
+		if !opts.ShowHidden && isHidden(path, info) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if matchEntry(opts, entry, info) {
+			item := SearchMatch{FileInfo: newFileInfo(path, info)}
+			matched := true
+			if matchContent != nil {
+				matched = false
+				if info.Mode().IsRegular() && info.Size() <= opts.MaxContentSize {
+					item.Line, item.Snippet, matched = searchContent(path, matchContent)
+				}
+			}
+			if matched {
+				stats.Matched++
+				if err := fn(item); err != nil {
+					return err
+				}
+				if stats.Matched >= opts.MaxResults {
+					return ErrSearchLimit
+				}
+			}
+		}
+
+		if entry.IsDir() && opts.MaxDepth > 0 && depth >= opts.MaxDepth {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+
+	stats.Elapsed = time.Since(started).Milliseconds()
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrSearchLimit):
+		stats.Truncated = true
+		stats.Reason = "max_results"
+	case errors.Is(err, context.DeadlineExceeded):
+		stats.Truncated = true
+		stats.Reason = "timeout"
+	default:
+		return stats, err
+	}
+	return stats, nil
+}
+
+// matchEntry 检查名称、类型、大小和修改时间条件
+func matchEntry(opts SearchOptions, entry os.DirEntry, info os.FileInfo) bool {
+	switch opts.Type {
+	case "file":
+		if entry.IsDir() {
+			return false
+		}
+	case "dir":
+		if !entry.IsDir() {
+			return false
+		}
+	}
+	if !matchName(opts.Names, entry.Name(), opts.IgnoreCase) {
+		return false
+	}
+	// 指定大小条件时只匹配文件
+	if opts.MinSize > 0 && (entry.IsDir() || info.Size() < opts.MinSize) {
+		return false
+	}
+	if opts.MaxSize > 0 && (entry.IsDir() || info.Size() > opts.MaxSize) {
+		return false
+	}
+	if opts.ModifiedAfter != nil && info.ModTime().Before(*opts.ModifiedAfter) {
+		return false
+	}
+	if opts.ModifiedBefore != nil && info.ModTime().After(*opts.ModifiedBefore) {
+		return false
+	}
+	return true
+}
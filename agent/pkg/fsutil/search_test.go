@@ -0,0 +1,79 @@
+package fsutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// searchNames 执行搜索并返回按字母排序的相对路径
+func searchNames(t *testing.T, opts SearchOptions) ([]string, *SearchStats) {
+	t.Helper()
+	var names []string
+	stats, err := Search(context.Background(), opts, func(match SearchMatch) error {
+		rel, _ := filepath.Rel(opts.Root, match.Path)
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	sort.Strings(names)
+	return names, stats
+}
+
+func TestSearch(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "app.log"), "starting\nERROR: disk full\n")
+	writeFile(t, filepath.Join(dir, "sub", "other.LOG"), "all good\n")
+	writeFile(t, filepath.Join(dir, "sub", "deep", "x.log"), "error again\n")
+	writeFile(t, filepath.Join(dir, "big.bin"), string(make([]byte, 2048)))
+
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(filepath.Join(dir, "sub", "other.LOG"), old, old)
+
+	names, _ := searchNames(t, SearchOptions{Root: dir, Names: []string{"*.log"}, IgnoreCase: true})
+	if len(names) != 3 {
+		t.Errorf("name search = %v", names)
+	}
+
+	names, _ = searchNames(t, SearchOptions{Root: dir, Names: []string{"*.log"}, IgnoreCase: true, MaxDepth: 2})
+	if len(names) != 2 {
+		t.Errorf("depth-limited search = %v", names)
+	}
+
+	after := time.Now().Add(-time.Hour)
+	names, _ = searchNames(t, SearchOptions{Root: dir, Names: []string{"*.log"}, IgnoreCase: true, ModifiedAfter: &after})
+	if len(names) != 2 {
+		t.Errorf("modified-after search = %v", names)
+	}
+
+	names, _ = searchNames(t, SearchOptions{Root: dir, MinSize: 1024})
+	if len(names) != 1 || names[0] != "big.bin" {
+		t.Errorf("size search = %v", names)
+	}
+
+	var match SearchMatch
+	Search(context.Background(), SearchOptions{Root: dir, Content: "error", IgnoreCase: true}, func(m SearchMatch) error {
+		if m.Name == "app.log" {
+			match = m
+		}
+		return nil
+	})
+	if match.Line != 2 || match.Snippet != "ERROR: disk full" {
+		t.Errorf("content match = line %d %q", match.Line, match.Snippet)
+	}
+
+	names, _ = searchNames(t, SearchOptions{Root: dir, Content: `^error \w+$`, Regex: true})
+	if len(names) != 1 || names[0] != "sub/deep/x.log" {
+		t.Errorf("regex search = %v", names)
+	}
+
+	_, stats := searchNames(t, SearchOptions{Root: dir, Type: "file", MaxResults: 2})
+	if stats.Matched != 2 || !stats.Truncated || stats.Reason != "max_results" {
+		t.Errorf("limited search stats = %+v", stats)
+	}
+}
@@ -0,0 +1,227 @@
+package fsutil
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// 监听事件类型
+const (
+	WatchCreated  = "created"
+	WatchModified = "modified"
+	WatchDeleted  = "deleted"
+)
+
+// 监听默认参数
+const (
+	DefaultWatchInterval   = 2 * time.Second
+	DefaultWatchMaxEntries = 50000
+)
+
+// ErrWatchLimit 监听的条目数超过上限
+var ErrWatchLimit = errors.New("监听的文件数超过上限")
+
+// WatchOptions 目录监听选项
+type WatchOptions struct {
+	Root       string
+	Recursive  bool          // 监听所有子目录，否则只监听直接子项
+	Exclude    []string      // 排除的文件或目录通配符，规则同HashOptions.Exclude
+	Interval   time.Duration // 扫描间隔
+	Debounce   time.Duration // 最后一次变化后保持静默多久再通知，期间的变化合并为一批
+	MaxEntries int           // 监听的条目数上限
+}
+
+// WatchEvent 文件变化事件
+type WatchEvent struct {
+	Op    string    `json:"op"`     // created/modified/deleted
+	Path  string    `json:"path"`   // 完整路径
+	Name  string    `json:"name"`   // 相对监听根路径，使用/分隔；监听单个文件时为文件名
+	IsDir bool      `json:"is_dir"` // 是否为目录
+	Size  int64     `json:"size"`
+	Time  time.Time `json:"time"` // 检测到变化的时间
+}
+
+// watchEntry 扫描时记录的条目状态
+type watchEntry struct {
+	size  int64
+	mod   time.Time
+	isDir bool
+}
+
+// scanWatchTree 扫描监听路径，根路径不存在时返回空结果（视为全部删除）
+func scanWatchTree(opts WatchOptions) (map[string]watchEntry, error) {
+	entries := make(map[string]watchEntry)
+	info, err := os.Stat(opts.Root)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return entries, nil
+		}
+		return nil, err
+	}
+	if !info.IsDir() {
+		// 监听单个文件时以空名称表示根路径本身
+		entries[""] = watchEntry{size: info.Size(), mod: info.ModTime()}
+		return entries, nil
+	}
+
+	err = filepath.WalkDir(opts.Root, func(p string, d os.DirEntry, err error) error {
+		if p == opts.Root {
+			return err
+		}
+		if err != nil {
+			// 扫描期间被删除或无权限读取的条目忽略
+			return nil
+		}
+
+		rel, err := filepath.Rel(opts.Root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if matchPattern(opts.Exclude, name) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		entries[name] = watchEntry{size: info.Size(), mod: info.ModTime(), isDir: d.IsDir()}
+		if len(entries) > opts.MaxEntries {
+			return ErrWatchLimit
+		}
+		if d.IsDir() && !opts.Recursive {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// diffWatchTree 比较两次扫描结果；目录的修改时间随子项变化，只报告目录的创建和删除
+func diffWatchTree(prev, cur map[string]watchEntry) map[string]string {
+	changes := make(map[string]string)
+	for name, entry := range cur {
+		old, ok := prev[name]
+		switch {
+		case !ok:
+			changes[name] = WatchCreated
+		case old.isDir != entry.isDir:
+			changes[name] = WatchModified
+		case !entry.isDir && (old.size != entry.size || !old.mod.Equal(entry.mod)):
+			changes[name] = WatchModified
+		}
+	}
+	for name := range prev {
+		if _, ok := cur[name]; !ok {
+			changes[name] = WatchDeleted
+		}
+	}
+	return changes
+}
+
+// mergeWatchOp 合并同一路径在一批通知中的多次变化，返回空字符串表示相互抵消
+func mergeWatchOp(pending, next string) string {
+	switch {
+	case pending == "":
+		return next
+	case pending == WatchCreated && next == WatchModified:
+		return WatchCreated
+	case pending == WatchCreated && next == WatchDeleted:
+		return ""
+	case pending == WatchDeleted && next == WatchCreated:
+		return WatchModified
+	}
+	return next
+}
+
+// Watch 定期扫描Root并在变化后静默Debounce时长时调用fn通知一批事件，直到ctx结束
+// 轮询方式不依赖平台的文件通知接口，网络路径和移动存储同样适用；首次扫描失败时直接返回错误
+func Watch(ctx context.Context, opts WatchOptions, fn func([]WatchEvent)) error {
+	opts.Root = filepath.Clean(opts.Root)
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchInterval
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultWatchMaxEntries
+	}
+	prev, err := scanWatchTree(opts)
+	if err != nil {
+		return err
+	}
+
+	pending := make(map[string]string)
+	known := make(map[string]watchEntry) // 待通知路径最近一次的状态，删除后仍能知道是否为目录
+	var lastChange time.Time
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		cur, err := scanWatchTree(opts)
+		if err != nil {
+			if errors.Is(err, ErrWatchLimit) {
+				return err
+			}
+			// 暂时无法访问时保留上次结果，下次扫描再比较
+			continue
+		}
+
+		now := time.Now()
+		changes := diffWatchTree(prev, cur)
+		for name, op := range changes {
+			if entry, ok := cur[name]; ok {
+				known[name] = entry
+			} else {
+				known[name] = prev[name]
+			}
+			if merged := mergeWatchOp(pending[name], op); merged != "" {
+				pending[name] = merged
+			} else {
+				delete(pending, name)
+			}
+		}
+		if len(changes) > 0 {
+			lastChange = now
+		}
+
+		if len(pending) == 0 || now.Sub(lastChange) < opts.Debounce {
+			prev = cur
+			continue
+		}
+
+		events := make([]WatchEvent, 0, len(pending))
+		for name, op := range pending {
+			event := WatchEvent{Op: op, Name: name, Path: filepath.Join(opts.Root, filepath.FromSlash(name)), Time: now}
+			if name == "" {
+				event.Name = filepath.Base(opts.Root)
+			}
+			entry := known[name]
+			event.IsDir = entry.isDir
+			if op != WatchDeleted {
+				event.Size = entry.size
+			}
+			events = append(events, event)
+		}
+		sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+		pending = make(map[string]string)
+		known = make(map[string]watchEntry)
+		prev = cur
+		fn(events)
+	}
+}
@@ -0,0 +1,101 @@
+package fsutil
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// collectWatch 在后台监听，返回接收事件批次的通道
+func collectWatch(t *testing.T, opts WatchOptions) (<-chan []WatchEvent, context.CancelFunc) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	batches := make(chan []WatchEvent, 10)
+	started := make(chan struct{})
+	go func() {
+		close(started)
+		Watch(ctx, opts, func(events []WatchEvent) { batches <- events })
+	}()
+	<-started
+	// 等待首次扫描完成
+	time.Sleep(3 * opts.Interval)
+	return batches, cancel
+}
+
+func waitBatch(t *testing.T, batches <-chan []WatchEvent) []WatchEvent {
+	t.Helper()
+	select {
+	case events := <-batches:
+		return events
+	case <-time.After(2 * time.Second):
+		t.Fatal("no watch events received")
+		return nil
+	}
+}
+
+func TestWatchDebounceAndCoalesce(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "keep.txt"), "a")
+	writeFile(t, filepath.Join(dir, "old.txt"), "a")
+
+	batches, cancel := collectWatch(t, WatchOptions{
+		Root:      dir,
+		Recursive: true,
+		Exclude:   []string{"*.tmp"},
+		Interval:  10 * time.Millisecond,
+		Debounce:  300 * time.Millisecond,
+	})
+	defer cancel()
+
+	// 写入过程中的多次修改合并为一个created事件，创建后又删除的文件不通知
+	writeFile(t, filepath.Join(dir, "drop", "new.txt"), "1")
+	time.Sleep(30 * time.Millisecond)
+	writeFile(t, filepath.Join(dir, "drop", "new.txt"), "12")
+	writeFile(t, filepath.Join(dir, "gone.txt"), "x")
+	time.Sleep(30 * time.Millisecond)
+	os.Remove(filepath.Join(dir, "gone.txt"))
+	os.Remove(filepath.Join(dir, "old.txt"))
+	writeFile(t, filepath.Join(dir, "ignored.tmp"), "x")
+
+	events := waitBatch(t, batches)
+	got := make(map[string]WatchEvent)
+	for _, event := range events {
+		got[event.Name] = event
+	}
+	if len(got) != 3 {
+		t.Fatalf("events = %+v", events)
+	}
+	if e := got["drop"]; e.Op != WatchCreated || !e.IsDir {
+		t.Errorf("drop = %+v", e)
+	}
+	if e := got["drop/new.txt"]; e.Op != WatchCreated || e.Size != 2 {
+		t.Errorf("drop/new.txt = %+v", e)
+	}
+	if e := got["old.txt"]; e.Op != WatchDeleted {
+		t.Errorf("old.txt = %+v", e)
+	}
+}
+
+func TestWatchSingleFile(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "app.conf")
+
+	batches, cancel := collectWatch(t, WatchOptions{Root: target, Interval: 10 * time.Millisecond})
+	defer cancel()
+
+	writeFile(t, target, "v1")
+	events := waitBatch(t, batches)
+	if len(events) != 1 || events[0].Op != WatchCreated || events[0].Name != "app.conf" || events[0].Path != target {
+		t.Fatalf("create events = %+v", events)
+	}
+
+	later := time.Now().Add(time.Minute)
+	writeFile(t, target, "v2")
+	os.Chtimes(target, later, later)
+	events = waitBatch(t, batches)
+	if len(events) != 1 || events[0].Op != WatchModified {
+		t.Fatalf("modify events = %+v", events)
+	}
+}
@@ -0,0 +1,231 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 候选代理的来源
+const (
+	SourceConfig = "config" // 配置文件
+	SourceSystem = "system" // 检测到的系统代理
+	SourceAPI    = "api"    // 通过接口添加
+)
+
+// 同时检查的候选代理数
+const checkConcurrency = 8
+
+// Candidate 候选代理及最近一次检查结果
+type Candidate struct {
+	URL    string  `json:"url"` // 隐藏密码后的地址
+	Source string  `json:"source"`
+	Active bool    `json:"active"`
+	Health *Result `json:"health"` // 未检查过时为nil
+
+	proxy *url.URL
+}
+
+// Status 当前生效的代理
+type Status struct {
+	Enabled bool    `json:"enabled"`
+	URL     string  `json:"url"`
+	Health  *Result `json:"health"`
+}
+
+// Manager 管理候选代理列表和当前生效的代理
+type Manager struct {
+	checkURL   string
+	timeout    time.Duration
+	mutex      sync.Mutex
+	candidates []*Candidate
+	active     *Candidate
+}
+
+// NewManager 创建代理管理器，checkURL为空时使用DefaultCheckURL
+func NewManager(checkURL string, timeout time.Duration) *Manager {
+	if checkURL == "" {
+		checkURL = DefaultCheckURL
+	}
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+	return &Manager{checkURL: checkURL, timeout: timeout}
+}
+
+// find 按协议和主机查找候选代理，调用方需持有锁
+func (m *Manager) find(u *url.URL) *Candidate {
+	key := Key(u)
+	for _, candidate := range m.candidates {
+		if Key(candidate.proxy) == key {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// Add 添加候选代理，已存在时更新认证信息
+func (m *Manager) Add(u *url.URL, source string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.add(u, source)
+}
+
+func (m *Manager) add(u *url.URL, source string) *Candidate {
+	if candidate := m.find(u); candidate != nil {
+		candidate.proxy = u
+		candidate.URL = Redact(u)
+		return candidate
+	}
+	candidate := &Candidate{URL: Redact(u), Source: source, proxy: u}
+	m.candidates = append(m.candidates, candidate)
+	return candidate
+}
+
+// Remove 移除候选代理，正在使用的代理不能移除
+func (m *Manager) Remove(u *url.URL) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for i, candidate := range m.candidates {
+		if Key(candidate.proxy) != Key(u) {
+			continue
+		}
+		if candidate == m.active {
+			return errors.New("代理正在使用，请先停止")
+		}
+		m.candidates = append(m.candidates[:i], m.candidates[i+1:]...)
+		return nil
+	}
+	return errors.New("代理不在列表中")
+}
+
+// List 返回候选代理列表的副本
+func (m *Manager) List() []Candidate {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	list := make([]Candidate, 0, len(m.candidates))
+	for _, candidate := range m.candidates {
+		item := *candidate
+		item.Active = candidate == m.active
+		list = append(list, item)
+	}
+	return list
+}
+
+// Best 最近一次检查可用且延迟最低的候选代理，没有时返回nil
+func (m *Manager) Best() *url.URL {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var best *Candidate
+	for _, candidate := range m.candidates {
+		if candidate.Health == nil || !candidate.Health.OK {
+			continue
+		}
+		if best == nil || candidate.Health.Latency < best.Health.Latency {
+			best = candidate
+		}
+	}
+	if best == nil {
+		return nil
+	}
+	return best.proxy
+}
+
+// Check 检查指定代理，代理在候选列表中时记录结果
+func (m *Manager) Check(ctx context.Context, u *url.URL) Result {
+	result := Check(ctx, u, m.checkURL, m.timeout)
+	m.mutex.Lock()
+	if candidate := m.find(u); candidate != nil {
+		candidate.Health = &result
+	}
+	m.mutex.Unlock()
+	return result
+}
+
+// CheckAll 并发检查所有候选代理，返回按延迟排序的结果，不可用的排在最后
+func (m *Manager) CheckAll(ctx context.Context) []Candidate {
+	m.mutex.Lock()
+	proxies := make([]*url.URL, 0, len(m.candidates))
+	for _, candidate := range m.candidates {
+		proxies = append(proxies, candidate.proxy)
+	}
+	m.mutex.Unlock()
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, checkConcurrency)
+	for _, u := range proxies {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(u *url.URL) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			m.Check(ctx, u)
+		}(u)
+	}
+	wg.Wait()
+
+	list := m.List()
+	sort.SliceStable(list, func(i, j int) bool {
+		a, b := list[i].Health, list[j].Health
+		if a == nil || !a.OK {
+			return false
+		}
+		if b == nil || !b.OK {
+			return true
+		}
+		return a.Latency < b.Latency
+	})
+	return list
+}
+
+// Activate 将代理设为当前生效的代理并应用到系统，代理不在列表中时加入列表
+func (m *Manager) Activate(u *url.URL, result *Result) error {
+	if err := applySystem(u); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	candidate := m.add(u, SourceAPI)
+	if result != nil {
+		candidate.Health = result
+	}
+	m.active = candidate
+	return nil
+}
+
+// Deactivate 停止使用代理并恢复系统设置
+func (m *Manager) Deactivate() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.active == nil {
+		return nil
+	}
+	if err := clearSystem(); err != nil {
+		return err
+	}
+	m.active = nil
+	return nil
+}
+
+// Active 当前生效的代理，未使用代理时返回nil
+func (m *Manager) Active() *url.URL {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.active == nil {
+		return nil
+	}
+	return m.active.proxy
+}
+
+// Status 当前生效的代理及最近一次检查结果
+func (m *Manager) Status() Status {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.active == nil {
+		return Status{}
+	}
+	return Status{Enabled: true, URL: m.active.URL, Health: m.active.Health}
+}
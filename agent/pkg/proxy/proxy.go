@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// 默认的连通性检查地址，返回出口IP
+const DefaultCheckURL = "https://www.icanhazip.com"
+
+// 默认的检查超时
+const DefaultCheckTimeout = 10 * time.Second
+
+// 支持的代理协议，socks5h由代理服务器解析域名
+var supportedSchemes = map[string]bool{
+	"http":    true,
+	"https":   true,
+	"socks5":  true,
+	"socks5h": true,
+}
+
+// Result 通过代理访问检查地址的结果
+type Result struct {
+	OK        bool      `json:"ok"`
+	Latency   int64     `json:"latency_ms"` // 请求耗时（毫秒）
+	ExitIP    string    `json:"exit_ip"`    // 检查地址返回的出口IP
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Parse 解析代理地址，未指定协议时按http处理；username非空时覆盖地址中的认证信息
+func Parse(raw, username, password string) (*url.URL, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, errors.New("代理地址为空")
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("代理地址格式错误: %w", err)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if !supportedSchemes[u.Scheme] {
+		return nil, fmt.Errorf("不支持的代理协议: %s", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return nil, fmt.Errorf("代理地址缺少主机或端口: %s", raw)
+	}
+	if username != "" {
+		u.User = url.UserPassword(username, password)
+	}
+	// 只保留协议、认证信息和主机
+	return &url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host}, nil
+}
+
+// Key 代理的唯一标识：协议和主机，不含认证信息
+func Key(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// Redact 隐藏密码后的代理地址，用于展示和上报
+func Redact(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	return u.Redacted()
+}
+
+// Check 通过代理请求检查地址，记录耗时并解析返回的出口IP
+func Check(ctx context.Context, u *url.URL, checkURL string, timeout time.Duration) Result {
+	if checkURL == "" {
+		checkURL = DefaultCheckURL
+	}
+	if timeout <= 0 {
+		timeout = DefaultCheckTimeout
+	}
+
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:             http.ProxyURL(u),
+			DisableKeepAlives: true,
+		},
+	}
+
+	result := Result{CheckedAt: time.Now()}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checkURL, nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	result.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("检查地址返回状态码 %d", resp.StatusCode)
+		return result
+	}
+
+	ip := strings.TrimSpace(string(body))
+	if net.ParseIP(ip) == nil {
+		result.Error = fmt.Sprintf("检查地址返回的不是IP: %q", ip)
+		return result
+	}
+	result.OK = true
+	result.ExitIP = ip
+	return result
+}
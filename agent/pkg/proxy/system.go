@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"net/url"
+	"os"
+	"sync"
+)
+
+// 代理相关的环境变量，Agent启动的子进程通过它们使用代理
+var envNames = []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "http_proxy", "https_proxy", "all_proxy"}
+
+var (
+	envMutex sync.Mutex
+	envSaved map[string]*string // 首次设置代理前的环境变量，停止代理时恢复
+)
+
+// setEnvProxy 设置代理环境变量
+func setEnvProxy(u *url.URL) error {
+	envMutex.Lock()
+	defer envMutex.Unlock()
+	if envSaved == nil {
+		envSaved = make(map[string]*string, len(envNames))
+		for _, name := range envNames {
+			if value, ok := os.LookupEnv(name); ok {
+				envSaved[name] = &value
+			} else {
+				envSaved[name] = nil
+			}
+		}
+	}
+	for _, name := range envNames {
+		if err := os.Setenv(name, u.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restoreEnvProxy 恢复设置代理前的环境变量
+func restoreEnvProxy() error {
+	envMutex.Lock()
+	defer envMutex.Unlock()
+	if envSaved == nil {
+		return nil
+	}
+	for name, value := range envSaved {
+		var err error
+		if value == nil {
+			err = os.Unsetenv(name)
+		} else {
+			err = os.Setenv(name, *value)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	envSaved = nil
+	return nil
+}
+
+// envProxy 环境变量中配置的代理
+func envProxy() string {
+	for _, name := range envNames {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package proxy
+
+import "net/url"
+
+// applySystem 应用代理：设置进程的代理环境变量，对Agent启动的子进程生效
+func applySystem(u *url.URL) error {
+	return setEnvProxy(u)
+}
+
+// clearSystem 停止代理：恢复环境变量
+func clearSystem() error {
+	return restoreEnvProxy()
+}
+
+// SystemProxy 检测系统配置的代理，未配置时返回空字符串
+func SystemProxy() string {
+	return envProxy()
+}
@@ -0,0 +1,171 @@
+//go:build windows
+// +build windows
+
+package proxy
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 当前用户的IE/WinINet代理设置，浏览器和大多数程序使用它
+const internetSettingsKey = `HKCU\Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+// regSet 写入注册表值
+func regSet(name, kind, data string) error {
+	output, err := exec.Command("reg", "add", internetSettingsKey, "/v", name, "/t", kind, "/d", data, "/f").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("写入注册表%s失败: %v %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// regDelete 删除注册表值
+func regDelete(name string) error {
+	output, err := exec.Command("reg", "delete", internetSettingsKey, "/v", name, "/f").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("删除注册表%s失败: %v %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// regLookup 读取注册表值及其类型，值不存在时ok为false
+func regLookup(name string) (kind, data string, ok bool) {
+	output, err := exec.Command("reg", "query", internetSettingsKey, "/v", name).Output()
+	if err != nil {
+		return "", "", false
+	}
+	// 输出格式: "    ProxyServer    REG_SZ    127.0.0.1:8080"
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && strings.EqualFold(fields[0], name) {
+			return fields[1], strings.Join(fields[2:], " "), true
+		}
+	}
+	return "", "", false
+}
+
+// regQuery 读取注册表值，不存在时返回空字符串
+func regQuery(name string) string {
+	_, data, _ := regLookup(name)
+	return data
+}
+
+// regValue 注册表值的类型和内容
+type regValue struct {
+	kind string
+	data string
+}
+
+// applySystem 修改的注册表值
+var regNames = []string{"ProxyServer", "ProxyOverride", "ProxyEnable"}
+
+var (
+	regMutex sync.Mutex
+	regSaved map[string]*regValue // 首次应用代理前的系统代理设置，停止代理时恢复，nil表示原来不存在
+)
+
+// saveSystem 首次应用代理前保存系统代理设置
+func saveSystem() {
+	regMutex.Lock()
+	defer regMutex.Unlock()
+	if regSaved != nil {
+		return
+	}
+	regSaved = make(map[string]*regValue, len(regNames))
+	for _, name := range regNames {
+		if kind, data, ok := regLookup(name); ok {
+			regSaved[name] = &regValue{kind: kind, data: data}
+		} else {
+			regSaved[name] = nil
+		}
+	}
+}
+
+// restoreSystem 恢复应用代理前的系统代理设置；没有保存的设置时关闭系统代理
+func restoreSystem() error {
+	regMutex.Lock()
+	defer regMutex.Unlock()
+	if regSaved == nil {
+		return regSet("ProxyEnable", "REG_DWORD", "0")
+	}
+	for _, name := range regNames {
+		var err error
+		if value := regSaved[name]; value == nil {
+			if _, _, ok := regLookup(name); ok {
+				err = regDelete(name)
+			}
+		} else {
+			err = regSet(name, value.kind, value.data)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	regSaved = nil
+	return nil
+}
+
+// applySystem 应用代理：保存原有系统代理设置后写入新设置，并设置进程的代理环境变量
+// 系统代理设置不支持认证信息，需要认证的代理只对使用环境变量的程序生效
+func applySystem(u *url.URL) error {
+	server := u.Host
+	if strings.HasPrefix(u.Scheme, "socks") {
+		server = "socks=" + u.Host
+	}
+	if u.User != nil {
+		log.WithField("proxy", Redact(u)).Warn("系统代理设置不支持认证信息")
+	}
+	saveSystem()
+	if err := regSet("ProxyServer", "REG_SZ", server); err != nil {
+		return err
+	}
+	if err := regSet("ProxyOverride", "REG_SZ", "<local>"); err != nil {
+		return err
+	}
+	if err := regSet("ProxyEnable", "REG_DWORD", "1"); err != nil {
+		return err
+	}
+	return setEnvProxy(u)
+}
+
+// clearSystem 停止代理：恢复应用代理前的系统代理设置和环境变量
+func clearSystem() error {
+	if err := restoreSystem(); err != nil {
+		return err
+	}
+	return restoreEnvProxy()
+}
+
+// SystemProxy 检测系统配置的代理，未配置时返回空字符串
+func SystemProxy() string {
+	if proxy := envProxy(); proxy != "" {
+		return proxy
+	}
+	if regQuery("ProxyEnable") != "0x1" {
+		return ""
+	}
+	server := regQuery("ProxyServer")
+	// 按协议分别设置时格式为 "http=host:port;https=host:port;socks=host:port"
+	if strings.Contains(server, "=") {
+		for _, part := range strings.Split(server, ";") {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			switch strings.ToLower(kv[0]) {
+			case "http", "https":
+				return "http://" + kv[1]
+			case "socks":
+				return "socks5://" + kv[1]
+			}
+		}
+		return ""
+	}
+	return server
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/chai2010/webp"
 	"github.com/go-vgo/robotgo"
 	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/draw"
 )
 
 // ImageFormat represents supported image formats
@@ -31,6 +32,9 @@ type ScreenshotOptions struct {
 	Y       int // Capture area Y coordinate
 	Width   int // Capture area width (0 = full screen)
 	Height  int // Capture area height (0 = full screen)
+
+	MaxWidth  int // 输出最大宽度，超出时按比例缩小 (0 = 不限制)
+	MaxHeight int // 输出最大高度，超出时按比例缩小 (0 = 不限制)
 }
 
 // DefaultScreenshotOptions returns default screenshot options
@@ -280,6 +284,8 @@ func CaptureScreenshotWithOptions(opts ScreenshotOptions) ([]byte, error) {
 
 	log.Infof("图像有效: 尺寸=%dx%d", bounds.Dx(), bounds.Dy())
 
+	img = fitImage(img, opts.MaxWidth, opts.MaxHeight)
+
 	log.Infof("图像转换成功，开始编码: Format=%s", opts.Format)
 
 	// Encode image to bytes
@@ -317,6 +323,46 @@ func CaptureScreenshotWithOptions(opts ScreenshotOptions) ([]byte, error) {
 	return imageData, nil
 }
 
+// fitSize 计算按比例缩放到不超过最大宽高后的尺寸，最大值为0表示该方向不限制
+func fitSize(width, height, maxWidth, maxHeight int) (int, int) {
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && height > maxHeight {
+		if s := float64(maxHeight) / float64(height); s < scale {
+			scale = s
+		}
+	}
+	if scale >= 1.0 {
+		return width, height
+	}
+
+	w := int(float64(width)*scale + 0.5)
+	h := int(float64(height)*scale + 0.5)
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	return w, h
+}
+
+// fitImage 将图像按比例缩小到不超过最大宽高，用于生成缩略图
+func fitImage(img image.Image, maxWidth, maxHeight int) image.Image {
+	bounds := img.Bounds()
+	w, h := fitSize(bounds.Dx(), bounds.Dy(), maxWidth, maxHeight)
+	if w == bounds.Dx() && h == bounds.Dy() {
+		return img
+	}
+
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+	log.Infof("截图缩放: %dx%d -> %dx%d", bounds.Dx(), bounds.Dy(), w, h)
+	return scaled
+}
+
 // GetScreenSize returns the screen dimensions
 func GetScreenSize() (int, int) {
 	width, height := robotgo.GetScreenSize()
@@ -369,6 +415,8 @@ func captureScreenshotSafe(opts ScreenshotOptions) ([]byte, error) {
 		return nil, fmt.Errorf("failed to capture screenshot using CaptureImg")
 	}
 
+	img = fitImage(img, opts.MaxWidth, opts.MaxHeight)
+
 	log.Infof("安全模式截图成功，开始编码: Format=%s", opts.Format)
 
 	// Encode image to bytes
@@ -0,0 +1,207 @@
+package transfer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 目标文件已存在时的处理策略
+const (
+	OverwriteAlways = "overwrite" // 覆盖
+	OverwriteSkip   = "skip"      // 跳过
+	OverwriteFail   = "fail"      // 报错
+)
+
+// 拉取结果状态
+const (
+	FetchDownloaded = "downloaded" // 已下载
+	FetchUnchanged  = "unchanged"  // 目标文件内容相同，无需下载
+	FetchSkipped    = "skipped"    // 目标文件已存在，按策略跳过
+)
+
+// 下载中断后的重试次数，重试时通过Range从已下载的位置继续
+const fetchRetries = 3
+
+const fetchSuffix = ".wmfetch"
+
+// FetchRequest 从服务器拉取文件的请求
+type FetchRequest struct {
+	URL       string `json:"url"`
+	Path      string `json:"path"`      // 保存的目标文件路径
+	SHA256    string `json:"sha256"`    // 文件SHA-256，下载完成后校验
+	Size      int64  `json:"size"`      // 文件大小，0表示不校验
+	Overwrite string `json:"overwrite"` // 目标已存在时的策略，默认overwrite
+}
+
+// FetchResult 拉取结果
+type FetchResult struct {
+	Status string `json:"status"`
+	Path   string `json:"path"`
+	Bytes  int64  `json:"bytes"` // 本次实际下载的字节数
+	SHA256 string `json:"sha256"`
+}
+
+// fileSHA256 计算文件的SHA-256
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Fetch 下载文件到目标路径并校验SHA-256
+// 下载先写入临时文件，网络中断时按Range续传，校验通过后才替换目标文件；
+// 临时文件名包含校验和，同一文件再次分发时可以继续上次未完成的下载
+func Fetch(ctx context.Context, client *http.Client, req FetchRequest) (*FetchResult, error) {
+	if req.URL == "" || req.Path == "" {
+		return nil, errors.New("缺少url或path参数")
+	}
+	if req.Overwrite == "" {
+		req.Overwrite = OverwriteAlways
+	}
+	req.SHA256 = strings.ToLower(req.SHA256)
+	path := filepath.Clean(req.Path)
+	result := &FetchResult{Path: path, SHA256: req.SHA256}
+
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return nil, fmt.Errorf("目标路径是目录: %s", path)
+		}
+		if req.SHA256 != "" && (req.Size <= 0 || info.Size() == req.Size) {
+			if sum, err := fileSHA256(path); err == nil && sum == req.SHA256 {
+				result.Status = FetchUnchanged
+				return result, nil
+			}
+		}
+		switch req.Overwrite {
+		case OverwriteSkip:
+			result.Status = FetchSkipped
+			return result, nil
+		case OverwriteFail:
+			return nil, ErrTargetExists
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	temp := path + fetchSuffix
+	if len(req.SHA256) >= 16 {
+		temp = path + "." + req.SHA256[:16] + fetchSuffix
+	}
+
+	var err error
+	for attempt := 0; attempt <= fetchRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+		var n int64
+		n, err = download(ctx, client, req.URL, temp)
+		result.Bytes += n
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(temp)
+	if err != nil {
+		return nil, err
+	}
+	if req.Size > 0 && info.Size() != req.Size {
+		os.Remove(temp)
+		return nil, fmt.Errorf("文件大小不一致: %d/%d", info.Size(), req.Size)
+	}
+	sum, err := fileSHA256(temp)
+	if err != nil {
+		return nil, err
+	}
+	if req.SHA256 != "" && sum != req.SHA256 {
+		os.Remove(temp)
+		return nil, ErrFileChecksum
+	}
+	result.SHA256 = sum
+
+	if err := os.Rename(temp, path); err != nil {
+		// Windows下目标存在时Rename会失败，先删除再重命名
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(temp, path); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Status = FetchDownloaded
+	return result, nil
+}
+
+// download 下载到临时文件，临时文件已有内容时从其末尾续传，返回本次下载的字节数
+func download(ctx context.Context, client *http.Client, url, temp string) (int64, error) {
+	file, err := os.OpenFile(temp, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// 服务器不支持Range或文件已变化，从头下载
+		if err := file.Truncate(0); err != nil {
+			return 0, err
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// 临时文件已经是完整的
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("下载失败: HTTP %d", resp.StatusCode)
+	}
+
+	return io.Copy(file, resp.Body)
+}
@@ -0,0 +1,79 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFetchResumesAndVerifies(t *testing.T) {
+	data := bytes.Repeat([]byte("abcdefgh"), 4096)
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(data))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	target := filepath.Join(dir, "sub", "file.bin")
+	req := FetchRequest{URL: server.URL, Path: target, SHA256: sum(data), Size: int64(len(data))}
+
+	// 模拟上次中断留下的临时文件
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	temp := target + "." + req.SHA256[:16] + fetchSuffix
+	if err := os.WriteFile(temp, data[:1000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := Fetch(context.Background(), server.Client(), req)
+	if err != nil {
+		t.Fatalf("Fetch failed: %v", err)
+	}
+	if result.Status != FetchDownloaded || result.Bytes != int64(len(data)-1000) {
+		t.Errorf("result = %+v", result)
+	}
+	if len(ranges) != 1 || ranges[0] != "bytes=1000-" {
+		t.Errorf("requested ranges = %v", ranges)
+	}
+	got, _ := os.ReadFile(target)
+	if !bytes.Equal(got, data) {
+		t.Fatal("downloaded content mismatch")
+	}
+
+	// 内容相同时不再下载
+	result, err = Fetch(context.Background(), server.Client(), req)
+	if err != nil || result.Status != FetchUnchanged {
+		t.Errorf("second Fetch = %+v, %v", result, err)
+	}
+
+	// 内容不同时按策略处理
+	os.WriteFile(target, []byte("old"), 0644)
+	req.Overwrite = OverwriteSkip
+	if result, err = Fetch(context.Background(), server.Client(), req); err != nil || result.Status != FetchSkipped {
+		t.Errorf("Fetch with skip = %+v, %v", result, err)
+	}
+	req.Overwrite = OverwriteFail
+	if _, err = Fetch(context.Background(), server.Client(), req); !errors.Is(err, ErrTargetExists) {
+		t.Errorf("Fetch with fail = %v, want ErrTargetExists", err)
+	}
+
+	// 校验失败时不替换目标文件
+	req.Overwrite = OverwriteAlways
+	req.SHA256 = sum([]byte("other"))
+	req.Size = 0
+	if _, err = Fetch(context.Background(), server.Client(), req); !errors.Is(err, ErrFileChecksum) {
+		t.Errorf("Fetch with wrong checksum = %v, want ErrFileChecksum", err)
+	}
+	if got, _ := os.ReadFile(target); string(got) != "old" {
+		t.Errorf("target replaced despite checksum failure: %q", got)
+	}
+}
@@ -0,0 +1,445 @@
+// Package transfer 实现可断点续传的文件传输：分块上传和从服务器拉取文件
+//
+// 每个上传会话在目标目录下保存一个临时数据文件和一个会话描述文件，
+// Agent重启后会话仍可继续。分块可以乱序或并发上传，每块带SHA-256校验，
+// 全部接收后再校验整个文件的SHA-256并原子重命名为目标文件。
+package transfer
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 临时文件后缀
+const (
+	partSuffix    = ".wmpart"
+	sessionSuffix = ".wmupload"
+)
+
+var (
+	// ErrSessionNotFound 上传会话不存在或已过期
+	ErrSessionNotFound = errors.New("上传会话不存在")
+	// ErrChunkChecksum 分块校验失败
+	ErrChunkChecksum = errors.New("分块SHA-256校验失败")
+	// ErrFileChecksum 整个文件校验失败
+	ErrFileChecksum = errors.New("文件SHA-256校验失败")
+	// ErrIncomplete 仍有未接收的数据
+	ErrIncomplete = errors.New("文件尚未接收完整")
+	// ErrOutOfRange 分块超出文件大小
+	ErrOutOfRange = errors.New("分块超出文件范围")
+	// ErrTargetExists 目标文件已存在且未允许覆盖
+	ErrTargetExists = errors.New("目标文件已存在")
+)
+
+// Range 已接收的数据区间 [Start, End)
+type Range struct {
+	Start int64 `json:"start"`
+	End   int64 `json:"end"`
+}
+
+// Session 上传会话
+type Session struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`   // 目标文件路径
+	Size      int64     `json:"size"`   // 文件总大小
+	SHA256    string    `json:"sha256"` // 整个文件的SHA-256(十六进制)，为空时不校验
+	Overwrite bool      `json:"overwrite"`
+	Received  []Range   `json:"received"` // 已接收的区间，按起点排序且互不重叠
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	mutex sync.Mutex
+}
+
+// Status 会话状态快照
+type Status struct {
+	ID            string    `json:"id"`
+	Path          string    `json:"path"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256,omitempty"`
+	Received      []Range   `json:"received"`
+	ReceivedBytes int64     `json:"received_bytes"`
+	NextOffset    int64     `json:"next_offset"` // 第一个缺失字节的位置，顺序续传时从这里开始
+	Complete      bool      `json:"complete"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// Manager 上传会话管理器
+type Manager struct {
+	mutex    sync.Mutex
+	sessions map[string]*Session
+	index    string        // 会话索引目录，保存会话ID到会话描述文件的映射
+	expire   time.Duration // 会话空闲过期时间
+}
+
+// NewManager 创建上传会话管理器，indexDir用于记录会话位置，Agent重启后据此恢复
+func NewManager(indexDir string, expire time.Duration) *Manager {
+	return &Manager{
+		sessions: make(map[string]*Session),
+		index:    indexDir,
+		expire:   expire,
+	}
+}
+
+// newSessionID 生成随机会话ID
+func newSessionID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// validSessionID 会话ID只能是十六进制字符，防止通过ID访问任意路径
+func validSessionID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
+
+func (s *Session) partPath() string {
+	return s.Path + "." + s.ID + partSuffix
+}
+
+func (s *Session) metaPath() string {
+	return s.Path + "." + s.ID + sessionSuffix
+}
+
+// Create 创建上传会话并预分配临时文件
+func (m *Manager) Create(path string, size int64, sum string, overwrite bool) (*Status, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("文件大小无效: %d", size)
+	}
+	if sum != "" {
+		if decoded, err := hex.DecodeString(sum); err != nil || len(decoded) != sha256.Size {
+			return nil, errors.New("sha256格式错误")
+		}
+		sum = strings.ToLower(sum)
+	}
+
+	path = filepath.Clean(path)
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			return nil, fmt.Errorf("目标路径是目录: %s", path)
+		}
+		if !overwrite {
+			return nil, ErrTargetExists
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+
+	m.CleanupExpired()
+
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	session := &Session{
+		ID:        id,
+		Path:      path,
+		Size:      size,
+		SHA256:    sum,
+		Overwrite: overwrite,
+		Received:  []Range{},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	part, err := os.OpenFile(session.partPath(), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return nil, err
+	}
+	err = part.Truncate(size)
+	part.Close()
+	if err != nil {
+		os.Remove(session.partPath())
+		return nil, err
+	}
+
+	if err := m.save(session); err != nil {
+		os.Remove(session.partPath())
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	m.sessions[id] = session
+	m.mutex.Unlock()
+
+	return session.status(), nil
+}
+
+// Get 获取上传会话，内存中没有时从索引目录恢复
+func (m *Manager) Get(id string) (*Session, error) {
+	if !validSessionID(id) {
+		return nil, ErrSessionNotFound
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if session, ok := m.sessions[id]; ok {
+		return session, nil
+	}
+
+	target, err := os.ReadFile(filepath.Join(m.index, id))
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	data, err := os.ReadFile(string(target))
+	if err != nil {
+		return nil, ErrSessionNotFound
+	}
+	session := &Session{}
+	if err := json.Unmarshal(data, session); err != nil || session.ID != id {
+		return nil, ErrSessionNotFound
+	}
+	if _, err := os.Stat(session.partPath()); err != nil {
+		return nil, ErrSessionNotFound
+	}
+
+	m.sessions[id] = session
+	return session, nil
+}
+
+// Status 获取会话状态
+func (m *Manager) Status(id string) (*Status, error) {
+	session, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	return session.status(), nil
+}
+
+// WriteChunk 写入一个分块；sum不为空时校验分块的SHA-256，校验失败的数据不计入已接收区间
+func (m *Manager) WriteChunk(id string, offset int64, length int64, sum string, r io.Reader) (*Status, error) {
+	session, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if offset < 0 || length < 0 || offset+length > session.Size {
+		return nil, ErrOutOfRange
+	}
+
+	part, err := os.OpenFile(session.partPath(), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+
+	hasher := sha256.New()
+	written, err := io.Copy(io.NewOffsetWriter(part, offset), io.TeeReader(io.LimitReader(r, length), hasher))
+	if err != nil {
+		return nil, err
+	}
+	if written != length {
+		return nil, fmt.Errorf("分块数据不完整: %d/%d", written, length)
+	}
+	if sum != "" && !strings.EqualFold(hex.EncodeToString(hasher.Sum(nil)), sum) {
+		return nil, ErrChunkChecksum
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.Received = mergeRange(session.Received, Range{Start: offset, End: offset + length})
+	session.UpdatedAt = time.Now()
+	if err := m.save(session); err != nil {
+		return nil, err
+	}
+	return session.status(), nil
+}
+
+// Complete 校验并完成上传，成功后临时文件重命名为目标文件
+func (m *Manager) Complete(id string) (*Status, error) {
+	session, err := m.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	status := session.status()
+	if !status.Complete {
+		return status, ErrIncomplete
+	}
+
+	if session.SHA256 != "" {
+		part, err := os.Open(session.partPath())
+		if err != nil {
+			return nil, err
+		}
+		hasher := sha256.New()
+		_, err = io.Copy(hasher, part)
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+		if hex.EncodeToString(hasher.Sum(nil)) != session.SHA256 {
+			// 数据已损坏，清空已接收区间以便客户端重新上传
+			session.Received = []Range{}
+			m.save(session)
+			return session.status(), ErrFileChecksum
+		}
+	}
+
+	if _, err := os.Stat(session.Path); err == nil && !session.Overwrite {
+		return status, ErrTargetExists
+	}
+	if err := os.Rename(session.partPath(), session.Path); err != nil {
+		// Windows下目标存在时Rename会失败，先删除再重命名
+		if !session.Overwrite {
+			return nil, err
+		}
+		if err := os.Remove(session.Path); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(session.partPath(), session.Path); err != nil {
+			return nil, err
+		}
+	}
+
+	m.forget(session)
+	return status, nil
+}
+
+// Abort 取消上传并删除临时文件
+func (m *Manager) Abort(id string) error {
+	session, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	os.Remove(session.partPath())
+	m.forget(session)
+	return nil
+}
+
+// CleanupExpired 删除空闲超过过期时间的会话
+func (m *Manager) CleanupExpired() int {
+	if m.expire <= 0 {
+		return 0
+	}
+
+	entries, err := os.ReadDir(m.index)
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		session, err := m.Get(entry.Name())
+		if err != nil {
+			// 描述文件已丢失的索引直接删除
+			if validSessionID(entry.Name()) {
+				os.Remove(filepath.Join(m.index, entry.Name()))
+			}
+			continue
+		}
+
+		session.mutex.Lock()
+		if time.Since(session.UpdatedAt) > m.expire {
+			os.Remove(session.partPath())
+			m.forget(session)
+			removed++
+		}
+		session.mutex.Unlock()
+	}
+	return removed
+}
+
+// save 保存会话描述文件和索引
+func (m *Manager) save(session *Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(session.metaPath(), data, 0644); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.index, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(m.index, session.ID), []byte(session.metaPath()), 0644)
+}
+
+// forget 删除会话描述文件和索引
+func (m *Manager) forget(session *Session) {
+	os.Remove(session.metaPath())
+	os.Remove(filepath.Join(m.index, session.ID))
+
+	m.mutex.Lock()
+	delete(m.sessions, session.ID)
+	m.mutex.Unlock()
+}
+
+// status 生成会话状态快照，调用方需持有会话锁或保证会话未被并发修改
+func (s *Session) status() *Status {
+	received := make([]Range, len(s.Received))
+	copy(received, s.Received)
+
+	var total, next int64
+	for _, r := range received {
+		total += r.End - r.Start
+	}
+	if len(received) > 0 && received[0].Start == 0 {
+		next = received[0].End
+	}
+
+	return &Status{
+		ID:            s.ID,
+		Path:          s.Path,
+		Size:          s.Size,
+		SHA256:        s.SHA256,
+		Received:      received,
+		ReceivedBytes: total,
+		NextOffset:    next,
+		Complete:      total == s.Size,
+		CreatedAt:     s.CreatedAt,
+		UpdatedAt:     s.UpdatedAt,
+	}
+}
+
+// mergeRange 将新区间合并到已排序的区间列表中，相邻或重叠的区间合并为一个
+func mergeRange(ranges []Range, add Range) []Range {
+	if add.End <= add.Start {
+		return ranges
+	}
+
+	all := append(append([]Range{}, ranges...), add)
+	sort.Slice(all, func(i, j int) bool { return all[i].Start < all[j].Start })
+
+	merged := []Range{all[0]}
+	for _, r := range all[1:] {
+		last := &merged[len(merged)-1]
+		if r.Start <= last.End {
+			if r.End > last.End {
+				last.End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
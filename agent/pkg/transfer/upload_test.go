@@ -0,0 +1,120 @@
+package transfer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func sum(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
+
+func TestMergeRange(t *testing.T) {
+	var ranges []Range
+	ranges = mergeRange(ranges, Range{10, 20})
+	ranges = mergeRange(ranges, Range{0, 5})
+	ranges = mergeRange(ranges, Range{30, 40})
+	ranges = mergeRange(ranges, Range{5, 10})
+	ranges = mergeRange(ranges, Range{15, 32})
+
+	want := []Range{{0, 40}}
+	if len(ranges) != len(want) || ranges[0] != want[0] {
+		t.Fatalf("mergeRange = %v, want %v", ranges, want)
+	}
+}
+
+func TestUploadOutOfOrderAndResume(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789"), 100)
+	target := filepath.Join(dir, "out", "file.bin")
+
+	manager := NewManager(filepath.Join(dir, "index"), time.Hour)
+	status, err := manager.Create(target, int64(len(data)), sum(data), false)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	id := status.ID
+
+	// 后半部分先到
+	if _, err := manager.WriteChunk(id, 600, 400, sum(data[600:]), bytes.NewReader(data[600:])); err != nil {
+		t.Fatalf("WriteChunk failed: %v", err)
+	}
+	// 校验失败的分块不计入
+	if _, err := manager.WriteChunk(id, 0, 300, sum(data[1:301]), bytes.NewReader(data[:300])); !errors.Is(err, ErrChunkChecksum) {
+		t.Fatalf("WriteChunk with bad checksum = %v, want ErrChunkChecksum", err)
+	}
+	if _, err := manager.Complete(id); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("Complete before all chunks = %v, want ErrIncomplete", err)
+	}
+
+	// 模拟Agent重启后恢复会话
+	manager = NewManager(filepath.Join(dir, "index"), time.Hour)
+	status, err = manager.Status(id)
+	if err != nil {
+		t.Fatalf("Status after restart failed: %v", err)
+	}
+	if status.ReceivedBytes != 400 || status.NextOffset != 0 {
+		t.Fatalf("status after restart = %+v", status)
+	}
+
+	if _, err := manager.WriteChunk(id, 0, 600, sum(data[:600]), bytes.NewReader(data[:600])); err != nil {
+		t.Fatalf("WriteChunk failed: %v", err)
+	}
+	if _, err := manager.Complete(id); err != nil {
+		t.Fatalf("Complete failed: %v", err)
+	}
+
+	got, err := os.ReadFile(target)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("uploaded file mismatch: %v", err)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(dir, "out", "*.wm*"))
+	if len(leftovers) != 0 {
+		t.Errorf("temporary files left behind: %v", leftovers)
+	}
+	if _, err := manager.Status(id); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Status after complete = %v, want ErrSessionNotFound", err)
+	}
+}
+
+func TestUploadFileChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("hello world")
+	target := filepath.Join(dir, "file.txt")
+
+	manager := NewManager(filepath.Join(dir, "index"), time.Hour)
+	status, err := manager.Create(target, int64(len(data)), sum([]byte("something else")), false)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if _, err := manager.WriteChunk(status.ID, 0, int64(len(data)), "", bytes.NewReader(data)); err != nil {
+		t.Fatalf("WriteChunk failed: %v", err)
+	}
+	status, err = manager.Complete(status.ID)
+	if !errors.Is(err, ErrFileChecksum) {
+		t.Fatalf("Complete = %v, want ErrFileChecksum", err)
+	}
+	if status.ReceivedBytes != 0 {
+		t.Errorf("received bytes after checksum failure = %d, want 0", status.ReceivedBytes)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("target created despite checksum failure: %v", err)
+	}
+
+	if err := manager.Abort(status.ID); err != nil {
+		t.Fatalf("Abort failed: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.Name() != "index" {
+			t.Errorf("unexpected file after abort: %s", entry.Name())
+		}
+	}
+}
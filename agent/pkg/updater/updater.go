@@ -0,0 +1,260 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 更新状态，与后端models中的UpdateStatus常量一致
+const (
+	StatusTrial      = "trial"       // 已替换为新版本，等待新版本重新注册
+	StatusConfirmed  = "confirmed"   // 新版本已重新注册，更新完成
+	StatusRolledBack = "rolled_back" // 新版本未能重新注册，已回滚到旧版本
+	StatusFailed     = "failed"      // 下载或校验失败，未替换
+)
+
+const (
+	newSuffix = ".new" // 下载中的新版本
+	oldSuffix = ".old" // 替换后保留的旧版本，确认成功后删除
+	stateFile = "update-state.json"
+)
+
+// ErrSignature 签名校验失败
+var ErrSignature = errors.New("安装包签名校验失败")
+
+// Release 后端下发的更新信息
+type Release struct {
+	ReleaseID uint   `json:"release_id"`
+	Version   string `json:"version" binding:"required"`
+	URL       string `json:"url" binding:"required"`
+	SHA256    string `json:"sha256" binding:"required"`
+	Size      int64  `json:"size"`
+	Signature string `json:"signature"` // SHA-256摘要的Ed25519签名(base64)
+}
+
+// State 保存在程序目录中的更新状态，新旧进程通过它交接
+type State struct {
+	Version         string    `json:"version"`          // 目标版本
+	PreviousVersion string    `json:"previous_version"` // 更新前的版本
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	Reported        bool      `json:"reported"` // 结果是否已在心跳中上报
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// Executable 当前程序文件的实际路径
+func Executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
+
+// NewPath 下载新版本使用的路径
+func NewPath(exe string) string {
+	return exe + newSuffix
+}
+
+// StatePath 更新状态文件路径
+func StatePath(exe string) string {
+	return filepath.Join(filepath.Dir(exe), stateFile)
+}
+
+// LoadState 读取更新状态，文件不存在时返回nil
+func LoadState(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SaveState 写入更新状态，先写临时文件再重命名，避免读到不完整的内容
+func SaveState(path string, state *State) error {
+	state.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(path)
+		return os.Rename(temp, path)
+	}
+	return nil
+}
+
+// VerifySignature 使用Ed25519公钥(base64)校验SHA-256摘要的签名
+func VerifySignature(publicKey, sum, signature string) error {
+	key, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("公钥格式错误")
+	}
+	digest, err := hex.DecodeString(strings.ToLower(sum))
+	if err != nil || len(digest) == 0 {
+		return fmt.Errorf("SHA-256格式错误")
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || len(sig) != ed25519.SignatureSize {
+		return ErrSignature
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), digest, sig) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// Replace 用新版本替换程序文件，旧版本重命名为.old保留用于回滚
+// 运行中的程序文件在Windows下不能删除或覆盖，但可以重命名
+func Replace(exe, newFile string) error {
+	old := exe + oldSuffix
+	if err := os.Remove(old); err != nil && !os.IsNotExist(err) {
+		// 上次保留的旧版本仍被占用时改为唯一名称，稍后由RemoveOld清理
+		if renameErr := os.Rename(old, fmt.Sprintf("%s.%d", old, time.Now().UnixNano())); renameErr != nil {
+			return fmt.Errorf("删除上次保留的旧版本失败: %w", err)
+		}
+	}
+	if err := os.Rename(exe, old); err != nil {
+		return err
+	}
+	if err := os.Rename(newFile, exe); err != nil {
+		if restoreErr := os.Rename(old, exe); restoreErr != nil {
+			return fmt.Errorf("替换失败: %v, 恢复旧版本失败: %v", err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Restore 用保留的旧版本恢复程序文件，新版本进程需已退出
+func Restore(exe string) error {
+	old := exe + oldSuffix
+	if _, err := os.Stat(old); err != nil {
+		return fmt.Errorf("旧版本不存在: %w", err)
+	}
+	if err := os.Remove(exe); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Rename(old, exe)
+}
+
+// RemoveOld 删除保留的旧版本及之前因被占用而改名的旧版本；旧进程可能还未退出，失败时重试直到超时
+func RemoveOld(exe string, timeout time.Duration) error {
+	old := exe + oldSuffix
+	deadline := time.Now().Add(timeout)
+	for {
+		err := os.Remove(old)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		stale, _ := filepath.Glob(old + ".*")
+		for _, path := range stale {
+			if removeErr := os.Remove(path); removeErr != nil && err == nil {
+				err = removeErr
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// RunTrial 启动替换后的新版本并等待它确认（状态变为confirmed）
+// 新进程在超时前退出或未确认时将其结束、恢复旧版本并启动旧版本，返回失败原因；
+// 调用方需要先释放监听端口，本函数返回后应直接退出
+func RunTrial(exe string, args []string, statePath string, timeout time.Duration) error {
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir, _ = os.Getwd()
+	if err := cmd.Start(); err != nil {
+		return rollback(exe, args, statePath, fmt.Errorf("启动新版本失败: %w", err))
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	deadline := time.After(timeout)
+
+	for {
+		select {
+		case err := <-exited:
+			return rollback(exe, args, statePath, fmt.Errorf("新版本在重新注册前退出: %v", err))
+		case <-deadline:
+			cmd.Process.Kill()
+			<-exited
+			return rollback(exe, args, statePath, fmt.Errorf("新版本未在%s内重新注册", timeout))
+		case <-ticker.C:
+			state, err := LoadState(statePath)
+			if err == nil && state != nil && state.Status == StatusConfirmed {
+				cmd.Process.Release()
+				return nil
+			}
+		}
+	}
+}
+
+// rollback 恢复旧版本、记录失败原因并启动旧版本
+func rollback(exe string, args []string, statePath string, cause error) error {
+	if err := RollBack(exe, statePath, cause); err != nil {
+		return err
+	}
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir, _ = os.Getwd()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("%s; 启动旧版本失败: %v", cause, err)
+	}
+	cmd.Process.Release()
+	return cause
+}
+
+// RollBack 恢复旧版本并将更新状态记录为rolled_back，新版本进程需已退出
+func RollBack(exe, statePath string, cause error) error {
+	state, _ := LoadState(statePath)
+	if state == nil {
+		state = &State{}
+	}
+	state.Status = StatusRolledBack
+	state.Error = cause.Error()
+	state.Reported = false
+
+	if err := Restore(exe); err != nil {
+		state.Error = fmt.Sprintf("%s; 恢复旧版本失败: %v", cause, err)
+		SaveState(statePath, state)
+		return fmt.Errorf("%s", state.Error)
+	}
+	return SaveState(statePath, state)
+}
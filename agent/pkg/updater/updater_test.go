@@ -0,0 +1,195 @@
+package updater
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestReplaceAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "agent")
+	if err := os.WriteFile(exe, []byte("v1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(NewPath(exe), []byte("v2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Replace(exe, NewPath(exe)); err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "v2" {
+		t.Fatalf("after replace got %q", data)
+	}
+	if data, _ := os.ReadFile(exe + oldSuffix); string(data) != "v1" {
+		t.Fatalf("old version got %q", data)
+	}
+
+	if err := Restore(exe); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "v1" {
+		t.Fatalf("after restore got %q", data)
+	}
+	if err := Restore(exe); err == nil {
+		t.Fatal("Restore without old version should fail")
+	}
+}
+
+func TestReplaceWithLockedOldVersion(t *testing.T) {
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "agent")
+	if err := os.WriteFile(exe, []byte("v2"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(NewPath(exe), []byte("v3"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 非空目录无法删除，模拟Windows下仍被运行中的进程占用的旧版本
+	locked := filepath.Join(exe+oldSuffix, "image")
+	if err := os.MkdirAll(filepath.Dir(locked), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(locked, []byte("v1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Replace(exe, NewPath(exe)); err != nil {
+		t.Fatalf("Replace with locked old version: %v", err)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "v3" {
+		t.Fatalf("after replace got %q", data)
+	}
+	if data, _ := os.ReadFile(exe + oldSuffix); string(data) != "v2" {
+		t.Fatalf("old version got %q", data)
+	}
+	stale, _ := filepath.Glob(exe + oldSuffix + ".*")
+	if len(stale) != 1 {
+		t.Fatalf("locked old version should be renamed aside, got %v", stale)
+	}
+
+	// 占用解除后一并清理
+	if err := os.Remove(filepath.Join(stale[0], "image")); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveOld(exe, 0); err != nil {
+		t.Fatalf("RemoveOld: %v", err)
+	}
+	if left, _ := filepath.Glob(exe + oldSuffix + "*"); len(left) != 0 {
+		t.Fatalf("old versions left: %v", left)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256([]byte("agent binary"))
+	sum := hex.EncodeToString(digest[:])
+	key := base64.StdEncoding.EncodeToString(pub)
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(priv, digest[:]))
+
+	if err := VerifySignature(key, sum, sig); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+
+	other := sha256.Sum256([]byte("tampered"))
+	if err := VerifySignature(key, hex.EncodeToString(other[:]), sig); err != ErrSignature {
+		t.Fatalf("tampered digest: got %v", err)
+	}
+	if err := VerifySignature(key, sum, ""); err != ErrSignature {
+		t.Fatalf("missing signature: got %v", err)
+	}
+	if err := VerifySignature("bad", sum, sig); err == nil {
+		t.Fatal("bad public key accepted")
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := StatePath(filepath.Join(t.TempDir(), "agent"))
+	if state, err := LoadState(path); err != nil || state != nil {
+		t.Fatalf("missing state: got %v, %v", state, err)
+	}
+
+	if err := SaveState(path, &State{Version: "1.1.0", PreviousVersion: "1.0.0", Status: StatusTrial}); err != nil {
+		t.Fatal(err)
+	}
+	state, err := LoadState(path)
+	if err != nil || state == nil {
+		t.Fatalf("LoadState: %v", err)
+	}
+	if state.Version != "1.1.0" || state.Status != StatusTrial || state.UpdatedAt.IsZero() {
+		t.Fatalf("unexpected state %+v", state)
+	}
+}
+
+func TestRunTrialRollback(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts")
+	}
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "agent")
+	statePath := StatePath(exe)
+	marker := filepath.Join(dir, "restarted")
+
+	// 旧版本启动时写入标记文件，新版本直接退出
+	if err := os.WriteFile(exe+oldSuffix, []byte("#!/bin/sh\ntouch "+marker+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(exe, []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveState(statePath, &State{Version: "1.1.0", Status: StatusTrial}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunTrial(exe, nil, statePath, 10*time.Second); err == nil {
+		t.Fatal("expected rollback error")
+	}
+	state, _ := LoadState(statePath)
+	if state == nil || state.Status != StatusRolledBack || state.Error == "" {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	if data, _ := os.ReadFile(exe); string(data) != "#!/bin/sh\ntouch "+marker+"\n" {
+		t.Fatalf("old version not restored: %q", data)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(marker); err == nil {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("old version was not restarted")
+}
+
+func TestRunTrialConfirmed(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts")
+	}
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "agent")
+	statePath := StatePath(exe)
+
+	// 新版本把状态改为confirmed后继续运行
+	script := "#!/bin/sh\nprintf '{\"version\":\"1.1.0\",\"status\":\"confirmed\"}' > " + statePath + "\nsleep 1\n"
+	if err := os.WriteFile(exe, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveState(statePath, &State{Version: "1.1.0", Status: StatusTrial}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RunTrial(exe, nil, statePath, 10*time.Second); err != nil {
+		t.Fatalf("RunTrial: %v", err)
+	}
+}
@@ -25,6 +25,15 @@ func NewFrameLimiter(desiredFps int) *FrameLimiter {
 	}
 }
 
+// SetFPS 修改目标帧率，下一帧起生效
+func (l *FrameLimiter) SetFPS(desiredFps int) {
+	if desiredFps <= 0 || desiredFps == l.DesiredFps {
+		return
+	}
+	l.DesiredFps = desiredFps
+	l.frameTimeNs = (time.Second / time.Duration(desiredFps)).Nanoseconds()
+}
+
 // Wait 等待到下一帧的时间
 func (l *FrameLimiter) Wait() {
 	l.DidSleep = false
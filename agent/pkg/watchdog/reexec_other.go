@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package watchdog
+
+import (
+	"os"
+	"syscall"
+)
+
+// Reexec 以指定程序替换当前进程映像重新启动看门狗，进程ID不变；成功时不返回
+func Reexec(exe string, args []string) error {
+	return syscall.Exec(exe, append([]string{exe}, args...), os.Environ())
+}
@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package watchdog
+
+import (
+	"os"
+	"os/exec"
+)
+
+// Reexec 以指定程序重新启动看门狗；Windows不支持替换当前进程映像，启动新进程后由调用方退出
+func Reexec(exe string, args []string) error {
+	cmd := exec.Command(exe, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir, _ = os.Getwd()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
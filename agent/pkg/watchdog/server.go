@@ -0,0 +1,115 @@
+package watchdog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// 控制接口只监听本机地址，由Agent的/watchdog路由调用
+const controlHost = "127.0.0.1"
+
+// controlResponse 控制接口的响应
+type controlResponse struct {
+	Code    int     `json:"code"`
+	Message string  `json:"message,omitempty"`
+	Data    *Status `json:"data,omitempty"`
+}
+
+// ControlAddr 控制接口的监听地址
+func ControlAddr(port int) string {
+	return fmt.Sprintf("%s:%d", controlHost, port)
+}
+
+// Handler 控制接口：GET /status, POST /settings, POST /update, POST /stop
+func (w *Watchdog) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		writeControl(rw, http.StatusOK, "", w.Status())
+	})
+	mux.HandleFunc("/settings", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeControl(rw, http.StatusMethodNotAllowed, "method not allowed", w.Status())
+			return
+		}
+		var settings Settings
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			writeControl(rw, http.StatusBadRequest, err.Error(), w.Status())
+			return
+		}
+		w.UpdateSettings(settings)
+		writeControl(rw, http.StatusOK, "", w.Status())
+	})
+	mux.HandleFunc("/update", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeControl(rw, http.StatusMethodNotAllowed, "method not allowed", w.Status())
+			return
+		}
+		w.NotifyUpdate()
+		writeControl(rw, http.StatusOK, "", w.Status())
+	})
+	mux.HandleFunc("/stop", func(rw http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeControl(rw, http.StatusMethodNotAllowed, "method not allowed", w.Status())
+			return
+		}
+		status := w.Status()
+		writeControl(rw, http.StatusOK, "", status)
+		// 响应发出后再停止，Agent保持运行
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			w.Stop(true)
+		}()
+	})
+	return mux
+}
+
+func writeControl(rw http.ResponseWriter, code int, message string, status Status) {
+	resp := controlResponse{Data: &status, Message: message}
+	if code != http.StatusOK {
+		resp.Code = code
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(resp)
+}
+
+// controlClient 访问看门狗控制接口的客户端
+var controlClient = &http.Client{Timeout: 3 * time.Second}
+
+// Call 调用看门狗控制接口，body为nil时使用GET，看门狗未运行时返回错误
+func Call(port int, path string, body interface{}) (*Status, error) {
+	url := fmt.Sprintf("http://%s%s", ControlAddr(port), path)
+
+	var resp *http.Response
+	var err error
+	if body == nil {
+		resp, err = controlClient.Get(url)
+	} else {
+		data, marshalErr := json.Marshal(body)
+		if marshalErr != nil {
+			return nil, marshalErr
+		}
+		resp, err = controlClient.Post(url, "application/json", bytes.NewReader(data))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result controlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("看门狗响应格式错误: %w", err)
+	}
+	if result.Code != 0 {
+		return result.Data, fmt.Errorf("看门狗返回错误: %s", result.Message)
+	}
+	return result.Data, nil
+}
+
+// GetStatus 获取看门狗状态，看门狗未运行时返回错误
+func GetStatus(port int) (*Status, error) {
+	return Call(port, "/status", nil)
+}
@@ -0,0 +1,464 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"winmanager-agent/pkg/updater"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// 默认参数
+const (
+	DefaultHealthInterval = 10 * time.Second
+	DefaultHealthFailures = 3
+	DefaultMinBackoff     = time.Second
+	DefaultMaxBackoff     = time.Minute
+	DefaultStableAfter    = 5 * time.Minute
+	DefaultTrialTimeout   = 2 * time.Minute
+)
+
+// 检查更新状态和计时的间隔
+const tickInterval = time.Second
+
+// ErrUpgraded 新版本已确认，看门狗本身仍是旧版本的程序映像，需要用新版本重新启动看门狗并接管Agent
+var ErrUpgraded = errors.New("Agent已更新，看门狗需要切换到新版本")
+
+// Options 看门狗选项
+type Options struct {
+	Exe            string        // Agent程序路径
+	Args           []string      // 启动Agent的参数
+	HealthURL      string        // Agent健康检查地址
+	HealthInterval time.Duration // 健康检查间隔
+	HealthFailures int           // 连续失败多少次视为无响应
+	MinBackoff     time.Duration // 重启的初始等待时间，连续重启时翻倍
+	MaxBackoff     time.Duration // 重启的最长等待时间
+	StableAfter    time.Duration // 运行超过该时长后重置退避
+	TrialTimeout   time.Duration // 更新后新版本重新注册的超时
+	StatePath      string        // 更新状态文件路径
+	AttachPID      int           // 接管已运行的Agent进程，0表示直接启动
+	Version        string        // 看门狗版本
+}
+
+// Settings 可在运行时调整的参数，单位为秒，0表示不修改
+type Settings struct {
+	HealthInterval int `json:"health_interval" form:"health_interval"`
+	HealthFailures int `json:"health_failures" form:"health_failures"`
+	MaxBackoff     int `json:"max_backoff" form:"max_backoff"`
+}
+
+// Status 看门狗状态
+type Status struct {
+	Version        string     `json:"version"`
+	PID            int        `json:"pid"`
+	AgentPID       int        `json:"agent_pid"`
+	Attached       bool       `json:"attached"` // 监控的是接管的Agent进程，而非看门狗启动的
+	StartedAt      time.Time  `json:"started_at"`
+	AgentStartedAt *time.Time `json:"agent_started_at"`
+	Restarts       int        `json:"restarts"`
+	LastExit       string     `json:"last_exit"` // 最近一次重启的原因
+	LastRestartAt  *time.Time `json:"last_restart_at"`
+	HealthFailures int        `json:"health_failures"` // 当前连续健康检查失败次数
+	Updating       bool       `json:"updating"`        // Agent已下载新版本，等待重启
+	Trial          bool       `json:"trial"`           // 新版本运行中，等待重新注册
+	Settings       Settings   `json:"settings"`
+}
+
+// 监控结束的原因
+type outcome int
+
+const (
+	outcomeStopped     outcome = iota // 看门狗停止
+	outcomeExited                     // Agent退出
+	outcomeHang                       // Agent无响应
+	outcomeUpdate                     // Agent为更新而退出
+	outcomeTrialFailed                // 新版本未能重新注册
+	outcomeUpgraded                   // 新版本已重新注册，Agent继续运行
+)
+
+// Watchdog 启动并监控Agent：崩溃或无响应时按退避重启，并接管Agent更新后的重启和回滚
+type Watchdog struct {
+	opts      Options
+	client    *http.Client
+	ctx       context.Context
+	cancel    context.CancelFunc
+	mutex     sync.Mutex
+	status    Status
+	update    bool // Agent已通知将为更新退出
+	keepAgent bool // 停止时保留Agent运行
+}
+
+// New 创建看门狗
+func New(opts Options) *Watchdog {
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = DefaultHealthInterval
+	}
+	if opts.HealthFailures <= 0 {
+		opts.HealthFailures = DefaultHealthFailures
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = DefaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = DefaultMaxBackoff
+	}
+	if opts.StableAfter <= 0 {
+		opts.StableAfter = DefaultStableAfter
+	}
+	if opts.TrialTimeout <= 0 {
+		opts.TrialTimeout = DefaultTrialTimeout
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Watchdog{
+		opts:   opts,
+		client: &http.Client{Timeout: 5 * time.Second},
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	w.status = Status{
+		Version:   opts.Version,
+		PID:       os.Getpid(),
+		StartedAt: time.Now(),
+	}
+	w.status.Settings = w.settings()
+	return w
+}
+
+// settings 当前参数，调用方需持有锁或在初始化时调用
+func (w *Watchdog) settings() Settings {
+	return Settings{
+		HealthInterval: int(w.opts.HealthInterval / time.Second),
+		HealthFailures: w.opts.HealthFailures,
+		MaxBackoff:     int(w.opts.MaxBackoff / time.Second),
+	}
+}
+
+// Status 获取看门狗状态
+func (w *Watchdog) Status() Status {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	status := w.status
+	status.Updating = w.update
+	return status
+}
+
+// UpdateSettings 调整健康检查和退避参数，返回调整后的参数
+func (w *Watchdog) UpdateSettings(settings Settings) Settings {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if settings.HealthInterval > 0 {
+		w.opts.HealthInterval = time.Duration(settings.HealthInterval) * time.Second
+	}
+	if settings.HealthFailures > 0 {
+		w.opts.HealthFailures = settings.HealthFailures
+	}
+	if settings.MaxBackoff > 0 {
+		w.opts.MaxBackoff = time.Duration(settings.MaxBackoff) * time.Second
+	}
+	w.status.Settings = w.settings()
+	log.WithField("settings", w.status.Settings).Info("看门狗参数已更新")
+	return w.status.Settings
+}
+
+// NotifyUpdate Agent已替换程序文件并即将退出，下次退出后立即启动新版本并等待其重新注册
+func (w *Watchdog) NotifyUpdate() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.update = true
+	log.Info("Agent即将为更新重启")
+}
+
+// Stop 停止看门狗，keepAgent为true时Agent继续运行
+func (w *Watchdog) Stop(keepAgent bool) {
+	w.mutex.Lock()
+	w.keepAgent = keepAgent
+	w.mutex.Unlock()
+	w.cancel()
+}
+
+// Run 启动并监控Agent直到Stop；新版本确认后返回ErrUpgraded，Agent保持运行，
+// 调用方应通过Reexec以新版本重新启动看门狗并接管Status().AgentPID
+func (w *Watchdog) Run() error {
+	if w.opts.AttachPID > 0 {
+		if w.superviseAttached() == outcomeStopped {
+			return nil
+		}
+	}
+
+	backoffs := 0
+	trial := w.takeUpdate()
+	for {
+		if w.ctx.Err() != nil {
+			return nil
+		}
+
+		started := time.Now()
+		cmd, exited, err := w.start(trial)
+		result := outcomeExited
+		detail := ""
+		if err != nil {
+			detail = fmt.Sprintf("启动Agent失败: %v", err)
+			if trial {
+				result = outcomeTrialFailed
+			}
+		} else {
+			result, detail = w.supervise(cmd, exited, trial)
+		}
+
+		switch result {
+		case outcomeStopped:
+			return nil
+		case outcomeUpgraded:
+			return ErrUpgraded
+		case outcomeUpdate:
+			trial = true
+			w.recordRestart("更新到新版本")
+			continue
+		case outcomeTrialFailed:
+			log.WithField("reason", detail).Error("新版本未能重新注册，回滚到旧版本")
+			if err := updater.RollBack(w.opts.Exe, w.opts.StatePath, errors.New(detail)); err != nil {
+				log.WithError(err).Error("回滚失败")
+			}
+			trial = false
+			w.recordRestart(detail)
+			continue
+		}
+
+		// 崩溃或无响应：运行足够久后重置退避，否则等待时间逐次翻倍
+		trial = false
+		if time.Since(started) >= w.opts.StableAfter {
+			backoffs = 0
+		}
+		delay := w.backoff(backoffs)
+		backoffs++
+		log.WithFields(log.Fields{"reason": detail, "delay": delay.String()}).Warn("Agent异常，等待后重启")
+		w.recordRestart(detail)
+
+		select {
+		case <-w.ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff 第n次连续重启前的等待时间
+func (w *Watchdog) backoff(n int) time.Duration {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delay := w.opts.MinBackoff
+	for i := 0; i < n && delay < w.opts.MaxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > w.opts.MaxBackoff {
+		delay = w.opts.MaxBackoff
+	}
+	return delay
+}
+
+// start 启动Agent进程
+func (w *Watchdog) start(trial bool) (*exec.Cmd, <-chan error, error) {
+	cmd := exec.Command(w.opts.Exe, w.opts.Args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir, _ = os.Getwd()
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	now := time.Now()
+	w.mutex.Lock()
+	w.status.AgentPID = cmd.Process.Pid
+	w.status.AgentStartedAt = &now
+	w.status.Attached = false
+	w.status.HealthFailures = 0
+	w.status.Trial = trial
+	w.mutex.Unlock()
+
+	log.WithFields(log.Fields{"pid": cmd.Process.Pid, "trial": trial}).Info("Agent已启动")
+	return cmd, exited, nil
+}
+
+// supervise 监控看门狗启动的Agent直到退出、无响应、新版本失败或看门狗停止
+func (w *Watchdog) supervise(cmd *exec.Cmd, exited <-chan error, trial bool) (outcome, string) {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	started := time.Now()
+	lastCheck := started
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			w.mutex.Lock()
+			keep := w.keepAgent
+			w.mutex.Unlock()
+			if !keep {
+				cmd.Process.Kill()
+				<-exited
+			} else {
+				cmd.Process.Release()
+			}
+			return outcomeStopped, ""
+		case err := <-exited:
+			if w.takeUpdate() {
+				return outcomeUpdate, ""
+			}
+			if trial {
+				return outcomeTrialFailed, fmt.Sprintf("新版本在重新注册前退出: %v", err)
+			}
+			return outcomeExited, fmt.Sprintf("Agent退出: %v", err)
+		case <-ticker.C:
+		}
+
+		if trial {
+			if w.confirmed() {
+				w.setTrial(false)
+				log.Info("新版本已重新注册，更新完成")
+				return outcomeUpgraded, ""
+			} else if time.Since(started) >= w.opts.TrialTimeout {
+				cmd.Process.Kill()
+				<-exited
+				return outcomeTrialFailed, fmt.Sprintf("新版本未在%s内重新注册", w.opts.TrialTimeout)
+			}
+			// 新版本确认前只按超时判断，不做健康检查
+			continue
+		}
+
+		if time.Since(lastCheck) < w.healthInterval() {
+			continue
+		}
+		lastCheck = time.Now()
+		if w.checkHealth() {
+			continue
+		}
+		if w.healthFailed() {
+			cmd.Process.Kill()
+			<-exited
+			if w.takeUpdate() {
+				return outcomeUpdate, ""
+			}
+			return outcomeHang, "Agent健康检查连续失败"
+		}
+	}
+}
+
+// superviseAttached 监控接管的Agent进程，只能通过健康检查判断状态；
+// Agent无响应时结束该进程，为更新退出时直接返回，随后由看门狗启动Agent
+func (w *Watchdog) superviseAttached() outcome {
+	w.mutex.Lock()
+	w.status.AgentPID = w.opts.AttachPID
+	w.status.Attached = true
+	w.mutex.Unlock()
+	log.WithField("pid", w.opts.AttachPID).Info("接管已运行的Agent")
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	lastCheck := time.Now()
+
+	for {
+		select {
+		case <-w.ctx.Done():
+			return outcomeStopped
+		case <-ticker.C:
+		}
+
+		if time.Since(lastCheck) < w.healthInterval() {
+			continue
+		}
+		lastCheck = time.Now()
+		if w.checkHealth() {
+			continue
+		}
+
+		w.mutex.Lock()
+		updating := w.update
+		w.mutex.Unlock()
+		if updating {
+			return outcomeUpdate
+		}
+		if w.healthFailed() {
+			if process, err := os.FindProcess(w.opts.AttachPID); err == nil {
+				process.Kill()
+			}
+			w.recordRestart("接管的Agent健康检查连续失败")
+			return outcomeHang
+		}
+	}
+}
+
+// checkHealth 请求Agent的健康检查接口，成功时清零连续失败次数
+func (w *Watchdog) checkHealth() bool {
+	resp, err := w.client.Get(w.opts.HealthURL)
+	if err == nil {
+		resp.Body.Close()
+	}
+	ok := err == nil && resp.StatusCode == http.StatusOK
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if ok {
+		w.status.HealthFailures = 0
+	} else {
+		w.status.HealthFailures++
+		log.WithFields(log.Fields{"failures": w.status.HealthFailures, "error": err}).Warn("Agent健康检查失败")
+	}
+	return ok
+}
+
+// healthFailed 连续失败次数是否达到阈值
+func (w *Watchdog) healthFailed() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.status.HealthFailures >= w.opts.HealthFailures
+}
+
+// healthInterval 当前的健康检查间隔
+func (w *Watchdog) healthInterval() time.Duration {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.opts.HealthInterval
+}
+
+// takeUpdate 取出Agent的更新通知
+func (w *Watchdog) takeUpdate() bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	update := w.update
+	w.update = false
+	return update
+}
+
+// confirmed 新版本是否已重新注册
+func (w *Watchdog) confirmed() bool {
+	state, err := updater.LoadState(w.opts.StatePath)
+	return err == nil && state != nil && state.Status == updater.StatusConfirmed
+}
+
+func (w *Watchdog) setTrial(trial bool) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.status.Trial = trial
+}
+
+// recordRestart 记录重启原因
+func (w *Watchdog) recordRestart(reason string) {
+	now := time.Now()
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.status.Restarts++
+	w.status.LastExit = reason
+	w.status.LastRestartAt = &now
+}
@@ -0,0 +1,194 @@
+package watchdog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"winmanager-agent/pkg/updater"
+)
+
+// writeScript 写入可执行的shell脚本
+func writeScript(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// countLines 统计脚本每次启动时追加的行数
+func countLines(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	return strings.Count(string(data), "\n")
+}
+
+// waitFor 等待条件成立
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("condition not met before timeout")
+}
+
+func skipWindows(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses shell scripts")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	w := New(Options{MinBackoff: time.Second, MaxBackoff: 10 * time.Second})
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second, 10 * time.Second}
+	for i, expected := range want {
+		if got := w.backoff(i); got != expected {
+			t.Errorf("backoff(%d) = %v, want %v", i, got, expected)
+		}
+	}
+}
+
+func TestRestartOnCrash(t *testing.T) {
+	skipWindows(t)
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "agent")
+	starts := filepath.Join(dir, "starts")
+	writeScript(t, exe, "echo start >> "+starts+"\nexit 1")
+
+	w := New(Options{
+		Exe:            exe,
+		HealthInterval: time.Hour,
+		MinBackoff:     20 * time.Millisecond,
+		MaxBackoff:     50 * time.Millisecond,
+		StatePath:      updater.StatePath(exe),
+	})
+	done := make(chan error, 1)
+	go func() { done <- w.Run() }()
+
+	waitFor(t, 5*time.Second, func() bool { return countLines(starts) >= 3 })
+	w.Stop(false)
+	if err := <-done; err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if status := w.Status(); status.Restarts < 2 || !strings.Contains(status.LastExit, "退出") {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestRestartOnHang(t *testing.T) {
+	skipWindows(t)
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "agent")
+	starts := filepath.Join(dir, "starts")
+	writeScript(t, exe, "echo start >> "+starts+"\nexec sleep 30")
+
+	health := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer health.Close()
+
+	w := New(Options{
+		Exe:            exe,
+		HealthURL:      health.URL,
+		HealthInterval: time.Second,
+		HealthFailures: 1,
+		MinBackoff:     20 * time.Millisecond,
+		StatePath:      updater.StatePath(exe),
+	})
+	done := make(chan error, 1)
+	go func() { done <- w.Run() }()
+
+	waitFor(t, 10*time.Second, func() bool { return countLines(starts) >= 2 })
+	w.Stop(false)
+	<-done
+	if status := w.Status(); status.LastExit != "Agent健康检查连续失败" {
+		t.Fatalf("unexpected status %+v", status)
+	}
+}
+
+func TestUpdateRollback(t *testing.T) {
+	skipWindows(t)
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "agent")
+	statePath := updater.StatePath(exe)
+	oldStarts := filepath.Join(dir, "old-starts")
+
+	// 新版本启动后立即退出，旧版本保持运行
+	writeScript(t, exe, "exit 2")
+	writeScript(t, exe+".old", "echo start >> "+oldStarts+"\nexec sleep 30")
+	if err := updater.SaveState(statePath, &updater.State{Version: "1.1.0", Status: updater.StatusTrial}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(Options{
+		Exe:            exe,
+		HealthInterval: time.Hour,
+		TrialTimeout:   10 * time.Second,
+		StatePath:      statePath,
+	})
+	w.NotifyUpdate()
+	done := make(chan error, 1)
+	go func() { done <- w.Run() }()
+
+	waitFor(t, 5*time.Second, func() bool { return countLines(oldStarts) >= 1 })
+	w.Stop(false)
+	<-done
+
+	state, _ := updater.LoadState(statePath)
+	if state == nil || state.Status != updater.StatusRolledBack {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	if status := w.Status(); status.Trial {
+		t.Fatalf("trial should have ended: %+v", status)
+	}
+}
+
+func TestUpgradeHandsOverAfterConfirm(t *testing.T) {
+	skipWindows(t)
+	dir := t.TempDir()
+	exe := filepath.Join(dir, "agent")
+	statePath := updater.StatePath(exe)
+
+	// 新版本启动后确认更新并保持运行
+	writeScript(t, exe, `printf '{"version":"1.1.0","status":"confirmed"}' > `+statePath+"\nexec sleep 30")
+	if err := updater.SaveState(statePath, &updater.State{Version: "1.1.0", Status: updater.StatusTrial}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := New(Options{
+		Exe:            exe,
+		HealthInterval: time.Hour,
+		TrialTimeout:   10 * time.Second,
+		StatePath:      statePath,
+	})
+	w.NotifyUpdate()
+	if err := w.Run(); err != ErrUpgraded {
+		t.Fatalf("Run = %v, want ErrUpgraded", err)
+	}
+
+	status := w.Status()
+	if status.Trial || status.AgentPID == 0 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	// Agent继续运行，由新版本看门狗接管
+	process, err := os.FindProcess(status.AgentPID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.Signal(0)); err != nil {
+		t.Fatalf("agent should keep running: %v", err)
+	}
+	process.Kill()
+}
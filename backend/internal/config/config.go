@@ -11,10 +11,22 @@ import (
 
 // Config 应用配置结构
 type Config struct {
-	Database DatabaseConfig `json:"database"`
-	Server   ServerConfig   `json:"server"`
-	Agent    AgentConfig    `json:"agent"`
-	Log      LogConfig      `json:"log"`
+	Database   DatabaseConfig   `json:"database"`
+	Server     ServerConfig     `json:"server"`
+	Agent      AgentConfig      `json:"agent"`
+	Control    ControlConfig    `json:"control"`
+	Stream     StreamConfig     `json:"stream"`
+	Share      ShareConfig      `json:"share"`
+	Session    SessionConfig    `json:"session"`
+	Recording  RecordingConfig  `json:"recording"`
+	Thumbnail  ThumbnailConfig  `json:"thumbnail"`
+	Timelapse  TimelapseConfig  `json:"timelapse"`
+	Artifact   ArtifactConfig   `json:"artifact"`
+	Integrity  IntegrityConfig  `json:"integrity"`
+	Update     UpdateConfig     `json:"update"`
+	Discovery  DiscoveryConfig  `json:"discovery"`
+	Enrollment EnrollmentConfig `json:"enrollment"`
+	Log        LogConfig        `json:"log"`
 }
 
 // DatabaseConfig 数据库配置
@@ -33,6 +45,104 @@ type AgentConfig struct {
 	GRPCPort                int `json:"grpc_port"`                  // Agent gRPC端口
 	HeartbeatTimeoutSeconds int `json:"heartbeat_timeout_seconds"`  // 心跳超时时间(秒)，超过此时间判断设备离线
 	OfflineCheckInterval    int `json:"offline_check_interval"`     // 离线检测间隔(秒)
+	ReconnectGraceSeconds   int `json:"reconnect_grace_seconds"`    // WebSocket代理与Agent断开后的重连宽限期(秒)，超时才关闭浏览器连接
+}
+
+// ControlConfig 远程控制配置
+type ControlConfig struct {
+	AdminToken string `json:"admin_token"` // 管理员令牌，持有者可强制接管/收回控制权，为空则禁用管理员覆盖
+}
+
+// StreamConfig 视频流代理配置
+type StreamConfig struct {
+	ViewerQueueSize int `json:"viewer_queue_size"` // 每个观看者的发送队列长度（帧），队列满时丢帧并等待下一个关键帧
+}
+
+// ShareConfig 分享链接配置
+type ShareConfig struct {
+	Secret            string `json:"secret"`              // 分享令牌签名密钥，为空时启动时随机生成（重启后已有链接失效）
+	MaxExpireSeconds  int    `json:"max_expire_seconds"`  // 分享链接最长有效期(秒)
+	DefaultMaxViewers int    `json:"default_max_viewers"` // 未指定时的最大同时观看人数
+}
+
+// SessionConfig 控制会话默认策略（分组未设置策略时使用）
+type SessionConfig struct {
+	IdleTimeoutMinutes int  `json:"idle_timeout_minutes"` // 无输入超时(分钟)，0表示不限制
+	MaxDurationMinutes int  `json:"max_duration_minutes"` // 最长会话时长(分钟)，0表示不限制
+	WarningSeconds     int  `json:"warning_seconds"`      // 断开前提前警告(秒)
+	RecordSessions     bool `json:"record_sessions"`      // 是否默认录制控制会话
+}
+
+// RecordingConfig 会话录制配置
+type RecordingConfig struct {
+	Dir                    string `json:"dir"`                      // 录制文件存储目录
+	RetentionDays          int    `json:"retention_days"`           // 录制保留天数，0表示不按时间清理
+	MaxTotalMB             int64  `json:"max_total_mb"`             // 录制总空间上限(MB)，超出时删除最旧的录制，0表示不限制
+	CleanupIntervalMinutes int    `json:"cleanup_interval_minutes"` // 清理检查间隔(分钟)
+}
+
+// ThumbnailConfig 缩略图采集配置
+type ThumbnailConfig struct {
+	Enabled         bool `json:"enabled"`          // 是否启用定时采集
+	IntervalSeconds int  `json:"interval_seconds"` // 采集间隔(秒)
+	Concurrency     int  `json:"concurrency"`      // 同时采集的设备数
+	TimeoutSeconds  int  `json:"timeout_seconds"`  // 单台设备截图超时(秒)
+	MaxWidth        int  `json:"max_width"`        // 缩略图最大宽度
+	MaxHeight       int  `json:"max_height"`       // 缩略图最大高度
+	Quality         int  `json:"quality"`          // JPEG质量(1-100)
+}
+
+// TimelapseConfig 定时截图归档配置，各设备是否归档由分组或设备策略决定
+type TimelapseConfig struct {
+	Dir                    string `json:"dir"`                      // 截图归档存储目录
+	CheckIntervalSeconds   int    `json:"check_interval_seconds"`   // 调度检查间隔(秒)，决定截图间隔的最小精度
+	Concurrency            int    `json:"concurrency"`              // 同时截图的设备数
+	CleanupIntervalMinutes int    `json:"cleanup_interval_minutes"` // 清理检查间隔(分钟)
+	MaxTotalMB             int64  `json:"max_total_mb"`             // 所有设备的归档总空间上限(MB)，0表示不限制
+	MaxVideoFrames         int    `json:"max_video_frames"`         // 生成延时视频的最大帧数
+	DefaultIntervalSeconds int    `json:"default_interval_seconds"` // 策略未指定时的截图间隔(秒)
+	DefaultRetentionDays   int    `json:"default_retention_days"`   // 策略未指定时的保留天数
+	DefaultMaxTotalMB      int64  `json:"default_max_total_mb"`     // 策略未指定时每台设备的存储上限(MB)
+	DefaultMaxWidth        int    `json:"default_max_width"`        // 策略未指定时的截图最大宽度
+	DefaultQuality         int    `json:"default_quality"`          // 策略未指定时的JPEG质量
+}
+
+// ArtifactConfig 文件分发配置
+type ArtifactConfig struct {
+	Dir                string `json:"dir"`                 // 分发文件存储目录
+	PublicURL          string `json:"public_url"`          // Agent访问后端的地址，为空时Agent使用自身配置的服务器地址
+	DefaultConcurrency int    `json:"default_concurrency"` // 分发任务未指定时的并发设备数
+	MaxConcurrency     int    `json:"max_concurrency"`     // 分发任务并发设备数上限
+	TimeoutMinutes     int    `json:"timeout_minutes"`     // 单台设备拉取文件的超时(分钟)
+}
+
+// IntegrityConfig 文件完整性核对配置
+type IntegrityConfig struct {
+	DefaultConcurrency int `json:"default_concurrency"` // 核对任务未指定时的并发设备数
+	MaxConcurrency     int `json:"max_concurrency"`     // 核对任务并发设备数上限
+	TimeoutMinutes     int `json:"timeout_minutes"`     // 单台设备计算哈希的超时(分钟)
+	MaxDiffItems       int `json:"max_diff_items"`      // 每台设备记录的差异文件数上限(新增/删除/修改各自计算)
+}
+
+// UpdateConfig Agent自动更新配置
+type UpdateConfig struct {
+	Dir string `json:"dir"` // Agent安装包存储目录
+}
+
+// DiscoveryConfig 局域网发现配置，未配置后端地址的Agent广播查询，后端回复自己的地址
+type DiscoveryConfig struct {
+	Enabled        bool   `json:"enabled"`         // 是否响应Agent的发现查询
+	Port           int    `json:"port"`            // 监听的UDP端口，需与Agent配置一致
+	Multicast      string `json:"multicast"`       // 组播地址，为空时只接收广播
+	URL            string `json:"url"`             // 回复给Agent的后端地址，为空时使用artifact.public_url，仍为空则按收到查询的网卡地址和服务端口生成
+	Name           string `json:"name"`            // 后端名称，Agent日志中显示，便于区分多个后端
+	EnrollmentHint string `json:"enrollment_hint"` // 回复给Agent的注册提示，如需要注册令牌时的说明
+}
+
+// EnrollmentConfig Agent注册准入配置
+type EnrollmentConfig struct {
+	Required        bool `json:"required"`         // 新Agent首次注册必须提供有效的注册令牌，已注册的Agent不受影响
+	PendingApproval bool `json:"pending_approval"` // 要求令牌时，没有令牌的Agent进入待审批列表，而不是直接拒绝
 }
 
 // LogConfig 日志配置
@@ -62,6 +172,68 @@ func Init() {
 			GRPCPort:                50051, // Agent默认gRPC端口
 			HeartbeatTimeoutSeconds: 90,    // 默认90秒超时
 			OfflineCheckInterval:    60,    // 默认60秒检查一次
+			ReconnectGraceSeconds:   15,    // 默认15秒重连宽限期
+		},
+		Stream: StreamConfig{
+			ViewerQueueSize: 64,
+		},
+		Share: ShareConfig{
+			MaxExpireSeconds:  7 * 24 * 3600, // 默认最长7天
+			DefaultMaxViewers: 5,
+		},
+		Session: SessionConfig{
+			WarningSeconds: 60,
+		},
+		Recording: RecordingConfig{
+			Dir:                    "./recordings",
+			RetentionDays:          30,
+			MaxTotalMB:             10240,
+			CleanupIntervalMinutes: 60,
+		},
+		Thumbnail: ThumbnailConfig{
+			Enabled:         true,
+			IntervalSeconds: 30,
+			Concurrency:     8,
+			TimeoutSeconds:  10,
+			MaxWidth:        320,
+			MaxHeight:       180,
+			Quality:         60,
+		},
+		Timelapse: TimelapseConfig{
+			Dir:                    "./timelapse",
+			CheckIntervalSeconds:   10,
+			Concurrency:            4,
+			CleanupIntervalMinutes: 30,
+			MaxTotalMB:             20480,
+			MaxVideoFrames:         10000,
+			DefaultIntervalSeconds: 60,
+			DefaultRetentionDays:   7,
+			DefaultMaxTotalMB:      1024,
+			DefaultMaxWidth:        1280,
+			DefaultQuality:         70,
+		},
+		Artifact: ArtifactConfig{
+			Dir:                "./artifacts",
+			DefaultConcurrency: 10,
+			MaxConcurrency:     50,
+			TimeoutMinutes:     30,
+		},
+		Integrity: IntegrityConfig{
+			DefaultConcurrency: 10,
+			MaxConcurrency:     50,
+			TimeoutMinutes:     30,
+			MaxDiffItems:       500,
+		},
+		Update: UpdateConfig{
+			Dir: "./releases",
+		},
+		Discovery: DiscoveryConfig{
+			Enabled: true,
+			Port:    9099,
+		},
+		Enrollment: EnrollmentConfig{
+			Required:        false,
+			PendingApproval: true,
 		},
 		Log: LogConfig{
 			Level:      "debug",
@@ -177,6 +349,77 @@ func GetOfflineCheckInterval() int {
 	return GlobalConfig.Agent.OfflineCheckInterval
 }
 
+// GetReconnectGraceSeconds 获取WebSocket代理重连宽限期(秒)，0表示不重连
+func GetReconnectGraceSeconds() int {
+	if GlobalConfig.Agent.ReconnectGraceSeconds < 0 {
+		return 0
+	}
+	return GlobalConfig.Agent.ReconnectGraceSeconds
+}
+
+// GetControlAdminToken 获取控制权管理员令牌
+func GetControlAdminToken() string {
+	return GlobalConfig.Control.AdminToken
+}
+
+// GetStreamViewerQueueSize 获取视频流观看者发送队列长度
+func GetStreamViewerQueueSize() int {
+	if GlobalConfig.Stream.ViewerQueueSize <= 0 {
+		return 64
+	}
+	return GlobalConfig.Stream.ViewerQueueSize
+}
+
+// GetShareConfig 获取分享链接配置
+func GetShareConfig() ShareConfig {
+	return GlobalConfig.Share
+}
+
+// GetSessionConfig 获取控制会话默认策略
+func GetSessionConfig() SessionConfig {
+	return GlobalConfig.Session
+}
+
+// GetRecordingConfig 获取会话录制配置
+func GetRecordingConfig() RecordingConfig {
+	return GlobalConfig.Recording
+}
+
+// GetThumbnailConfig 获取缩略图采集配置
+func GetThumbnailConfig() ThumbnailConfig {
+	return GlobalConfig.Thumbnail
+}
+
+// GetTimelapseConfig 获取定时截图归档配置
+func GetTimelapseConfig() TimelapseConfig {
+	return GlobalConfig.Timelapse
+}
+
+// GetArtifactConfig 获取文件分发配置
+func GetArtifactConfig() ArtifactConfig {
+	return GlobalConfig.Artifact
+}
+
+// GetIntegrityConfig 获取文件完整性核对配置
+func GetIntegrityConfig() IntegrityConfig {
+	return GlobalConfig.Integrity
+}
+
+// GetUpdateConfig 获取Agent自动更新配置
+func GetUpdateConfig() UpdateConfig {
+	return GlobalConfig.Update
+}
+
+// GetDiscoveryConfig 获取局域网发现配置
+func GetDiscoveryConfig() DiscoveryConfig {
+	return GlobalConfig.Discovery
+}
+
+// GetEnrollmentConfig 获取Agent注册准入配置
+func GetEnrollmentConfig() EnrollmentConfig {
+	return GlobalConfig.Enrollment
+}
+
 // SaveConfig 保存配置到文件
 func SaveConfig(filename string) error {
 	data, err := json.MarshalIndent(GlobalConfig, "", "  ")
@@ -0,0 +1,495 @@
+package agent
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 控制权仲裁消息类型（由后端处理，不转发给Agent）
+const (
+	MsgControlRequest  = "CONTROL_REQUEST"  // 观察者申请控制权；后端→控制者：有人申请控制权
+	MsgControlGrant    = "CONTROL_GRANT"    // 控制者将控制权移交给指定客户端
+	MsgControlDeny     = "CONTROL_DENY"     // 控制者拒绝申请；后端→申请者：申请被拒绝
+	MsgControlRelease  = "CONTROL_RELEASE"  // 控制者主动释放控制权
+	MsgControlRevoke   = "CONTROL_REVOKE"   // 管理员收回当前控制权
+	MsgControlTakeover = "CONTROL_TAKEOVER" // 管理员强制接管控制权
+	MsgControlStatus   = "CONTROL_STATUS"   // 后端→客户端：控制权状态变更通知
+)
+
+// 与Agent一致的响应消息类型
+const (
+	MsgResponseSuccess = "RESPONSE_SUCCESS"
+	MsgResponseError   = "RESPONSE_ERROR"
+)
+
+// 控制连接角色
+const (
+	RoleController = "controller"
+	RoleObserver   = "observer"
+)
+
+// ControlMessage 控制通道消息结构（与Agent的消息格式保持一致）
+type ControlMessage struct {
+	Type      string                 `json:"type"`
+	Data      map[string]interface{} `json:"data"`
+	Timestamp int64                  `json:"timestamp"`
+	ID        string                 `json:"id,omitempty"`
+}
+
+// controlClient 浏览器侧的一个控制连接
+type controlClient struct {
+	id       string
+	conn     *websocket.Conn
+	admin    bool
+	joinedAt time.Time
+	writeMu  sync.Mutex // gorilla/websocket 不支持并发写
+}
+
+// writeMessage 线程安全地向客户端写消息
+func (cc *controlClient) writeMessage(messageType int, data []byte) error {
+	cc.writeMu.Lock()
+	defer cc.writeMu.Unlock()
+	return cc.conn.WriteMessage(messageType, data)
+}
+
+// sendControl 向客户端发送一条控制通道消息
+func (cc *controlClient) sendControl(msgType string, data map[string]interface{}) error {
+	payload, err := json.Marshal(ControlMessage{
+		Type:      msgType,
+		Data:      data,
+		Timestamp: time.Now().Unix(),
+	})
+	if err != nil {
+		return fmt.Errorf("序列化控制消息失败: %w", err)
+	}
+	return cc.writeMessage(websocket.TextMessage, payload)
+}
+
+// sendError 向客户端发送 RESPONSE_ERROR
+func (cc *controlClient) sendError(message, details string) {
+	if err := cc.sendControl(MsgResponseError, map[string]interface{}{
+		"message": message,
+		"details": details,
+	}); err != nil {
+		logger.Debugf("发送错误响应失败: client=%s, 错误=%v", cc.id, err)
+	}
+}
+
+// controlArbiter 单台设备的控制权仲裁器：一个控制者，任意数量的观察者
+type controlArbiter struct {
+	instanceID int
+	mutex      sync.Mutex
+	clients    map[string]*controlClient
+	controller string               // 当前控制者ID，为空表示无人控制
+	pending    map[string]time.Time // 等待控制者答复的申请
+}
+
+var (
+	controlArbiters      = make(map[int]*controlArbiter)
+	controlArbitersMutex sync.Mutex
+)
+
+// joinControlArbiter 将客户端加入设备的仲裁器（不存在则创建）
+// 在全局锁内完成加入，避免与最后一个客户端离开时的清理发生竞争
+func joinControlArbiter(instanceID int, client *controlClient, wantControl bool) *controlArbiter {
+	controlArbitersMutex.Lock()
+	arbiter, ok := controlArbiters[instanceID]
+	if !ok {
+		arbiter = &controlArbiter{
+			instanceID: instanceID,
+			clients:    make(map[string]*controlClient),
+			pending:    make(map[string]time.Time),
+		}
+		controlArbiters[instanceID] = arbiter
+	}
+	arbiter.join(client, wantControl)
+	controlArbitersMutex.Unlock()
+
+	logger.Infof("控制连接加入: 实例=%d, 客户端=%s, 管理员=%v, 角色=%s",
+		instanceID, client.id, client.admin, arbiter.roleOf(client.id))
+
+	arbiter.broadcastStatus()
+	return arbiter
+}
+
+// findControlArbiter 查找已存在的仲裁器，不存在时返回nil
+func findControlArbiter(instanceID int) *controlArbiter {
+	controlArbitersMutex.Lock()
+	defer controlArbitersMutex.Unlock()
+	return controlArbiters[instanceID]
+}
+
+// newControlClientID 生成控制连接ID
+func newControlClientID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// isAdminToken 校验管理员令牌，未配置令牌时始终返回false
+func isAdminToken(token string) bool {
+	adminToken := config.GetControlAdminToken()
+	if adminToken == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(adminToken), []byte(token)) == 1
+}
+
+// isInputMessage 判断是否为会操作设备的输入类消息（观察者不允许发送）
+func isInputMessage(msgType string) bool {
+	switch {
+	case strings.HasPrefix(msgType, "MOUSE_"),
+		strings.HasPrefix(msgType, "KEY_"),
+		strings.HasPrefix(msgType, "SYSTEM_"),
+		strings.HasPrefix(msgType, "APP_"):
+		return true
+	case msgType == "CLIPBOARD_PASTE", msgType == "CLIPBOARD_SET", msgType == "CLIPBOARD_COPY":
+		return true
+	}
+	return false
+}
+
+// isArbitrationMessage 判断是否为控制权仲裁消息
+func isArbitrationMessage(msgType string) bool {
+	switch msgType {
+	case MsgControlRequest, MsgControlGrant, MsgControlDeny,
+		MsgControlRelease, MsgControlRevoke, MsgControlTakeover, MsgControlStatus:
+		return true
+	}
+	return false
+}
+
+// join 加入仲裁（由joinControlArbiter调用）；wantControl 为true且当前无人控制时直接获得控制权
+func (a *controlArbiter) join(client *controlClient, wantControl bool) {
+	a.mutex.Lock()
+	a.clients[client.id] = client
+	if wantControl && a.controller == "" {
+		a.controller = client.id
+	}
+	a.mutex.Unlock()
+}
+
+// leave 离开仲裁；控制者离开后控制权空出
+func (a *controlArbiter) leave(client *controlClient) {
+	a.mutex.Lock()
+	delete(a.clients, client.id)
+	delete(a.pending, client.id)
+	wasController := a.controller == client.id
+	if wasController {
+		a.controller = ""
+	}
+	empty := len(a.clients) == 0
+	a.mutex.Unlock()
+
+	logger.Infof("控制连接离开: 实例=%d, 客户端=%s, 曾为控制者=%v", a.instanceID, client.id, wasController)
+
+	if empty {
+		controlArbitersMutex.Lock()
+		a.mutex.Lock()
+		if len(a.clients) == 0 && controlArbiters[a.instanceID] == a {
+			delete(controlArbiters, a.instanceID)
+		}
+		a.mutex.Unlock()
+		controlArbitersMutex.Unlock()
+		return
+	}
+
+	a.broadcastStatus()
+}
+
+// isController 判断客户端是否为当前控制者
+func (a *controlArbiter) isController(clientID string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.controller == clientID
+}
+
+// roleOf 获取客户端角色
+func (a *controlArbiter) roleOf(clientID string) string {
+	if a.isController(clientID) {
+		return RoleController
+	}
+	return RoleObserver
+}
+
+// setController 切换控制者并清理对应的申请
+func (a *controlArbiter) setController(clientID string) {
+	a.mutex.Lock()
+	a.controller = clientID
+	if clientID != "" {
+		delete(a.pending, clientID)
+	}
+	a.mutex.Unlock()
+}
+
+// handleMessage 处理仲裁消息
+func (a *controlArbiter) handleMessage(client *controlClient, msg ControlMessage) {
+	targetID, _ := msg.Data["client_id"].(string)
+
+	switch msg.Type {
+	case MsgControlRequest:
+		a.handleRequest(client)
+
+	case MsgControlGrant:
+		// 校验控制者、查找目标和移交在同一次加锁内完成，避免移交给期间已离开的客户端
+		a.mutex.Lock()
+		isController := a.controller == client.id
+		_, ok := a.clients[targetID]
+		if isController && ok {
+			a.controller = targetID
+			delete(a.pending, targetID)
+		}
+		a.mutex.Unlock()
+		if !isController {
+			client.sendError("无权移交控制权", "只有当前控制者可以移交控制权")
+			return
+		}
+		if !ok {
+			client.sendError("移交控制权失败", fmt.Sprintf("客户端不存在: %s", targetID))
+			return
+		}
+		logger.Infof("控制权移交: 实例=%d, %s → %s", a.instanceID, client.id, targetID)
+		a.broadcastStatus()
+
+	case MsgControlDeny:
+		if !a.isController(client.id) {
+			client.sendError("无权拒绝申请", "只有当前控制者可以拒绝控制权申请")
+			return
+		}
+		a.mutex.Lock()
+		_, requested := a.pending[targetID]
+		delete(a.pending, targetID)
+		target := a.clients[targetID]
+		a.mutex.Unlock()
+		if requested && target != nil {
+			target.sendControl(MsgControlDeny, map[string]interface{}{"controller_id": client.id})
+		}
+		a.broadcastStatus()
+
+	case MsgControlRelease:
+		if !a.isController(client.id) {
+			client.sendError("释放控制权失败", "当前不是控制者")
+			return
+		}
+		a.setController("")
+		logger.Infof("控制权已释放: 实例=%d, 客户端=%s", a.instanceID, client.id)
+		a.broadcastStatus()
+
+	case MsgControlRevoke:
+		if !client.admin {
+			client.sendError("无权收回控制权", "需要管理员权限")
+			return
+		}
+		a.revoke(client.id)
+
+	case MsgControlTakeover:
+		if !client.admin {
+			client.sendError("无权接管控制权", "需要管理员权限")
+			return
+		}
+		a.setController(client.id)
+		logger.Warnf("管理员强制接管控制权: 实例=%d, 管理员=%s", a.instanceID, client.id)
+		a.broadcastStatus()
+
+	case MsgControlStatus:
+		a.sendStatus(client)
+	}
+}
+
+// handleRequest 处理控制权申请：无人控制时立即授予，否则通知当前控制者
+func (a *controlArbiter) handleRequest(client *controlClient) {
+	a.mutex.Lock()
+	if a.controller == client.id {
+		a.mutex.Unlock()
+		a.sendStatus(client)
+		return
+	}
+	if a.controller == "" {
+		a.controller = client.id
+		delete(a.pending, client.id)
+		a.mutex.Unlock()
+		logger.Infof("控制权授予: 实例=%d, 客户端=%s", a.instanceID, client.id)
+		a.broadcastStatus()
+		return
+	}
+	a.pending[client.id] = time.Now()
+	controller := a.clients[a.controller]
+	a.mutex.Unlock()
+
+	if controller != nil {
+		controller.sendControl(MsgControlRequest, map[string]interface{}{
+			"client_id": client.id,
+			"admin":     client.admin,
+		})
+	}
+	logger.Infof("收到控制权申请: 实例=%d, 申请者=%s", a.instanceID, client.id)
+	a.broadcastStatus()
+}
+
+// revoke 收回当前控制权（管理员操作）
+func (a *controlArbiter) revoke(operator string) {
+	a.mutex.Lock()
+	previous := a.controller
+	a.controller = ""
+	a.mutex.Unlock()
+
+	logger.Warnf("控制权被收回: 实例=%d, 原控制者=%s, 操作者=%s", a.instanceID, previous, operator)
+	a.broadcastStatus()
+}
+
+// statusLocked 构建指定客户端视角的状态（调用方需持有锁）
+func (a *controlArbiter) statusLocked(clientID string) map[string]interface{} {
+	role := RoleObserver
+	if a.controller == clientID {
+		role = RoleController
+	}
+
+	pending := make([]string, 0, len(a.pending))
+	for id := range a.pending {
+		pending = append(pending, id)
+	}
+	sort.Strings(pending)
+
+	admin := false
+	if client, ok := a.clients[clientID]; ok {
+		admin = client.admin
+	}
+
+	return map[string]interface{}{
+		"instance_id":   a.instanceID,
+		"client_id":     clientID,
+		"role":          role,
+		"admin":         admin,
+		"controller_id": a.controller,
+		"clients":       len(a.clients),
+		"pending":       pending,
+	}
+}
+
+// sendStatus 向单个客户端发送状态
+func (a *controlArbiter) sendStatus(client *controlClient) {
+	a.mutex.Lock()
+	status := a.statusLocked(client.id)
+	a.mutex.Unlock()
+	client.sendControl(MsgControlStatus, status)
+}
+
+// broadcastStatus 向所有客户端广播状态
+func (a *controlArbiter) broadcastStatus() {
+	a.mutex.Lock()
+	clients := make([]*controlClient, 0, len(a.clients))
+	statuses := make([]map[string]interface{}, 0, len(a.clients))
+	for _, client := range a.clients {
+		clients = append(clients, client)
+		statuses = append(statuses, a.statusLocked(client.id))
+	}
+	a.mutex.Unlock()
+
+	for i, client := range clients {
+		if err := client.sendControl(MsgControlStatus, statuses[i]); err != nil {
+			logger.Debugf("广播控制权状态失败: client=%s, 错误=%v", client.id, err)
+		}
+	}
+}
+
+// snapshot 返回仲裁器状态（供HTTP接口使用）
+func (a *controlArbiter) snapshot() map[string]interface{} {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	clients := make([]map[string]interface{}, 0, len(a.clients))
+	for _, client := range a.clients {
+		role := RoleObserver
+		if a.controller == client.id {
+			role = RoleController
+		}
+		_, requested := a.pending[client.id]
+		clients = append(clients, map[string]interface{}{
+			"client_id": client.id,
+			"role":      role,
+			"admin":     client.admin,
+			"joined_at": client.joinedAt,
+			"requested": requested,
+		})
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i]["joined_at"].(time.Time).Before(clients[j]["joined_at"].(time.Time))
+	})
+
+	return map[string]interface{}{
+		"instance_id":   a.instanceID,
+		"controller_id": a.controller,
+		"clients":       clients,
+	}
+}
+
+// GetControlStatus 获取设备的控制权状态
+func GetControlStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取控制权状态参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	arbiter := findControlArbiter(id)
+	if arbiter == nil {
+		SuccessRes(c, gin.H{
+			"instance_id":   id,
+			"controller_id": "",
+			"clients":       []interface{}{},
+		})
+		return
+	}
+
+	SuccessRes(c, arbiter.snapshot())
+}
+
+// RevokeControl 管理员收回设备的当前控制权
+func RevokeControl(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("收回控制权参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	token := c.GetHeader("X-Admin-Token")
+	if token == "" {
+		token = c.Query("admin_token")
+	}
+	if !isAdminToken(token) {
+		logger.Warnf("收回控制权被拒绝: 实例=%d, 管理员令牌无效", id)
+		c.JSON(http.StatusForbidden, gin.H{
+			"code":    -1,
+			"message": "需要管理员权限",
+		})
+		return
+	}
+
+	arbiter := findControlArbiter(id)
+	if arbiter == nil {
+		NotFoundRes(c, "当前没有控制连接")
+		return
+	}
+
+	arbiter.revoke("http")
+	SuccessRes(c, arbiter.snapshot())
+}
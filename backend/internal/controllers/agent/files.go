@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 转发给Agent的请求头：内容类型、断点续传和分块校验
+var fileRequestHeaders = []string{
+	"Content-Type", "Range", "If-Range", "If-None-Match", "If-Modified-Since", "X-Chunk-SHA256",
+}
+
+// 返回给客户端的Agent响应头
+var fileResponseHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Content-Disposition",
+	"Accept-Ranges", "ETag", "Last-Modified", "X-Archive-Files", "X-Archive-Bytes",
+}
+
+// fileTransferClient 文件请求客户端
+// 大文件传输耗时不可预估，不设置整体超时；递归复制/删除大目录可能较久才返回响应头
+var fileTransferClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 10 * time.Second}).DialContext,
+		ResponseHeaderTimeout: 10 * time.Minute,
+	},
+}
+
+// proxyFileRequest 将文件请求原样转发给Agent，查询参数和请求体保持不变
+// 请求体和响应体都以流的方式转发，不在后端缓存整个文件
+func proxyFileRequest(c *gin.Context, method string, agentPath string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("文件管理参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	// 获取实例信息
+	instance, err := models.GetInstance(id)
+	if err != nil {
+		logger.Errorf("获取实例失败: ID=%d, 错误=%v", id, err)
+		NotFoundRes(c, "实例不存在")
+		return
+	}
+
+	agentHTTPPort := config.GetAgentHTTPPort()
+	targetURL := fmt.Sprintf("http://%s:%d%s", instance.Lan, agentHTTPPort, agentPath)
+	if c.Request.URL.RawQuery != "" {
+		targetURL += "?" + c.Request.URL.RawQuery
+	}
+
+	var body io.Reader
+	if method != http.MethodGet && method != http.MethodHead {
+		body = c.Request.Body
+	}
+
+	// 客户端断开时取消对Agent的请求
+	req, err := http.NewRequestWithContext(c.Request.Context(), method, targetURL, body)
+	if err != nil {
+		logger.Errorf("创建文件管理请求失败: %v", err)
+		InternalErrorRes(c, "请求创建失败")
+		return
+	}
+	if body != nil {
+		// 分块上传需要Agent知道分块长度
+		req.ContentLength = c.Request.ContentLength
+	}
+	for _, key := range fileRequestHeaders {
+		if value := c.GetHeader(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := fileTransferClient.Do(req)
+	if err != nil {
+		logger.Errorf("发送文件管理请求失败: %s, 错误=%v", targetURL, err)
+		InternalErrorRes(c, "请求发送失败")
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, key := range fileResponseHeaders {
+		if value := resp.Header.Get(key); value != "" {
+			c.Header(key, value)
+		}
+	}
+	c.Status(resp.StatusCode)
+
+	// 每次读到数据立即刷新，搜索结果等流式响应才能实时到达客户端
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Writer.Write(buf[:n]); writeErr != nil {
+				logger.Errorf("写入响应失败: ID=%d, %s %s, 错误=%v", id, method, agentPath, writeErr)
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Errorf("复制响应体失败: ID=%d, %s %s, 错误=%v", id, method, agentPath, err)
+			return
+		}
+	}
+
+	logger.Infof("文件管理请求完成: ID=%d, %s %s, 状态=%d", id, method, agentPath, resp.StatusCode)
+}
+
+// ListFiles 列出目录内容，未指定path时返回磁盘分区
+func ListFiles(c *gin.Context) {
+	proxyFileRequest(c, http.MethodGet, "/api/files")
+}
+
+// StatFile 获取文件或目录信息
+func StatFile(c *gin.Context) {
+	proxyFileRequest(c, http.MethodGet, "/api/files/stat")
+}
+
+// ListDrives 列出磁盘分区或挂载点
+func ListDrives(c *gin.Context) {
+	proxyFileRequest(c, http.MethodGet, "/api/files/drives")
+}
+
+// SearchFiles 搜索文件，结果以NDJSON流式返回
+func SearchFiles(c *gin.Context) {
+	proxyFileRequest(c, http.MethodGet, "/api/files/search")
+}
+
+// HashFiles 计算设备上文件或目录树的SHA-256（可选MD5）清单
+func HashFiles(c *gin.Context) {
+	proxyFileRequest(c, http.MethodGet, "/api/files/hash")
+}
+
+// MakeDir 创建目录
+func MakeDir(c *gin.Context) {
+	proxyFileRequest(c, http.MethodPost, "/api/files/mkdir")
+}
+
+// MoveFile 移动或重命名文件/目录
+func MoveFile(c *gin.Context) {
+	proxyFileRequest(c, http.MethodPost, "/api/files/move")
+}
+
+// CopyFile 复制文件/目录
+func CopyFile(c *gin.Context) {
+	proxyFileRequest(c, http.MethodPost, "/api/files/copy")
+}
+
+// DeleteFile 删除文件/目录，递归删除需要在confirm中再次填写路径
+func DeleteFile(c *gin.Context) {
+	proxyFileRequest(c, http.MethodPost, "/api/files/delete")
+}
+
+// DownloadArchive 将目录打包为zip或tar.gz流式下载，支持include/exclude筛选和大小限制
+func DownloadArchive(c *gin.Context) {
+	proxyFileRequest(c, http.MethodGet, "/api/archive")
+}
+
+// ExtractArchive 上传压缩包并在设备上解压到dir目录
+func ExtractArchive(c *gin.Context) {
+	proxyFileRequest(c, http.MethodPost, "/api/extract")
+}
+
+// ListWatches 获取设备上的目录监听列表
+func ListWatches(c *gin.Context) {
+	proxyFileRequest(c, http.MethodGet, "/api/watches")
+}
+
+// CreateWatch 在设备上创建目录监听，变化事件通过控制通道推送给所有控制连接
+func CreateWatch(c *gin.Context) {
+	proxyFileRequest(c, http.MethodPost, "/api/watches")
+}
+
+// DeleteWatch 取消设备上的目录监听
+func DeleteWatch(c *gin.Context) {
+	proxyFileRequest(c, http.MethodDelete, "/api/watches/"+c.Param("watch"))
+}
+
+// ListWatchEvents 获取设备记录的目录变化事件，since参数为上次获取到的最大序号
+func ListWatchEvents(c *gin.Context) {
+	proxyFileRequest(c, http.MethodGet, "/api/watches/events")
+}
+
+// CreateUploadSession 创建分块上传会话
+func CreateUploadSession(c *gin.Context) {
+	proxyFileRequest(c, http.MethodPost, "/api/uploads")
+}
+
+// GetUploadSession 查询上传会话已接收的区间，用于断点续传
+func GetUploadSession(c *gin.Context) {
+	proxyFileRequest(c, http.MethodGet, "/api/uploads/"+c.Param("session"))
+}
+
+// UploadChunk 上传分块，请求体为分块数据，offset参数指定位置，X-Chunk-SHA256请求头用于校验
+func UploadChunk(c *gin.Context) {
+	proxyFileRequest(c, http.MethodPut, "/api/uploads/"+c.Param("session")+"/chunks")
+}
+
+// CompleteUploadSession 校验整个文件SHA-256并完成上传
+func CompleteUploadSession(c *gin.Context) {
+	proxyFileRequest(c, http.MethodPost, "/api/uploads/"+c.Param("session")+"/complete")
+}
+
+// AbortUploadSession 取消上传
+func AbortUploadSession(c *gin.Context) {
+	proxyFileRequest(c, http.MethodDelete, "/api/uploads/"+c.Param("session"))
+}
@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+
+	"github.com/gorilla/websocket"
+)
+
+// MsgUpstreamStatus 后端→客户端：与Agent的上游连接状态变更通知
+const MsgUpstreamStatus = "UPSTREAM_STATUS"
+
+// MsgRequestKeyFrame 后端→Agent：请求视频流立即生成关键帧
+const MsgRequestKeyFrame = "REQUEST_KEYFRAME"
+
+// MsgWatchStatus Agent→客户端：目录监听状态；与Agent的连接断开时由后端为失效的监听代发
+const MsgWatchStatus = "WATCH_STATUS"
+
+// 上游连接状态
+const (
+	UpstreamReconnecting = "reconnecting" // 连接已断开，正在重连
+	UpstreamResumed      = "resumed"      // 重连成功，已恢复
+	UpstreamLost         = "lost"         // 宽限期内未能重连，即将关闭
+)
+
+const (
+	reconnectInitialBackoff = 500 * time.Millisecond
+	reconnectMaxBackoff     = 5 * time.Second
+)
+
+var (
+	// errReconnectAborted 重连期间所有客户端已离开
+	errReconnectAborted = errors.New("重连已取消")
+	// errUpstreamUnavailable 上游连接正在重连
+	errUpstreamUnavailable = errors.New("Agent连接正在重连")
+)
+
+// agentUpstream 可重连的Agent上游连接，写操作在锁内串行执行
+type agentUpstream struct {
+	mutex sync.Mutex
+	conn  *websocket.Conn
+}
+
+// set 替换当前上游连接，nil表示正在重连
+func (u *agentUpstream) set(conn *websocket.Conn) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.conn = conn
+}
+
+// writeMessage 向当前上游连接写消息，重连期间返回errUpstreamUnavailable
+func (u *agentUpstream) writeMessage(messageType int, data []byte) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.conn == nil {
+		return errUpstreamUnavailable
+	}
+	return u.conn.WriteMessage(messageType, data)
+}
+
+// close 关闭当前上游连接
+func (u *agentUpstream) close() {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.conn != nil {
+		u.conn.Close()
+		u.conn = nil
+	}
+}
+
+// redialAgent 在宽限期内以指数退避重连Agent WebSocket
+// stop 关闭时立即放弃重连；宽限期为0时不重连
+func redialAgent(agentURL string, stop <-chan struct{}) (*websocket.Conn, error) {
+	grace := time.Duration(config.GetReconnectGraceSeconds()) * time.Second
+	if grace <= 0 {
+		return nil, fmt.Errorf("未启用重连")
+	}
+
+	deadline := time.Now().Add(grace)
+	backoff := reconnectInitialBackoff
+	var lastErr error
+
+	for attempt := 1; ; attempt++ {
+		wait := backoff
+		if remaining := time.Until(deadline); remaining < wait {
+			wait = remaining
+		}
+		if wait <= 0 {
+			break
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-stop:
+			timer.Stop()
+			return nil, errReconnectAborted
+		case <-timer.C:
+		}
+
+		conn, _, err := websocket.DefaultDialer.Dial(agentURL, nil)
+		if err == nil {
+			logger.Infof("Agent WebSocket重连成功: %s, 第%d次尝试", agentURL, attempt)
+			return conn, nil
+		}
+		lastErr = err
+		logger.Warnf("Agent WebSocket重连失败: %s, 第%d次尝试, 错误=%v", agentURL, attempt, err)
+
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+
+	return nil, fmt.Errorf("重连宽限期(%s)已过: %v", grace, lastErr)
+}
+
+// upstreamStatusMessage 构建上游连接状态通知消息
+func upstreamStatusMessage(state string) []byte {
+	payload, _ := json.Marshal(ControlMessage{
+		Type: MsgUpstreamStatus,
+		Data: map[string]interface{}{
+			"state":         state,
+			"grace_seconds": config.GetReconnectGraceSeconds(),
+		},
+		Timestamp: time.Now().Unix(),
+	})
+	return payload
+}
+
+// keyFrameRequestMessage 构建关键帧请求消息
+func keyFrameRequestMessage() []byte {
+	payload, _ := json.Marshal(ControlMessage{
+		Type:      MsgRequestKeyFrame,
+		Timestamp: time.Now().Unix(),
+	})
+	return payload
+}
+
+// controlWatches 控制连接通过WATCH_SUBSCRIBE创建的目录监听
+// Agent在连接断开时取消这些监听，重连后不会恢复，需要通知客户端重新订阅
+type controlWatches map[string]bool
+
+// track 根据Agent发来的WATCH_STATUS消息记录仍然有效的监听
+func (w controlWatches) track(msg map[string]interface{}) {
+	if msgType, _ := msg["type"].(string); msgType != MsgWatchStatus {
+		return
+	}
+	data, _ := msg["data"].(map[string]interface{})
+	id, _ := data["watch_id"].(string)
+	if id == "" {
+		return
+	}
+	if state, _ := data["state"].(string); state == "subscribed" {
+		w[id] = true
+	} else {
+		delete(w, id)
+	}
+}
+
+// lostMessages 上游连接断开后为每个失效的监听构建取消通知，并清空记录
+func (w controlWatches) lostMessages() [][]byte {
+	messages := make([][]byte, 0, len(w))
+	for id := range w {
+		payload, _ := json.Marshal(ControlMessage{
+			Type: MsgWatchStatus,
+			Data: map[string]interface{}{
+				"watch_id": id,
+				"state":    "unsubscribed",
+				"reason":   "upstream_lost",
+				"error":    "与Agent的连接已断开，监听已取消，请重新订阅",
+			},
+			Timestamp: time.Now().Unix(),
+		})
+		messages = append(messages, payload)
+		delete(w, id)
+	}
+	return messages
+}
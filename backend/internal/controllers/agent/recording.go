@@ -0,0 +1,184 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+	"winmanager-backend/internal/recorder"
+
+	"github.com/gorilla/websocket"
+)
+
+// 视频流不可用时重新加入分发中心的间隔
+const recordingRejoinInterval = 2 * time.Second
+
+// 录制进度写入数据库的间隔
+const recordingFlushInterval = 10 * time.Second
+
+// sessionRecorder 将控制会话期间的视频帧和输入事件写入录制文件
+// 以一个不带浏览器连接的观看者身份加入设备的视频流分发中心
+type sessionRecorder struct {
+	record    *models.Recording
+	writer    *recorder.Writer
+	agentURL  string
+	startedAt time.Time
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// startSessionRecording 为控制会话开始录制
+func startSessionRecording(instance *models.Instance, sessionID uint) (*sessionRecorder, error) {
+	now := time.Now()
+	record := &models.Recording{
+		InstanceID:       int(instance.ID),
+		ControlSessionID: sessionID,
+		Status:           models.RecordingStatusRecording,
+		StartedAt:        now,
+	}
+	if err := models.CreateRecording(record); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Join(config.GetRecordingConfig().Dir, strconv.Itoa(record.InstanceID), strconv.Itoa(int(record.ID)))
+	writer, err := recorder.Create(dir)
+	if err != nil {
+		models.UpdateRecording(record.ID, map[string]interface{}{
+			"status": models.RecordingStatusFailed,
+			"error":  err.Error(),
+		})
+		return nil, err
+	}
+	models.UpdateRecording(record.ID, map[string]interface{}{"path": dir})
+	record.Path = dir
+
+	r := &sessionRecorder{
+		record:    record,
+		writer:    writer,
+		agentURL:  agentStreamURL(instance),
+		startedAt: now,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go r.run()
+
+	logger.Infof("开始录制控制会话: 录制=%d, 实例=%d, 会话=%d, 目录=%s", record.ID, record.InstanceID, sessionID, dir)
+	return r, nil
+}
+
+// run 持续从视频流分发中心读取帧；视频流中断时定期重新加入，直到录制结束
+func (r *sessionRecorder) run() {
+	defer close(r.done)
+
+	flush := time.NewTicker(recordingFlushInterval)
+	defer flush.Stop()
+
+	for {
+		viewer := newStreamViewer(nil, "")
+		hub := joinStreamHub(r.record.InstanceID, r.agentURL, viewer)
+
+		stopped := r.consume(viewer, flush.C)
+		hub.leave(viewer)
+		if stopped {
+			return
+		}
+
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(recordingRejoinInterval):
+		}
+	}
+}
+
+// consume 写入观看者队列中的帧，录制结束时返回true，视频流断开时返回false
+func (r *sessionRecorder) consume(viewer *streamViewer, flush <-chan time.Time) bool {
+	skippedJPEG := false
+	for {
+		select {
+		case <-r.stop:
+			return true
+		case <-viewer.done:
+			return false
+		case <-flush:
+			r.saveProgress()
+		case frame := <-viewer.send:
+			if frame.messageType != websocket.BinaryMessage {
+				continue
+			}
+			// 仅录制H.264视频流
+			if len(frame.data) >= 2 && frame.data[0] == 0xFF && frame.data[1] == 0xD8 {
+				if !skippedJPEG {
+					logger.Warnf("会话录制仅支持H.264视频流，忽略JPEG帧: 录制=%d", r.record.ID)
+					skippedJPEG = true
+				}
+				continue
+			}
+			ts := time.Since(r.startedAt)
+			if err := r.writer.WriteFrame(ts, isStreamKeyFrame(frame.data), frame.data); err != nil {
+				logger.Errorf("写入录制视频帧失败: 录制=%d, 错误=%v", r.record.ID, err)
+			}
+		}
+	}
+}
+
+// recordInput 记录一条转发给Agent的输入事件
+func (r *sessionRecorder) recordInput(msgType string, message []byte) {
+	data := json.RawMessage(message)
+	if !json.Valid(message) {
+		// 旧格式文本消息按字符串保存
+		encoded, _ := json.Marshal(string(message))
+		data = encoded
+	}
+	if err := r.writer.WriteEvent(time.Since(r.startedAt), msgType, data); err != nil {
+		logger.Errorf("写入录制输入事件失败: 录制=%d, 错误=%v", r.record.ID, err)
+	}
+}
+
+// saveProgress 将当前录制进度写入数据库
+func (r *sessionRecorder) saveProgress() {
+	frames, events, bytes, duration := r.writer.Stats()
+	models.UpdateRecording(r.record.ID, map[string]interface{}{
+		"frames":      frames,
+		"events":      events,
+		"bytes":       bytes,
+		"duration_ms": duration.Milliseconds(),
+	})
+}
+
+// finish 结束录制并保存结果
+func (r *sessionRecorder) finish() {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+		<-r.done
+
+		status := models.RecordingStatusCompleted
+		errMsg := ""
+		if err := r.writer.Close(); err != nil {
+			status = models.RecordingStatusFailed
+			errMsg = fmt.Sprintf("关闭录制文件失败: %v", err)
+		}
+
+		frames, events, bytes, duration := r.writer.Stats()
+		now := time.Now()
+		models.UpdateRecording(r.record.ID, map[string]interface{}{
+			"status":      status,
+			"error":       errMsg,
+			"ended_at":    &now,
+			"frames":      frames,
+			"events":      events,
+			"bytes":       bytes,
+			"duration_ms": duration.Milliseconds(),
+		})
+
+		logger.Infof("控制会话录制结束: 录制=%d, 帧数=%d, 事件数=%d, 大小=%d字节", r.record.ID, frames, events, bytes)
+	})
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 会话策略消息类型（后端→客户端）
+const (
+	MsgSessionWarning = "SESSION_WARNING" // 会话即将因策略被断开
+	MsgSessionClosed  = "SESSION_CLOSED"  // 会话已因策略被断开
+)
+
+// 策略检查间隔
+const sessionCheckInterval = time.Second
+
+// sessionEnforcer 在后端代理中执行控制会话的空闲超时和最长时长策略
+// 空闲超时只约束控制者，观察者只观看画面，不会产生输入
+type sessionEnforcer struct {
+	policy       models.SessionPolicy
+	client       *controlClient
+	arbiter      *controlArbiter
+	instanceID   int
+	sessionKey   string // 浏览器为同一会话的控制和视频流连接指定的标识，断开会话时一并断开视频流
+	startedAt    time.Time
+	lastActivity int64 // UnixNano，原子访问
+
+	reasonOnce sync.Once
+	reason     string
+}
+
+func newSessionEnforcer(policy models.SessionPolicy, client *controlClient, arbiter *controlArbiter, sessionKey string) *sessionEnforcer {
+	now := time.Now()
+	return &sessionEnforcer{
+		policy:       policy,
+		client:       client,
+		arbiter:      arbiter,
+		instanceID:   arbiter.instanceID,
+		sessionKey:   sessionKey,
+		startedAt:    now,
+		lastActivity: now.UnixNano(),
+	}
+}
+
+// touch 记录一次转发给Agent的输入操作
+func (e *sessionEnforcer) touch() {
+	atomic.StoreInt64(&e.lastActivity, time.Now().UnixNano())
+}
+
+// setReason 记录关闭原因，只有第一次调用生效
+func (e *sessionEnforcer) setReason(reason string) {
+	e.reasonOnce.Do(func() {
+		e.reason = reason
+	})
+}
+
+// closeReason 获取关闭原因，未记录时视为客户端断开
+func (e *sessionEnforcer) closeReason() string {
+	e.setReason(models.CloseReasonClient)
+	return e.reason
+}
+
+// run 周期检查策略，直到stop关闭或会话被断开
+func (e *sessionEnforcer) run(stop <-chan struct{}) {
+	idleTimeout := time.Duration(e.policy.IdleTimeoutMinutes) * time.Minute
+	maxDuration := time.Duration(e.policy.MaxDurationMinutes) * time.Minute
+	if idleTimeout <= 0 && maxDuration <= 0 {
+		return
+	}
+	warning := time.Duration(e.policy.WarningSeconds) * time.Second
+
+	ticker := time.NewTicker(sessionCheckInterval)
+	defer ticker.Stop()
+
+	idleWarned, durationWarned := false, false
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if maxDuration > 0 {
+				left := maxDuration - now.Sub(e.startedAt)
+				if left <= 0 {
+					e.terminate(models.CloseReasonMaxDuration)
+					return
+				}
+				if !durationWarned && left <= warning {
+					durationWarned = true
+					e.warn(models.CloseReasonMaxDuration, left)
+				}
+			}
+
+			if idleTimeout > 0 && !e.arbiter.isController(e.client.id) {
+				// 观察者不受空闲超时约束，获得控制权后重新计时
+				e.touch()
+				idleWarned = false
+			} else if idleTimeout > 0 {
+				idle := now.Sub(time.Unix(0, atomic.LoadInt64(&e.lastActivity)))
+				left := idleTimeout - idle
+				if left <= 0 {
+					e.terminate(models.CloseReasonIdle)
+					return
+				}
+				if left > warning {
+					// 警告后有新的操作，重新计时
+					idleWarned = false
+				} else if !idleWarned {
+					idleWarned = true
+					e.warn(models.CloseReasonIdle, left)
+				}
+			}
+		}
+	}
+}
+
+// warn 通知客户端会话即将被断开
+func (e *sessionEnforcer) warn(reason string, left time.Duration) {
+	seconds := int(left.Round(time.Second) / time.Second)
+	logger.Infof("控制会话即将断开: 客户端=%s, 原因=%s, 剩余=%d秒", e.client.id, reason, seconds)
+	e.client.sendControl(MsgSessionWarning, map[string]interface{}{
+		"reason":       reason,
+		"seconds_left": seconds,
+	})
+}
+
+// terminate 按策略断开会话，同时断开该会话的视频流连接，没有其他观看者时Agent停止编码
+func (e *sessionEnforcer) terminate(reason string) {
+	e.setReason(reason)
+	logger.Infof("控制会话按策略断开: 客户端=%s, 原因=%s", e.client.id, reason)
+
+	e.client.sendControl(MsgSessionClosed, map[string]interface{}{
+		"reason": reason,
+	})
+	e.client.writeMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason))
+	e.client.conn.Close()
+
+	if e.sessionKey != "" {
+		detachStreamViewers(e.instanceID, e.sessionKey, reason)
+	}
+}
+
+// ListControlSessions 获取设备的控制会话记录
+func ListControlSessions(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取控制会话记录参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	sessions, err := models.ListControlSessions(id, limit)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, sessions)
+}
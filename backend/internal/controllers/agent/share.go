@@ -0,0 +1,477 @@
+package agent
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 分享链接默认有效期
+const defaultShareExpireSeconds = 3600
+
+var (
+	errShareTokenInvalid = errors.New("分享令牌无效")
+	errShareExpired      = errors.New("分享链接已过期或已撤销")
+	errSharePassword     = errors.New("分享密码错误")
+	errShareViewerLimit  = errors.New("观看人数已达上限")
+)
+
+var (
+	shareSecretOnce sync.Once
+	shareSecretKey  []byte
+)
+
+// CreateShareLinkRequest 创建分享链接请求
+type CreateShareLinkRequest struct {
+	Scope      string `json:"scope"`      // stream(默认) 或 control
+	ExpiresIn  int    `json:"expires_in"` // 有效期(秒)
+	MaxViewers int    `json:"max_viewers"`
+	Password   string `json:"password"`
+	Note       string `json:"note"`
+}
+
+// shareSecret 获取分享令牌签名密钥
+func shareSecret() []byte {
+	shareSecretOnce.Do(func() {
+		if secret := config.GetShareConfig().Secret; secret != "" {
+			shareSecretKey = []byte(secret)
+			return
+		}
+		shareSecretKey = make([]byte, 32)
+		if _, err := rand.Read(shareSecretKey); err != nil {
+			panic(fmt.Sprintf("生成分享令牌密钥失败: %v", err))
+		}
+		logger.Warnf("未配置share.secret，已随机生成分享令牌密钥，服务重启后已发放的分享链接将失效")
+	})
+	return shareSecretKey
+}
+
+// signShareToken 为分享链接生成签名令牌：base64(ID.实例.过期时间.范围).base64(HMAC-SHA256)
+func signShareToken(link *models.ShareLink) string {
+	payload := fmt.Sprintf("%d.%d.%d.%s", link.ID, link.InstanceID, link.ExpiresAt.Unix(), link.Scope)
+	mac := hmac.New(sha256.New, shareSecret())
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyShareToken 校验令牌签名并加载对应的分享链接
+func verifyShareToken(token string) (*models.ShareLink, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, errShareTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errShareTokenInvalid
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errShareTokenInvalid
+	}
+
+	mac := hmac.New(sha256.New, shareSecret())
+	mac.Write(payload)
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, errShareTokenInvalid
+	}
+
+	fields := strings.Split(string(payload), ".")
+	if len(fields) != 4 {
+		return nil, errShareTokenInvalid
+	}
+	id, err := strconv.ParseUint(fields[0], 10, 64)
+	if err != nil {
+		return nil, errShareTokenInvalid
+	}
+	expiresAt, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil || time.Now().Unix() >= expiresAt {
+		return nil, errShareExpired
+	}
+
+	link, err := models.GetShareLink(uint(id))
+	if err != nil {
+		return nil, errShareTokenInvalid
+	}
+	// 令牌内容必须与记录一致，防止记录被修改后旧令牌继续生效
+	if strconv.Itoa(link.InstanceID) != fields[1] || link.Scope != fields[3] || link.ExpiresAt.Unix() != expiresAt {
+		return nil, errShareTokenInvalid
+	}
+	if !link.IsActive() {
+		return nil, errShareExpired
+	}
+
+	return link, nil
+}
+
+// shareSession 通过分享链接建立的一个连接
+type shareSession struct {
+	link   *models.ShareLink
+	mutex  sync.Mutex
+	conn   *websocket.Conn
+	closed bool
+	timer  *time.Timer
+}
+
+var (
+	shareSessions      = make(map[uint]map[*shareSession]struct{})
+	shareSessionsMutex sync.Mutex
+)
+
+// acquireShareSession 占用分享链接的一个观看名额，到期时自动断开
+func acquireShareSession(link *models.ShareLink) (*shareSession, error) {
+	shareSessionsMutex.Lock()
+	defer shareSessionsMutex.Unlock()
+
+	sessions := shareSessions[link.ID]
+	if link.MaxViewers > 0 && len(sessions) >= link.MaxViewers {
+		return nil, errShareViewerLimit
+	}
+	if sessions == nil {
+		sessions = make(map[*shareSession]struct{})
+		shareSessions[link.ID] = sessions
+	}
+
+	session := &shareSession{link: link}
+	session.timer = time.AfterFunc(time.Until(link.ExpiresAt), func() {
+		logger.Infof("分享链接已到期，断开连接: ID=%d", link.ID)
+		session.close()
+	})
+	sessions[session] = struct{}{}
+	return session, nil
+}
+
+// bind 关联浏览器连接，会话已被关闭时立即断开
+func (s *shareSession) bind(conn *websocket.Conn) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.conn = conn
+	if s.closed {
+		conn.Close()
+	}
+}
+
+// close 断开浏览器连接，由处理函数退出时完成清理
+func (s *shareSession) close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.closed = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+}
+
+// isClosed 会话是否已因分享链接到期或撤销而关闭
+func (s *shareSession) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// release 释放观看名额
+func (s *shareSession) release() {
+	s.timer.Stop()
+
+	shareSessionsMutex.Lock()
+	defer shareSessionsMutex.Unlock()
+
+	if sessions, ok := shareSessions[s.link.ID]; ok {
+		delete(sessions, s)
+		if len(sessions) == 0 {
+			delete(shareSessions, s.link.ID)
+		}
+	}
+}
+
+// countShareSessions 获取分享链接当前的连接数
+func countShareSessions(id uint) int {
+	shareSessionsMutex.Lock()
+	defer shareSessionsMutex.Unlock()
+	return len(shareSessions[id])
+}
+
+// closeShareSessions 断开分享链接的所有连接
+func closeShareSessions(id uint) int {
+	shareSessionsMutex.Lock()
+	sessions := make([]*shareSession, 0, len(shareSessions[id]))
+	for session := range shareSessions[id] {
+		sessions = append(sessions, session)
+	}
+	shareSessionsMutex.Unlock()
+
+	for _, session := range sessions {
+		session.close()
+	}
+	return len(sessions)
+}
+
+// shareLinkView 分享链接的返回结构
+func shareLinkView(link *models.ShareLink) gin.H {
+	return gin.H{
+		"id":           link.ID,
+		"instance_id":  link.InstanceID,
+		"scope":        link.Scope,
+		"expires_at":   link.ExpiresAt,
+		"max_viewers":  link.MaxViewers,
+		"has_password": link.HasPassword,
+		"note":         link.Note,
+		"revoked_at":   link.RevokedAt,
+		"created_at":   link.CreatedAt,
+		"active":       link.IsActive(),
+		"viewers":      countShareSessions(link.ID),
+	}
+}
+
+// CreateShareLink 为设备创建分享链接
+func CreateShareLink(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("创建分享链接参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var req CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Errorf("创建分享链接参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+
+	if _, err := models.GetInstance(id); err != nil {
+		NotFoundRes(c, "实例不存在")
+		return
+	}
+
+	if req.Scope == "" {
+		req.Scope = models.ShareScopeStream
+	}
+	if req.Scope != models.ShareScopeStream && req.Scope != models.ShareScopeControl {
+		BadRequestRes(c, "scope 只能为 stream 或 control")
+		return
+	}
+
+	shareConfig := config.GetShareConfig()
+	if req.ExpiresIn <= 0 {
+		req.ExpiresIn = defaultShareExpireSeconds
+	}
+	if shareConfig.MaxExpireSeconds > 0 && req.ExpiresIn > shareConfig.MaxExpireSeconds {
+		BadRequestRes(c, fmt.Sprintf("有效期不能超过 %d 秒", shareConfig.MaxExpireSeconds))
+		return
+	}
+	if req.MaxViewers < 0 {
+		BadRequestRes(c, "max_viewers 不能为负数")
+		return
+	}
+	if req.MaxViewers == 0 {
+		req.MaxViewers = shareConfig.DefaultMaxViewers
+	}
+
+	link := &models.ShareLink{
+		InstanceID: id,
+		Scope:      req.Scope,
+		ExpiresAt:  time.Now().Add(time.Duration(req.ExpiresIn) * time.Second),
+		MaxViewers: req.MaxViewers,
+		Note:       req.Note,
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			logger.Errorf("生成分享密码哈希失败: %v", err)
+			InternalErrorRes(c, "生成分享密码失败")
+			return
+		}
+		link.PasswordHash = string(hash)
+		link.HasPassword = true
+	}
+
+	if err := models.CreateShareLink(link); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	token := signShareToken(link)
+	data := shareLinkView(link)
+	data["token"] = token
+	data["stream_url"] = "/api/share/stream?token=" + url.QueryEscape(token)
+	if link.Scope == models.ShareScopeControl {
+		data["control_url"] = "/api/share/control?token=" + url.QueryEscape(token)
+	}
+
+	SuccessRes(c, data)
+}
+
+// ListShareLinks 获取设备的分享链接列表
+func ListShareLinks(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取分享链接列表参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	links, err := models.ListShareLinks(id)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	items := make([]gin.H, 0, len(links))
+	for i := range links {
+		items = append(items, shareLinkView(&links[i]))
+	}
+
+	SuccessRes(c, items)
+}
+
+// RevokeShareLink 撤销分享链接并断开其所有连接
+func RevokeShareLink(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("撤销分享链接参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+	shareID, err := strconv.ParseUint(c.Param("shareId"), 10, 64)
+	if err != nil {
+		logger.Errorf("撤销分享链接参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	link, err := models.GetShareLink(uint(shareID))
+	if err != nil || link.InstanceID != id {
+		NotFoundRes(c, "分享链接不存在")
+		return
+	}
+
+	if err := models.RevokeShareLink(link.ID); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	closed := closeShareSessions(link.ID)
+	logger.Infof("分享链接已撤销: ID=%d, 实例=%d, 断开连接数=%d", link.ID, id, closed)
+
+	link, err = models.GetShareLink(link.ID)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	SuccessRes(c, shareLinkView(link))
+}
+
+// authorizeShare 校验请求中的分享令牌和密码
+func authorizeShare(c *gin.Context) (*models.ShareLink, int, error) {
+	token := c.Query("token")
+	if token == "" {
+		token = c.GetHeader("X-Share-Token")
+	}
+	if token == "" {
+		return nil, http.StatusUnauthorized, errShareTokenInvalid
+	}
+
+	link, err := verifyShareToken(token)
+	if err != nil {
+		if errors.Is(err, errShareExpired) {
+			return nil, http.StatusGone, err
+		}
+		return nil, http.StatusUnauthorized, err
+	}
+
+	if link.HasPassword {
+		password := c.Query("password")
+		if password == "" {
+			password = c.GetHeader("X-Share-Password")
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			return nil, http.StatusForbidden, errSharePassword
+		}
+	}
+
+	return link, http.StatusOK, nil
+}
+
+// ShareInfo 通过分享令牌获取分享信息（不需要密码，便于页面提示输入密码）
+func ShareInfo(c *gin.Context) {
+	link, err := verifyShareToken(c.Query("token"))
+	if err != nil {
+		status := http.StatusUnauthorized
+		if errors.Is(err, errShareExpired) {
+			status = http.StatusGone
+		}
+		c.JSON(status, gin.H{"code": -1, "message": err.Error()})
+		return
+	}
+
+	SuccessRes(c, gin.H{
+		"scope":        link.Scope,
+		"expires_at":   link.ExpiresAt,
+		"has_password": link.HasPassword,
+		"max_viewers":  link.MaxViewers,
+		"viewers":      countShareSessions(link.ID),
+	})
+}
+
+// ShareStream 通过分享令牌观看设备视频流
+func ShareStream(c *gin.Context) {
+	serveShare(c, false)
+}
+
+// ShareControl 通过分享令牌连接设备控制通道，仅control范围的链接可用
+func ShareControl(c *gin.Context) {
+	serveShare(c, true)
+}
+
+func serveShare(c *gin.Context, control bool) {
+	link, status, err := authorizeShare(c)
+	if err != nil {
+		logger.Warnf("分享链接访问被拒绝: %s, 错误=%v", c.ClientIP(), err)
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	if control && link.Scope != models.ShareScopeControl {
+		c.JSON(http.StatusForbidden, gin.H{"error": "该分享链接仅允许观看"})
+		return
+	}
+
+	instance, err := models.GetInstance(link.InstanceID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "实例不存在"})
+		return
+	}
+
+	session, err := acquireShareSession(link)
+	if err != nil {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	defer session.release()
+
+	logger.Infof("分享链接连接: ID=%d, 实例=%d, 控制=%v, 来源=%s", link.ID, link.InstanceID, control, c.ClientIP())
+
+	if control {
+		proxyControl(c, instance, false, session)
+	} else {
+		proxyStream(c, instance, session)
+	}
+}
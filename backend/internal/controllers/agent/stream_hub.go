@@ -0,0 +1,478 @@
+package agent
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamWriteWait  = 10 * time.Second
+	streamPongWait   = 60 * time.Second
+	streamPingPeriod = (streamPongWait * 9) / 10
+)
+
+// streamFrame 待发送给观看者的一条消息
+type streamFrame struct {
+	messageType int
+	data        []byte
+}
+
+// streamViewer 浏览器侧的一个视频流观看连接
+type streamViewer struct {
+	id         string
+	sessionKey string // 所属控制会话的标识，可为空
+	conn       *websocket.Conn
+	send       chan streamFrame
+	done       chan struct{}
+	joinedAt   time.Time
+
+	closeOnce    sync.Once
+	waitKeyFrame bool   // 队列溢出后丢弃非关键帧，直到下一个关键帧（由hub.mutex保护）
+	sent         uint64 // 由hub.mutex保护
+	dropped      uint64 // 由hub.mutex保护
+}
+
+// streamHub 设备视频流分发中心：每个设备只保持一条到Agent的上游连接，由所有观看者共享
+type streamHub struct {
+	instanceID int
+	agentURL   string
+	mutex      sync.Mutex
+	viewers    map[string]*streamViewer
+	upstream   *websocket.Conn
+	keyFrame   []byte // 最近一个关键帧，新观看者加入时立即发送
+	closed     bool
+	stop       chan struct{} // 分发中心关闭时关闭，用于中断重连
+	startedAt  time.Time
+}
+
+var (
+	streamHubs      = make(map[int]*streamHub)
+	streamHubsMutex sync.Mutex
+)
+
+func newStreamViewer(conn *websocket.Conn, sessionKey string) *streamViewer {
+	return &streamViewer{
+		id:         newControlClientID(),
+		sessionKey: sessionKey,
+		conn:       conn,
+		send:       make(chan streamFrame, config.GetStreamViewerQueueSize()),
+		done:       make(chan struct{}),
+		joinedAt:   time.Now(),
+	}
+}
+
+// close 通知写协程退出，可重复调用
+func (v *streamViewer) close() {
+	v.closeOnce.Do(func() {
+		close(v.done)
+	})
+}
+
+// writePump 将队列中的帧写给浏览器，并定期发送ping
+func (v *streamViewer) writePump() {
+	ticker := time.NewTicker(streamPingPeriod)
+	defer func() {
+		ticker.Stop()
+		v.conn.Close()
+	}()
+
+	for {
+		select {
+		case frame := <-v.send:
+			if err := v.write(frame); err != nil {
+				logger.Debugf("向观看者发送帧失败: 观看者=%s, 错误=%v", v.id, err)
+				return
+			}
+		case <-ticker.C:
+			v.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if err := v.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-v.done:
+			// 尽量把已排队的消息（如断开原因）发出去
+			for {
+				select {
+				case frame := <-v.send:
+					if err := v.write(frame); err != nil {
+						return
+					}
+				default:
+					v.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+					v.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+					return
+				}
+			}
+		}
+	}
+}
+
+func (v *streamViewer) write(frame streamFrame) error {
+	v.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	return v.conn.WriteMessage(frame.messageType, frame.data)
+}
+
+// readPump 读取浏览器消息以检测断开，观看者发来的消息不再转发给Agent
+func (v *streamViewer) readPump() {
+	v.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	v.conn.SetPongHandler(func(string) error {
+		v.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+		return nil
+	})
+
+	for {
+		if _, _, err := v.conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				logger.Errorf("观看者连接异常关闭: 观看者=%s, 错误=%v", v.id, err)
+			}
+			return
+		}
+	}
+}
+
+// joinStreamHub 将观看者加入设备的分发中心，不存在时创建并建立上游连接
+// 在全局锁内完成加入，避免与最后一个观看者离开时的清理发生竞争
+func joinStreamHub(instanceID int, agentURL string, viewer *streamViewer) *streamHub {
+	streamHubsMutex.Lock()
+	hub, ok := streamHubs[instanceID]
+	if !ok {
+		hub = &streamHub{
+			instanceID: instanceID,
+			agentURL:   agentURL,
+			viewers:    make(map[string]*streamViewer),
+			stop:       make(chan struct{}),
+			startedAt:  time.Now(),
+		}
+		streamHubs[instanceID] = hub
+	}
+	hub.join(viewer)
+	streamHubsMutex.Unlock()
+
+	if !ok {
+		go hub.run()
+	}
+
+	logger.Infof("视频流观看者加入: 实例=%d, 观看者=%s, 复用上游=%v", instanceID, viewer.id, ok)
+	return hub
+}
+
+// findStreamHub 查找已存在的分发中心，不存在时返回nil
+func findStreamHub(instanceID int) *streamHub {
+	streamHubsMutex.Lock()
+	defer streamHubsMutex.Unlock()
+	return streamHubs[instanceID]
+}
+
+// detachStreamViewers 断开属于指定会话的观看者，返回断开的数量
+// 观看者的连接关闭后由proxyStream离开分发中心，最后一个观看者离开时关闭上游连接
+func detachStreamViewers(instanceID int, sessionKey, reason string) int {
+	hub := findStreamHub(instanceID)
+	if hub == nil {
+		return 0
+	}
+
+	payload, _ := json.Marshal(ControlMessage{
+		Type:      MsgSessionClosed,
+		Data:      map[string]interface{}{"reason": reason},
+		Timestamp: time.Now().Unix(),
+	})
+
+	hub.mutex.Lock()
+	detached := 0
+	for _, viewer := range hub.viewers {
+		if viewer.sessionKey != sessionKey {
+			continue
+		}
+		select {
+		case viewer.send <- streamFrame{messageType: websocket.TextMessage, data: payload}:
+		default:
+		}
+		viewer.close()
+		detached++
+	}
+	hub.mutex.Unlock()
+
+	if detached > 0 {
+		logger.Infof("会话已断开，断开其视频流观看者: 实例=%d, 数量=%d, 原因=%s", instanceID, detached, reason)
+	}
+	return detached
+}
+
+// join 添加观看者；如有缓存的关键帧则立即发送，否则等待下一个关键帧
+func (h *streamHub) join(viewer *streamViewer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.viewers[viewer.id] = viewer
+	if h.keyFrame != nil {
+		viewer.send <- streamFrame{messageType: websocket.BinaryMessage, data: h.keyFrame}
+		viewer.sent++
+	} else {
+		viewer.waitKeyFrame = true
+	}
+}
+
+// leave 移除观看者，最后一个观看者离开时关闭上游连接
+func (h *streamHub) leave(viewer *streamViewer) {
+	streamHubsMutex.Lock()
+	h.mutex.Lock()
+
+	delete(h.viewers, viewer.id)
+	viewer.close()
+
+	remaining := len(h.viewers)
+	lastViewer := remaining == 0 && !h.closed
+	if lastViewer {
+		h.markClosedLocked()
+		if streamHubs[h.instanceID] == h {
+			delete(streamHubs, h.instanceID)
+		}
+		if h.upstream != nil {
+			h.upstream.Close()
+		}
+	}
+
+	h.mutex.Unlock()
+	streamHubsMutex.Unlock()
+
+	logger.Infof("视频流观看者离开: 实例=%d, 观看者=%s, 剩余=%d", h.instanceID, viewer.id, remaining)
+	if lastViewer {
+		logger.Infof("最后一个观看者已离开，关闭Agent上游连接: 实例=%d", h.instanceID)
+	}
+}
+
+// markClosedLocked 标记分发中心已关闭（调用方需持有h.mutex）
+func (h *streamHub) markClosedLocked() {
+	if !h.closed {
+		h.closed = true
+		close(h.stop)
+	}
+}
+
+// run 建立到Agent的上游连接并持续分发帧
+// 上游断开时在宽限期内重连，期间观看者保持连接；宽限期过后才关闭所有观看者
+func (h *streamHub) run() {
+	logger.Infof("连接到Agent WebSocket: %s", h.agentURL)
+
+	conn, _, err := websocket.DefaultDialer.Dial(h.agentURL, nil)
+	if err != nil {
+		logger.Errorf("连接Agent WebSocket失败: %v", err)
+		h.shutdown(`{"error": "连接Agent失败"}`)
+		return
+	}
+
+	for {
+		if !h.attach(conn) {
+			// 拨号期间所有观看者都已离开
+			conn.Close()
+			return
+		}
+
+		h.pump(conn)
+
+		h.mutex.Lock()
+		closed := h.closed
+		h.upstream = nil
+		h.keyFrame = nil // 断开前的关键帧与恢复后的帧不再连续
+		h.mutex.Unlock()
+		if closed {
+			logger.Infof("Agent上游连接已关闭: 实例=%d", h.instanceID)
+			return
+		}
+
+		logger.Warnf("Agent视频流上游断开，开始重连: 实例=%d", h.instanceID)
+		h.broadcast(websocket.TextMessage, upstreamStatusMessage(UpstreamReconnecting))
+
+		conn, err = redialAgent(h.agentURL, h.stop)
+		if err != nil {
+			if err == errReconnectAborted {
+				return
+			}
+			logger.Errorf("Agent视频流重连失败: 实例=%d, 错误=%v", h.instanceID, err)
+			h.broadcast(websocket.TextMessage, upstreamStatusMessage(UpstreamLost))
+			h.shutdown(`{"error": "Agent视频流已断开"}`)
+			return
+		}
+
+		// 请求Agent立即生成关键帧，使观看者尽快恢复画面
+		conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+		if err := conn.WriteMessage(websocket.TextMessage, keyFrameRequestMessage()); err != nil {
+			logger.Warnf("请求关键帧失败: 实例=%d, 错误=%v", h.instanceID, err)
+		}
+		h.broadcast(websocket.TextMessage, upstreamStatusMessage(UpstreamResumed))
+	}
+}
+
+// attach 设置当前上游连接，分发中心已关闭时返回false
+// 重新连接后所有观看者需等待新的关键帧
+func (h *streamHub) attach(conn *websocket.Conn) bool {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.closed {
+		return false
+	}
+	h.upstream = conn
+	for _, viewer := range h.viewers {
+		viewer.waitKeyFrame = true
+	}
+	return true
+}
+
+// pump 读取上游消息并分发，直到连接断开
+func (h *streamHub) pump(conn *websocket.Conn) {
+	defer conn.Close()
+
+	for {
+		messageType, message, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				logger.Errorf("Agent连接异常关闭: %v", err)
+			}
+			return
+		}
+		h.broadcast(messageType, message)
+	}
+}
+
+// shutdown 上游不可用时通知并关闭所有观看者
+func (h *streamHub) shutdown(reason string) {
+	streamHubsMutex.Lock()
+	h.mutex.Lock()
+
+	h.markClosedLocked()
+	if streamHubs[h.instanceID] == h {
+		delete(streamHubs, h.instanceID)
+	}
+	if h.upstream != nil {
+		h.upstream.Close()
+	}
+	for id, viewer := range h.viewers {
+		select {
+		case viewer.send <- streamFrame{messageType: websocket.TextMessage, data: []byte(reason)}:
+		default:
+		}
+		viewer.close()
+		delete(h.viewers, id)
+	}
+
+	h.mutex.Unlock()
+	streamHubsMutex.Unlock()
+
+	logger.Infof("视频流分发中心已关闭: 实例=%d", h.instanceID)
+}
+
+// broadcast 将一条上游消息分发给所有观看者
+// 观看者队列满时丢弃该帧，并在下一个关键帧之前跳过后续视频帧，避免解码花屏
+func (h *streamHub) broadcast(messageType int, data []byte) {
+	isKey := messageType == websocket.BinaryMessage && isStreamKeyFrame(data)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if isKey {
+		h.keyFrame = data
+	}
+
+	for _, viewer := range h.viewers {
+		if messageType == websocket.BinaryMessage && viewer.waitKeyFrame && !isKey {
+			viewer.dropped++
+			continue
+		}
+		select {
+		case viewer.send <- streamFrame{messageType: messageType, data: data}:
+			viewer.sent++
+			if isKey {
+				viewer.waitKeyFrame = false
+			}
+		default:
+			viewer.dropped++
+			if messageType == websocket.BinaryMessage {
+				viewer.waitKeyFrame = true
+			}
+		}
+	}
+}
+
+// isStreamKeyFrame 判断是否为可独立解码的帧：含IDR的H.264帧或完整的JPEG图像
+func isStreamKeyFrame(payload []byte) bool {
+	if len(payload) >= 2 && payload[0] == 0xFF && payload[1] == 0xD8 {
+		return true
+	}
+
+	for i := 0; i+4 < len(payload); i++ {
+		// 查找NAL单元起始码 0x000001 / 0x00000001
+		if payload[i] != 0x00 || payload[i+1] != 0x00 {
+			continue
+		}
+		if payload[i+2] == 0x01 {
+			if payload[i+3]&0x1F == 5 {
+				return true
+			}
+		} else if payload[i+2] == 0x00 && payload[i+3] == 0x01 {
+			if payload[i+4]&0x1F == 5 {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// snapshot 获取分发中心状态
+func (h *streamHub) snapshot() map[string]interface{} {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	viewers := make([]map[string]interface{}, 0, len(h.viewers))
+	for _, viewer := range h.viewers {
+		viewers = append(viewers, map[string]interface{}{
+			"id":             viewer.id,
+			"joined_at":      viewer.joinedAt.Unix(),
+			"queued":         len(viewer.send),
+			"sent":           viewer.sent,
+			"dropped":        viewer.dropped,
+			"wait_key_frame": viewer.waitKeyFrame,
+		})
+	}
+	sort.Slice(viewers, func(i, j int) bool {
+		return viewers[i]["joined_at"].(int64) < viewers[j]["joined_at"].(int64)
+	})
+
+	return map[string]interface{}{
+		"instance_id":     h.instanceID,
+		"upstream":        h.upstream != nil && !h.closed,
+		"started_at":      h.startedAt.Unix(),
+		"key_frame_bytes": len(h.keyFrame),
+		"viewers":         viewers,
+	}
+}
+
+// GetStreamViewers 获取设备视频流的观看者状态
+func GetStreamViewers(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取视频流观看者参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	hub := findStreamHub(id)
+	if hub == nil {
+		SuccessRes(c, gin.H{
+			"instance_id": id,
+			"upstream":    false,
+			"viewers":     []interface{}{},
+		})
+		return
+	}
+
+	SuccessRes(c, hub.snapshot())
+}
@@ -1,11 +1,9 @@
 package agent
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"strconv"
 	"time"
@@ -275,176 +273,16 @@ func ExecuteScript(c *gin.Context) {
 	c.JSON(resp.StatusCode, result)
 }
 
-// DownloadFile 下载文件
+// DownloadFile 下载文件，支持Range断点续传，文件内容直接流式转发
 func DownloadFile(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		logger.Errorf("文件下载参数错误: %v", err)
-		BadRequestRes(c, "参数错误")
-		return
-	}
-
-	// 获取实例信息
-	instance, err := models.GetInstance(id)
-	if err != nil {
-		logger.Errorf("获取实例失败: ID=%d, 错误=%v", id, err)
-		NotFoundRes(c, "实例不存在")
-		return
-	}
-
-	// 获取文件路径参数
-	filePath := c.Query("path")
-	if filePath == "" {
+	if c.Query("path") == "" {
 		BadRequestRes(c, "文件路径参数缺失")
 		return
 	}
-
-	// 构建下载URL
-	agentHTTPPort := config.GetAgentHTTPPort()
-	downloadURL := fmt.Sprintf("http://%s:%d/api/download?path=%s", instance.Lan, agentHTTPPort, filePath)
-
-	logger.Infof("代理文件下载请求: %s", downloadURL)
-
-	// 创建HTTP请求
-	req, err := http.NewRequest("GET", downloadURL, nil)
-	if err != nil {
-		logger.Errorf("创建下载请求失败: %v", err)
-		InternalErrorRes(c, "请求创建失败")
-		return
-	}
-
-	// 复制请求头
-	for key, values := range c.Request.Header {
-		for _, value := range values {
-			req.Header.Add(key, value)
-		}
-	}
-
-	// 发送请求
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Errorf("发送下载请求失败: %v", err)
-		InternalErrorRes(c, "请求发送失败")
-		return
-	}
-	defer resp.Body.Close()
-
-	// 复制响应头
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Header(key, value)
-		}
-	}
-
-	// 设置状态码
-	c.Status(resp.StatusCode)
-
-	// 复制响应体
-	_, err = io.Copy(c.Writer, resp.Body)
-	if err != nil {
-		logger.Errorf("复制响应体失败: %v", err)
-		return
-	}
-
-	logger.Infof("文件下载代理完成: ID=%d, Path=%s", id, filePath)
+	proxyFileRequest(c, c.Request.Method, "/api/download")
 }
 
-// UploadFile 上传文件
+// UploadFile 上传文件，multipart请求体原样流式转发给Agent，不在后端缓存
 func UploadFile(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
-	if err != nil {
-		logger.Errorf("文件上传参数错误: %v", err)
-		BadRequestRes(c, "参数错误")
-		return
-	}
-
-	// 获取实例信息
-	instance, err := models.GetInstance(id)
-	if err != nil {
-		logger.Errorf("获取实例失败: ID=%d, 错误=%v", id, err)
-		NotFoundRes(c, "实例不存在")
-		return
-	}
-
-	// 构建上传URL
-	agentHTTPPort := config.GetAgentHTTPPort()
-	uploadURL := fmt.Sprintf("http://%s:%d/api/upload", instance.Lan, agentHTTPPort)
-
-	// 添加查询参数
-	if dir := c.Query("dir"); dir != "" {
-		uploadURL += "?dir=" + dir
-	}
-
-	logger.Infof("代理文件上传请求: %s", uploadURL)
-
-	// 获取上传的文件
-	file, header, err := c.Request.FormFile("file")
-	if err != nil {
-		logger.Errorf("获取上传文件失败: %v", err)
-		BadRequestRes(c, "获取上传文件失败")
-		return
-	}
-	defer file.Close()
-
-	// 创建multipart form
-	formData := &bytes.Buffer{}
-	writer := multipart.NewWriter(formData)
-
-	// 创建form字段
-	part, err := writer.CreateFormFile("file", header.Filename)
-	if err != nil {
-		logger.Errorf("创建form字段失败: %v", err)
-		InternalErrorRes(c, "创建form字段失败")
-		return
-	}
-
-	// 复制文件内容
-	_, err = io.Copy(part, file)
-	if err != nil {
-		logger.Errorf("复制文件内容失败: %v", err)
-		InternalErrorRes(c, "复制文件内容失败")
-		return
-	}
-
-	// 关闭writer
-	writer.Close()
-
-	// 创建HTTP请求
-	req, err := http.NewRequest("POST", uploadURL, formData)
-	if err != nil {
-		logger.Errorf("创建上传请求失败: %v", err)
-		InternalErrorRes(c, "请求创建失败")
-		return
-	}
-
-	// 设置Content-Type
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-
-	// 发送请求
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		logger.Errorf("发送上传请求失败: %v", err)
-		InternalErrorRes(c, "请求发送失败")
-		return
-	}
-	defer resp.Body.Close()
-
-	// 读取响应
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		logger.Errorf("读取上传响应失败: %v", err)
-		InternalErrorRes(c, "响应读取失败")
-		return
-	}
-
-	// 设置响应头
-	c.Header("Content-Type", "application/json")
-	c.Status(resp.StatusCode)
-
-	// 返回响应
-	c.Writer.Write(body)
-
-	logger.Infof("文件上传代理完成: ID=%d, Filename=%s", id, header.Filename)
+	proxyFileRequest(c, http.MethodPost, "/api/upload")
 }
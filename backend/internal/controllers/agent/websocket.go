@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"winmanager-backend/internal/config"
 	"winmanager-backend/internal/logger"
@@ -23,6 +24,7 @@ var upgrader = websocket.Upgrader{
 }
 
 // WebSocketStream WebSocket视频流代理
+// 同一设备的所有观看者共享一条到Agent的上游连接，由streamHub负责分发和断线重连
 func WebSocketStream(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -39,90 +41,48 @@ func WebSocketStream(c *gin.Context) {
 		return
 	}
 
-	// 升级HTTP连接为WebSocket
-	clientConn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		logger.Errorf("升级WebSocket失败: %v", err)
-		return
-	}
-	defer clientConn.Close()
+	proxyStream(c, instance, nil)
+}
 
-	// 构建Agent WebSocket URL
-	agentHTTPPort := config.GetAgentHTTPPort()
+// agentStreamURL 构建Agent视频流WebSocket地址
+func agentStreamURL(instance *models.Instance) string {
 	agentWSURL := url.URL{
 		Scheme: "ws",
-		Host:   fmt.Sprintf("%s:%d", instance.Lan, agentHTTPPort),
+		Host:   fmt.Sprintf("%s:%d", instance.Lan, config.GetAgentHTTPPort()),
 		Path:   "/wsstream",
 	}
+	return agentWSURL.String()
+}
 
-	logger.Infof("连接到Agent WebSocket: %s", agentWSURL.String())
+// proxyStream 将浏览器连接加入设备的视频流分发中心，session不为nil时表示通过分享链接访问
+func proxyStream(c *gin.Context, instance *models.Instance, session *shareSession) {
+	id := int(instance.ID)
 
-	// 连接到Agent的WebSocket
-	agentConn, _, err := websocket.DefaultDialer.Dial(agentWSURL.String(), nil)
+	// 升级HTTP连接为WebSocket
+	clientConn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		logger.Errorf("连接Agent WebSocket失败: %v", err)
-		clientConn.WriteMessage(websocket.TextMessage, []byte(`{"error": "连接Agent失败"}`))
+		logger.Errorf("升级WebSocket失败: %v", err)
 		return
 	}
-	defer agentConn.Close()
+	defer clientConn.Close()
+	if session != nil {
+		session.bind(clientConn)
+	}
 
-	// 创建双向代理
-	errChan := make(chan error, 2)
+	// session 与同一页面的控制连接一致，会话按策略断开时一并断开视频流
+	viewer := newStreamViewer(clientConn, c.Query("session"))
+	hub := joinStreamHub(id, agentStreamURL(instance), viewer)
+	defer hub.leave(viewer)
 
-	// 客户端到Agent
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				logger.Errorf("客户端到Agent代理panic: %v", r)
-			}
-		}()
-		for {
-			messageType, message, err := clientConn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					logger.Errorf("客户端连接异常关闭: %v", err)
-				}
-				errChan <- err
-				return
-			}
-			if err := agentConn.WriteMessage(messageType, message); err != nil {
-				logger.Errorf("向Agent发送消息失败: %v", err)
-				errChan <- err
-				return
-			}
-		}
-	}()
-
-	// Agent到客户端
-	go func() {
-		defer func() {
-			if r := recover(); r != nil {
-				logger.Errorf("Agent到客户端代理panic: %v", r)
-			}
-		}()
-		for {
-			messageType, message, err := agentConn.ReadMessage()
-			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					logger.Errorf("Agent连接异常关闭: %v", err)
-				}
-				errChan <- err
-				return
-			}
-			if err := clientConn.WriteMessage(messageType, message); err != nil {
-				logger.Errorf("向客户端发送消息失败: %v", err)
-				errChan <- err
-				return
-			}
-		}
-	}()
-
-	// 等待任一方向的连接出错
-	<-errChan
+	go viewer.writePump()
+	viewer.readPump()
 	logger.Infof("WebSocket代理连接结束: ID=%d", id)
 }
 
 // WebSocketControl WebSocket控制代理
+// 同一设备的多个控制连接由仲裁器协调：仅控制者的输入消息会被转发给Agent
+// 与Agent的连接断开时在宽限期内自动重连，浏览器连接保持不变
+// 会话受所属分组的空闲超时和最长时长策略约束
 func WebSocketControl(c *gin.Context) {
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
@@ -139,6 +99,13 @@ func WebSocketControl(c *gin.Context) {
 		return
 	}
 
+	proxyControl(c, instance, isAdminToken(c.Query("admin_token")), nil)
+}
+
+// proxyControl 代理浏览器与Agent之间的控制连接，session不为nil时表示通过分享链接访问
+func proxyControl(c *gin.Context, instance *models.Instance, admin bool, session *shareSession) {
+	id := int(instance.ID)
+
 	// 升级HTTP连接为WebSocket
 	clientConn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -146,6 +113,9 @@ func WebSocketControl(c *gin.Context) {
 		return
 	}
 	defer clientConn.Close()
+	if session != nil {
+		session.bind(clientConn)
+	}
 
 	// 构建Agent WebSocket URL
 	agentHTTPPort := config.GetAgentHTTPPort()
@@ -164,7 +134,57 @@ func WebSocketControl(c *gin.Context) {
 		clientConn.WriteMessage(websocket.TextMessage, []byte(`{"error": "连接Agent失败"}`))
 		return
 	}
-	defer agentConn.Close()
+	upstream := &agentUpstream{conn: agentConn}
+	defer upstream.close()
+
+	// 客户端断开时关闭，用于中断重连
+	clientDone := make(chan struct{})
+	defer close(clientDone)
+
+	// 加入控制权仲裁：mode=observe 以观察者身份加入，否则在无人控制时成为控制者
+	client := &controlClient{
+		id:       newControlClientID(),
+		conn:     clientConn,
+		admin:    admin,
+		joinedAt: time.Now(),
+	}
+	arbiter := joinControlArbiter(id, client, c.Query("mode") != "observe")
+	defer arbiter.leave(client)
+
+	// 记录会话并执行所属分组的空闲超时/最长时长策略
+	record := &models.ControlSession{
+		InstanceID: id,
+		ClientID:   client.id,
+		RemoteAddr: c.ClientIP(),
+		Admin:      admin,
+		StartedAt:  client.joinedAt,
+	}
+	if session != nil {
+		record.ShareLinkID = &session.link.ID
+	}
+	if err := models.CreateControlSession(record); err != nil {
+		logger.Warnf("控制会话记录失败，继续代理: %v", err)
+	}
+	policy := models.ResolveSessionPolicy(instance.GroupID)
+	enforcer := newSessionEnforcer(policy, client, arbiter, c.Query("session"))
+	go enforcer.run(clientDone)
+	defer func() {
+		if record.ID != 0 {
+			models.CloseControlSession(record.ID, enforcer.closeReason())
+		}
+	}()
+
+	// 分组策略开启录制或连接时指定 record=true 时录制本次会话
+	var sessionRec *sessionRecorder
+	if policy.RecordSessions || c.Query("record") == "true" || c.Query("record") == "1" {
+		sessionRec, err = startSessionRecording(instance, record.ID)
+		if err != nil {
+			logger.Errorf("开始会话录制失败: 实例=%d, 错误=%v", id, err)
+			client.sendError("会话录制启动失败", err.Error())
+		} else {
+			defer sessionRec.finish()
+		}
+	}
 
 	// 创建双向代理
 	errChan := make(chan error, 2)
@@ -182,24 +202,60 @@ func WebSocketControl(c *gin.Context) {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					logger.Errorf("客户端控制连接异常关闭: %v", err)
 				}
+				if session != nil && session.isClosed() {
+					enforcer.setReason(models.CloseReasonShareEnded)
+				}
 				errChan <- err
 				return
 			}
+			// 控制消息均为文本帧，二进制帧会绕过控制权仲裁，直接丢弃
+			if messageType != websocket.TextMessage {
+				client.sendError("不支持的控制消息格式", "控制连接只接受文本消息")
+				continue
+			}
 
-			// 剪贴板消息特殊日志
-			if messageType == websocket.TextMessage {
-				var msg map[string]interface{}
-				if err := json.Unmarshal(message, &msg); err == nil {
-					if msgType, ok := msg["type"].(string); ok && strings.Contains(msgType, "CLIPBOARD") {
-						logger.Infof("📋 [Backend] 转发剪贴板消息 客户端→Agent: %s", msgType)
-					}
+			// 只有转发给Agent的输入才算作操作，状态查询和被拒绝的消息不重置空闲计时
+			input := false
+			var msg ControlMessage
+			if err := json.Unmarshal(message, &msg); err == nil {
+				// 控制权仲裁消息由后端处理，不转发给Agent
+				if isArbitrationMessage(msg.Type) {
+					arbiter.handleMessage(client, msg)
+					continue
+				}
+
+				// 观察者的输入消息直接拒绝
+				if isInputMessage(msg.Type) && !arbiter.isController(client.id) {
+					client.sendError("当前为观察者，无法操作设备", fmt.Sprintf("消息类型 %s 需要控制权", msg.Type))
+					continue
+				}
+
+				// 剪贴板消息特殊日志
+				if strings.Contains(msg.Type, "CLIPBOARD") {
+					logger.Infof("📋 [Backend] 转发剪贴板消息 客户端→Agent: %s", msg.Type)
+				}
+
+				input = isInputMessage(msg.Type)
+				if sessionRec != nil && input {
+					sessionRec.recordInput(msg.Type, message)
+				}
+			} else if !arbiter.isController(client.id) {
+				// 旧格式消息（5.mouse / 3.key 等）均为输入操作
+				client.sendError("当前为观察者，无法操作设备", "旧格式控制消息需要控制权")
+				continue
+			} else {
+				input = true
+				if sessionRec != nil {
+					sessionRec.recordInput("LEGACY", message)
 				}
 			}
 
-			if err := agentConn.WriteMessage(messageType, message); err != nil {
-				logger.Errorf("向Agent发送控制消息失败: %v", err)
-				errChan <- err
-				return
+			// 写失败时由读取协程负责重连，这里只通知客户端消息未送达
+			if err := upstream.writeMessage(messageType, message); err != nil {
+				logger.Warnf("向Agent发送控制消息失败: %v", err)
+				client.sendError("Agent连接中断，消息未送达", err.Error())
+			} else if input {
+				enforcer.touch()
 			}
 		}
 	}()
@@ -211,20 +267,42 @@ func WebSocketControl(c *gin.Context) {
 				logger.Errorf("Agent到客户端控制代理panic: %v", r)
 			}
 		}()
+		conn := agentConn
+		watches := controlWatches{}
 		for {
-			messageType, message, err := agentConn.ReadMessage()
+			messageType, message, err := conn.ReadMessage()
 			if err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					logger.Errorf("Agent控制连接异常关闭: %v", err)
 				}
-				errChan <- err
-				return
+
+				// 在宽限期内重连Agent，期间保持浏览器连接
+				// Agent已随连接断开取消本连接创建的目录监听，逐个通知客户端
+				upstream.close()
+				for _, notice := range watches.lostMessages() {
+					client.writeMessage(websocket.TextMessage, notice)
+				}
+				client.writeMessage(websocket.TextMessage, upstreamStatusMessage(UpstreamReconnecting))
+				conn, err = redialAgent(agentWSURL.String(), clientDone)
+				if err != nil {
+					if err != errReconnectAborted {
+						enforcer.setReason(models.CloseReasonAgentLost)
+						logger.Errorf("Agent控制连接重连失败: ID=%d, 错误=%v", id, err)
+						client.writeMessage(websocket.TextMessage, upstreamStatusMessage(UpstreamLost))
+					}
+					errChan <- err
+					return
+				}
+				upstream.set(conn)
+				client.writeMessage(websocket.TextMessage, upstreamStatusMessage(UpstreamResumed))
+				continue
 			}
 
-			// 剪贴板消息特殊日志
+			// 记录目录监听状态，剪贴板消息特殊日志
 			if messageType == websocket.TextMessage {
 				var msg map[string]interface{}
 				if err := json.Unmarshal(message, &msg); err == nil {
+					watches.track(msg)
 					if msgType, ok := msg["type"].(string); ok && strings.Contains(msgType, "CLIPBOARD") {
 						logger.Infof("📋 [Backend] 转发剪贴板消息 Agent→客户端: %s", msgType)
 						// 如果是CLIPBOARD_UPDATE，显示消息体内容
@@ -241,7 +319,7 @@ func WebSocketControl(c *gin.Context) {
 				}
 			}
 
-			if err := clientConn.WriteMessage(messageType, message); err != nil {
+			if err := client.writeMessage(messageType, message); err != nil {
 				logger.Errorf("向客户端发送控制消息失败: %v", err)
 				errChan <- err
 				return
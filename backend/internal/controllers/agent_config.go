@@ -0,0 +1,408 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ConfigProfileRequest 配置模板请求结构
+type ConfigProfileRequest struct {
+	Name        string            `json:"name" binding:"required"`
+	Description string            `json:"description"`
+	Config      models.ConfigData `json:"config"`
+}
+
+// GroupConfigProfileRequest 设置分组配置模板请求结构
+type GroupConfigProfileRequest struct {
+	ProfileID uint `json:"profile_id" binding:"required"`
+}
+
+// InstanceConfigOverrideRequest 设置设备配置覆盖请求结构
+type InstanceConfigOverrideRequest struct {
+	Config models.ConfigData `json:"config" binding:"required"`
+}
+
+// AgentConfigReport Agent在心跳中上报的集中配置应用结果
+type AgentConfigReport struct {
+	Version   string     `json:"version"`
+	Error     string     `json:"error"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// InstanceConfigStatus 设备的集中配置及应用情况
+type InstanceConfigStatus struct {
+	models.EffectiveConfig
+	InstanceID     uint       `json:"instance_id"`
+	Hostname       string     `json:"hostname"`
+	Lan            string     `json:"lan"`
+	AppliedVersion string     `json:"applied_version"` // Agent上报的已应用版本
+	AppliedAt      *time.Time `json:"applied_at"`
+	Error          string     `json:"error"` // Agent应用配置时的错误
+	Drift          bool       `json:"drift"` // 已应用版本与生效版本不一致
+}
+
+// newInstanceConfigStatus 计算设备的集中配置及应用情况
+func newInstanceConfigStatus(instance *models.Instance) (*InstanceConfigStatus, error) {
+	effective, err := models.ResolveEffectiveConfig(instance)
+	if err != nil {
+		return nil, err
+	}
+	return &InstanceConfigStatus{
+		EffectiveConfig: *effective,
+		InstanceID:      instance.ID,
+		Hostname:        instance.Hostname,
+		Lan:             instance.Lan,
+		AppliedVersion:  instance.ConfigVersion,
+		AppliedAt:       instance.ConfigAppliedAt,
+		Error:           instance.ConfigError,
+		Drift:           instance.ConfigVersion != effective.Version,
+	}, nil
+}
+
+// getConfigProfileParam 根据路径参数获取配置模板，失败时已写入响应
+func getConfigProfileParam(c *gin.Context) (*models.ConfigProfile, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("配置模板参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return nil, false
+	}
+
+	profile, err := models.GetConfigProfile(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "配置模板不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return nil, false
+	}
+	return profile, true
+}
+
+// bindConfigProfile 绑定并校验配置模板参数，失败时已写入响应
+func bindConfigProfile(c *gin.Context, excludeID uint) (*ConfigProfileRequest, bool) {
+	var item ConfigProfileRequest
+	if err := c.ShouldBindJSON(&item); err != nil {
+		logger.Errorf("配置模板参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return nil, false
+	}
+	if err := item.Config.Validate(); err != nil {
+		BadRequestRes(c, err.Error())
+		return nil, false
+	}
+	if existing, err := models.GetConfigProfileByName(item.Name); err == nil && existing.ID != excludeID {
+		BadRequestRes(c, "配置模板名称已存在")
+		return nil, false
+	}
+	if item.Config == nil {
+		item.Config = models.ConfigData{}
+	}
+	return &item, true
+}
+
+// CreateConfigProfile 创建配置模板
+func CreateConfigProfile(c *gin.Context) {
+	item, ok := bindConfigProfile(c, 0)
+	if !ok {
+		return
+	}
+
+	profile := &models.ConfigProfile{
+		Name:        item.Name,
+		Description: item.Description,
+		Config:      item.Config,
+	}
+	if err := models.CreateConfigProfile(profile); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, profile)
+}
+
+// ListConfigProfiles 获取配置模板列表
+func ListConfigProfiles(c *gin.Context) {
+	profiles, err := models.GetConfigProfileList()
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, profiles)
+}
+
+// GetConfigProfile 获取配置模板详情
+func GetConfigProfile(c *gin.Context) {
+	profile, ok := getConfigProfileParam(c)
+	if !ok {
+		return
+	}
+
+	SuccessRes(c, profile)
+}
+
+// UpdateConfigProfile 更新配置模板，使用该模板的设备在下次心跳时获取新配置
+func UpdateConfigProfile(c *gin.Context) {
+	profile, ok := getConfigProfileParam(c)
+	if !ok {
+		return
+	}
+	item, ok := bindConfigProfile(c, profile.ID)
+	if !ok {
+		return
+	}
+
+	updated, err := models.UpdateConfigProfile(int(profile.ID), item.Name, item.Description, item.Config)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, updated)
+}
+
+// DeleteConfigProfile 删除配置模板，仍有分组使用时不允许删除
+func DeleteConfigProfile(c *gin.Context) {
+	profile, ok := getConfigProfileParam(c)
+	if !ok {
+		return
+	}
+
+	count, err := models.CountGroupsByConfigProfile(int(profile.ID))
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if count > 0 {
+		BadRequestRes(c, "仍有分组使用该配置模板，请先取消分配")
+		return
+	}
+
+	if err := models.DeleteConfigProfile(int(profile.ID)); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, nil)
+}
+
+// GetGroupConfigProfile 获取分组使用的配置模板
+func GetGroupConfigProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取分组配置模板参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	assignment, err := models.GetGroupConfigProfile(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "分组未设置配置模板")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return
+	}
+
+	profile, err := models.GetConfigProfile(int(assignment.ProfileID))
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, profile)
+}
+
+// PutGroupConfigProfile 设置分组使用的配置模板
+func PutGroupConfigProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("设置分组配置模板参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var item GroupConfigProfileRequest
+	if err := c.ShouldBindJSON(&item); err != nil {
+		logger.Errorf("设置分组配置模板参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+
+	if _, err := models.GetGroup(id); err != nil {
+		NotFoundRes(c, "分组不存在")
+		return
+	}
+	profile, err := models.GetConfigProfile(int(item.ProfileID))
+	if err != nil {
+		NotFoundRes(c, "配置模板不存在")
+		return
+	}
+
+	if _, err := models.SaveGroupConfigProfile(id, profile.ID); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, profile)
+}
+
+// DeleteGroupConfigProfile 取消分组的配置模板，分组内设备恢复使用本地配置
+func DeleteGroupConfigProfile(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("取消分组配置模板参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if err := models.DeleteGroupConfigProfile(id); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, nil)
+}
+
+// GetGroupConfigDrift 获取分组内设备的配置应用情况，drift=true时只返回配置漂移的设备
+func GetGroupConfigDrift(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取分组配置漂移参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	instances, err := models.ListInstancesByGroupId(id)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	onlyDrift := c.Query("drift") == "true"
+	items := make([]InstanceConfigStatus, 0, len(instances))
+	drifted := 0
+	for i := range instances {
+		status, err := newInstanceConfigStatus(&instances[i])
+		if err != nil {
+			ErrorRes(c, ErrDbReturn, err.Error())
+			return
+		}
+		if status.Drift {
+			drifted++
+		} else if onlyDrift {
+			continue
+		}
+		// 列表中不返回配置内容
+		status.Config = nil
+		items = append(items, *status)
+	}
+
+	SuccessRes(c, gin.H{"total": len(instances), "drift": drifted, "items": items})
+}
+
+// GetInstanceConfig 获取设备生效的集中配置及应用情况，Agent注册后和配置变化时通过该接口获取配置
+func GetInstanceConfig(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取设备配置参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	instance, err := models.GetInstance(id)
+	if err != nil {
+		NotFoundRes(c, "设备不存在")
+		return
+	}
+
+	status, err := newInstanceConfigStatus(instance)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, status)
+}
+
+// GetInstanceConfigOverride 获取设备的配置覆盖
+func GetInstanceConfigOverride(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取设备配置覆盖参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	override, err := models.GetInstanceConfigOverride(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "设备未设置配置覆盖")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return
+	}
+
+	SuccessRes(c, override)
+}
+
+// PutInstanceConfigOverride 设置设备的配置覆盖，合并在分组配置模板之上
+func PutInstanceConfigOverride(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("设置设备配置覆盖参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var item InstanceConfigOverrideRequest
+	if err := c.ShouldBindJSON(&item); err != nil {
+		logger.Errorf("设置设备配置覆盖参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+	if err := item.Config.Validate(); err != nil {
+		BadRequestRes(c, err.Error())
+		return
+	}
+
+	if _, err := models.GetInstance(id); err != nil {
+		NotFoundRes(c, "设备不存在")
+		return
+	}
+
+	override, err := models.SaveInstanceConfigOverride(id, item.Config)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, override)
+}
+
+// DeleteInstanceConfigOverride 删除设备的配置覆盖
+func DeleteInstanceConfigOverride(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("删除设备配置覆盖参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if err := models.DeleteInstanceConfigOverride(id); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, nil)
+}
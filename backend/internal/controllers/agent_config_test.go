@@ -0,0 +1,166 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// setupConfigDB 使用临时数据库，返回配置模板接口的路由
+func setupConfigDB(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: gormLogger.Default.LogMode(gormLogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Group{}, &models.Instance{}, &models.ConfigProfile{},
+		&models.GroupConfigProfile{}, &models.InstanceConfigOverride{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	oldDB := models.DB
+	models.DB = db
+	t.Cleanup(func() { models.DB = oldDB })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/config-profiles", CreateConfigProfile)
+	return router
+}
+
+// postConfigProfile 调用创建配置模板接口，返回响应码和消息
+func postConfigProfile(t *testing.T, router *gin.Engine, name, config string) (int, string) {
+	t.Helper()
+
+	body := `{"name": "` + name + `", "config": ` + config + `}`
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/config-profiles", bytes.NewReader([]byte(body))))
+
+	var res struct {
+		Code int    `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("解析响应失败: %v, 响应=%s", err, w.Body.String())
+	}
+	return res.Code, res.Msg
+}
+
+func TestCreateConfigProfileRejectsInvalidValues(t *testing.T) {
+	router := setupConfigDB(t)
+
+	invalid := map[string]struct {
+		config string
+		field  string
+	}{
+		"帧率超出范围":   {`{"encoder": {"frame_rate": 500}}`, "encoder.frame_rate"},
+		"帧率为0":     {`{"encoder": {"frame_rate": 0}}`, "encoder.frame_rate"},
+		"帧率不是整数":   {`{"encoder": {"frame_rate": 12.5}}`, "encoder.frame_rate"},
+		"不支持的编码器":  {`{"encoder": {"default_codec": "h265"}}`, "encoder.default_codec"},
+		"编码器列表":    {`{"encoder": {"enabled_codecs": ["h264", "av1"]}}`, "encoder.enabled_codecs"},
+		"类型不符":     {`{"input": {"mouse_enabled": "yes"}}`, "input.mouse_enabled"},
+		"未知字段":     {`{"screen": {"quality": 80}}`, "screen.quality"},
+		"嵌套字段":     {`{"encoder": {"debug": {"save_video_duration": -1}}}`, "encoder.debug.save_video_duration"},
+		"端口不可集中管理": {`{"agent": {"http_port": 70000}}`, "agent"},
+	}
+	for name, item := range invalid {
+		code, msg := postConfigProfile(t, router, name, item.config)
+		if code != ErrParam || !strings.Contains(msg, item.field) {
+			t.Errorf("%s: 应拒绝并指出%s, code=%d, msg=%s", name, item.field, code, msg)
+		}
+	}
+	if profiles, _ := models.GetConfigProfileList(); len(profiles) != 0 {
+		t.Fatalf("不合法的配置模板不应保存: %d个", len(profiles))
+	}
+
+	valid := `{"encoder": {"frame_rate": 30, "default_codec": "h264", "enabled_codecs": ["h264", "jpeg"], "debug": {"save_video_duration": 0}},
+		"screen": {"jpeg_quality": 80, "capture_method": "dxgi"}, "input": {"paste_enabled": false}}`
+	if code, msg := postConfigProfile(t, router, "valid", valid); code != ErrSuccess {
+		t.Fatalf("合法的配置模板被拒绝: code=%d, msg=%s", code, msg)
+	}
+}
+
+func TestResolveEffectiveConfigPrecedence(t *testing.T) {
+	setupConfigDB(t)
+
+	group := models.Group{Name: "office"}
+	if err := models.DB.Create(&group).Error; err != nil {
+		t.Fatalf("创建分组失败: %v", err)
+	}
+	groupID := int(group.ID)
+	grouped := models.Instance{Uuid: "uuid-grouped", Lan: "10.0.2.1", GroupID: &groupID}
+	ungrouped := models.Instance{Uuid: "uuid-ungrouped", Lan: "10.0.2.2"}
+	for _, instance := range []*models.Instance{&grouped, &ungrouped} {
+		if err := models.DB.Create(instance).Error; err != nil {
+			t.Fatalf("创建设备失败: %v", err)
+		}
+	}
+
+	profile := models.ConfigProfile{Name: "office", Config: models.ConfigData{
+		"encoder": map[string]interface{}{"frame_rate": 15.0, "default_codec": "h264"},
+		"input":   map[string]interface{}{"paste_enabled": false},
+	}}
+	if err := models.CreateConfigProfile(&profile); err != nil {
+		t.Fatalf("创建配置模板失败: %v", err)
+	}
+	if _, err := models.SaveGroupConfigProfile(groupID, profile.ID); err != nil {
+		t.Fatalf("设置分组配置模板失败: %v", err)
+	}
+
+	// 只有分组模板
+	effective, err := models.ResolveEffectiveConfig(&grouped)
+	if err != nil {
+		t.Fatalf("获取生效配置失败: %v", err)
+	}
+	encoder := effective.Config["encoder"].(map[string]interface{})
+	if effective.ProfileID != profile.ID || effective.HasOverride || encoder["frame_rate"] != 15.0 {
+		t.Fatalf("分组模板未生效: %+v", effective)
+	}
+	profileVersion := effective.Version
+
+	// 设备覆盖优先于分组模板，未覆盖的字段保留模板的值
+	override := models.ConfigData{"encoder": map[string]interface{}{"frame_rate": 30.0}}
+	if _, err := models.SaveInstanceConfigOverride(int(grouped.ID), override); err != nil {
+		t.Fatalf("设置设备配置覆盖失败: %v", err)
+	}
+	effective, _ = models.ResolveEffectiveConfig(&grouped)
+	encoder = effective.Config["encoder"].(map[string]interface{})
+	input := effective.Config["input"].(map[string]interface{})
+	if !effective.HasOverride || encoder["frame_rate"] != 30.0 || encoder["default_codec"] != "h264" || input["paste_enabled"] != false {
+		t.Fatalf("设备覆盖未按优先级合并: %+v", effective.Config)
+	}
+	if effective.Version == profileVersion {
+		t.Fatal("配置内容变化后版本应变化")
+	}
+
+	// 未分组的设备没有集中配置
+	effective, _ = models.ResolveEffectiveConfig(&ungrouped)
+	if effective.ProfileID != 0 || len(effective.Config) != 0 || effective.Version != "" {
+		t.Fatalf("未分组设备不应有集中配置: %+v", effective)
+	}
+
+	// 分组的模板被删除后只保留设备覆盖
+	if err := models.DeleteConfigProfile(int(profile.ID)); err != nil {
+		t.Fatalf("删除配置模板失败: %v", err)
+	}
+	effective, err = models.ResolveEffectiveConfig(&grouped)
+	if err != nil {
+		t.Fatalf("获取生效配置失败: %v", err)
+	}
+	encoder = effective.Config["encoder"].(map[string]interface{})
+	if effective.ProfileID != 0 || encoder["frame_rate"] != 30.0 || encoder["default_codec"] != nil {
+		t.Fatalf("模板删除后应只保留设备覆盖: %+v", effective)
+	}
+}
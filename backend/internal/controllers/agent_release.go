@@ -0,0 +1,469 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// AgentUpdateOffer 下发给Agent的更新信息，心跳响应和推送更新共用
+type AgentUpdateOffer struct {
+	ReleaseID uint   `json:"release_id"`
+	Version   string `json:"version"`
+	URL       string `json:"url"` // 相对路径，Agent基于自身配置的服务器地址下载
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	Signature string `json:"signature"`
+}
+
+// AgentUpdateReport Agent在心跳中上报的更新结果
+type AgentUpdateReport struct {
+	Version string `json:"version"`
+	Status  string `json:"status"`
+	Error   string `json:"error"`
+}
+
+// AgentRolloutRequest 灰度发布设置请求结构
+type AgentRolloutRequest struct {
+	Version string `json:"version" binding:"required"`
+	Percent int    `json:"percent"`
+}
+
+// PushAgentUpdateRequest 推送更新请求结构
+type PushAgentUpdateRequest struct {
+	ReleaseID int `json:"release_id"` // 为空时使用分组灰度发布的目标版本，分组未设置时使用该平台最新版本
+}
+
+// agentUpdateClient 通知Agent更新的请求客户端，Agent收到后在后台下载
+var agentUpdateClient = &http.Client{Timeout: 10 * time.Second}
+
+// instancePlatform 设备平台，与安装包的platform字段对应
+func instancePlatform(instance *models.Instance) string {
+	return instance.OS + "/" + instance.Arch
+}
+
+// newAgentUpdateOffer 根据安装包生成更新信息
+func newAgentUpdateOffer(release *models.AgentRelease) *AgentUpdateOffer {
+	return &AgentUpdateOffer{
+		ReleaseID: release.ID,
+		Version:   release.Version,
+		URL:       fmt.Sprintf("/api/agent-releases/%d/download", release.ID),
+		SHA256:    release.SHA256,
+		Size:      release.Size,
+		Signature: release.Signature,
+	}
+}
+
+// resolveAgentUpdate 根据分组灰度发布判断设备是否需要更新，不需要时返回nil
+// 该版本在设备上已回滚或失败过时不再下发，需要通过推送更新手动重试
+func resolveAgentUpdate(instance *models.Instance) *AgentUpdateOffer {
+	if instance.GroupID == nil {
+		return nil
+	}
+	rollout, err := models.GetAgentRolloutByGroup(*instance.GroupID)
+	if err != nil || rollout.Version == instance.Version || !rollout.InRollout(instance) {
+		return nil
+	}
+	if instance.UpdateVersion == rollout.Version &&
+		(instance.UpdateStatus == models.UpdateStatusRolledBack || instance.UpdateStatus == models.UpdateStatusFailed) {
+		return nil
+	}
+
+	release, err := models.FindAgentRelease(rollout.Version, instancePlatform(instance))
+	if err != nil {
+		return nil
+	}
+	return newAgentUpdateOffer(release)
+}
+
+// getAgentReleaseParam 根据路径参数获取安装包，失败时已写入响应
+func getAgentReleaseParam(c *gin.Context) (*models.AgentRelease, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("Agent版本参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return nil, false
+	}
+
+	release, err := models.GetAgentRelease(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "Agent版本不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return nil, false
+	}
+	return release, true
+}
+
+// removeReleaseFile 没有其他记录引用时删除安装包文件
+func removeReleaseFile(path string) {
+	if count, err := models.CountAgentReleasesByPath(path); err == nil && count == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.Errorf("删除Agent安装包失败: %s, 错误=%v", path, err)
+		}
+	}
+}
+
+// UploadAgentRelease 上传Agent安装包
+// multipart表单字段: file 安装包, version 版本号, platform 平台(如windows/amd64),
+// sha256 可选，填写时校验上传内容, signature 可选，SHA-256摘要的Ed25519签名(base64), notes 更新说明
+func UploadAgentRelease(c *gin.Context) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		BadRequestRes(c, "请使用multipart/form-data上传文件")
+		return
+	}
+
+	release := &models.AgentRelease{
+		Version:   c.Query("version"),
+		Platform:  c.Query("platform"),
+		Signature: c.Query("signature"),
+		Notes:     c.Query("notes"),
+	}
+	expected := c.Query("sha256")
+	received := false
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Errorf("读取上传内容失败: %v", err)
+			BadRequestRes(c, "读取上传内容失败")
+			return
+		}
+
+		if part.FormName() == "file" {
+			if !received {
+				release.Name = filepath.Base(strings.ReplaceAll(part.FileName(), "\\", "/"))
+				release.Path, release.Size, release.SHA256, err = saveStoreFile(config.GetUpdateConfig().Dir, part)
+				if err != nil {
+					logger.Errorf("保存Agent安装包失败: %v", err)
+					ErrorRes(c, ErrInternal, "保存文件失败")
+					return
+				}
+				received = true
+			}
+			part.Close()
+			continue
+		}
+
+		value, _ := io.ReadAll(io.LimitReader(part, 4096))
+		part.Close()
+		if len(value) == 0 {
+			continue
+		}
+		switch part.FormName() {
+		case "version":
+			release.Version = strings.TrimSpace(string(value))
+		case "platform":
+			release.Platform = strings.TrimSpace(string(value))
+		case "sha256":
+			expected = strings.TrimSpace(string(value))
+		case "signature":
+			release.Signature = strings.TrimSpace(string(value))
+		case "notes":
+			release.Notes = string(value)
+		}
+	}
+
+	if !received {
+		BadRequestRes(c, "缺少file字段")
+		return
+	}
+
+	// 参数校验失败时删除已保存但未被引用的文件
+	reject := func(msg string) {
+		removeReleaseFile(release.Path)
+		BadRequestRes(c, msg)
+	}
+	if release.Version == "" || !strings.Contains(release.Platform, "/") {
+		reject("缺少version参数或platform格式错误(应为os/arch)")
+		return
+	}
+	if expected != "" && !strings.EqualFold(expected, release.SHA256) {
+		reject("文件SHA-256与sha256参数不一致")
+		return
+	}
+	if release.Signature != "" {
+		if sig, err := base64.StdEncoding.DecodeString(release.Signature); err != nil || len(sig) != 64 {
+			reject("signature应为base64编码的Ed25519签名")
+			return
+		}
+	}
+	if _, err := models.FindAgentRelease(release.Version, release.Platform); err == nil {
+		reject("该版本的平台安装包已存在")
+		return
+	}
+	if release.Name == "" || release.Name == "." || release.Name == "/" {
+		release.Name = release.SHA256
+	}
+
+	if err := models.CreateAgentRelease(release); err != nil {
+		removeReleaseFile(release.Path)
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	logger.Infof("上传Agent安装包: ID=%d, 版本=%s, 平台=%s, 大小=%d, 签名=%v",
+		release.ID, release.Version, release.Platform, release.Size, release.Signature != "")
+	SuccessRes(c, release)
+}
+
+// ListAgentReleases 获取Agent版本列表
+func ListAgentReleases(c *gin.Context) {
+	var params models.AgentReleaseListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		logger.Errorf("Agent版本列表参数绑定失败: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	result, err := models.GetAgentReleaseList(&params)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, result)
+}
+
+// GetAgentRelease 获取Agent版本信息
+func GetAgentRelease(c *gin.Context) {
+	release, ok := getAgentReleaseParam(c)
+	if !ok {
+		return
+	}
+	SuccessRes(c, release)
+}
+
+// DownloadAgentRelease 下载Agent安装包，Agent更新时使用，支持Range断点续传
+func DownloadAgentRelease(c *gin.Context) {
+	release, ok := getAgentReleaseParam(c)
+	if !ok {
+		return
+	}
+
+	file, err := os.Open(release.Path)
+	if err != nil {
+		logger.Errorf("打开Agent安装包失败: ID=%d, 错误=%v", release.ID, err)
+		NotFoundRes(c, "安装包已丢失")
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		ErrorRes(c, ErrInternal, err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", release.Name))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("ETag", fmt.Sprintf("\"%s\"", release.SHA256))
+	c.Header("X-Content-SHA256", release.SHA256)
+	http.ServeContent(c.Writer, c.Request, release.Name, info.ModTime(), file)
+}
+
+// DeleteAgentRelease 删除Agent版本，有分组灰度发布以该版本为目标时不允许删除
+func DeleteAgentRelease(c *gin.Context) {
+	release, ok := getAgentReleaseParam(c)
+	if !ok {
+		return
+	}
+
+	count, err := models.CountAgentRolloutsByVersion(release.Version)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if count > 0 {
+		BadRequestRes(c, "有分组正在灰度发布该版本，请先修改或删除灰度发布")
+		return
+	}
+
+	if err := models.DeleteAgentRelease(int(release.ID)); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	removeReleaseFile(release.Path)
+
+	logger.Infof("删除Agent版本: ID=%d, 版本=%s, 平台=%s", release.ID, release.Version, release.Platform)
+	SuccessRes(c, nil)
+}
+
+// GetGroupAgentRollout 获取分组的灰度发布设置
+func GetGroupAgentRollout(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取灰度发布参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	rollout, err := models.GetAgentRolloutByGroup(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "分组未设置灰度发布")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return
+	}
+
+	SuccessRes(c, rollout)
+}
+
+// PutGroupAgentRollout 设置分组的灰度发布：分组内percent比例的设备在心跳时更新到version
+func PutGroupAgentRollout(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("设置灰度发布参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var item AgentRolloutRequest
+	if err := c.ShouldBindJSON(&item); err != nil {
+		logger.Errorf("设置灰度发布参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+	if item.Percent < 0 || item.Percent > 100 {
+		BadRequestRes(c, "percent应在0-100之间")
+		return
+	}
+
+	if _, err := models.GetGroup(id); err != nil {
+		NotFoundRes(c, "分组不存在")
+		return
+	}
+	result, err := models.GetAgentReleaseList(&models.AgentReleaseListParams{Version: item.Version, Size: 1})
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if result.Total == 0 {
+		BadRequestRes(c, "该版本没有上传安装包")
+		return
+	}
+
+	rollout, err := models.SaveAgentRollout(models.AgentRollout{
+		GroupID: id,
+		Version: item.Version,
+		Percent: item.Percent,
+	})
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, rollout)
+}
+
+// DeleteGroupAgentRollout 删除分组的灰度发布设置，停止自动更新
+func DeleteGroupAgentRollout(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("删除灰度发布参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if err := models.DeleteAgentRollout(id); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, nil)
+}
+
+// PushAgentUpdate 立即通知设备更新到指定版本，不受灰度比例限制
+func PushAgentUpdate(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("推送更新参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var req PushAgentUpdateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			logger.Errorf("推送更新参数绑定失败: %v", err)
+			ErrorRes(c, ErrBindJson, err.Error())
+			return
+		}
+	}
+
+	instance, err := models.GetInstance(id)
+	if err != nil {
+		NotFoundRes(c, "实例不存在")
+		return
+	}
+
+	platform := instancePlatform(instance)
+	var release *models.AgentRelease
+	switch {
+	case req.ReleaseID > 0:
+		release, err = models.GetAgentRelease(req.ReleaseID)
+	case instance.GroupID != nil:
+		if rollout, rolloutErr := models.GetAgentRolloutByGroup(*instance.GroupID); rolloutErr == nil {
+			release, err = models.FindAgentRelease(rollout.Version, platform)
+		} else {
+			release, err = models.GetLatestAgentRelease(platform)
+		}
+	default:
+		release, err = models.GetLatestAgentRelease(platform)
+	}
+	if err != nil {
+		NotFoundRes(c, "没有适用于该设备的Agent版本")
+		return
+	}
+	if release.Platform != platform {
+		BadRequestRes(c, fmt.Sprintf("安装包平台(%s)与设备平台(%s)不一致", release.Platform, platform))
+		return
+	}
+
+	offer := newAgentUpdateOffer(release)
+	body, _ := json.Marshal(offer)
+	url := fmt.Sprintf("http://%s:%d/api/update", instance.Lan, config.GetAgentHTTPPort())
+	resp, err := agentUpdateClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		logger.Errorf("通知Agent更新失败: ID=%d, 错误=%v", id, err)
+		ErrorRes(c, ErrInternal, "通知Agent更新失败: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || resp.StatusCode != http.StatusOK || result.Code != 0 {
+		logger.Errorf("Agent拒绝更新: ID=%d, 状态码=%d, 信息=%s", id, resp.StatusCode, result.Message)
+		ErrorRes(c, ErrInternal, "Agent拒绝更新: "+result.Message)
+		return
+	}
+
+	logger.Infof("推送Agent更新: ID=%d, 当前版本=%s, 目标版本=%s", id, instance.Version, release.Version)
+	SuccessRes(c, offer)
+}
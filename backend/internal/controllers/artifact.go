@@ -0,0 +1,232 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// getArtifactParam 根据路径参数获取分发文件，失败时已写入响应
+func getArtifactParam(c *gin.Context) (*models.Artifact, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("分发文件参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return nil, false
+	}
+
+	artifact, err := models.GetArtifact(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "分发文件不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return nil, false
+	}
+	return artifact, true
+}
+
+// saveStoreFile 将上传内容写入存储目录并计算SHA-256，以SHA-256命名，相同内容的文件只保存一份
+func saveStoreFile(dir string, r io.Reader) (path string, size int64, sum string, err error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", 0, "", fmt.Errorf("创建存储目录失败: %v", err)
+	}
+
+	temp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", 0, "", err
+	}
+	defer os.Remove(temp.Name())
+
+	hasher := sha256.New()
+	size, err = io.Copy(temp, io.TeeReader(r, hasher))
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	sum = hex.EncodeToString(hasher.Sum(nil))
+	path = filepath.Join(dir, sum)
+	if _, err := os.Stat(path); err == nil {
+		return path, size, sum, nil
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return "", 0, "", err
+	}
+	return path, size, sum, nil
+}
+
+// UploadArtifact 上传待分发文件
+// multipart表单中的file字段以流的方式写入存储目录，不在内存中缓存；name/description可通过表单字段或查询参数指定
+func UploadArtifact(c *gin.Context) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		BadRequestRes(c, "请使用multipart/form-data上传文件")
+		return
+	}
+
+	artifact := &models.Artifact{
+		Name:        c.Query("name"),
+		Description: c.Query("description"),
+	}
+	filename := ""
+	received := false
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Errorf("读取上传内容失败: %v", err)
+			BadRequestRes(c, "读取上传内容失败")
+			return
+		}
+
+		switch part.FormName() {
+		case "file":
+			if !received {
+				filename = filepath.Base(strings.ReplaceAll(part.FileName(), "\\", "/"))
+				artifact.Path, artifact.Size, artifact.SHA256, err = saveStoreFile(config.GetArtifactConfig().Dir, part)
+				if err != nil {
+					logger.Errorf("保存分发文件失败: %v", err)
+					ErrorRes(c, ErrInternal, "保存文件失败")
+					return
+				}
+				received = true
+			}
+		case "name":
+			if value, _ := io.ReadAll(io.LimitReader(part, 4096)); len(value) > 0 {
+				artifact.Name = string(value)
+			}
+		case "description":
+			if value, _ := io.ReadAll(io.LimitReader(part, 4096)); len(value) > 0 {
+				artifact.Description = string(value)
+			}
+		}
+		part.Close()
+	}
+
+	if !received {
+		BadRequestRes(c, "缺少file字段")
+		return
+	}
+	if artifact.Name == "" {
+		artifact.Name = filename
+	}
+	if artifact.Name == "" || artifact.Name == "." || artifact.Name == "/" {
+		artifact.Name = artifact.SHA256
+	}
+
+	if err := models.CreateArtifact(artifact); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	logger.Infof("上传分发文件: ID=%d, 文件名=%s, 大小=%d, SHA256=%s", artifact.ID, artifact.Name, artifact.Size, artifact.SHA256)
+	SuccessRes(c, artifact)
+}
+
+// ListArtifacts 获取分发文件列表
+func ListArtifacts(c *gin.Context) {
+	var params models.ArtifactListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		logger.Errorf("分发文件列表参数绑定失败: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	result, err := models.GetArtifactList(&params)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, result)
+}
+
+// GetArtifact 获取分发文件信息
+func GetArtifact(c *gin.Context) {
+	artifact, ok := getArtifactParam(c)
+	if !ok {
+		return
+	}
+	SuccessRes(c, artifact)
+}
+
+// DownloadArtifact 下载分发文件，Agent拉取时使用，支持Range断点续传
+func DownloadArtifact(c *gin.Context) {
+	artifact, ok := getArtifactParam(c)
+	if !ok {
+		return
+	}
+
+	file, err := os.Open(artifact.Path)
+	if err != nil {
+		logger.Errorf("打开分发文件失败: ID=%d, 错误=%v", artifact.ID, err)
+		NotFoundRes(c, "分发文件已丢失")
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		ErrorRes(c, ErrInternal, err.Error())
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", artifact.Name))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("ETag", fmt.Sprintf("\"%s\"", artifact.SHA256))
+	c.Header("X-Content-SHA256", artifact.SHA256)
+	http.ServeContent(c.Writer, c.Request, artifact.Name, info.ModTime(), file)
+}
+
+// DeleteArtifact 删除分发文件，有进行中的分发任务时不允许删除
+func DeleteArtifact(c *gin.Context) {
+	artifact, ok := getArtifactParam(c)
+	if !ok {
+		return
+	}
+
+	running, err := models.CountRunningDistributionJobsByArtifact(artifact.ID)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if running > 0 {
+		BadRequestRes(c, "该文件有进行中的分发任务，请先取消任务")
+		return
+	}
+
+	if err := models.DeleteArtifact(int(artifact.ID)); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	// 相同内容的文件共用存储，没有其他记录引用时才删除文件
+	if count, err := models.CountArtifactsByPath(artifact.Path); err == nil && count == 0 {
+		if err := os.Remove(artifact.Path); err != nil && !os.IsNotExist(err) {
+			logger.Errorf("删除分发文件失败: %s, 错误=%v", artifact.Path, err)
+		}
+	}
+
+	logger.Infof("删除分发文件: ID=%d, 文件名=%s", artifact.ID, artifact.Name)
+	SuccessRes(c, nil)
+}
@@ -0,0 +1,238 @@
+package controllers
+
+import (
+	"encoding/hex"
+	"errors"
+	"path"
+	"strconv"
+	"strings"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+	"winmanager-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateBaselineRequest 创建基线请求结构
+// 指定source_instance_id时由该设备计算root下的哈希清单作为基线，否则使用files导入的清单
+type CreateBaselineRequest struct {
+	Name             string                `json:"name" binding:"required"`
+	Description      string                `json:"description"`
+	Root             string                `json:"root" binding:"required"` // 设备上要核对的文件或目录
+	MD5              bool                  `json:"md5"`                     // 同时计算并核对MD5
+	Exclude          []string              `json:"exclude"`                 // 排除的文件或目录通配符
+	SourceInstanceID *int                  `json:"source_instance_id"`      // 采集基线的设备
+	Files            []models.BaselineFile `json:"files"`                   // 导入的清单
+}
+
+// getBaselineParam 根据路径参数获取基线，失败时已写入响应
+func getBaselineParam(c *gin.Context) (*models.Baseline, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("基线参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return nil, false
+	}
+
+	baseline, err := models.GetBaseline(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "基线不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return nil, false
+	}
+	return baseline, true
+}
+
+// normalizeBaselineFiles 检查导入的清单并统一路径格式，同一路径只保留一条
+func normalizeBaselineFiles(files []models.BaselineFile, withMD5 bool) ([]models.BaselineFile, error) {
+	seen := make(map[string]bool, len(files))
+	result := make([]models.BaselineFile, 0, len(files))
+	for _, file := range files {
+		name := strings.TrimPrefix(path.Clean(strings.ReplaceAll(file.Path, "\\", "/")), "/")
+		if file.Path == "" || name == "." || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, errors.New("文件路径无效: " + file.Path)
+		}
+		if sum, err := hex.DecodeString(file.SHA256); err != nil || len(sum) != 32 {
+			return nil, errors.New("SHA-256格式错误: " + file.Path)
+		}
+		if withMD5 && file.MD5 != "" {
+			if sum, err := hex.DecodeString(file.MD5); err != nil || len(sum) != 16 {
+				return nil, errors.New("MD5格式错误: " + file.Path)
+			}
+		}
+		if file.Size < 0 {
+			return nil, errors.New("文件大小无效: " + file.Path)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		file.Path = name
+		file.SHA256 = strings.ToLower(file.SHA256)
+		file.MD5 = strings.ToLower(file.MD5)
+		if !withMD5 {
+			file.MD5 = ""
+		}
+		result = append(result, file)
+	}
+	return result, nil
+}
+
+// ListGroupBaselines 获取分组的基线列表
+func ListGroupBaselines(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取基线列表参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	baselines, err := models.ListBaselinesByGroup(id)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, baselines)
+}
+
+// CreateBaseline 为分组创建基线，从源设备采集或导入清单
+func CreateBaseline(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("创建基线参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var req CreateBaselineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Errorf("创建基线参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+	if req.SourceInstanceID == nil && len(req.Files) == 0 {
+		BadRequestRes(c, "请指定source_instance_id或files")
+		return
+	}
+
+	if _, err := models.GetGroup(groupID); err != nil {
+		NotFoundRes(c, "分组不存在")
+		return
+	}
+	if _, err := models.GetBaselineByName(groupID, req.Name); err == nil {
+		BadRequestRes(c, "该分组已存在同名基线")
+		return
+	}
+
+	baseline := &models.Baseline{
+		GroupID:     groupID,
+		Name:        req.Name,
+		Description: req.Description,
+		Root:        req.Root,
+		MD5:         req.MD5,
+		Exclude:     req.Exclude,
+	}
+
+	var files []models.BaselineFile
+	if req.SourceInstanceID != nil {
+		instance, err := models.GetInstance(*req.SourceInstanceID)
+		if err != nil {
+			NotFoundRes(c, "源设备不存在")
+			return
+		}
+		if instance.Status != 1 {
+			BadRequestRes(c, "源设备离线")
+			return
+		}
+
+		manifest, err := services.RequestAgentHash(c.Request.Context(), instance, req.Root, req.MD5, req.Exclude)
+		if err != nil {
+			logger.Errorf("采集基线清单失败: 设备=%d, 路径=%s, 错误=%v", instance.ID, req.Root, err)
+			ErrorRes(c, ErrInternal, "采集基线清单失败: "+err.Error())
+			return
+		}
+		if len(manifest.Errors) > 0 {
+			logger.Warnf("采集基线时有文件无法读取: 设备=%d, 路径=%s, 数量=%d", instance.ID, req.Root, len(manifest.Errors))
+		}
+		baseline.SourceInstanceID = req.SourceInstanceID
+		files = manifest.Files
+	} else {
+		if files, err = normalizeBaselineFiles(req.Files, req.MD5); err != nil {
+			BadRequestRes(c, err.Error())
+			return
+		}
+	}
+
+	if err := models.CreateBaseline(baseline, files); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	logger.Infof("创建基线: ID=%d, 分组=%d, 名称=%s, 路径=%s, 文件数=%d",
+		baseline.ID, groupID, baseline.Name, baseline.Root, baseline.FileCount)
+	SuccessRes(c, baseline)
+}
+
+// GetBaseline 获取基线信息
+func GetBaseline(c *gin.Context) {
+	baseline, ok := getBaselineParam(c)
+	if !ok {
+		return
+	}
+	SuccessRes(c, baseline)
+}
+
+// ListBaselineFiles 分页获取基线的文件清单，keyword按路径筛选
+func ListBaselineFiles(c *gin.Context) {
+	baseline, ok := getBaselineParam(c)
+	if !ok {
+		return
+	}
+
+	var params models.BaselineFileListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		logger.Errorf("基线文件列表参数绑定失败: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	result, err := models.GetBaselineFileList(baseline.ID, &params)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, result)
+}
+
+// DeleteBaseline 删除基线，有进行中的核对任务时不允许删除
+func DeleteBaseline(c *gin.Context) {
+	baseline, ok := getBaselineParam(c)
+	if !ok {
+		return
+	}
+
+	running, err := models.CountRunningIntegrityChecksByBaseline(baseline.ID)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if running > 0 {
+		BadRequestRes(c, "该基线有进行中的核对任务，请先取消任务")
+		return
+	}
+
+	if err := models.DeleteBaseline(baseline.ID); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	logger.Infof("删除基线: ID=%d, 名称=%s", baseline.ID, baseline.Name)
+	SuccessRes(c, nil)
+}
@@ -0,0 +1,268 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+	"winmanager-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateDistributionRequest 创建分发任务请求结构
+type CreateDistributionRequest struct {
+	ArtifactID  uint   `json:"artifact_id" binding:"required"`
+	GroupID     *int   `json:"group_id"`     // 目标分组，与instance_ids二选一
+	InstanceIDs []int  `json:"instance_ids"` // 目标设备
+	TargetDir   string `json:"target_dir" binding:"required"`
+	Filename    string `json:"filename"`    // 保存的文件名，默认使用分发文件名
+	Overwrite   string `json:"overwrite"`   // 目标已存在时的策略：overwrite(默认)/skip/fail
+	Concurrency int    `json:"concurrency"` // 同时分发的设备数，默认使用全局配置
+	OnlineOnly  bool   `json:"online_only"` // 只分发给当前在线的设备，否则离线设备记为失败
+}
+
+// DistributionDetail 分发任务详情
+type DistributionDetail struct {
+	models.DistributionJob
+	Results []models.DistributionResult `json:"results"`
+}
+
+// getDistributionParam 根据路径参数获取分发任务，失败时已写入响应
+func getDistributionParam(c *gin.Context) (*models.DistributionJob, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("分发任务参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return nil, false
+	}
+
+	job, err := models.GetDistributionJob(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "分发任务不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return nil, false
+	}
+	return job, true
+}
+
+// distributionTargets 获取分发目标设备（去重）
+func distributionTargets(req *CreateDistributionRequest) ([]models.Instance, error) {
+	var instances []models.Instance
+	var err error
+	if req.GroupID != nil {
+		instances, err = models.ListInstancesByGroupId(*req.GroupID)
+	} else {
+		instances, err = models.GetInstances(req.InstanceIDs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool, len(instances))
+	targets := make([]models.Instance, 0, len(instances))
+	for _, instance := range instances {
+		if seen[instance.ID] || (req.OnlineOnly && instance.Status != 1) {
+			continue
+		}
+		seen[instance.ID] = true
+		targets = append(targets, instance)
+	}
+	return targets, nil
+}
+
+// CreateDistribution 创建分发任务并立即开始分发
+func CreateDistribution(c *gin.Context) {
+	var req CreateDistributionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Errorf("创建分发任务参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+
+	if req.GroupID == nil && len(req.InstanceIDs) == 0 {
+		BadRequestRes(c, "请指定group_id或instance_ids")
+		return
+	}
+	switch req.Overwrite {
+	case "":
+		req.Overwrite = models.OverwriteAlways
+	case models.OverwriteAlways, models.OverwriteSkip, models.OverwriteFail:
+	default:
+		BadRequestRes(c, "overwrite 只能是 overwrite、skip 或 fail")
+		return
+	}
+
+	artifact, err := models.GetArtifact(int(req.ArtifactID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "分发文件不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return
+	}
+
+	if req.Filename == "" {
+		req.Filename = artifact.Name
+	}
+	if strings.ContainsAny(req.Filename, "/\\") || req.Filename == "." || req.Filename == ".." {
+		BadRequestRes(c, "filename 不能包含路径")
+		return
+	}
+
+	cfg := config.GetArtifactConfig()
+	if req.Concurrency <= 0 {
+		req.Concurrency = cfg.DefaultConcurrency
+	}
+	if cfg.MaxConcurrency > 0 && req.Concurrency > cfg.MaxConcurrency {
+		req.Concurrency = cfg.MaxConcurrency
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = 1
+	}
+
+	targets, err := distributionTargets(&req)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if len(targets) == 0 {
+		BadRequestRes(c, "没有可分发的设备")
+		return
+	}
+
+	service := services.GetDistributionService()
+	if service == nil {
+		ErrorRes(c, ErrInternal, "文件分发服务未启动")
+		return
+	}
+
+	job := &models.DistributionJob{
+		ArtifactID:   artifact.ID,
+		ArtifactName: artifact.Name,
+		GroupID:      req.GroupID,
+		TargetDir:    req.TargetDir,
+		Filename:     req.Filename,
+		Overwrite:    req.Overwrite,
+		Concurrency:  req.Concurrency,
+		Status:       models.DistributionStatusRunning,
+		Total:        len(targets),
+		StartedAt:    time.Now(),
+	}
+	if err := models.CreateDistributionJob(job, targets); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	service.Run(job)
+
+	logger.Infof("创建分发任务: ID=%d, 文件=%s, 设备数=%d, 目标目录=%s, 并发=%d",
+		job.ID, artifact.Name, job.Total, job.TargetDir, job.Concurrency)
+	SuccessRes(c, job)
+}
+
+// ListDistributions 获取分发任务列表
+func ListDistributions(c *gin.Context) {
+	var params models.DistributionListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		logger.Errorf("分发任务列表参数绑定失败: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	result, err := models.GetDistributionJobList(&params)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, result)
+}
+
+// GetDistribution 获取分发任务详情及每台设备的结果，status参数可筛选设备结果
+func GetDistribution(c *gin.Context) {
+	job, ok := getDistributionParam(c)
+	if !ok {
+		return
+	}
+
+	results, err := models.ListDistributionResults(job.ID, c.Query("status"))
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, DistributionDetail{DistributionJob: *job, Results: results})
+}
+
+// CancelDistribution 取消进行中的分发任务
+func CancelDistribution(c *gin.Context) {
+	job, ok := getDistributionParam(c)
+	if !ok {
+		return
+	}
+
+	service := services.GetDistributionService()
+	if service == nil || !service.Cancel(job.ID) {
+		BadRequestRes(c, "分发任务未在进行中")
+		return
+	}
+
+	logger.Infof("取消分发任务: ID=%d", job.ID)
+	SuccessRes(c, nil)
+}
+
+// RetryDistribution 重新分发给失败或已取消的设备
+func RetryDistribution(c *gin.Context) {
+	job, ok := getDistributionParam(c)
+	if !ok {
+		return
+	}
+
+	service := services.GetDistributionService()
+	if service == nil {
+		ErrorRes(c, ErrInternal, "文件分发服务未启动")
+		return
+	}
+	if service.IsRunning(job.ID) {
+		BadRequestRes(c, "分发任务正在进行中")
+		return
+	}
+
+	count, err := models.ResetDistributionResults(job.ID, []string{
+		models.DistributionResultFailed,
+		models.DistributionResultCancelled,
+	})
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if count == 0 {
+		BadRequestRes(c, "没有需要重试的设备")
+		return
+	}
+
+	job.Status = models.DistributionStatusRunning
+	job.FinishedAt = nil
+	if err := models.UpdateDistributionJob(job.ID, map[string]interface{}{
+		"status":      job.Status,
+		"finished_at": nil,
+	}); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if err := service.Run(job); err != nil {
+		BadRequestRes(c, err.Error())
+		return
+	}
+
+	logger.Infof("重试分发任务: ID=%d, 设备数=%d", job.ID, count)
+	SuccessRes(c, gin.H{"retried": count})
+}
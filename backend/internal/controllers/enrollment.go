@@ -0,0 +1,397 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 注册令牌的前缀，便于在配置文件和日志中识别
+const enrollmentTokenPrefix = "wme_"
+
+// 注册令牌失效时返回给Agent的提示
+const enrollmentTokenUnusableMsg = "注册令牌已撤销、过期或达到使用次数上限"
+
+// EnrollmentTokenRequest 创建注册令牌请求结构
+type EnrollmentTokenRequest struct {
+	Name        string `json:"name" binding:"required"`
+	GroupID     *int   `json:"group_id"`     // 使用该令牌注册的设备所在分组
+	ExpireHours int    `json:"expire_hours"` // 有效期(小时)，0表示不过期
+	MaxUses     int    `json:"max_uses"`     // 最多注册设备数，0表示不限制
+}
+
+// EnrollmentReviewRequest 审批注册申请请求结构
+type EnrollmentReviewRequest struct {
+	GroupID *int   `json:"group_id"` // 批准时指定设备所在分组
+	Note    string `json:"note"`
+}
+
+// EnrollmentTokenInfo 注册令牌及是否仍可使用
+type EnrollmentTokenInfo struct {
+	models.EnrollmentToken
+	Active bool   `json:"active"`
+	Token  string `json:"token,omitempty"` // 令牌明文，只在创建时返回一次
+}
+
+// registrationGrant 注册准入检查的结果
+type registrationGrant struct {
+	KnownID     uint  // 已确认身份的实例ID，注册时更新该实例
+	GroupID     *int  // 首次注册时分配的分组
+	TokenID     *uint // 首次注册使用的注册令牌
+	RequestID   uint  // 首次注册使用的已批准注册申请
+	IssueSecret bool  // 是否向Agent签发新的密钥
+}
+
+// newEnrollmentSecret 生成随机密钥，用于注册令牌、Agent密钥和审批凭据
+func newEnrollmentSecret() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashEnrollmentSecret 计算密钥的哈希，数据库只保存哈希
+func hashEnrollmentSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// authorizeRegistration 检查Agent是否可以注册，失败时已写入响应：
+// 提交了有效密钥的Agent（或设备UUID一致且尚未签发密钥的早期版本Agent）按原实例注册；
+// 新Agent提交注册令牌时使用令牌，未要求令牌时直接注册，否则进入待审批列表或拒绝。
+// 未证明身份的Agent按LAN地址注册，不能覆盖已绑定密钥的设备
+func authorizeRegistration(c *gin.Context, info *DeviceInfo) (*registrationGrant, bool) {
+	// 支持密钥的Agent才签发密钥，早期版本的Agent不会保存密钥，签发后将无法重新注册
+	canHoldSecret := info.EnrollmentVersion > 0
+
+	if info.ID > 0 {
+		instance, err := models.GetInstance(int(info.ID))
+		switch {
+		case err != nil:
+			logger.Warnf("Agent保存的实例不存在，按新设备处理: ID=%d, LAN=%s", info.ID, info.LAN)
+		case instance.AgentSecretHash == "":
+			// 没有密钥时只能凭一致的设备UUID沿用原实例
+			if instance.Uuid != "" && instance.Uuid == info.Uuid {
+				return &registrationGrant{KnownID: info.ID, IssueSecret: canHoldSecret}, true
+			}
+			logger.Warnf("设备UUID不一致，按新设备处理: ID=%d, LAN=%s, UUID=%s", info.ID, info.LAN, info.Uuid)
+		case instance.Uuid != "" && info.Uuid != "" && instance.Uuid != info.Uuid:
+			logger.Warnf("设备UUID不一致，按新设备处理: ID=%d, LAN=%s, UUID=%s", info.ID, info.LAN, info.Uuid)
+		case info.AgentSecret != "" && hashEnrollmentSecret(info.AgentSecret) == instance.AgentSecretHash:
+			return &registrationGrant{KnownID: info.ID}, true
+		default:
+			logger.Warnf("Agent密钥不匹配，按新设备处理: ID=%d, LAN=%s", info.ID, info.LAN)
+		}
+	}
+
+	if info.EnrollmentToken != "" {
+		return useEnrollmentToken(c, info.EnrollmentToken, canHoldSecret)
+	}
+
+	cfg := config.GetEnrollmentConfig()
+	if !cfg.Required {
+		return &registrationGrant{IssueSecret: canHoldSecret}, true
+	}
+	if !cfg.PendingApproval {
+		ErrorRes(c, ErrEnrollment, "首次注册需要注册令牌")
+		return nil, false
+	}
+	return checkEnrollmentRequest(c, info, canHoldSecret)
+}
+
+// useEnrollmentToken 校验注册令牌，令牌次数在设备注册成功的同一事务中增加
+func useEnrollmentToken(c *gin.Context, raw string, canHoldSecret bool) (*registrationGrant, bool) {
+	token, err := models.GetEnrollmentTokenByHash(hashEnrollmentSecret(raw))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			ErrorRes(c, ErrEnrollment, "注册令牌无效")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return nil, false
+	}
+
+	if !token.IsActive() {
+		ErrorRes(c, ErrEnrollment, enrollmentTokenUnusableMsg)
+		return nil, false
+	}
+
+	logger.Infof("Agent使用注册令牌注册: 令牌=%d(%s), 分组=%v", token.ID, token.Name, token.GroupID)
+	return &registrationGrant{GroupID: token.GroupID, TokenID: &token.ID, IssueSecret: canHoldSecret}, true
+}
+
+// checkEnrollmentRequest 没有注册令牌的新Agent：已批准时凭审批凭据完成注册，
+// 否则创建或更新注册申请，返回审批凭据供Agent在审批通过后使用。
+// 申请签发凭据后只接受持有该凭据的Agent，凭据丢失时需管理员删除或重置申请
+func checkEnrollmentRequest(c *gin.Context, info *DeviceInfo, canHoldSecret bool) (*registrationGrant, bool) {
+	if info.Uuid == "" {
+		ErrorRes(c, ErrEnrollment, "缺少设备UUID，无法提交注册申请")
+		return nil, false
+	}
+
+	request, err := models.GetEnrollmentRequestByUuid(info.Uuid)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return nil, false
+	}
+	if err != nil {
+		request = &models.EnrollmentRequest{Uuid: info.Uuid, Status: models.EnrollmentPending}
+	} else if request.Status == models.EnrollmentEnrolled {
+		if _, err := models.GetInstance(int(request.InstanceID)); err == nil {
+			ErrorRes(c, ErrEnrollment, "该设备已完成注册，请使用原Agent的身份注册")
+			return nil, false
+		}
+		// 完成注册后实例被删除，重新申请
+		request.Status = models.EnrollmentPending
+		request.KeyHash = ""
+		request.GroupID = nil
+		request.Note = ""
+		request.ReviewedAt = nil
+		request.InstanceID = 0
+	}
+
+	if request.Status == models.EnrollmentRejected {
+		ErrorRes(c, ErrEnrollment, "注册申请已被拒绝")
+		return nil, false
+	}
+	// 凭据不匹配时不修改申请，避免他人冒用设备UUID顶替等待审批的申请
+	keyMatched := info.PendingKey != "" && hashEnrollmentSecret(info.PendingKey) == request.KeyHash
+	if request.KeyHash != "" && !keyMatched {
+		logger.Warnf("注册申请的审批凭据不匹配: 申请=%d, UUID=%s, LAN=%s", request.ID, request.Uuid, info.LAN)
+		ErrorRes(c, ErrEnrollment, "审批凭据不匹配，请联系管理员删除或重置注册申请")
+		return nil, false
+	}
+	if request.Status == models.EnrollmentApproved {
+		logger.Infof("Agent凭已批准的注册申请注册: 申请=%d, UUID=%s, 分组=%v", request.ID, request.Uuid, request.GroupID)
+		return &registrationGrant{GroupID: request.GroupID, RequestID: request.ID, IssueSecret: canHoldSecret}, true
+	}
+
+	// 等待审批：新申请或管理员重置后的申请签发凭据
+	var key string
+	if request.KeyHash == "" {
+		if key, err = newEnrollmentSecret(); err != nil {
+			InternalErrorRes(c, "生成审批凭据失败")
+			return nil, false
+		}
+		request.KeyHash = hashEnrollmentSecret(key)
+	}
+	now := time.Now()
+	request.Hostname = info.Hostname
+	request.Lan = info.LAN
+	request.Wan = info.WAN
+	request.Mac = info.MAC
+	request.OS = info.OS
+	request.Username = info.Username
+	request.Version = info.Version
+	request.LastSeenAt = &now
+	if err := models.SaveEnrollmentRequest(request); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return nil, false
+	}
+
+	logger.Infof("Agent注册申请等待审批: 申请=%d, UUID=%s, 主机名=%s, LAN=%s", request.ID, request.Uuid, request.Hostname, request.Lan)
+	data := gin.H{"request_id": request.ID}
+	if key != "" {
+		data["pending_key"] = key
+	}
+	c.JSON(http.StatusOK, Response{Code: ErrEnrollmentPending, Msg: "注册申请等待管理员审批", Data: data})
+	return nil, false
+}
+
+// CreateEnrollmentToken 创建注册令牌，令牌明文只在响应中返回一次
+func CreateEnrollmentToken(c *gin.Context) {
+	var item EnrollmentTokenRequest
+	if err := c.ShouldBindJSON(&item); err != nil {
+		logger.Errorf("注册令牌参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+	if item.ExpireHours < 0 || item.MaxUses < 0 {
+		BadRequestRes(c, "有效期和使用次数不能为负数")
+		return
+	}
+	if item.GroupID != nil {
+		if _, err := models.GetGroup(*item.GroupID); err != nil {
+			NotFoundRes(c, "分组不存在")
+			return
+		}
+	}
+
+	secret, err := newEnrollmentSecret()
+	if err != nil {
+		InternalErrorRes(c, "生成注册令牌失败")
+		return
+	}
+	raw := enrollmentTokenPrefix + secret
+
+	token := models.EnrollmentToken{
+		Name:      item.Name,
+		TokenHash: hashEnrollmentSecret(raw),
+		Prefix:    raw[:len(enrollmentTokenPrefix)+6],
+		GroupID:   item.GroupID,
+		MaxUses:   item.MaxUses,
+	}
+	if item.ExpireHours > 0 {
+		expiresAt := time.Now().Add(time.Duration(item.ExpireHours) * time.Hour)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := models.CreateEnrollmentToken(&token); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, EnrollmentTokenInfo{EnrollmentToken: token, Active: true, Token: raw})
+}
+
+// ListEnrollmentTokens 获取注册令牌列表
+func ListEnrollmentTokens(c *gin.Context) {
+	tokens, err := models.ListEnrollmentTokens()
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	items := make([]EnrollmentTokenInfo, 0, len(tokens))
+	for i := range tokens {
+		items = append(items, EnrollmentTokenInfo{EnrollmentToken: tokens[i], Active: tokens[i].IsActive()})
+	}
+
+	SuccessRes(c, items)
+}
+
+// RevokeEnrollmentToken 撤销注册令牌，已用它注册的设备不受影响
+func RevokeEnrollmentToken(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("撤销注册令牌参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if _, err := models.GetEnrollmentToken(id); err != nil {
+		NotFoundRes(c, "注册令牌不存在")
+		return
+	}
+	if err := models.RevokeEnrollmentToken(id); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, nil)
+}
+
+// ListEnrollmentRequests 获取注册申请列表，可按状态筛选
+func ListEnrollmentRequests(c *gin.Context) {
+	requests, err := models.ListEnrollmentRequests(c.Query("status"))
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, requests)
+}
+
+// ApproveEnrollmentRequest 批准注册申请，Agent下次注册时完成注册并进入指定分组
+func ApproveEnrollmentRequest(c *gin.Context) {
+	reviewEnrollmentRequest(c, models.EnrollmentApproved)
+}
+
+// RejectEnrollmentRequest 拒绝注册申请，删除申请前该设备不能再申请
+func RejectEnrollmentRequest(c *gin.Context) {
+	reviewEnrollmentRequest(c, models.EnrollmentRejected)
+}
+
+// reviewEnrollmentRequest 审批注册申请
+func reviewEnrollmentRequest(c *gin.Context, status string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("审批注册申请参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var item EnrollmentReviewRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&item); err != nil {
+			logger.Errorf("审批注册申请参数绑定失败: %v", err)
+			ErrorRes(c, ErrBindJson, err.Error())
+			return
+		}
+	}
+	if status == models.EnrollmentRejected {
+		item.GroupID = nil
+	}
+	if item.GroupID != nil {
+		if _, err := models.GetGroup(*item.GroupID); err != nil {
+			NotFoundRes(c, "分组不存在")
+			return
+		}
+	}
+
+	if _, err := models.GetEnrollmentRequest(id); err != nil {
+		NotFoundRes(c, "注册申请不存在")
+		return
+	}
+	request, err := models.ReviewEnrollmentRequest(id, status, item.GroupID, item.Note)
+	if err != nil {
+		BadRequestRes(c, err.Error())
+		return
+	}
+
+	SuccessRes(c, request)
+}
+
+// ResetEnrollmentRequest 重置注册申请为等待审批并作废审批凭据，
+// 用于Agent丢失凭据的情况，重置后第一个提交该设备UUID的Agent获得新的凭据
+func ResetEnrollmentRequest(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("重置注册申请参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if _, err := models.GetEnrollmentRequest(id); err != nil {
+		NotFoundRes(c, "注册申请不存在")
+		return
+	}
+	request, err := models.ResetEnrollmentRequest(id)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, request)
+}
+
+// DeleteEnrollmentRequest 删除注册申请
+func DeleteEnrollmentRequest(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("删除注册申请参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if _, err := models.GetEnrollmentRequest(id); err != nil {
+		NotFoundRes(c, "注册申请不存在")
+		return
+	}
+	if err := models.DeleteEnrollmentRequest(id); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, nil)
+}
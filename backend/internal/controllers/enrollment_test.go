@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// setupRegisterDB 使用临时数据库，返回注册接口的路由
+func setupRegisterDB(t *testing.T) *gin.Engine {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: gormLogger.Default.LogMode(gormLogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.Group{}, &models.Instance{}, &models.GroupRule{},
+		&models.EnrollmentToken{}, &models.EnrollmentRequest{}); err != nil {
+		t.Fatalf("迁移数据表失败: %v", err)
+	}
+	oldDB := models.DB
+	models.DB = db
+	t.Cleanup(func() { models.DB = oldDB })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/register", Register)
+	return router
+}
+
+// postRegister 调用注册接口，返回响应码和注册结果
+func postRegister(t *testing.T, router *gin.Engine, info DeviceInfo) (int, RegisterResult) {
+	t.Helper()
+
+	body, _ := json.Marshal(info)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body)))
+
+	var res struct {
+		Code int            `json:"code"`
+		Data RegisterResult `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatalf("解析响应失败: %v, 响应=%s", err, w.Body.String())
+	}
+	return res.Code, res.Data
+}
+
+func TestRegisterDoesNotOverwriteProtectedInstance(t *testing.T) {
+	router := setupRegisterDB(t)
+
+	agent := DeviceInfo{Uuid: "uuid-agent", LAN: "10.0.0.5", Hostname: "pc-1", EnrollmentVersion: 1}
+	code, first := postRegister(t, router, agent)
+	if code != ErrSuccess || first.ID == 0 || first.AgentSecret == "" {
+		t.Fatalf("首次注册失败: code=%d, 结果=%+v", code, first)
+	}
+	protected, _ := models.GetInstance(int(first.ID))
+
+	attacks := map[string]DeviceInfo{
+		"不带ID":   {Uuid: "uuid-attacker", LAN: "10.0.0.5", Hostname: "evil", EnrollmentVersion: 1},
+		"错误密钥":   {ID: first.ID, Uuid: "uuid-agent", LAN: "10.0.0.5", Hostname: "evil", AgentSecret: "wrong", EnrollmentVersion: 1},
+		"缺少UUID": {ID: first.ID, LAN: "10.0.0.5", Hostname: "evil", EnrollmentVersion: 1},
+	}
+	for name, info := range attacks {
+		if code, _ := postRegister(t, router, info); code != ErrEnrollment {
+			t.Errorf("%s: 覆盖已绑定密钥的设备应被拒绝, code=%d", name, code)
+		}
+	}
+
+	instance, _ := models.GetInstance(int(first.ID))
+	if instance.AgentSecretHash != protected.AgentSecretHash || instance.Hostname != "pc-1" || instance.Uuid != "uuid-agent" {
+		t.Fatalf("已绑定密钥的设备被覆盖: %+v", instance)
+	}
+
+	agent.ID = first.ID
+	agent.AgentSecret = first.AgentSecret
+	if code, again := postRegister(t, router, agent); code != ErrSuccess || again.ID != first.ID {
+		t.Fatalf("原Agent重新注册失败: code=%d, 结果=%+v", code, again)
+	}
+}
+
+func TestRegisterWithoutSecretRequiresMatchingUuid(t *testing.T) {
+	router := setupRegisterDB(t)
+
+	// 早期版本Agent注册的设备没有密钥
+	legacy := models.Instance{Uuid: "uuid-legacy", Lan: "10.0.0.6", Hostname: "legacy"}
+	if err := models.DB.Create(&legacy).Error; err != nil {
+		t.Fatalf("创建设备失败: %v", err)
+	}
+
+	code, res := postRegister(t, router, DeviceInfo{ID: legacy.ID, LAN: "10.0.0.7", Hostname: "evil", EnrollmentVersion: 1})
+	if code != ErrSuccess || res.ID == legacy.ID {
+		t.Fatalf("缺少UUID时不应沿用原设备: code=%d, 结果=%+v", code, res)
+	}
+	instance, _ := models.GetInstance(int(legacy.ID))
+	if instance.Hostname != "legacy" || instance.AgentSecretHash != "" {
+		t.Fatalf("没有密钥的设备被覆盖: %+v", instance)
+	}
+
+	code, res = postRegister(t, router, DeviceInfo{ID: legacy.ID, Uuid: "uuid-legacy", LAN: "10.0.0.6", Hostname: "legacy", EnrollmentVersion: 1})
+	if code != ErrSuccess || res.ID != legacy.ID || res.AgentSecret == "" {
+		t.Fatalf("UUID一致时应沿用原设备并签发密钥: code=%d, 结果=%+v", code, res)
+	}
+}
+
+func TestRegisterFailureDoesNotConsumeToken(t *testing.T) {
+	router := setupRegisterDB(t)
+
+	raw := enrollmentTokenPrefix + "test-token"
+	token := models.EnrollmentToken{Name: "test", TokenHash: hashEnrollmentSecret(raw), MaxUses: 1}
+	if err := models.CreateEnrollmentToken(&token); err != nil {
+		t.Fatalf("创建注册令牌失败: %v", err)
+	}
+	protected := models.Instance{Uuid: "uuid-protected", Lan: "10.0.0.8", AgentSecretHash: hashEnrollmentSecret("secret")}
+	if err := models.DB.Create(&protected).Error; err != nil {
+		t.Fatalf("创建设备失败: %v", err)
+	}
+
+	// 注册失败时令牌次数不变
+	if code, _ := postRegister(t, router, DeviceInfo{Uuid: "uuid-a", LAN: "10.0.0.8", EnrollmentToken: raw, EnrollmentVersion: 1}); code != ErrEnrollment {
+		t.Fatalf("覆盖已绑定密钥的设备应被拒绝, code=%d", code)
+	}
+	if item, _ := models.GetEnrollmentToken(int(token.ID)); item.Uses != 0 {
+		t.Fatalf("注册失败不应消耗令牌次数: uses=%d", item.Uses)
+	}
+
+	if code, _ := postRegister(t, router, DeviceInfo{Uuid: "uuid-a", LAN: "10.0.0.9", EnrollmentToken: raw, EnrollmentVersion: 1}); code != ErrSuccess {
+		t.Fatalf("使用注册令牌注册失败: code=%d", code)
+	}
+	if item, _ := models.GetEnrollmentToken(int(token.ID)); item.Uses != 1 {
+		t.Fatalf("注册成功应消耗一次令牌: uses=%d", item.Uses)
+	}
+
+	if code, _ := postRegister(t, router, DeviceInfo{Uuid: "uuid-b", LAN: "10.0.0.10", EnrollmentToken: raw, EnrollmentVersion: 1}); code != ErrEnrollment {
+		t.Fatalf("令牌达到使用次数上限后应拒绝注册: code=%d", code)
+	}
+}
+
+func TestPendingRequestRejectsMismatchedKey(t *testing.T) {
+	router := setupRegisterDB(t)
+
+	oldCfg := config.GlobalConfig.Enrollment
+	config.GlobalConfig.Enrollment = config.EnrollmentConfig{Required: true, PendingApproval: true}
+	t.Cleanup(func() { config.GlobalConfig.Enrollment = oldCfg })
+
+	// postPending 提交注册申请，返回响应码和签发的审批凭据
+	postPending := func(info DeviceInfo) (int, string) {
+		body, _ := json.Marshal(info)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/register", bytes.NewReader(body)))
+		var res struct {
+			Code int `json:"code"`
+			Data struct {
+				PendingKey string `json:"pending_key"`
+			} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &res)
+		return res.Code, res.Data.PendingKey
+	}
+
+	agent := DeviceInfo{Uuid: "uuid-pending", LAN: "10.0.1.1", Hostname: "pc-1", EnrollmentVersion: 1}
+	code, key := postPending(agent)
+	if code != ErrEnrollmentPending || key == "" {
+		t.Fatalf("首次申请应签发审批凭据: code=%d, key=%q", code, key)
+	}
+
+	for name, info := range map[string]DeviceInfo{
+		"没有凭据": {Uuid: "uuid-pending", LAN: "10.0.1.2", Hostname: "evil", EnrollmentVersion: 1},
+		"错误凭据": {Uuid: "uuid-pending", LAN: "10.0.1.2", Hostname: "evil", PendingKey: "wrong", EnrollmentVersion: 1},
+	} {
+		if code, newKey := postPending(info); code != ErrEnrollment || newKey != "" {
+			t.Errorf("%s: 冒用UUID的申请应被拒绝: code=%d, key=%q", name, code, newKey)
+		}
+	}
+
+	request, _ := models.GetEnrollmentRequestByUuid("uuid-pending")
+	if request.KeyHash != hashEnrollmentSecret(key) || request.Hostname != "pc-1" || request.Lan != "10.0.1.1" {
+		t.Fatalf("注册申请被冒用者修改: %+v", request)
+	}
+
+	if _, err := models.ReviewEnrollmentRequest(int(request.ID), models.EnrollmentApproved, nil, ""); err != nil {
+		t.Fatalf("批准注册申请失败: %v", err)
+	}
+	agent.PendingKey = key
+	if code, res := postRegister(t, router, agent); code != ErrSuccess || res.ID == 0 {
+		t.Fatalf("持有凭据的Agent应完成注册: code=%d, 结果=%+v", code, res)
+	}
+}
@@ -163,3 +163,89 @@ func GetGroup(c *gin.Context) {
 
 	SuccessRes(c, group)
 }
+
+// SessionPolicyRequest 会话策略请求结构
+type SessionPolicyRequest struct {
+	IdleTimeoutMinutes int  `json:"idle_timeout_minutes"`
+	MaxDurationMinutes int  `json:"max_duration_minutes"`
+	WarningSeconds     int  `json:"warning_seconds"`
+	RecordSessions     bool `json:"record_sessions"`
+}
+
+// GetGroupSessionPolicy 获取分组的控制会话策略，未设置时返回全局默认策略
+func GetGroupSessionPolicy(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取会话策略参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if _, err := models.GetGroup(id); err != nil {
+		NotFoundRes(c, "分组不存在")
+		return
+	}
+
+	policy := models.ResolveSessionPolicy(&id)
+	policy.GroupID = id
+
+	SuccessRes(c, policy)
+}
+
+// PutGroupSessionPolicy 设置分组的控制会话策略
+func PutGroupSessionPolicy(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("设置会话策略参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var item SessionPolicyRequest
+	if err := c.ShouldBindJSON(&item); err != nil {
+		logger.Errorf("设置会话策略参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+
+	if item.IdleTimeoutMinutes < 0 || item.MaxDurationMinutes < 0 || item.WarningSeconds < 0 {
+		BadRequestRes(c, "策略参数不能为负数")
+		return
+	}
+
+	if _, err := models.GetGroup(id); err != nil {
+		NotFoundRes(c, "分组不存在")
+		return
+	}
+
+	policy, err := models.SaveSessionPolicy(models.SessionPolicy{
+		GroupID:            id,
+		IdleTimeoutMinutes: item.IdleTimeoutMinutes,
+		MaxDurationMinutes: item.MaxDurationMinutes,
+		WarningSeconds:     item.WarningSeconds,
+		RecordSessions:     item.RecordSessions,
+	})
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, policy)
+}
+
+// DeleteGroupSessionPolicy 删除分组的控制会话策略，恢复使用全局默认策略
+func DeleteGroupSessionPolicy(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("删除会话策略参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if err := models.DeleteSessionPolicy(id); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, models.DefaultSessionPolicy())
+}
@@ -0,0 +1,224 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GroupRuleRequest 自动分组规则请求结构
+type GroupRuleRequest struct {
+	Name            string   `json:"name" binding:"required"`
+	Priority        int      `json:"priority"`
+	Enabled         *bool    `json:"enabled"` // 为空时默认启用
+	GroupID         int      `json:"group_id" binding:"required"`
+	HostnamePattern string   `json:"hostname_pattern"`
+	LanCIDRs        []string `json:"lan_cidrs"`
+	OS              []string `json:"os"`
+	Usernames       []string `json:"usernames"`
+	Uuids           []string `json:"uuids"`
+}
+
+// GroupRuleMatch 规则匹配到的设备
+type GroupRuleMatch struct {
+	InstanceID uint   `json:"instance_id"`
+	Hostname   string `json:"hostname"`
+	Lan        string `json:"lan"`
+	GroupID    *int   `json:"group_id"` // 设备当前所在分组
+	Assigned   bool   `json:"assigned"` // 该规则是设备匹配的第一条启用且分组存在的规则，注册时会分配到它的分组
+}
+
+// GroupRuleDryRun 规则对现有设备的匹配结果
+type GroupRuleDryRun struct {
+	Rule         models.GroupRule `json:"rule"`
+	Matched      []GroupRuleMatch `json:"matched"`
+	Assigned     int              `json:"assigned"`      // 以该规则为第一条匹配规则的设备数
+	GroupMissing bool             `json:"group_missing"` // 规则的分组已不存在，注册时跳过该规则
+}
+
+// getGroupRuleParam 根据路径参数获取自动分组规则，失败时已写入响应
+func getGroupRuleParam(c *gin.Context) (*models.GroupRule, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("自动分组规则参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return nil, false
+	}
+
+	rule, err := models.GetGroupRule(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "自动分组规则不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return nil, false
+	}
+	return rule, true
+}
+
+// bindGroupRule 绑定并校验规则参数，写入rule，失败时已写入响应
+func bindGroupRule(c *gin.Context, rule *models.GroupRule) bool {
+	var item GroupRuleRequest
+	if err := c.ShouldBindJSON(&item); err != nil {
+		logger.Errorf("自动分组规则参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return false
+	}
+	if _, err := models.GetGroup(item.GroupID); err != nil {
+		NotFoundRes(c, "分组不存在")
+		return false
+	}
+
+	rule.Name = item.Name
+	rule.Priority = item.Priority
+	rule.Enabled = item.Enabled == nil || *item.Enabled
+	rule.GroupID = item.GroupID
+	rule.HostnamePattern = item.HostnamePattern
+	rule.LanCIDRs = item.LanCIDRs
+	rule.OS = item.OS
+	rule.Usernames = item.Usernames
+	rule.Uuids = item.Uuids
+	if err := rule.Validate(); err != nil {
+		BadRequestRes(c, err.Error())
+		return false
+	}
+	return true
+}
+
+// CreateGroupRule 创建自动分组规则
+func CreateGroupRule(c *gin.Context) {
+	var rule models.GroupRule
+	if !bindGroupRule(c, &rule) {
+		return
+	}
+
+	if err := models.CreateGroupRule(&rule); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, rule)
+}
+
+// ListGroupRules 按匹配顺序获取自动分组规则列表
+func ListGroupRules(c *gin.Context) {
+	rules, err := models.ListGroupRules(false)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, rules)
+}
+
+// GetGroupRule 获取自动分组规则
+func GetGroupRule(c *gin.Context) {
+	rule, ok := getGroupRuleParam(c)
+	if !ok {
+		return
+	}
+
+	SuccessRes(c, rule)
+}
+
+// UpdateGroupRule 更新自动分组规则，只影响之后注册的新设备
+func UpdateGroupRule(c *gin.Context) {
+	rule, ok := getGroupRuleParam(c)
+	if !ok {
+		return
+	}
+	if !bindGroupRule(c, rule) {
+		return
+	}
+
+	if err := models.SaveGroupRule(rule); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, rule)
+}
+
+// DeleteGroupRule 删除自动分组规则
+func DeleteGroupRule(c *gin.Context) {
+	rule, ok := getGroupRuleParam(c)
+	if !ok {
+		return
+	}
+
+	if err := models.DeleteGroupRule(int(rule.ID)); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, nil)
+}
+
+// DryRunGroupRules 预览每条规则匹配的现有设备，不修改设备分组
+// ungrouped=true 时只检查未分组的设备
+func DryRunGroupRules(c *gin.Context) {
+	rules, err := models.ListGroupRules(false)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	instances, err := models.ListInstances(nil)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	ungroupedOnly := c.Query("ungrouped") == "true"
+
+	// 与注册时一致，分组已不存在的规则不参与分配
+	results := make([]GroupRuleDryRun, len(rules))
+	for i := range rules {
+		results[i] = GroupRuleDryRun{Rule: rules[i], Matched: []GroupRuleMatch{}}
+		if _, err := models.GetGroup(rules[i].GroupID); err != nil {
+			results[i].GroupMissing = true
+		}
+	}
+	for i := range instances {
+		instance := &instances[i]
+		if ungroupedOnly && instance.GroupID != nil {
+			continue
+		}
+		assigned := false
+		for j := range rules {
+			if !rules[j].Matches(instance) {
+				continue
+			}
+			match := GroupRuleMatch{
+				InstanceID: instance.ID,
+				Hostname:   instance.Hostname,
+				Lan:        instance.Lan,
+				GroupID:    instance.GroupID,
+			}
+			if rules[j].Enabled && !results[j].GroupMissing && !assigned {
+				match.Assigned = true
+				assigned = true
+				results[j].Assigned++
+			}
+			results[j].Matched = append(results[j].Matched, match)
+		}
+	}
+
+	SuccessRes(c, results)
+}
+
+// applyGroupRules 新设备注册时按规则分配分组，没有匹配的规则时保持未分组
+func applyGroupRules(instance *models.Instance) {
+	rules, err := models.ListGroupRules(true)
+	if err != nil || len(rules) == 0 {
+		return
+	}
+	if rule := models.MatchGroupRule(rules, instance); rule != nil {
+		groupID := rule.GroupID
+		instance.GroupID = &groupID
+		logger.Infof("新设备匹配自动分组规则: 主机名=%s, LAN=%s, 规则=%d(%s), 分组=%d", instance.Hostname, instance.Lan, rule.ID, rule.Name, groupID)
+	}
+}
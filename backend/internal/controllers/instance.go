@@ -1,18 +1,22 @@
 package controllers
 
 import (
+	"errors"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 	"winmanager-backend/internal/logger"
 	"winmanager-backend/internal/models"
+	"winmanager-backend/internal/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // DeviceInfo 设备信息结构（用于注册）
 type DeviceInfo struct {
+	ID              uint   `json:"id"` // Agent本地保存的实例ID，重新注册时沿用
 	Uuid            string `json:"uuid"`
 	OS              string `json:"os"`
 	Arch            string `json:"arch"`
@@ -27,12 +31,31 @@ type DeviceInfo struct {
 	Username        string `json:"username"`
 	Version         string `json:"version"`
 	WatchdogVersion string `json:"watchdog_version"`
+	ServerURL       string `json:"server_url"` // Agent注册使用的后端地址
+
+	// 注册准入
+	AgentSecret       string `json:"agent_secret"`       // 后端首次注册时签发的密钥
+	EnrollmentToken   string `json:"enrollment_token"`   // 管理员签发的注册令牌，新Agent首次注册时使用
+	PendingKey        string `json:"pending_key"`        // 注册申请的审批凭据
+	EnrollmentVersion int    `json:"enrollment_version"` // 大于0表示Agent会保存后端签发的密钥
+}
+
+// RegisterResult 注册结果
+type RegisterResult struct {
+	ID          uint   `json:"id"`
+	AgentSecret string `json:"agent_secret,omitempty"` // 新签发的密钥，只返回一次
+	GroupID     *int   `json:"group_id,omitempty"`     // 首次注册时分配的分组
 }
 
 // HeartbeatRequest 心跳请求结构
 type HeartbeatRequest struct {
-	Wan    string `json:"wan"`    // 外网IP
-	Uptime uint64 `json:"uptime"` // 系统运行时间
+	Wan             string             `json:"wan"`              // 外网IP
+	Uptime          uint64             `json:"uptime"`           // 系统运行时间
+	Version         string             `json:"version"`          // Agent版本
+	WatchdogVersion string             `json:"watchdog_version"` // 看门狗版本，看门狗未运行时为空
+	Update          *AgentUpdateReport `json:"update"`           // 最近一次自动更新的结果，只上报一次
+	Config          *AgentConfigReport `json:"config"`           // 已应用的集中配置版本
+	ServerURL       string             `json:"server_url"`       // Agent当前连接的后端地址
 }
 
 // Heartbeat 心跳接口
@@ -69,9 +92,41 @@ func Heartbeat(c *gin.Context) {
 		updateData["uptime"] = heartbeatData.Uptime
 	}
 
+	if heartbeatData.Version != "" {
+		updateData["version"] = heartbeatData.Version
+		// 上报版本的Agent同时上报看门狗版本，为空表示看门狗未运行
+		updateData["watchdog_version"] = heartbeatData.WatchdogVersion
+	}
+
+	// 记录Agent上报的更新结果
+	if report := heartbeatData.Update; report != nil && report.Status != "" {
+		updateData["update_version"] = report.Version
+		updateData["update_status"] = report.Status
+		updateData["update_error"] = report.Error
+		logger.Infof("Agent更新结果: ID=%d, 版本=%s, 状态=%s, 错误=%s", id, report.Version, report.Status, report.Error)
+	}
+
+	// 记录Agent当前连接的后端，连接时间在注册时更新
+	if heartbeatData.ServerURL != "" {
+		updateData["server_url"] = heartbeatData.ServerURL
+	}
+
+	// 记录Agent已应用的集中配置版本
+	if report := heartbeatData.Config; report != nil {
+		updateData["config_version"] = report.Version
+		updateData["config_error"] = report.Error
+		updateData["config_applied_at"] = report.AppliedAt
+	}
+
 	// 更新实例
 	err = models.PatchInstance(id, updateData)
 	if err != nil {
+		// 实例已被删除时返回未找到，Agent据此重新注册
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Warnf("心跳的实例不存在: ID=%d", id)
+			NotFoundRes(c, "实例不存在，请重新注册")
+			return
+		}
 		logger.Errorf("更新心跳状态失败: ID=%d, 错误=%v", id, err)
 		ErrorRes(c, ErrDbReturn, err.Error())
 		return
@@ -79,6 +134,73 @@ func Heartbeat(c *gin.Context) {
 
 	logger.Infof("心跳更新成功: ID=%d, WAN=%s, Uptime=%d", id, heartbeatData.Wan, heartbeatData.Uptime)
 
+	// 按分组灰度发布检查是否需要更新；返回生效的集中配置版本，与Agent已应用的版本不一致时Agent重新获取配置
+	data := gin.H{}
+	if instance, err := models.GetInstance(id); err == nil {
+		if offer := resolveAgentUpdate(instance); offer != nil {
+			logger.Infof("下发Agent更新: ID=%d, 当前版本=%s, 目标版本=%s", id, instance.Version, offer.Version)
+			data["update"] = offer
+		}
+		if effective, err := models.ResolveEffectiveConfig(instance); err == nil {
+			data["config_version"] = effective.Version
+		} else {
+			logger.Errorf("获取设备集中配置失败: ID=%d, 错误=%v", id, err)
+		}
+	}
+
+	SuccessRes(c, data)
+}
+
+// ProxyStatusRequest Agent上报的代理状态
+type ProxyStatusRequest struct {
+	Enabled   bool       `json:"enabled"`    // 是否使用代理
+	URL       string     `json:"url"`        // 代理地址，密码已隐藏
+	OK        bool       `json:"ok"`         // 最近一次检查是否可用
+	LatencyMs int64      `json:"latency_ms"` // 最近一次检查的延迟
+	ExitIP    string     `json:"exit_ip"`    // 通过代理访问时的出口IP
+	Error     string     `json:"error"`      // 检查失败的原因
+	CheckedAt *time.Time `json:"checked_at"` // 检查时间
+}
+
+// ReportProxyStatus Agent上报代理状态
+func ReportProxyStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var req ProxyStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Errorf("代理状态绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+
+	// 停止代理时清空检查结果
+	updateData := map[string]interface{}{
+		"proxy_enabled":    req.Enabled,
+		"proxy_url":        req.URL,
+		"proxy_ok":         req.Enabled && req.OK,
+		"proxy_latency":    req.LatencyMs,
+		"proxy_exit_ip":    req.ExitIP,
+		"proxy_error":      req.Error,
+		"proxy_checked_at": req.CheckedAt,
+	}
+	if !req.Enabled {
+		updateData["proxy_latency"] = 0
+		updateData["proxy_exit_ip"] = ""
+		updateData["proxy_error"] = ""
+		updateData["proxy_checked_at"] = nil
+	}
+
+	if err := models.PatchInstance(id, updateData); err != nil {
+		logger.Errorf("更新代理状态失败: ID=%d, 错误=%v", id, err)
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	logger.Infof("代理状态更新: ID=%d, 启用=%v, 地址=%s, 可用=%v, 延迟=%dms, 出口IP=%s", id, req.Enabled, req.URL, req.OK, req.LatencyMs, req.ExitIP)
 	SuccessRes(c, nil)
 }
 
@@ -106,21 +228,63 @@ func Register(c *gin.Context) {
 		Username:        info.Username,
 		Version:         info.Version,
 		WatchdogVersion: info.WatchdogVersion,
+		ServerURL:       info.ServerURL,
 		Status:          1, // 设置为在线状态
 	}
+	if info.ServerURL != "" {
+		now := time.Now()
+		newInstance.AttachedAt = &now
+	}
+
+	grant, ok := authorizeRegistration(c, &info)
+	if !ok {
+		return
+	}
+	if grant.TokenID != nil || grant.RequestID != 0 {
+		now := time.Now()
+		newInstance.GroupID = grant.GroupID
+		newInstance.EnrollmentTokenID = grant.TokenID
+		newInstance.EnrolledAt = &now
+	}
+	// 新设备未由注册令牌或审批指定分组时，按自动分组规则分配
+	if newInstance.GroupID == nil && grant.KnownID == 0 && !models.InstanceExistsByLan(info.LAN) {
+		applyGroupRules(&newInstance)
+	}
+
+	var secret string
+	if grant.IssueSecret {
+		generated, err := newEnrollmentSecret()
+		if err != nil {
+			logger.Errorf("生成Agent密钥失败: %v", err)
+		} else {
+			secret = generated
+			newInstance.AgentSecretHash = hashEnrollmentSecret(secret)
+		}
+	}
 
 	logger.Infof("注册设备: %+v", newInstance)
 
-	id, err := models.CreateOrUpdateInstance(newInstance)
+	id, err := models.RegisterInstance(newInstance, grant.KnownID)
 	if err != nil {
 		logger.Errorf("注册设备失败: %v", err)
-		ErrorRes(c, ErrDbReturn, err.Error())
+		switch {
+		case errors.Is(err, models.ErrInstanceProtected):
+			ErrorRes(c, ErrEnrollment, "该LAN地址的设备已绑定Agent密钥，请使用原Agent的身份注册或先删除该设备")
+		case errors.Is(err, models.ErrEnrollmentTokenUnusable):
+			ErrorRes(c, ErrEnrollment, enrollmentTokenUnusableMsg)
+		default:
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
 		return
 	}
 
+	if grant.RequestID != 0 {
+		models.CompleteEnrollmentRequest(grant.RequestID, id)
+	}
+
 	logger.Infof("设备注册成功: ID=%d", id)
 
-	SuccessRes(c, id)
+	SuccessRes(c, RegisterResult{ID: id, AgentSecret: secret, GroupID: newInstance.GroupID})
 }
 
 // ListInstances 获取实例列表
@@ -256,6 +420,10 @@ func DeleteInstance(c *gin.Context) {
 		return
 	}
 
+	if service := services.GetThumbnailService(); service != nil {
+		service.Remove(uint(id))
+	}
+
 	logger.Infof("删除实例成功: ID=%d", id)
 
 	SuccessRes(c, nil)
@@ -0,0 +1,266 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+	"winmanager-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateIntegrityCheckRequest 创建核对任务请求结构
+type CreateIntegrityCheckRequest struct {
+	InstanceIDs []int `json:"instance_ids"` // 核对的设备，为空时核对基线所属分组的全部设备
+	Concurrency int   `json:"concurrency"`  // 同时核对的设备数，默认使用全局配置
+	OnlineOnly  bool  `json:"online_only"`  // 只核对当前在线的设备，否则离线设备记为失败
+}
+
+// IntegrityCheckDetail 核对任务详情，设备结果不含差异明细
+type IntegrityCheckDetail struct {
+	models.IntegrityCheck
+	Results []models.IntegrityResult `json:"results"`
+}
+
+// getIntegrityCheckParam 根据路径参数获取核对任务，失败时已写入响应
+func getIntegrityCheckParam(c *gin.Context) (*models.IntegrityCheck, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("核对任务参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return nil, false
+	}
+
+	check, err := models.GetIntegrityCheck(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "核对任务不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return nil, false
+	}
+	return check, true
+}
+
+// integrityTargets 获取核对目标设备（去重）
+func integrityTargets(baseline *models.Baseline, req *CreateIntegrityCheckRequest) ([]models.Instance, error) {
+	var instances []models.Instance
+	var err error
+	if len(req.InstanceIDs) > 0 {
+		instances, err = models.GetInstances(req.InstanceIDs)
+	} else {
+		instances, err = models.ListInstancesByGroupId(baseline.GroupID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[uint]bool, len(instances))
+	targets := make([]models.Instance, 0, len(instances))
+	for _, instance := range instances {
+		if seen[instance.ID] || (req.OnlineOnly && instance.Status != 1) {
+			continue
+		}
+		seen[instance.ID] = true
+		targets = append(targets, instance)
+	}
+	return targets, nil
+}
+
+// CreateIntegrityCheck 按基线核对设备文件并立即开始执行
+func CreateIntegrityCheck(c *gin.Context) {
+	baseline, ok := getBaselineParam(c)
+	if !ok {
+		return
+	}
+
+	var req CreateIntegrityCheckRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			logger.Errorf("创建核对任务参数绑定失败: %v", err)
+			ErrorRes(c, ErrBindJson, err.Error())
+			return
+		}
+	}
+
+	cfg := config.GetIntegrityConfig()
+	if req.Concurrency <= 0 {
+		req.Concurrency = cfg.DefaultConcurrency
+	}
+	if cfg.MaxConcurrency > 0 && req.Concurrency > cfg.MaxConcurrency {
+		req.Concurrency = cfg.MaxConcurrency
+	}
+	if req.Concurrency <= 0 {
+		req.Concurrency = 1
+	}
+
+	targets, err := integrityTargets(baseline, &req)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if len(targets) == 0 {
+		BadRequestRes(c, "没有可核对的设备")
+		return
+	}
+
+	service := services.GetIntegrityService()
+	if service == nil {
+		ErrorRes(c, ErrInternal, "完整性核对服务未启动")
+		return
+	}
+
+	check := &models.IntegrityCheck{
+		BaselineID:   baseline.ID,
+		BaselineName: baseline.Name,
+		GroupID:      baseline.GroupID,
+		Root:         baseline.Root,
+		Concurrency:  req.Concurrency,
+		Status:       models.IntegrityStatusRunning,
+		Total:        len(targets),
+		StartedAt:    time.Now(),
+	}
+	if err := models.CreateIntegrityCheck(check, targets); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	service.Run(check)
+
+	logger.Infof("创建核对任务: ID=%d, 基线=%s, 设备数=%d, 路径=%s, 并发=%d",
+		check.ID, baseline.Name, check.Total, check.Root, check.Concurrency)
+	SuccessRes(c, check)
+}
+
+// ListIntegrityChecks 获取核对任务列表
+func ListIntegrityChecks(c *gin.Context) {
+	var params models.IntegrityListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		logger.Errorf("核对任务列表参数绑定失败: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	result, err := models.GetIntegrityCheckList(&params)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, result)
+}
+
+// GetIntegrityCheck 获取核对任务详情及每台设备的差异数量，status参数可筛选设备结果
+func GetIntegrityCheck(c *gin.Context) {
+	check, ok := getIntegrityCheckParam(c)
+	if !ok {
+		return
+	}
+
+	results, err := models.ListIntegrityResults(check.ID, c.Query("status"))
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	// 差异明细可能很大，通过设备结果接口单独获取
+	for i := range results {
+		results[i].Diff = nil
+	}
+
+	SuccessRes(c, IntegrityCheckDetail{IntegrityCheck: *check, Results: results})
+}
+
+// GetIntegrityResult 获取核对任务中单台设备的结果及差异明细
+func GetIntegrityResult(c *gin.Context) {
+	check, ok := getIntegrityCheckParam(c)
+	if !ok {
+		return
+	}
+
+	instanceID, err := strconv.Atoi(c.Param("instance"))
+	if err != nil {
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	result, err := models.GetIntegrityResult(check.ID, instanceID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "该设备不在核对任务中")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return
+	}
+
+	SuccessRes(c, result)
+}
+
+// CancelIntegrityCheck 取消进行中的核对任务
+func CancelIntegrityCheck(c *gin.Context) {
+	check, ok := getIntegrityCheckParam(c)
+	if !ok {
+		return
+	}
+
+	service := services.GetIntegrityService()
+	if service == nil || !service.Cancel(check.ID) {
+		BadRequestRes(c, "核对任务未在进行中")
+		return
+	}
+
+	logger.Infof("取消核对任务: ID=%d", check.ID)
+	SuccessRes(c, nil)
+}
+
+// RetryIntegrityCheck 重新核对失败或已取消的设备
+func RetryIntegrityCheck(c *gin.Context) {
+	check, ok := getIntegrityCheckParam(c)
+	if !ok {
+		return
+	}
+
+	service := services.GetIntegrityService()
+	if service == nil {
+		ErrorRes(c, ErrInternal, "完整性核对服务未启动")
+		return
+	}
+	if service.IsRunning(check.ID) {
+		BadRequestRes(c, "核对任务正在进行中")
+		return
+	}
+
+	count, err := models.ResetIntegrityResults(check.ID, []string{
+		models.IntegrityResultFailed,
+		models.IntegrityResultCancelled,
+	})
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if count == 0 {
+		BadRequestRes(c, "没有需要重试的设备")
+		return
+	}
+
+	check.Status = models.IntegrityStatusRunning
+	check.FinishedAt = nil
+	if err := models.UpdateIntegrityCheck(check.ID, map[string]interface{}{
+		"status":      check.Status,
+		"finished_at": nil,
+	}); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+	if err := service.Run(check); err != nil {
+		BadRequestRes(c, err.Error())
+		return
+	}
+
+	logger.Infof("重试核对任务: ID=%d, 设备数=%d", check.ID, count)
+	SuccessRes(c, gin.H{"retried": count})
+}
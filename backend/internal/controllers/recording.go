@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+	"winmanager-backend/internal/recorder"
+	"winmanager-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ListRecordings 获取会话录制列表
+func ListRecordings(c *gin.Context) {
+	var params models.RecordingListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		logger.Errorf("录制列表参数绑定失败: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	result, err := models.GetRecordingList(&params)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, result)
+}
+
+// getRecordingParam 根据路径参数获取录制记录，失败时已写入响应
+func getRecordingParam(c *gin.Context) *models.Recording {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("录制参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return nil
+	}
+
+	recording, err := models.GetRecording(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "录制不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return nil
+	}
+	return recording
+}
+
+// GetRecording 获取单个录制
+func GetRecording(c *gin.Context) {
+	recording := getRecordingParam(c)
+	if recording == nil {
+		return
+	}
+	SuccessRes(c, recording)
+}
+
+// GetRecordingVideo 以MP4或分片MP4输出录制视频
+// format=mp4(默认) 输出带完整索引的MP4，支持Range请求，浏览器可以拖动进度；
+// format=fmp4 流式输出分片MP4，适合MSE边下边播，不支持Range请求
+func GetRecordingVideo(c *gin.Context) {
+	recording := getRecordingParam(c)
+	if recording == nil {
+		return
+	}
+
+	format := c.DefaultQuery("format", "mp4")
+	if format != "mp4" && format != "fmp4" {
+		BadRequestRes(c, "format 只能为 mp4 或 fmp4")
+		return
+	}
+
+	filename := fmt.Sprintf("recording-%d-%s.mp4", recording.ID, recording.StartedAt.Format("20060102-150405"))
+	disposition := "inline"
+	if c.Query("download") == "true" || c.Query("download") == "1" {
+		disposition = "attachment"
+	}
+
+	if format == "mp4" {
+		path, err := recorder.ExportMP4(recording.Path)
+		if err != nil {
+			logger.Errorf("导出录制视频失败: ID=%d, 错误=%v", recording.ID, err)
+			NotFoundRes(c, fmt.Sprintf("录制视频不可用: %v", err))
+			return
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			InternalErrorRes(c, "打开录制视频失败")
+			return
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			InternalErrorRes(c, "打开录制视频失败")
+			return
+		}
+
+		c.Header("Content-Type", "video/mp4")
+		c.Header("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, filename))
+		http.ServeContent(c.Writer, c.Request, filename, info.ModTime(), file)
+		return
+	}
+
+	movie, err := recorder.LoadMovie(recording.Path)
+	if err != nil {
+		logger.Errorf("加载录制视频失败: ID=%d, 错误=%v", recording.ID, err)
+		NotFoundRes(c, fmt.Sprintf("录制视频不可用: %v", err))
+		return
+	}
+
+	c.Header("Content-Type", "video/mp4")
+	c.Header("Content-Disposition", fmt.Sprintf(`%s; filename="%s"`, disposition, filename))
+	c.Status(http.StatusOK)
+	if err := movie.WriteFragmentedMP4(c.Writer); err != nil {
+		logger.Errorf("输出录制视频失败: ID=%d, 错误=%v", recording.ID, err)
+	}
+}
+
+// GetRecordingEvents 获取录制的输入事件和关键帧时间，用于回放定位
+func GetRecordingEvents(c *gin.Context) {
+	recording := getRecordingParam(c)
+	if recording == nil {
+		return
+	}
+
+	events, err := recorder.ReadEvents(recording.Path)
+	if err != nil {
+		logger.Errorf("读取录制输入事件失败: ID=%d, 错误=%v", recording.ID, err)
+		InternalErrorRes(c, "读取输入事件失败")
+		return
+	}
+
+	data := gin.H{
+		"recording_id": recording.ID,
+		"started_at":   recording.StartedAt,
+		"events":       events,
+		"keyframes_ms": []int64{},
+	}
+
+	// 视频时间轴以第一个可解码的关键帧为0点，事件时间需减去该偏移
+	if movie, err := recorder.LoadMovie(recording.Path); err == nil {
+		keyframes := movie.Keyframes()
+		offset := keyframes[0].Milliseconds()
+		keyframesMs := make([]int64, 0, len(keyframes))
+		for _, k := range keyframes {
+			keyframesMs = append(keyframesMs, k.Milliseconds()-offset)
+		}
+		width, height := movie.Resolution()
+		data["video_offset_ms"] = offset
+		data["duration_ms"] = movie.Duration().Milliseconds()
+		data["keyframes_ms"] = keyframesMs
+		data["width"] = width
+		data["height"] = height
+	}
+
+	SuccessRes(c, data)
+}
+
+// DeleteRecording 删除录制
+func DeleteRecording(c *gin.Context) {
+	recording := getRecordingParam(c)
+	if recording == nil {
+		return
+	}
+
+	if err := services.RemoveRecording(recording); err != nil {
+		logger.Errorf("删除录制失败: ID=%d, 错误=%v", recording.ID, err)
+		ErrorRes(c, ErrInternal, err.Error())
+		return
+	}
+
+	SuccessRes(c, nil)
+}
@@ -17,6 +17,12 @@ const (
 	ErrInternal  = 1005
 )
 
+// Agent注册准入错误代码
+const (
+	ErrEnrollment        = 1006 // 缺少或无效的注册令牌、注册申请被拒绝
+	ErrEnrollmentPending = 1007 // 注册申请等待管理员审批
+)
+
 // Response 统一响应结构
 type Response struct {
 	Code int         `json:"code"`
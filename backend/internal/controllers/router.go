@@ -39,6 +39,27 @@ func InitRouter(ctx *gin.RouterGroup) {
 	// Agent交互路由（包含网关转发功能）
 	setupAgentRoutes(ctx)
 
+	// 分享链接路由
+	setupShareRoutes(ctx)
+
+	// 会话录制路由
+	setupRecordingRoutes(ctx)
+
+	// 文件分发路由
+	setupDistributionRoutes(ctx)
+
+	// 文件完整性核对路由
+	setupIntegrityRoutes(ctx)
+
+	// Agent自动更新路由
+	setupAgentUpdateRoutes(ctx)
+
+	// Agent集中配置路由
+	setupAgentConfigRoutes(ctx)
+
+	// Agent注册准入路由
+	setupEnrollmentRoutes(ctx)
+
 	logger.Infof("路由配置完成")
 }
 
@@ -52,6 +73,36 @@ func setupSystemRoutes(ctx *gin.RouterGroup) {
 			status := services.GetOfflineDetectorStatus()
 			SuccessRes(c, status)
 		})
+
+		// 录制清理服务状态
+		system.GET("/recording-cleaner/status", func(c *gin.Context) {
+			SuccessRes(c, services.GetRecordingCleanerStatus())
+		})
+
+		// 缩略图采集服务状态
+		system.GET("/thumbnail/status", func(c *gin.Context) {
+			SuccessRes(c, services.GetThumbnailServiceStatus())
+		})
+
+		// 截图归档服务状态
+		system.GET("/timelapse/status", func(c *gin.Context) {
+			SuccessRes(c, services.GetTimelapseServiceStatus())
+		})
+
+		// 文件分发服务状态
+		system.GET("/distribution/status", func(c *gin.Context) {
+			SuccessRes(c, services.GetDistributionServiceStatus())
+		})
+
+		// 完整性核对服务状态
+		system.GET("/integrity/status", func(c *gin.Context) {
+			SuccessRes(c, services.GetIntegrityServiceStatus())
+		})
+
+		// 局域网发现服务状态
+		system.GET("/discovery/status", func(c *gin.Context) {
+			SuccessRes(c, services.GetDiscoveryServiceStatus())
+		})
 	}
 }
 
@@ -63,12 +114,28 @@ func setupInstanceRoutes(ctx *gin.RouterGroup) {
 
 	ctx.PATCH("/heartbeat/:id", Heartbeat)
 
+	// Agent上报代理状态
+	ctx.PATCH("/proxy/:id", ReportProxyStatus)
+
 	// 实例管理
 	ctx.GET("/instances", ListInstances)
 	ctx.GET("/instances/:id", GetInstance)
 	ctx.PATCH("/instances/:id", PatchInstance)
 	ctx.DELETE("/instances/:id", DeleteInstance)
 	ctx.PATCH("/instances/move-group", MoveGroupInstance)
+
+	// 设备缩略图（设备墙）
+	ctx.GET("/thumbnails", ListThumbnails)
+	ctx.GET("/thumbnails/:id", GetThumbnail)
+
+	// 截图归档与延时视频
+	ctx.GET("/instances/:id/timelapse-policy", GetInstanceTimelapsePolicy)
+	ctx.PUT("/instances/:id/timelapse-policy", PutInstanceTimelapsePolicy)
+	ctx.DELETE("/instances/:id/timelapse-policy", DeleteInstanceTimelapsePolicy)
+	ctx.GET("/instances/:id/snapshots", ListSnapshots)
+	ctx.POST("/instances/:id/snapshots", CaptureSnapshot)
+	ctx.GET("/instances/:id/timelapse", GetTimelapseVideo)
+	ctx.GET("/snapshots/:id/image", GetSnapshotImage)
 }
 
 // setupGroupRoutes 设置分组相关路由
@@ -81,6 +148,24 @@ func setupGroupRoutes(ctx *gin.RouterGroup) {
 	ctx.POST("/groups", CreateGroup)
 	ctx.PATCH("/groups/:id", PatchGroup)
 	ctx.DELETE("/groups/:id", DeleteGroup)
+
+	// 分组控制会话策略
+	ctx.GET("/groups/:id/session-policy", GetGroupSessionPolicy)
+	ctx.PUT("/groups/:id/session-policy", PutGroupSessionPolicy)
+	ctx.DELETE("/groups/:id/session-policy", DeleteGroupSessionPolicy)
+
+	// 新设备自动分组规则
+	ctx.GET("/group-rules", ListGroupRules)
+	ctx.POST("/group-rules", CreateGroupRule)
+	ctx.GET("/group-rules/dry-run", DryRunGroupRules)
+	ctx.GET("/group-rules/:id", GetGroupRule)
+	ctx.PUT("/group-rules/:id", UpdateGroupRule)
+	ctx.DELETE("/group-rules/:id", DeleteGroupRule)
+
+	// 分组截图归档策略
+	ctx.GET("/groups/:id/timelapse-policy", GetGroupTimelapsePolicy)
+	ctx.PUT("/groups/:id/timelapse-policy", PutGroupTimelapsePolicy)
+	ctx.DELETE("/groups/:id/timelapse-policy", DeleteGroupTimelapsePolicy)
 }
 
 // setupWebSocketRoutes 设置WebSocket相关路由
@@ -94,6 +179,70 @@ func setupWebSocketRoutes(ctx *gin.RouterGroup) {
 	ctx.GET("/ws/:id/control", agent.WebSocketControl)
 }
 
+// setupShareRoutes 设置分享链接访问路由
+// 仅凭分享令牌访问，令牌只能用于这里的接口，不能访问其他API
+func setupShareRoutes(ctx *gin.RouterGroup) {
+	logger.Infof("设置分享链接路由")
+
+	share := ctx.Group("/share")
+	{
+		share.GET("/info", agent.ShareInfo)
+		share.GET("/stream", agent.ShareStream)
+		share.GET("/control", agent.ShareControl)
+	}
+}
+
+// setupRecordingRoutes 设置会话录制相关路由
+func setupRecordingRoutes(ctx *gin.RouterGroup) {
+	logger.Infof("设置会话录制路由")
+
+	ctx.GET("/recordings", ListRecordings)
+	ctx.GET("/recordings/:id", GetRecording)
+	ctx.GET("/recordings/:id/video", GetRecordingVideo)
+	ctx.GET("/recordings/:id/events", GetRecordingEvents)
+	ctx.DELETE("/recordings/:id", DeleteRecording)
+}
+
+// setupDistributionRoutes 设置文件分发相关路由
+func setupDistributionRoutes(ctx *gin.RouterGroup) {
+	logger.Infof("设置文件分发路由")
+
+	// 分发文件
+	ctx.POST("/artifacts", UploadArtifact)
+	ctx.GET("/artifacts", ListArtifacts)
+	ctx.GET("/artifacts/:id", GetArtifact)
+	ctx.GET("/artifacts/:id/download", DownloadArtifact)
+	ctx.HEAD("/artifacts/:id/download", DownloadArtifact)
+	ctx.DELETE("/artifacts/:id", DeleteArtifact)
+
+	// 分发任务
+	ctx.POST("/distributions", CreateDistribution)
+	ctx.GET("/distributions", ListDistributions)
+	ctx.GET("/distributions/:id", GetDistribution)
+	ctx.POST("/distributions/:id/cancel", CancelDistribution)
+	ctx.POST("/distributions/:id/retry", RetryDistribution)
+}
+
+// setupIntegrityRoutes 设置文件基线与完整性核对相关路由
+func setupIntegrityRoutes(ctx *gin.RouterGroup) {
+	logger.Infof("设置完整性核对路由")
+
+	// 分组基线
+	ctx.GET("/groups/:id/baselines", ListGroupBaselines)
+	ctx.POST("/groups/:id/baselines", CreateBaseline)
+	ctx.GET("/baselines/:id", GetBaseline)
+	ctx.GET("/baselines/:id/files", ListBaselineFiles)
+	ctx.DELETE("/baselines/:id", DeleteBaseline)
+
+	// 核对任务
+	ctx.POST("/baselines/:id/checks", CreateIntegrityCheck)
+	ctx.GET("/integrity-checks", ListIntegrityChecks)
+	ctx.GET("/integrity-checks/:id", GetIntegrityCheck)
+	ctx.GET("/integrity-checks/:id/results/:instance", GetIntegrityResult)
+	ctx.POST("/integrity-checks/:id/cancel", CancelIntegrityCheck)
+	ctx.POST("/integrity-checks/:id/retry", RetryIntegrityCheck)
+}
+
 // setupAgentRoutes 设置Agent交互相关路由
 func setupAgentRoutes(ctx *gin.RouterGroup) {
 	logger.Infof("设置Agent交互路由")
@@ -116,10 +265,48 @@ func setupAgentRoutes(ctx *gin.RouterGroup) {
 		agentGroup.POST("/:id/shutdown", agent.ShutdownDevice)
 		agentGroup.POST("/:id/execscript", agent.ExecuteScript)
 
+		// 控制权仲裁
+		agentGroup.GET("/:id/control", agent.GetControlStatus)
+		agentGroup.POST("/:id/control/revoke", agent.RevokeControl)
+		agentGroup.GET("/:id/stream/viewers", agent.GetStreamViewers)
+		agentGroup.GET("/:id/sessions", agent.ListControlSessions)
+
+		// 分享链接管理
+		agentGroup.POST("/:id/shares", agent.CreateShareLink)
+		agentGroup.GET("/:id/shares", agent.ListShareLinks)
+		agentGroup.DELETE("/:id/shares/:shareId", agent.RevokeShareLink)
+
 		// 文件操作
 		agentGroup.GET("/:id/download", agent.DownloadFile)
+		agentGroup.HEAD("/:id/download", agent.DownloadFile)
 		agentGroup.POST("/:id/upload", agent.UploadFile)
 
+		// 分块上传（断点续传）
+		agentGroup.POST("/:id/uploads", agent.CreateUploadSession)
+		agentGroup.GET("/:id/uploads/:session", agent.GetUploadSession)
+		agentGroup.PUT("/:id/uploads/:session/chunks", agent.UploadChunk)
+		agentGroup.POST("/:id/uploads/:session/complete", agent.CompleteUploadSession)
+		agentGroup.DELETE("/:id/uploads/:session", agent.AbortUploadSession)
+
+		// 文件管理
+		agentGroup.GET("/:id/files", agent.ListFiles)
+		agentGroup.GET("/:id/files/stat", agent.StatFile)
+		agentGroup.GET("/:id/files/drives", agent.ListDrives)
+		agentGroup.GET("/:id/files/search", agent.SearchFiles)
+		agentGroup.GET("/:id/files/hash", agent.HashFiles)
+		agentGroup.POST("/:id/files/mkdir", agent.MakeDir)
+		agentGroup.POST("/:id/files/move", agent.MoveFile)
+		agentGroup.POST("/:id/files/copy", agent.CopyFile)
+		agentGroup.POST("/:id/files/delete", agent.DeleteFile)
+		agentGroup.GET("/:id/archive", agent.DownloadArchive)
+		agentGroup.POST("/:id/extract", agent.ExtractArchive)
+
+		// 目录监听
+		agentGroup.GET("/:id/watches", agent.ListWatches)
+		agentGroup.POST("/:id/watches", agent.CreateWatch)
+		agentGroup.GET("/:id/watches/events", agent.ListWatchEvents)
+		agentGroup.DELETE("/:id/watches/:watch", agent.DeleteWatch)
+
 		// WebSocket接口组 - 单独分组避免路径冲突
 		wsGroup := agentGroup.Group("/ws")
 		{
@@ -137,3 +324,65 @@ func setupAgentRoutes(ctx *gin.RouterGroup) {
 	// ctx.DELETE("/websocket/instances/:id", CloseInstanceConnections)
 	// ctx.DELETE("/websocket/connections/:conn_id", CloseWebSocketConnection)
 }
+
+// setupAgentUpdateRoutes 设置Agent自动更新相关路由
+func setupAgentUpdateRoutes(ctx *gin.RouterGroup) {
+	logger.Infof("设置Agent自动更新路由")
+
+	// Agent安装包
+	ctx.POST("/agent-releases", UploadAgentRelease)
+	ctx.GET("/agent-releases", ListAgentReleases)
+	ctx.GET("/agent-releases/:id", GetAgentRelease)
+	ctx.GET("/agent-releases/:id/download", DownloadAgentRelease)
+	ctx.HEAD("/agent-releases/:id/download", DownloadAgentRelease)
+	ctx.DELETE("/agent-releases/:id", DeleteAgentRelease)
+
+	// 分组灰度发布
+	ctx.GET("/groups/:id/agent-rollout", GetGroupAgentRollout)
+	ctx.PUT("/groups/:id/agent-rollout", PutGroupAgentRollout)
+	ctx.DELETE("/groups/:id/agent-rollout", DeleteGroupAgentRollout)
+
+	// 立即推送更新
+	ctx.POST("/instances/:id/update", PushAgentUpdate)
+}
+
+// setupAgentConfigRoutes 设置Agent集中配置相关路由
+func setupAgentConfigRoutes(ctx *gin.RouterGroup) {
+	logger.Infof("设置Agent集中配置路由")
+
+	// 配置模板
+	ctx.POST("/config-profiles", CreateConfigProfile)
+	ctx.GET("/config-profiles", ListConfigProfiles)
+	ctx.GET("/config-profiles/:id", GetConfigProfile)
+	ctx.PUT("/config-profiles/:id", UpdateConfigProfile)
+	ctx.DELETE("/config-profiles/:id", DeleteConfigProfile)
+
+	// 分组配置模板和配置漂移
+	ctx.GET("/groups/:id/config-profile", GetGroupConfigProfile)
+	ctx.PUT("/groups/:id/config-profile", PutGroupConfigProfile)
+	ctx.DELETE("/groups/:id/config-profile", DeleteGroupConfigProfile)
+	ctx.GET("/groups/:id/config-drift", GetGroupConfigDrift)
+
+	// 设备生效配置和配置覆盖
+	ctx.GET("/instances/:id/config", GetInstanceConfig)
+	ctx.GET("/instances/:id/config-override", GetInstanceConfigOverride)
+	ctx.PUT("/instances/:id/config-override", PutInstanceConfigOverride)
+	ctx.DELETE("/instances/:id/config-override", DeleteInstanceConfigOverride)
+}
+
+// setupEnrollmentRoutes 设置Agent注册令牌和注册申请相关路由
+func setupEnrollmentRoutes(ctx *gin.RouterGroup) {
+	logger.Infof("设置Agent注册准入路由")
+
+	// 注册令牌
+	ctx.POST("/enrollment-tokens", CreateEnrollmentToken)
+	ctx.GET("/enrollment-tokens", ListEnrollmentTokens)
+	ctx.DELETE("/enrollment-tokens/:id", RevokeEnrollmentToken)
+
+	// 待审批的注册申请
+	ctx.GET("/enrollment-requests", ListEnrollmentRequests)
+	ctx.POST("/enrollment-requests/:id/approve", ApproveEnrollmentRequest)
+	ctx.POST("/enrollment-requests/:id/reject", RejectEnrollmentRequest)
+	ctx.POST("/enrollment-requests/:id/reset", ResetEnrollmentRequest)
+	ctx.DELETE("/enrollment-requests/:id", DeleteEnrollmentRequest)
+}
@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+	"winmanager-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ThumbnailListParams 批量获取缩略图参数
+type ThumbnailListParams struct {
+	models.InstanceListParams
+	IncludeData bool   `form:"include_data"` // 是否在结果中内嵌Base64图片数据
+	Known       string `form:"known"`        // 客户端已有的ETag，逗号分隔，这些缩略图不再返回图片数据
+}
+
+// ThumbnailItem 批量缩略图中的单个设备
+type ThumbnailItem struct {
+	InstanceID uint       `json:"instance_id"`
+	Hostname   string     `json:"hostname"`
+	Lan        string     `json:"lan"`
+	Status     int        `json:"status"`
+	ETag       string     `json:"etag,omitempty"`
+	CapturedAt *time.Time `json:"captured_at,omitempty"`
+	Size       int        `json:"size,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Data       string     `json:"data,omitempty"` // Base64编码的图片数据
+}
+
+// etagMatch 判断If-None-Match是否命中当前ETag
+func etagMatch(c *gin.Context, etag string) bool {
+	header := c.GetHeader("If-None-Match")
+	if header == "" || etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ListThumbnails 批量获取设备缩略图，用于设备墙
+// 支持与设备列表相同的分组、状态和搜索筛选；整个结果带ETag，未变化时返回304
+func ListThumbnails(c *gin.Context) {
+	var params ThumbnailListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		logger.Errorf("缩略图列表参数绑定失败: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+	if params.Size <= 0 {
+		params.Size = 200
+	}
+
+	service := services.GetThumbnailService()
+	if service == nil {
+		InternalErrorRes(c, "缩略图服务未初始化")
+		return
+	}
+
+	result, err := models.ListInstancesWithParams(params.InstanceListParams)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	known := make(map[string]bool)
+	for _, etag := range strings.Split(params.Known, ",") {
+		if etag = strings.TrimSpace(etag); etag != "" {
+			known[etag] = true
+		}
+	}
+
+	hash := sha1.New()
+	items := make([]ThumbnailItem, 0, len(result.Devices))
+	for _, instance := range result.Devices {
+		item := ThumbnailItem{
+			InstanceID: instance.ID,
+			Hostname:   instance.Hostname,
+			Lan:        instance.Lan,
+			Status:     instance.Status,
+		}
+		if thumb := service.Get(instance.ID); thumb != nil {
+			item.ETag = thumb.ETag
+			item.Error = thumb.Error
+			if thumb.ETag != "" {
+				capturedAt := thumb.CapturedAt
+				item.CapturedAt = &capturedAt
+				item.Size = thumb.Size
+				if params.IncludeData && !known[thumb.ETag] {
+					item.Data = base64.StdEncoding.EncodeToString(thumb.Data)
+				}
+			}
+		}
+		fmt.Fprintf(hash, "%d:%d:%s:%s;", item.InstanceID, item.Status, item.ETag, item.Error)
+		items = append(items, item)
+	}
+	// 结果内容还取决于是否内嵌数据以及客户端已有的ETag
+	fmt.Fprintf(hash, "%d:%d:%d:%t:%s", result.Total, result.Page, result.Size, params.IncludeData, params.Known)
+
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:8]) + `"`
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+	if etagMatch(c, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	SuccessRes(c, gin.H{
+		"items": items,
+		"total": result.Total,
+		"page":  result.Page,
+		"size":  result.Size,
+	})
+}
+
+// GetThumbnail 获取单个设备的缩略图图片
+// refresh=true 时立即重新采集；支持If-None-Match，未变化时返回304
+func GetThumbnail(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("缩略图参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	service := services.GetThumbnailService()
+	if service == nil {
+		InternalErrorRes(c, "缩略图服务未初始化")
+		return
+	}
+
+	thumb := service.Get(uint(id))
+	if c.Query("refresh") == "true" || c.Query("refresh") == "1" || thumb == nil || thumb.ETag == "" {
+		instance, err := models.GetInstance(id)
+		if err != nil {
+			logger.Errorf("获取实例失败: ID=%d, 错误=%v", id, err)
+			NotFoundRes(c, "设备不存在")
+			return
+		}
+		if refreshed, err := service.Refresh(instance); err == nil {
+			thumb = refreshed
+		} else if thumb == nil || thumb.ETag == "" {
+			ErrorRes(c, ErrInternal, fmt.Sprintf("采集缩略图失败: %v", err))
+			return
+		}
+	}
+
+	c.Header("ETag", thumb.ETag)
+	c.Header("Last-Modified", thumb.CapturedAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", "no-cache")
+	if etagMatch(c, thumb.ETag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, thumb.ContentType, thumb.Data)
+}
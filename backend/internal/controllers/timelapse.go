@@ -0,0 +1,419 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+	"winmanager-backend/internal/recorder"
+	"winmanager-backend/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// TimelapsePolicyRequest 截图归档策略请求结构
+type TimelapsePolicyRequest struct {
+	Enabled         bool  `json:"enabled"`
+	IntervalSeconds int   `json:"interval_seconds"`
+	RetentionDays   int   `json:"retention_days"`
+	MaxTotalMB      int64 `json:"max_total_mb"`
+	MaxWidth        int   `json:"max_width"`
+	Quality         int   `json:"quality"`
+}
+
+// resolveTimelapsePolicy 获取分组或设备当前生效的归档策略
+func resolveTimelapsePolicy(scope string, id int) (models.TimelapsePolicy, error) {
+	policies, err := models.LoadTimelapsePolicySet()
+	if err != nil {
+		return models.TimelapsePolicy{}, err
+	}
+
+	if scope == models.TimelapseScopeGroup {
+		return policies.Resolve(0, &id), nil
+	}
+
+	instance, err := models.GetInstance(id)
+	if err != nil {
+		return models.TimelapsePolicy{}, err
+	}
+	return policies.Resolve(id, instance.GroupID), nil
+}
+
+// checkTimelapseTarget 检查策略目标是否存在，失败时已写入响应
+func checkTimelapseTarget(c *gin.Context, scope string, id int) bool {
+	var err error
+	if scope == models.TimelapseScopeGroup {
+		_, err = models.GetGroup(id)
+	} else {
+		_, err = models.GetInstance(id)
+	}
+	if err != nil {
+		if scope == models.TimelapseScopeGroup {
+			NotFoundRes(c, "分组不存在")
+		} else {
+			NotFoundRes(c, "设备不存在")
+		}
+		return false
+	}
+	return true
+}
+
+// getTimelapsePolicy 获取归档策略，未设置时返回上级策略或全局默认策略
+func getTimelapsePolicy(c *gin.Context, scope string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("获取归档策略参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if !checkTimelapseTarget(c, scope, id) {
+		return
+	}
+
+	policy, err := resolveTimelapsePolicy(scope, id)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, policy)
+}
+
+// putTimelapsePolicy 设置归档策略
+func putTimelapsePolicy(c *gin.Context, scope string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("设置归档策略参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var item TimelapsePolicyRequest
+	if err := c.ShouldBindJSON(&item); err != nil {
+		logger.Errorf("设置归档策略参数绑定失败: %v", err)
+		ErrorRes(c, ErrBindJson, err.Error())
+		return
+	}
+
+	if item.IntervalSeconds < 0 || item.RetentionDays < 0 || item.MaxTotalMB < 0 || item.MaxWidth < 0 {
+		BadRequestRes(c, "策略参数不能为负数")
+		return
+	}
+	if item.Quality < 0 || item.Quality > 100 {
+		BadRequestRes(c, "quality 必须在1-100之间")
+		return
+	}
+
+	// 未指定的参数使用全局默认值
+	defaults := models.DefaultTimelapsePolicy()
+	if item.IntervalSeconds == 0 {
+		item.IntervalSeconds = defaults.IntervalSeconds
+	}
+	if item.Quality == 0 {
+		item.Quality = defaults.Quality
+	}
+
+	if !checkTimelapseTarget(c, scope, id) {
+		return
+	}
+
+	policy, err := models.SaveTimelapsePolicy(models.TimelapsePolicy{
+		Scope:           scope,
+		TargetID:        id,
+		Enabled:         item.Enabled,
+		IntervalSeconds: item.IntervalSeconds,
+		RetentionDays:   item.RetentionDays,
+		MaxTotalMB:      item.MaxTotalMB,
+		MaxWidth:        item.MaxWidth,
+		Quality:         item.Quality,
+	})
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, policy)
+}
+
+// deleteTimelapsePolicy 删除归档策略，恢复使用上级策略或全局默认策略
+func deleteTimelapsePolicy(c *gin.Context, scope string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("删除归档策略参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	if err := models.DeleteTimelapsePolicy(scope, id); err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	policy, err := resolveTimelapsePolicy(scope, id)
+	if err != nil {
+		policy = models.DefaultTimelapsePolicy()
+	}
+
+	SuccessRes(c, policy)
+}
+
+// GetGroupTimelapsePolicy 获取分组的截图归档策略
+func GetGroupTimelapsePolicy(c *gin.Context) {
+	getTimelapsePolicy(c, models.TimelapseScopeGroup)
+}
+
+// PutGroupTimelapsePolicy 设置分组的截图归档策略
+func PutGroupTimelapsePolicy(c *gin.Context) {
+	putTimelapsePolicy(c, models.TimelapseScopeGroup)
+}
+
+// DeleteGroupTimelapsePolicy 删除分组的截图归档策略
+func DeleteGroupTimelapsePolicy(c *gin.Context) {
+	deleteTimelapsePolicy(c, models.TimelapseScopeGroup)
+}
+
+// GetInstanceTimelapsePolicy 获取设备的截图归档策略
+func GetInstanceTimelapsePolicy(c *gin.Context) {
+	getTimelapsePolicy(c, models.TimelapseScopeInstance)
+}
+
+// PutInstanceTimelapsePolicy 设置设备的截图归档策略，优先于分组策略
+func PutInstanceTimelapsePolicy(c *gin.Context) {
+	putTimelapsePolicy(c, models.TimelapseScopeInstance)
+}
+
+// DeleteInstanceTimelapsePolicy 删除设备的截图归档策略
+func DeleteInstanceTimelapsePolicy(c *gin.Context) {
+	deleteTimelapsePolicy(c, models.TimelapseScopeInstance)
+}
+
+// parseTimeParam 解析时间参数，支持RFC3339和Unix时间戳(秒)
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		t := time.Unix(unix, 0)
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("时间格式错误: %s", value)
+	}
+	return &t, nil
+}
+
+// parseTimeRange 解析from/to参数，失败时已写入响应
+func parseTimeRange(c *gin.Context) (from *time.Time, to *time.Time, ok bool) {
+	var err error
+	if from, err = parseTimeParam(c.Query("from")); err != nil {
+		BadRequestRes(c, err.Error())
+		return nil, nil, false
+	}
+	if to, err = parseTimeParam(c.Query("to")); err != nil {
+		BadRequestRes(c, err.Error())
+		return nil, nil, false
+	}
+	return from, to, true
+}
+
+// ListSnapshots 按时间浏览设备的截图归档
+func ListSnapshots(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("截图归档参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	var params models.SnapshotListParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		BadRequestRes(c, "参数错误")
+		return
+	}
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+	params.From, params.To = from, to
+
+	result, err := models.GetSnapshotList(id, &params)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	SuccessRes(c, result)
+}
+
+// CaptureSnapshot 立即为设备截图并归档，不受策略是否启用限制
+func CaptureSnapshot(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("截图归档参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	service := services.GetTimelapseService()
+	if service == nil {
+		InternalErrorRes(c, "截图归档服务未初始化")
+		return
+	}
+
+	instance, err := models.GetInstance(id)
+	if err != nil {
+		NotFoundRes(c, "设备不存在")
+		return
+	}
+
+	policy, err := resolveTimelapsePolicy(models.TimelapseScopeInstance, id)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	snapshot, err := service.Capture(instance, policy)
+	if err != nil {
+		logger.Errorf("截图归档失败: ID=%d, 错误=%v", id, err)
+		InternalErrorRes(c, fmt.Sprintf("截图失败: %v", err))
+		return
+	}
+
+	SuccessRes(c, snapshot)
+}
+
+// GetSnapshotImage 获取归档的截图图片
+func GetSnapshotImage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("截图参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	snapshot, err := models.GetSnapshot(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			NotFoundRes(c, "截图不存在")
+		} else {
+			ErrorRes(c, ErrDbReturn, err.Error())
+		}
+		return
+	}
+
+	// 归档截图不会再改变，允许客户端长期缓存
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.Header("Content-Type", "image/jpeg")
+	c.File(snapshot.Path)
+}
+
+// GetTimelapseVideo 将时间范围内的归档截图生成MJPEG AVI延时视频
+// fps 为输出帧率（默认10）；截图数超过上限时均匀抽帧
+func GetTimelapseVideo(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		logger.Errorf("延时视频参数错误: %v", err)
+		BadRequestRes(c, "参数错误")
+		return
+	}
+
+	from, to, ok := parseTimeRange(c)
+	if !ok {
+		return
+	}
+	if to == nil {
+		now := time.Now()
+		to = &now
+	}
+	if from == nil {
+		start := to.Add(-24 * time.Hour)
+		from = &start
+	}
+	if !from.Before(*to) {
+		BadRequestRes(c, "from 必须早于 to")
+		return
+	}
+
+	fps, err := strconv.Atoi(c.DefaultQuery("fps", "10"))
+	if err != nil || fps <= 0 || fps > 60 {
+		BadRequestRes(c, "fps 必须在1-60之间")
+		return
+	}
+
+	snapshots, err := models.ListSnapshotsInRange(id, *from, *to, -1)
+	if err != nil {
+		ErrorRes(c, ErrDbReturn, err.Error())
+		return
+	}
+
+	maxFrames := config.GetTimelapseConfig().MaxVideoFrames
+	if maxFrames > 0 && len(snapshots) > maxFrames {
+		sampled := make([]models.Snapshot, 0, maxFrames)
+		for i := 0; i < maxFrames; i++ {
+			sampled = append(sampled, snapshots[i*len(snapshots)/maxFrames])
+		}
+		snapshots = sampled
+	}
+
+	// 以文件实际大小为准，跳过已被清理的截图
+	frames := make([]models.Snapshot, 0, len(snapshots))
+	sizes := make([]int, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		info, err := os.Stat(snapshot.Path)
+		if err != nil {
+			continue
+		}
+		frames = append(frames, snapshot)
+		sizes = append(sizes, int(info.Size()))
+	}
+	if len(frames) == 0 {
+		NotFoundRes(c, "时间范围内没有截图")
+		return
+	}
+
+	avi, err := recorder.NewMJPEGAVI(frames[0].Width, frames[0].Height, fps, sizes)
+	if err != nil {
+		BadRequestRes(c, err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("timelapse-%d-%s-%s.avi", id, from.Format("20060102-150405"), to.Format("20060102-150405"))
+	c.Header("Content-Type", "video/x-msvideo")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Content-Length", strconv.FormatInt(avi.Size(), 10))
+	c.Status(http.StatusOK)
+
+	if err := avi.WriteHeader(c.Writer); err != nil {
+		logger.Errorf("输出延时视频失败: ID=%d, 错误=%v", id, err)
+		return
+	}
+	for i, frame := range frames {
+		data, err := os.ReadFile(frame.Path)
+		if err == nil && len(data) != sizes[i] {
+			err = fmt.Errorf("截图文件已变化")
+		}
+		if err != nil {
+			// 文件头已发出，无法再返回错误响应，只能中断连接
+			logger.Errorf("读取截图失败，延时视频中断: %s, 错误=%v", frame.Path, err)
+			return
+		}
+		if err := avi.WriteFrame(c.Writer, data); err != nil {
+			logger.Errorf("输出延时视频失败: ID=%d, 错误=%v", id, err)
+			return
+		}
+	}
+	if err := avi.WriteIndex(c.Writer); err != nil {
+		logger.Errorf("输出延时视频失败: ID=%d, 错误=%v", id, err)
+		return
+	}
+
+	logger.Infof("延时视频生成完成: ID=%d, 帧数=%d, 大小=%d字节", id, len(frames), avi.Size())
+}
@@ -0,0 +1,472 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// ManagedConfigSections 可集中管理的配置段，与Agent配置文件的段名一致
+var ManagedConfigSections = []string{"screen", "encoder", "input", "monitoring", "system"}
+
+// ConfigData Agent配置片段，按配置文件的段组织，如 {"encoder": {"frame_rate": 15}}
+type ConfigData map[string]interface{}
+
+// Value 以JSON保存配置
+func (d ConfigData) Value() (driver.Value, error) {
+	if d == nil {
+		return "{}", nil
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan 读取JSON格式的配置
+func (d *ConfigData) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(data), d)
+	case []byte:
+		return json.Unmarshal(data, d)
+	}
+	return errors.New("配置内容格式错误")
+}
+
+// 配置取值范围，与Agent配置校验一致
+var (
+	SupportedCodecs         = []string{"h264", "jpeg", "jpeg-turbo", "vp8"}
+	SupportedCaptureMethods = []string{"auto", "dxgi", "wgc", "robotgo"}
+)
+
+const MaxFrameRate = 120
+
+// configField 配置项的类型和取值范围
+type configField struct {
+	kind   string   // int, bool, string, strings, string_map, object
+	min    *float64 // 整数的最小值
+	max    *float64 // 整数的最大值
+	values []string // 字符串或字符串数组允许的取值，为空时不限制
+	fields map[string]configField
+}
+
+func intRange(min, max float64) configField {
+	return configField{kind: "int", min: &min, max: &max}
+}
+
+func nonNegative() configField {
+	min := 0.0
+	return configField{kind: "int", min: &min}
+}
+
+var (
+	boolField   = configField{kind: "bool"}
+	stringField = configField{kind: "string"}
+)
+
+// managedConfigSchema 可集中管理的配置段的字段，与Agent配置文件的字段一致
+var managedConfigSchema = map[string]map[string]configField{
+	"screen": {
+		"jpeg_quality":   intRange(1, 100),
+		"capture_method": {kind: "string", values: SupportedCaptureMethods},
+	},
+	"encoder": {
+		"default_codec":   {kind: "string", values: SupportedCodecs},
+		"jpeg_quality":    intRange(1, 100),
+		"h264_preset":     stringField,
+		"h264_tune":       stringField,
+		"h264_profile":    stringField,
+		"h264_bitrate":    nonNegative(),
+		"vp8_bitrate":     nonNegative(),
+		"nvenc_bitrate":   nonNegative(),
+		"nvenc_preset":    stringField,
+		"frame_rate":      intRange(1, MaxFrameRate),
+		"enabled_codecs":  {kind: "strings", values: SupportedCodecs},
+		"codec_priority":  {kind: "strings", values: SupportedCodecs},
+		"custom_settings": {kind: "string_map"},
+		"debug": {kind: "object", fields: map[string]configField{
+			"save_path":           stringField,
+			"save_video_duration": nonNegative(),
+		}},
+	},
+	"input": {
+		"mouse_enabled":    boolField,
+		"keyboard_enabled": boolField,
+		"paste_enabled":    boolField,
+	},
+	"monitoring": {
+		"metrics_enabled":      boolField,
+		"metrics_interval":     nonNegative(),
+		"health_check_enabled": boolField,
+	},
+	"system": {
+		"reboot_enabled":   boolField,
+		"reboot_delay":     nonNegative(),
+		"shutdown_enabled": boolField,
+		"commands_enabled": boolField,
+	},
+}
+
+// Validate 检查配置只包含可集中管理的配置段和字段，且取值类型和范围与Agent的校验一致，返回所有不合法的字段
+func (d ConfigData) Validate() error {
+	var problems []string
+	for section, value := range d {
+		fields, ok := managedConfigSchema[section]
+		if !ok {
+			return fmt.Errorf("不支持集中管理的配置段: %s", section)
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("配置段%s必须是对象", section)
+		}
+		problems = append(problems, validateConfigObject(section, object, fields)...)
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// validateConfigObject 检查对象中的字段，prefix为字段路径前缀
+func validateConfigObject(prefix string, object map[string]interface{}, fields map[string]configField) []string {
+	var problems []string
+	for name, value := range object {
+		path := prefix + "." + name
+		field, ok := fields[name]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s 不是可集中管理的配置项", path))
+			continue
+		}
+		if problem := field.check(path, value); problem != "" {
+			problems = append(problems, problem)
+		}
+		if nested, ok := value.(map[string]interface{}); ok && field.kind == "object" {
+			problems = append(problems, validateConfigObject(path, nested, field.fields)...)
+		}
+	}
+	return problems
+}
+
+// check 检查单个配置项，合法时返回空字符串
+func (f configField) check(path string, value interface{}) string {
+	switch f.kind {
+	case "int":
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) {
+			return fmt.Sprintf("%s 必须是整数", path)
+		}
+		if f.min != nil && f.max != nil && (number < *f.min || number > *f.max) {
+			return fmt.Sprintf("%s 必须在%v到%v之间", path, *f.min, *f.max)
+		}
+		if f.min != nil && number < *f.min {
+			return fmt.Sprintf("%s 不能小于%v", path, *f.min)
+		}
+	case "bool":
+		if _, ok := value.(bool); !ok {
+			return fmt.Sprintf("%s 必须是布尔值", path)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Sprintf("%s 必须是字符串", path)
+		}
+		if len(f.values) > 0 && !containsString(f.values, text) {
+			return fmt.Sprintf("%s 必须是 %s 之一", path, strings.Join(f.values, ", "))
+		}
+	case "strings":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Sprintf("%s 必须是字符串数组", path)
+		}
+		for _, item := range items {
+			text, ok := item.(string)
+			if !ok {
+				return fmt.Sprintf("%s 必须是字符串数组", path)
+			}
+			if len(f.values) > 0 && !containsString(f.values, text) {
+				return fmt.Sprintf("%s 包含不支持的取值: %s", path, text)
+			}
+		}
+	case "string_map":
+		items, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Sprintf("%s 必须是对象", path)
+		}
+		for key, item := range items {
+			if _, ok := item.(string); !ok {
+				return fmt.Sprintf("%s.%s 必须是字符串", path, key)
+			}
+		}
+	case "object":
+		if _, ok := value.(map[string]interface{}); !ok {
+			return fmt.Sprintf("%s 必须是对象", path)
+		}
+	}
+	return ""
+}
+
+// containsString 判断values中是否包含value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeConfigData 将overlay逐层合并到base上，返回新的配置，不修改参数
+func MergeConfigData(base, overlay ConfigData) ConfigData {
+	result := make(ConfigData, len(base)+len(overlay))
+	for key, value := range base {
+		result[key] = value
+	}
+	for key, value := range overlay {
+		if overlayMap, ok := value.(map[string]interface{}); ok {
+			if baseMap, ok := result[key].(map[string]interface{}); ok {
+				result[key] = map[string]interface{}(MergeConfigData(baseMap, overlayMap))
+				continue
+			}
+		}
+		result[key] = value
+	}
+	return result
+}
+
+// ConfigProfile 集中管理的Agent配置模板，分配给分组后下发到分组内的设备
+type ConfigProfile struct {
+	gorm.Model
+	Name        string     `json:"name" gorm:"uniqueIndex;comment:配置名称"`
+	Description string     `json:"description" gorm:"comment:描述"`
+	Config      ConfigData `json:"config" gorm:"type:text;comment:配置内容(JSON)"`
+	Revision    int        `json:"revision" gorm:"comment:修改次数"`
+}
+
+// GroupConfigProfile 分组使用的配置模板
+type GroupConfigProfile struct {
+	gorm.Model
+	GroupID   int  `json:"group_id" gorm:"uniqueIndex;comment:分组ID"`
+	ProfileID uint `json:"profile_id" gorm:"index;comment:配置模板ID"`
+}
+
+// InstanceConfigOverride 单台设备的配置覆盖，合并在分组配置模板之上
+type InstanceConfigOverride struct {
+	gorm.Model
+	InstanceID int        `json:"instance_id" gorm:"uniqueIndex;comment:设备ID"`
+	Config     ConfigData `json:"config" gorm:"type:text;comment:覆盖的配置内容(JSON)"`
+}
+
+// EffectiveConfig 设备生效的集中配置
+type EffectiveConfig struct {
+	Version     string     `json:"version"` // 配置内容的摘要，没有集中配置时为空
+	ProfileID   uint       `json:"profile_id"`
+	ProfileName string     `json:"profile_name"`
+	HasOverride bool       `json:"has_override"`
+	Config      ConfigData `json:"config"`
+}
+
+// CreateConfigProfile 创建配置模板
+func CreateConfigProfile(profile *ConfigProfile) error {
+	profile.Revision = 1
+	if err := DB.Create(profile).Error; err != nil {
+		logger.Errorf("创建配置模板失败: %v", err)
+		return err
+	}
+	logger.Infof("创建配置模板成功: ID=%d, 名称=%s", profile.ID, profile.Name)
+	return nil
+}
+
+// GetConfigProfile 获取配置模板
+func GetConfigProfile(id int) (*ConfigProfile, error) {
+	var item ConfigProfile
+	if err := DB.First(&item, id).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetConfigProfileByName 按名称获取配置模板，不存在时返回gorm.ErrRecordNotFound
+func GetConfigProfileByName(name string) (*ConfigProfile, error) {
+	var item ConfigProfile
+	if err := DB.Where("name = ?", name).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetConfigProfileList 获取所有配置模板
+func GetConfigProfileList() ([]ConfigProfile, error) {
+	var items []ConfigProfile
+	if err := DB.Order("id").Find(&items).Error; err != nil {
+		logger.Errorf("获取配置模板列表失败: %v", err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// UpdateConfigProfile 更新配置模板并增加修改次数
+func UpdateConfigProfile(id int, name, description string, config ConfigData) (*ConfigProfile, error) {
+	err := DB.Model(&ConfigProfile{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"name":        name,
+		"description": description,
+		"config":      config,
+		"revision":    gorm.Expr("revision + 1"),
+	}).Error
+	if err != nil {
+		logger.Errorf("更新配置模板失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+
+	profile, err := GetConfigProfile(id)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("更新配置模板成功: ID=%d, 名称=%s, 修改次数=%d", profile.ID, profile.Name, profile.Revision)
+	return profile, nil
+}
+
+// DeleteConfigProfile 删除配置模板
+func DeleteConfigProfile(id int) error {
+	if err := DB.Unscoped().Delete(&ConfigProfile{}, id).Error; err != nil {
+		logger.Errorf("删除配置模板失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+	logger.Infof("删除配置模板成功: ID=%d", id)
+	return nil
+}
+
+// CountGroupsByConfigProfile 统计使用配置模板的分组数
+func CountGroupsByConfigProfile(profileID int) (int64, error) {
+	var count int64
+	if err := DB.Model(&GroupConfigProfile{}).Where("profile_id = ?", profileID).Count(&count).Error; err != nil {
+		logger.Errorf("统计配置模板的分组数失败: 模板=%d, 错误=%v", profileID, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// GetGroupConfigProfile 获取分组使用的配置模板，未设置时返回gorm.ErrRecordNotFound
+func GetGroupConfigProfile(groupID int) (*GroupConfigProfile, error) {
+	var item GroupConfigProfile
+	if err := DB.Where("group_id = ?", groupID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// SaveGroupConfigProfile 设置分组使用的配置模板
+func SaveGroupConfigProfile(groupID int, profileID uint) (*GroupConfigProfile, error) {
+	var item GroupConfigProfile
+	err := DB.Where(GroupConfigProfile{GroupID: groupID}).
+		Assign(map[string]interface{}{"profile_id": profileID}).
+		FirstOrCreate(&item).Error
+	if err != nil {
+		logger.Errorf("设置分组配置模板失败: 分组=%d, 错误=%v", groupID, err)
+		return nil, err
+	}
+	logger.Infof("设置分组配置模板成功: 分组=%d, 模板=%d", groupID, profileID)
+	return &item, nil
+}
+
+// DeleteGroupConfigProfile 取消分组的配置模板
+func DeleteGroupConfigProfile(groupID int) error {
+	if err := DB.Unscoped().Where("group_id = ?", groupID).Delete(&GroupConfigProfile{}).Error; err != nil {
+		logger.Errorf("取消分组配置模板失败: 分组=%d, 错误=%v", groupID, err)
+		return err
+	}
+	logger.Infof("取消分组配置模板成功: 分组=%d", groupID)
+	return nil
+}
+
+// GetInstanceConfigOverride 获取设备的配置覆盖，未设置时返回gorm.ErrRecordNotFound
+func GetInstanceConfigOverride(instanceID int) (*InstanceConfigOverride, error) {
+	var item InstanceConfigOverride
+	if err := DB.Where("instance_id = ?", instanceID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// SaveInstanceConfigOverride 设置设备的配置覆盖
+func SaveInstanceConfigOverride(instanceID int, config ConfigData) (*InstanceConfigOverride, error) {
+	var item InstanceConfigOverride
+	err := DB.Where(InstanceConfigOverride{InstanceID: instanceID}).
+		Assign(map[string]interface{}{"config": config}).
+		FirstOrCreate(&item).Error
+	if err != nil {
+		logger.Errorf("设置设备配置覆盖失败: 设备=%d, 错误=%v", instanceID, err)
+		return nil, err
+	}
+	logger.Infof("设置设备配置覆盖成功: 设备=%d", instanceID)
+	return &item, nil
+}
+
+// DeleteInstanceConfigOverride 删除设备的配置覆盖
+func DeleteInstanceConfigOverride(instanceID int) error {
+	if err := DB.Unscoped().Where("instance_id = ?", instanceID).Delete(&InstanceConfigOverride{}).Error; err != nil {
+		logger.Errorf("删除设备配置覆盖失败: 设备=%d, 错误=%v", instanceID, err)
+		return err
+	}
+	logger.Infof("删除设备配置覆盖成功: 设备=%d", instanceID)
+	return nil
+}
+
+// ConfigVersion 配置内容的摘要，json.Marshal按键排序，内容相同时摘要相同
+func ConfigVersion(config ConfigData) string {
+	if len(config) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// ResolveEffectiveConfig 获取设备生效的集中配置：分组的配置模板合并设备的配置覆盖
+func ResolveEffectiveConfig(instance *Instance) (*EffectiveConfig, error) {
+	result := &EffectiveConfig{Config: ConfigData{}}
+
+	if instance.GroupID != nil {
+		assignment, err := GetGroupConfigProfile(*instance.GroupID)
+		if err == nil {
+			profile, err := GetConfigProfile(int(assignment.ProfileID))
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			if profile != nil {
+				result.ProfileID = profile.ID
+				result.ProfileName = profile.Name
+				result.Config = MergeConfigData(result.Config, profile.Config)
+			}
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+	}
+
+	override, err := GetInstanceConfigOverride(int(instance.ID))
+	if err == nil {
+		result.HasOverride = true
+		result.Config = MergeConfigData(result.Config, override.Config)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	result.Version = ConfigVersion(result.Config)
+	return result, nil
+}
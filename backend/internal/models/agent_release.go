@@ -0,0 +1,214 @@
+package models
+
+import (
+	"hash/fnv"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// Agent上报的自动更新状态
+const (
+	UpdateStatusTrial      = "trial"       // 已替换为新版本，等待新版本重新注册
+	UpdateStatusConfirmed  = "confirmed"   // 新版本已重新注册，更新完成
+	UpdateStatusRolledBack = "rolled_back" // 新版本未能重新注册，已回滚到旧版本
+	UpdateStatusFailed     = "failed"      // 下载或校验失败，未替换
+)
+
+// AgentRelease Agent安装包，同一版本的每个平台各一条记录
+type AgentRelease struct {
+	gorm.Model
+	Version   string `json:"version" gorm:"index;comment:版本号"`
+	Platform  string `json:"platform" gorm:"index;comment:平台(os/arch)，如windows/amd64"`
+	Name      string `json:"name" gorm:"comment:文件名"`
+	Size      int64  `json:"size" gorm:"comment:文件大小(字节)"`
+	SHA256    string `json:"sha256" gorm:"comment:文件SHA-256"`
+	Signature string `json:"signature" gorm:"comment:SHA-256摘要的Ed25519签名(base64)，可为空"`
+	Notes     string `json:"notes" gorm:"comment:更新说明"`
+	Path      string `json:"-" gorm:"comment:存储路径"`
+}
+
+// AgentRollout 分组的灰度发布设置
+type AgentRollout struct {
+	gorm.Model
+	GroupID int    `json:"group_id" gorm:"uniqueIndex;comment:分组ID"`
+	Version string `json:"version" gorm:"comment:目标版本"`
+	Percent int    `json:"percent" gorm:"comment:参与更新的设备百分比(0-100)"`
+}
+
+// AgentReleaseListParams 版本列表查询参数
+type AgentReleaseListParams struct {
+	Version  string `json:"version" form:"version"`
+	Platform string `json:"platform" form:"platform"`
+	Page     int    `json:"page" form:"page"`
+	Size     int    `json:"size" form:"size"`
+}
+
+// AgentReleaseListResult 版本列表返回结果
+type AgentReleaseListResult struct {
+	Releases []AgentRelease `json:"releases"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	Size     int            `json:"size"`
+}
+
+// CreateAgentRelease 创建版本记录
+func CreateAgentRelease(item *AgentRelease) error {
+	if err := DB.Create(item).Error; err != nil {
+		logger.Errorf("创建Agent版本失败: 版本=%s, 平台=%s, 错误=%v", item.Version, item.Platform, err)
+		return err
+	}
+	return nil
+}
+
+// GetAgentRelease 获取版本记录
+func GetAgentRelease(id int) (*AgentRelease, error) {
+	var item AgentRelease
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取Agent版本失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+	return &item, nil
+}
+
+// FindAgentRelease 获取指定版本和平台的安装包，未上传时返回gorm.ErrRecordNotFound
+func FindAgentRelease(version, platform string) (*AgentRelease, error) {
+	var item AgentRelease
+	if err := DB.Where("version = ? AND platform = ?", version, platform).Order("id DESC").First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetLatestAgentRelease 获取平台最新上传的安装包
+func GetLatestAgentRelease(platform string) (*AgentRelease, error) {
+	var item AgentRelease
+	if err := DB.Where("platform = ?", platform).Order("id DESC").First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetAgentReleaseList 获取版本列表
+func GetAgentReleaseList(params *AgentReleaseListParams) (*AgentReleaseListResult, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 {
+		params.Size = 20
+	}
+
+	query := DB.Model(&AgentRelease{})
+	if params.Version != "" {
+		query = query.Where("version = ?", params.Version)
+	}
+	if params.Platform != "" {
+		query = query.Where("platform = ?", params.Platform)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("获取Agent版本总数失败: %v", err)
+		return nil, err
+	}
+
+	var items []AgentRelease
+	offset := (params.Page - 1) * params.Size
+	if err := query.Order("id DESC").Offset(offset).Limit(params.Size).Find(&items).Error; err != nil {
+		logger.Errorf("获取Agent版本列表失败: %v", err)
+		return nil, err
+	}
+
+	return &AgentReleaseListResult{
+		Releases: items,
+		Total:    total,
+		Page:     params.Page,
+		Size:     params.Size,
+	}, nil
+}
+
+// CountAgentReleasesByPath 统计使用同一存储文件的记录数
+func CountAgentReleasesByPath(path string) (int64, error) {
+	var count int64
+	if err := DB.Model(&AgentRelease{}).Where("path = ?", path).Count(&count).Error; err != nil {
+		logger.Errorf("统计Agent版本引用失败: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// DeleteAgentRelease 删除版本记录
+func DeleteAgentRelease(id int) error {
+	if err := DB.Delete(&AgentRelease{}, id).Error; err != nil {
+		logger.Errorf("删除Agent版本失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+	return nil
+}
+
+// GetAgentRolloutByGroup 获取分组的灰度发布设置，未设置时返回gorm.ErrRecordNotFound
+func GetAgentRolloutByGroup(groupID int) (*AgentRollout, error) {
+	var item AgentRollout
+	if err := DB.Where("group_id = ?", groupID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// CountAgentRolloutsByVersion 统计以指定版本为目标的分组数
+func CountAgentRolloutsByVersion(version string) (int64, error) {
+	var count int64
+	if err := DB.Model(&AgentRollout{}).Where("version = ?", version).Count(&count).Error; err != nil {
+		logger.Errorf("统计灰度发布失败: 版本=%s, 错误=%v", version, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// SaveAgentRollout 创建或更新分组的灰度发布设置
+func SaveAgentRollout(rollout AgentRollout) (*AgentRollout, error) {
+	var item AgentRollout
+	err := DB.Where(AgentRollout{GroupID: rollout.GroupID}).
+		Assign(map[string]interface{}{
+			"version": rollout.Version,
+			"percent": rollout.Percent,
+		}).
+		FirstOrCreate(&item).Error
+	if err != nil {
+		logger.Errorf("保存灰度发布失败: 分组=%d, 错误=%v", rollout.GroupID, err)
+		return nil, err
+	}
+
+	logger.Infof("保存灰度发布成功: 分组=%d, 版本=%s, 比例=%d%%", item.GroupID, item.Version, item.Percent)
+	return &item, nil
+}
+
+// DeleteAgentRollout 删除分组的灰度发布设置，分组内设备不再自动更新
+func DeleteAgentRollout(groupID int) error {
+	if err := DB.Unscoped().Where("group_id = ?", groupID).Delete(&AgentRollout{}).Error; err != nil {
+		logger.Errorf("删除灰度发布失败: 分组=%d, 错误=%v", groupID, err)
+		return err
+	}
+
+	logger.Infof("删除灰度发布成功: 分组=%d", groupID)
+	return nil
+}
+
+// InRollout 判断设备是否落在灰度比例内
+// 按设备标识和目标版本计算固定的分桶，同一版本调高比例时已更新的设备仍在范围内
+func (r *AgentRollout) InRollout(instance *Instance) bool {
+	if r.Percent >= 100 {
+		return true
+	}
+	if r.Percent <= 0 {
+		return false
+	}
+
+	key := instance.Uuid
+	if key == "" {
+		key = instance.Lan
+	}
+	hasher := fnv.New32a()
+	hasher.Write([]byte(key + "|" + r.Version))
+	return int(hasher.Sum32()%100) < r.Percent
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// Artifact 上传到后端的待分发文件
+type Artifact struct {
+	gorm.Model
+	Name        string `json:"name" gorm:"comment:文件名"`
+	Description string `json:"description" gorm:"comment:描述"`
+	Size        int64  `json:"size" gorm:"comment:文件大小(字节)"`
+	SHA256      string `json:"sha256" gorm:"index;comment:文件SHA-256"`
+	Path        string `json:"-" gorm:"comment:存储路径"`
+}
+
+// ArtifactListParams 分发文件列表查询参数
+type ArtifactListParams struct {
+	Keyword string `json:"keyword" form:"keyword"`
+	Page    int    `json:"page" form:"page"`
+	Size    int    `json:"size" form:"size"`
+}
+
+// ArtifactListResult 分发文件列表返回结果
+type ArtifactListResult struct {
+	Artifacts []Artifact `json:"artifacts"`
+	Total     int64      `json:"total"`
+	Page      int        `json:"page"`
+	Size      int        `json:"size"`
+}
+
+// CreateArtifact 创建分发文件记录
+func CreateArtifact(item *Artifact) error {
+	if err := DB.Create(item).Error; err != nil {
+		logger.Errorf("创建分发文件记录失败: 文件名=%s, 错误=%v", item.Name, err)
+		return err
+	}
+	return nil
+}
+
+// GetArtifact 获取分发文件记录
+func GetArtifact(id int) (*Artifact, error) {
+	var item Artifact
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取分发文件记录失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetArtifactList 获取分发文件列表（支持分页和按名称搜索）
+func GetArtifactList(params *ArtifactListParams) (*ArtifactListResult, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 {
+		params.Size = 20
+	}
+
+	query := DB.Model(&Artifact{})
+	if params.Keyword != "" {
+		query = query.Where("name LIKE ?", "%"+params.Keyword+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("获取分发文件总数失败: %v", err)
+		return nil, err
+	}
+
+	var items []Artifact
+	offset := (params.Page - 1) * params.Size
+	if err := query.Order("id DESC").Offset(offset).Limit(params.Size).Find(&items).Error; err != nil {
+		logger.Errorf("获取分发文件列表失败: %v", err)
+		return nil, err
+	}
+
+	return &ArtifactListResult{
+		Artifacts: items,
+		Total:     total,
+		Page:      params.Page,
+		Size:      params.Size,
+	}, nil
+}
+
+// CountArtifactsByPath 统计使用同一存储文件的记录数（相同内容的文件共用存储）
+func CountArtifactsByPath(path string) (int64, error) {
+	var count int64
+	if err := DB.Model(&Artifact{}).Where("path = ?", path).Count(&count).Error; err != nil {
+		logger.Errorf("统计分发文件引用失败: %v", err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// DeleteArtifact 删除分发文件记录
+func DeleteArtifact(id int) error {
+	if err := DB.Delete(&Artifact{}, id).Error; err != nil {
+		logger.Errorf("删除分发文件记录失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+	return nil
+}
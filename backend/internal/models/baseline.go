@@ -0,0 +1,163 @@
+package models
+
+import (
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// Baseline 分组的文件基线清单，用于核对设备上的文件是否被新增、删除或修改
+type Baseline struct {
+	gorm.Model
+	GroupID          int      `json:"group_id" gorm:"index;comment:所属分组ID"`
+	Name             string   `json:"name" gorm:"comment:基线名称"`
+	Description      string   `json:"description" gorm:"comment:描述"`
+	Root             string   `json:"root" gorm:"comment:设备上的文件或目录路径"`
+	MD5              bool     `json:"md5" gorm:"comment:是否同时核对MD5"`
+	Exclude          []string `json:"exclude" gorm:"serializer:json;comment:排除的通配符"`
+	SourceInstanceID *int     `json:"source_instance_id" gorm:"comment:采集基线的设备ID，导入时为空"`
+	FileCount        int      `json:"file_count" gorm:"comment:文件数"`
+	TotalBytes       int64    `json:"total_bytes" gorm:"comment:文件总大小"`
+}
+
+// BaselineFile 基线清单中的单个文件
+type BaselineFile struct {
+	ID         uint   `json:"-" gorm:"primarykey"`
+	BaselineID uint   `json:"-" gorm:"index;comment:基线ID"`
+	Path       string `json:"path" gorm:"comment:相对路径，使用/分隔"`
+	Size       int64  `json:"size" gorm:"comment:文件大小"`
+	SHA256     string `json:"sha256" gorm:"comment:SHA-256"`
+	MD5        string `json:"md5,omitempty" gorm:"comment:MD5"`
+}
+
+// BaselineFileListParams 基线文件列表查询参数
+type BaselineFileListParams struct {
+	Keyword string `json:"keyword" form:"keyword"`
+	Page    int    `json:"page" form:"page"`
+	Size    int    `json:"size" form:"size"`
+}
+
+// BaselineFileListResult 基线文件列表返回结果
+type BaselineFileListResult struct {
+	Files []BaselineFile `json:"files"`
+	Total int64          `json:"total"`
+	Page  int            `json:"page"`
+	Size  int            `json:"size"`
+}
+
+// CreateBaseline 创建基线及其文件清单
+func CreateBaseline(baseline *Baseline, files []BaselineFile) error {
+	baseline.FileCount = len(files)
+	baseline.TotalBytes = 0
+	for _, file := range files {
+		baseline.TotalBytes += file.Size
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(baseline).Error; err != nil {
+			logger.Errorf("创建基线失败: %v", err)
+			return err
+		}
+
+		for i := range files {
+			files[i].ID = 0
+			files[i].BaselineID = baseline.ID
+		}
+		if len(files) > 0 {
+			if err := tx.CreateInBatches(files, 500).Error; err != nil {
+				logger.Errorf("保存基线文件清单失败: 基线=%d, 错误=%v", baseline.ID, err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetBaseline 获取基线
+func GetBaseline(id int) (*Baseline, error) {
+	var item Baseline
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取基线失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetBaselineByName 获取分组中指定名称的基线
+func GetBaselineByName(groupID int, name string) (*Baseline, error) {
+	var item Baseline
+	if err := DB.Where("group_id = ? AND name = ?", groupID, name).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// ListBaselinesByGroup 获取分组的基线列表
+func ListBaselinesByGroup(groupID int) ([]Baseline, error) {
+	var items []Baseline
+	if err := DB.Where("group_id = ?", groupID).Order("id DESC").Find(&items).Error; err != nil {
+		logger.Errorf("获取基线列表失败: 分组=%d, 错误=%v", groupID, err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListBaselineFiles 获取基线的全部文件清单
+func ListBaselineFiles(baselineID uint) ([]BaselineFile, error) {
+	var items []BaselineFile
+	if err := DB.Where("baseline_id = ?", baselineID).Order("path").Find(&items).Error; err != nil {
+		logger.Errorf("获取基线文件清单失败: 基线=%d, 错误=%v", baselineID, err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetBaselineFileList 分页获取基线文件清单
+func GetBaselineFileList(baselineID uint, params *BaselineFileListParams) (*BaselineFileListResult, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 {
+		params.Size = 100
+	}
+
+	query := DB.Model(&BaselineFile{}).Where("baseline_id = ?", baselineID)
+	if params.Keyword != "" {
+		query = query.Where("path LIKE ?", "%"+params.Keyword+"%")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("获取基线文件总数失败: %v", err)
+		return nil, err
+	}
+
+	var items []BaselineFile
+	offset := (params.Page - 1) * params.Size
+	if err := query.Order("path").Offset(offset).Limit(params.Size).Find(&items).Error; err != nil {
+		logger.Errorf("获取基线文件列表失败: %v", err)
+		return nil, err
+	}
+
+	return &BaselineFileListResult{
+		Files: items,
+		Total: total,
+		Page:  params.Page,
+		Size:  params.Size,
+	}, nil
+}
+
+// DeleteBaseline 删除基线及其文件清单
+func DeleteBaseline(id uint) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("baseline_id = ?", id).Delete(&BaselineFile{}).Error; err != nil {
+			logger.Errorf("删除基线文件清单失败: 基线=%d, 错误=%v", id, err)
+			return err
+		}
+		if err := tx.Delete(&Baseline{}, id).Error; err != nil {
+			logger.Errorf("删除基线失败: ID=%d, 错误=%v", id, err)
+			return err
+		}
+		return nil
+	})
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"time"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// 控制会话关闭原因
+const (
+	CloseReasonClient      = "client_closed" // 浏览器主动断开
+	CloseReasonIdle        = "idle_timeout"  // 无输入超时
+	CloseReasonMaxDuration = "max_duration"  // 超过最长会话时长
+	CloseReasonAgentLost   = "agent_lost"    // 与Agent的连接断开且重连失败
+	CloseReasonShareEnded  = "share_ended"   // 分享链接到期或被撤销
+)
+
+// ControlSession 控制会话记录
+type ControlSession struct {
+	gorm.Model
+	InstanceID  int        `json:"instance_id" gorm:"index;comment:设备ID"`
+	ClientID    string     `json:"client_id" gorm:"comment:控制连接ID"`
+	RemoteAddr  string     `json:"remote_addr" gorm:"comment:客户端地址"`
+	Admin       bool       `json:"admin" gorm:"comment:是否管理员连接"`
+	ShareLinkID *uint      `json:"share_link_id" gorm:"comment:分享链接ID，为空表示非分享访问"`
+	StartedAt   time.Time  `json:"started_at" gorm:"comment:开始时间"`
+	EndedAt     *time.Time `json:"ended_at" gorm:"comment:结束时间"`
+	CloseReason string     `json:"close_reason" gorm:"comment:关闭原因"`
+}
+
+// CreateControlSession 创建控制会话记录
+func CreateControlSession(item *ControlSession) error {
+	if err := DB.Create(item).Error; err != nil {
+		logger.Errorf("创建控制会话记录失败: 实例=%d, 错误=%v", item.InstanceID, err)
+		return err
+	}
+	return nil
+}
+
+// CloseControlSession 记录控制会话结束时间和关闭原因
+func CloseControlSession(id uint, reason string) error {
+	now := time.Now()
+	err := DB.Model(&ControlSession{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"ended_at":     &now,
+		"close_reason": reason,
+	}).Error
+	if err != nil {
+		logger.Errorf("更新控制会话记录失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+
+	logger.Infof("控制会话已结束: ID=%d, 原因=%s", id, reason)
+
+	return nil
+}
+
+// ListControlSessions 获取设备最近的控制会话记录
+func ListControlSessions(instanceID int, limit int) ([]ControlSession, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	var items []ControlSession
+	if err := DB.Where("instance_id = ?", instanceID).Order("started_at DESC").Limit(limit).Find(&items).Error; err != nil {
+		logger.Errorf("获取控制会话记录失败: 实例=%d, 错误=%v", instanceID, err)
+		return nil, err
+	}
+
+	return items, nil
+}
@@ -0,0 +1,254 @@
+package models
+
+import (
+	"time"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// 分发任务状态
+const (
+	DistributionStatusRunning   = "running"   // 分发中
+	DistributionStatusCompleted = "completed" // 已完成
+	DistributionStatusCancelled = "cancelled" // 已取消
+)
+
+// 单台设备的分发结果状态
+const (
+	DistributionResultPending   = "pending"   // 等待分发
+	DistributionResultRunning   = "running"   // 正在拉取
+	DistributionResultSuccess   = "success"   // 已下载并校验
+	DistributionResultUnchanged = "unchanged" // 目标文件内容相同，无需下载
+	DistributionResultSkipped   = "skipped"   // 目标文件已存在，按策略跳过
+	DistributionResultFailed    = "failed"    // 失败
+	DistributionResultCancelled = "cancelled" // 任务取消，未执行
+)
+
+// 目标文件已存在时的处理策略
+const (
+	OverwriteAlways = "overwrite" // 覆盖
+	OverwriteSkip   = "skip"      // 跳过
+	OverwriteFail   = "fail"      // 报错
+)
+
+// DistributionJob 文件分发任务
+type DistributionJob struct {
+	gorm.Model
+	ArtifactID   uint       `json:"artifact_id" gorm:"index;comment:分发文件ID"`
+	ArtifactName string     `json:"artifact_name" gorm:"comment:分发文件名"`
+	GroupID      *int       `json:"group_id" gorm:"comment:目标分组ID，按设备选择时为空"`
+	TargetDir    string     `json:"target_dir" gorm:"comment:目标目录"`
+	Filename     string     `json:"filename" gorm:"comment:保存的文件名"`
+	Overwrite    string     `json:"overwrite" gorm:"comment:目标已存在时的策略"`
+	Concurrency  int        `json:"concurrency" gorm:"comment:并发设备数"`
+	Status       string     `json:"status" gorm:"index;comment:任务状态"`
+	Total        int        `json:"total" gorm:"comment:设备总数"`
+	Succeeded    int        `json:"succeeded" gorm:"comment:成功数(含内容相同)"`
+	Skipped      int        `json:"skipped" gorm:"comment:跳过数"`
+	Failed       int        `json:"failed" gorm:"comment:失败数"`
+	StartedAt    time.Time  `json:"started_at" gorm:"comment:开始时间"`
+	FinishedAt   *time.Time `json:"finished_at" gorm:"comment:结束时间"`
+}
+
+// DistributionResult 单台设备的分发结果
+type DistributionResult struct {
+	ID         uint       `json:"id" gorm:"primarykey"`
+	JobID      uint       `json:"job_id" gorm:"index;comment:分发任务ID"`
+	InstanceID int        `json:"instance_id" gorm:"index;comment:设备ID"`
+	Hostname   string     `json:"hostname" gorm:"comment:设备主机名"`
+	Lan        string     `json:"lan" gorm:"comment:设备内网IP"`
+	Status     string     `json:"status" gorm:"comment:分发状态"`
+	Path       string     `json:"path" gorm:"comment:设备上的文件路径"`
+	Bytes      int64      `json:"bytes" gorm:"comment:实际下载字节数"`
+	Error      string     `json:"error" gorm:"comment:错误信息"`
+	StartedAt  *time.Time `json:"started_at" gorm:"comment:开始时间"`
+	FinishedAt *time.Time `json:"finished_at" gorm:"comment:结束时间"`
+	DurationMs int64      `json:"duration_ms" gorm:"comment:耗时(毫秒)"`
+}
+
+// DistributionListParams 分发任务列表查询参数
+type DistributionListParams struct {
+	ArtifactID int    `json:"artifact_id" form:"artifact_id"`
+	Status     string `json:"status" form:"status"`
+	Page       int    `json:"page" form:"page"`
+	Size       int    `json:"size" form:"size"`
+}
+
+// DistributionListResult 分发任务列表返回结果
+type DistributionListResult struct {
+	Jobs  []DistributionJob `json:"jobs"`
+	Total int64             `json:"total"`
+	Page  int               `json:"page"`
+	Size  int               `json:"size"`
+}
+
+// CreateDistributionJob 创建分发任务及每台设备的待分发记录
+func CreateDistributionJob(job *DistributionJob, instances []Instance) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(job).Error; err != nil {
+			logger.Errorf("创建分发任务失败: %v", err)
+			return err
+		}
+
+		results := make([]DistributionResult, 0, len(instances))
+		for _, instance := range instances {
+			results = append(results, DistributionResult{
+				JobID:      job.ID,
+				InstanceID: int(instance.ID),
+				Hostname:   instance.Hostname,
+				Lan:        instance.Lan,
+				Status:     DistributionResultPending,
+			})
+		}
+		if len(results) > 0 {
+			if err := tx.CreateInBatches(results, 100).Error; err != nil {
+				logger.Errorf("创建分发记录失败: 任务=%d, 错误=%v", job.ID, err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetDistributionJob 获取分发任务
+func GetDistributionJob(id int) (*DistributionJob, error) {
+	var item DistributionJob
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取分发任务失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetDistributionJobList 获取分发任务列表
+func GetDistributionJobList(params *DistributionListParams) (*DistributionListResult, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 {
+		params.Size = 20
+	}
+
+	query := DB.Model(&DistributionJob{})
+	if params.ArtifactID > 0 {
+		query = query.Where("artifact_id = ?", params.ArtifactID)
+	}
+	if params.Status != "" {
+		query = query.Where("status = ?", params.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("获取分发任务总数失败: %v", err)
+		return nil, err
+	}
+
+	var items []DistributionJob
+	offset := (params.Page - 1) * params.Size
+	if err := query.Order("id DESC").Offset(offset).Limit(params.Size).Find(&items).Error; err != nil {
+		logger.Errorf("获取分发任务列表失败: %v", err)
+		return nil, err
+	}
+
+	return &DistributionListResult{
+		Jobs:  items,
+		Total: total,
+		Page:  params.Page,
+		Size:  params.Size,
+	}, nil
+}
+
+// ListRunningDistributionJobs 获取进行中的分发任务
+func ListRunningDistributionJobs() ([]DistributionJob, error) {
+	var items []DistributionJob
+	if err := DB.Where("status = ?", DistributionStatusRunning).Find(&items).Error; err != nil {
+		logger.Errorf("获取进行中的分发任务失败: %v", err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// CountRunningDistributionJobsByArtifact 统计使用指定文件且进行中的分发任务数
+func CountRunningDistributionJobsByArtifact(artifactID uint) (int64, error) {
+	var count int64
+	err := DB.Model(&DistributionJob{}).
+		Where("artifact_id = ? AND status = ?", artifactID, DistributionStatusRunning).
+		Count(&count).Error
+	if err != nil {
+		logger.Errorf("统计分发任务失败: 文件=%d, 错误=%v", artifactID, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// UpdateDistributionJob 更新分发任务
+func UpdateDistributionJob(id uint, data map[string]interface{}) error {
+	if err := DB.Model(&DistributionJob{}).Where("id = ?", id).Updates(data).Error; err != nil {
+		logger.Errorf("更新分发任务失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+	return nil
+}
+
+// ListDistributionResults 获取分发任务的设备结果，status为空时返回全部
+func ListDistributionResults(jobID uint, status string) ([]DistributionResult, error) {
+	var items []DistributionResult
+	query := DB.Where("job_id = ?", jobID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("id").Find(&items).Error; err != nil {
+		logger.Errorf("获取分发结果失败: 任务=%d, 错误=%v", jobID, err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// UpdateDistributionResult 更新单台设备的分发结果
+func UpdateDistributionResult(id uint, data map[string]interface{}) error {
+	if err := DB.Model(&DistributionResult{}).Where("id = ?", id).Updates(data).Error; err != nil {
+		logger.Errorf("更新分发结果失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+	return nil
+}
+
+// ResetDistributionResults 将指定状态的设备结果重置为待分发，返回重置的数量
+func ResetDistributionResults(jobID uint, statuses []string) (int64, error) {
+	result := DB.Model(&DistributionResult{}).
+		Where("job_id = ? AND status IN ?", jobID, statuses).
+		Updates(map[string]interface{}{
+			"status":      DistributionResultPending,
+			"error":       "",
+			"bytes":       0,
+			"started_at":  nil,
+			"finished_at": nil,
+			"duration_ms": 0,
+		})
+	if result.Error != nil {
+		logger.Errorf("重置分发结果失败: 任务=%d, 错误=%v", jobID, result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// CountDistributionResults 按状态统计分发任务的设备结果
+func CountDistributionResults(jobID uint) (map[string]int, error) {
+	var rows []struct {
+		Status string
+		Count  int
+	}
+	err := DB.Model(&DistributionResult{}).Select("status, COUNT(*) AS count").
+		Where("job_id = ?", jobID).Group("status").Scan(&rows).Error
+	if err != nil {
+		logger.Errorf("统计分发结果失败: 任务=%d, 错误=%v", jobID, err)
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// 注册申请状态
+const (
+	EnrollmentPending  = "pending"  // 等待审批
+	EnrollmentApproved = "approved" // 已批准，等待Agent完成注册
+	EnrollmentRejected = "rejected" // 已拒绝
+	EnrollmentEnrolled = "enrolled" // Agent已完成注册
+)
+
+// ErrEnrollmentTokenUnusable 注册令牌已撤销、过期或已达到使用次数上限
+var ErrEnrollmentTokenUnusable = errors.New("注册令牌已失效")
+
+// EnrollmentToken 管理员签发的Agent注册令牌，令牌本身不落库，仅保存哈希用于校验
+type EnrollmentToken struct {
+	gorm.Model
+	Name       string     `json:"name" gorm:"comment:令牌名称"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;comment:令牌哈希"`
+	Prefix     string     `json:"prefix" gorm:"comment:令牌前缀，用于识别令牌"`
+	GroupID    *int       `json:"group_id" gorm:"comment:使用该令牌注册的设备所在分组"`
+	ExpiresAt  *time.Time `json:"expires_at" gorm:"comment:过期时间，为空表示不过期"`
+	MaxUses    int        `json:"max_uses" gorm:"comment:最多注册设备数，0表示不限制"`
+	Uses       int        `json:"uses" gorm:"comment:已注册设备数"`
+	LastUsedAt *time.Time `json:"last_used_at" gorm:"comment:最近使用时间"`
+	RevokedAt  *time.Time `json:"revoked_at" gorm:"comment:撤销时间"`
+}
+
+// IsActive 注册令牌是否仍可使用
+func (t *EnrollmentToken) IsActive() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	if t.ExpiresAt != nil && !time.Now().Before(*t.ExpiresAt) {
+		return false
+	}
+	return t.MaxUses <= 0 || t.Uses < t.MaxUses
+}
+
+// EnrollmentRequest 没有注册令牌的Agent提交的注册申请，管理员批准后Agent才能完成注册
+type EnrollmentRequest struct {
+	gorm.Model
+	Uuid       string     `json:"uuid" gorm:"uniqueIndex;comment:设备唯一标识"`
+	KeyHash    string     `json:"-" gorm:"comment:审批凭据哈希，Agent凭它完成注册"`
+	Status     string     `json:"status" gorm:"index;comment:状态(pending/approved/rejected/enrolled)"`
+	Hostname   string     `json:"hostname" gorm:"comment:主机名"`
+	Lan        string     `json:"lan" gorm:"comment:内网IP"`
+	Wan        string     `json:"wan" gorm:"comment:外网IP"`
+	Mac        string     `json:"mac" gorm:"comment:MAC地址"`
+	OS         string     `json:"os" gorm:"comment:操作系统"`
+	Username   string     `json:"username" gorm:"comment:用户名"`
+	Version    string     `json:"version" gorm:"comment:Agent版本"`
+	GroupID    *int       `json:"group_id" gorm:"comment:批准时指定的分组"`
+	Note       string     `json:"note" gorm:"comment:审批备注"`
+	LastSeenAt *time.Time `json:"last_seen_at" gorm:"comment:Agent最近一次提交申请的时间"`
+	ReviewedAt *time.Time `json:"reviewed_at" gorm:"comment:审批时间"`
+	InstanceID uint       `json:"instance_id" gorm:"comment:完成注册后的设备ID"`
+}
+
+// CreateEnrollmentToken 创建注册令牌
+func CreateEnrollmentToken(item *EnrollmentToken) error {
+	if err := DB.Create(item).Error; err != nil {
+		logger.Errorf("创建注册令牌失败: 名称=%s, 错误=%v", item.Name, err)
+		return err
+	}
+
+	logger.Infof("创建注册令牌成功: ID=%d, 名称=%s, 分组=%v, 次数上限=%d", item.ID, item.Name, item.GroupID, item.MaxUses)
+
+	return nil
+}
+
+// GetEnrollmentToken 获取注册令牌
+func GetEnrollmentToken(id int) (*EnrollmentToken, error) {
+	var item EnrollmentToken
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取注册令牌失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// GetEnrollmentTokenByHash 根据令牌哈希获取注册令牌
+func GetEnrollmentTokenByHash(hash string) (*EnrollmentToken, error) {
+	var item EnrollmentToken
+	if err := DB.Where("token_hash = ?", hash).First(&item).Error; err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// ListEnrollmentTokens 获取注册令牌列表
+func ListEnrollmentTokens() ([]EnrollmentToken, error) {
+	var items []EnrollmentToken
+	if err := DB.Order("created_at DESC").Find(&items).Error; err != nil {
+		logger.Errorf("获取注册令牌列表失败: %v", err)
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// useEnrollmentToken 在注册设备的事务中使用一次注册令牌，令牌已失效时返回ErrEnrollmentTokenUnusable
+// 次数在同一条UPDATE中检查并增加，并发注册不会超过次数上限
+func useEnrollmentToken(tx *gorm.DB, id uint) error {
+	now := time.Now()
+	result := tx.Model(&EnrollmentToken{}).
+		Where("id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?) AND (max_uses <= 0 OR uses < max_uses)", id, now).
+		Updates(map[string]interface{}{
+			"uses":         gorm.Expr("uses + 1"),
+			"last_used_at": &now,
+		})
+	if result.Error != nil {
+		logger.Errorf("使用注册令牌失败: ID=%d, 错误=%v", id, result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrEnrollmentTokenUnusable
+	}
+
+	return nil
+}
+
+// RevokeEnrollmentToken 撤销注册令牌，已注册的设备不受影响
+func RevokeEnrollmentToken(id int) error {
+	now := time.Now()
+	if err := DB.Model(&EnrollmentToken{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", &now).Error; err != nil {
+		logger.Errorf("撤销注册令牌失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+
+	logger.Infof("撤销注册令牌成功: ID=%d", id)
+
+	return nil
+}
+
+// GetEnrollmentRequest 获取注册申请
+func GetEnrollmentRequest(id int) (*EnrollmentRequest, error) {
+	var item EnrollmentRequest
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取注册申请失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// GetEnrollmentRequestByUuid 根据设备UUID获取注册申请
+func GetEnrollmentRequestByUuid(uuid string) (*EnrollmentRequest, error) {
+	var item EnrollmentRequest
+	if err := DB.Where("uuid = ?", uuid).First(&item).Error; err != nil {
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// ListEnrollmentRequests 获取注册申请列表，status为空时返回全部
+func ListEnrollmentRequests(status string) ([]EnrollmentRequest, error) {
+	var items []EnrollmentRequest
+	query := DB.Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&items).Error; err != nil {
+		logger.Errorf("获取注册申请列表失败: %v", err)
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// SaveEnrollmentRequest 创建或更新注册申请
+func SaveEnrollmentRequest(item *EnrollmentRequest) error {
+	if err := DB.Save(item).Error; err != nil {
+		logger.Errorf("保存注册申请失败: UUID=%s, 错误=%v", item.Uuid, err)
+		return err
+	}
+
+	return nil
+}
+
+// ReviewEnrollmentRequest 批准或拒绝注册申请，只能审批等待中的申请，已批准的申请可以改为拒绝
+func ReviewEnrollmentRequest(id int, status string, groupID *int, note string) (*EnrollmentRequest, error) {
+	item, err := GetEnrollmentRequest(id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Status != EnrollmentPending && !(item.Status == EnrollmentApproved && status == EnrollmentRejected) {
+		return nil, fmt.Errorf("注册申请当前状态为%s，不能审批", item.Status)
+	}
+
+	now := time.Now()
+	item.Status = status
+	item.GroupID = groupID
+	item.Note = note
+	item.ReviewedAt = &now
+	if err := DB.Save(item).Error; err != nil {
+		logger.Errorf("审批注册申请失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+
+	logger.Infof("审批注册申请: ID=%d, UUID=%s, 主机名=%s, 结果=%s", item.ID, item.Uuid, item.Hostname, status)
+
+	return item, nil
+}
+
+// ResetEnrollmentRequest 重置注册申请为等待审批，作废审批凭据和审批结果
+func ResetEnrollmentRequest(id int) (*EnrollmentRequest, error) {
+	item, err := GetEnrollmentRequest(id)
+	if err != nil {
+		return nil, err
+	}
+
+	item.Status = EnrollmentPending
+	item.KeyHash = ""
+	item.GroupID = nil
+	item.Note = ""
+	item.ReviewedAt = nil
+	item.InstanceID = 0
+	if err := DB.Save(item).Error; err != nil {
+		logger.Errorf("重置注册申请失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+
+	logger.Infof("重置注册申请: ID=%d, UUID=%s", item.ID, item.Uuid)
+
+	return item, nil
+}
+
+// CompleteEnrollmentRequest Agent凭批准的申请完成注册
+func CompleteEnrollmentRequest(id uint, instanceID uint) error {
+	if err := DB.Model(&EnrollmentRequest{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      EnrollmentEnrolled,
+		"instance_id": instanceID,
+	}).Error; err != nil {
+		logger.Errorf("更新注册申请状态失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+
+	return nil
+}
+
+// DeleteEnrollmentRequest 删除注册申请，被拒绝的设备删除申请后可以重新申请
+func DeleteEnrollmentRequest(id int) error {
+	if err := DB.Unscoped().Delete(&EnrollmentRequest{}, id).Error; err != nil {
+		logger.Errorf("删除注册申请失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+
+	logger.Infof("删除注册申请成功: ID=%d", id)
+
+	return nil
+}
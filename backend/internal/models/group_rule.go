@@ -0,0 +1,188 @@
+package models
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// GroupRule 设备自动分组规则，新设备注册时按优先级依次匹配，第一条匹配的规则决定分组
+// 同一条规则中填写的条件需全部满足，列表类条件满足其中一项即可
+type GroupRule struct {
+	gorm.Model
+	Name            string   `json:"name" gorm:"comment:规则名称"`
+	Priority        int      `json:"priority" gorm:"index;comment:优先级，越小越先匹配"`
+	Enabled         bool     `json:"enabled" gorm:"comment:是否启用"`
+	GroupID         int      `json:"group_id" gorm:"comment:匹配后分配的分组ID"`
+	HostnamePattern string   `json:"hostname_pattern" gorm:"comment:主机名正则表达式"`
+	LanCIDRs        []string `json:"lan_cidrs" gorm:"serializer:json;comment:内网IP所在网段"`
+	OS              []string `json:"os" gorm:"serializer:json;comment:操作系统，不区分大小写"`
+	Usernames       []string `json:"usernames" gorm:"serializer:json;comment:用户名，不区分大小写"`
+	Uuids           []string `json:"uuids" gorm:"serializer:json;comment:设备UUID列表"`
+}
+
+// Validate 检查规则条件，至少需要一个条件
+func (r *GroupRule) Validate() error {
+	if r.HostnamePattern == "" && len(r.LanCIDRs) == 0 && len(r.OS) == 0 && len(r.Usernames) == 0 && len(r.Uuids) == 0 {
+		return fmt.Errorf("规则至少需要一个匹配条件")
+	}
+	if r.HostnamePattern != "" {
+		if _, err := regexp.Compile(r.HostnamePattern); err != nil {
+			return fmt.Errorf("主机名正则表达式无效: %v", err)
+		}
+	}
+	for _, cidr := range r.LanCIDRs {
+		if parseRuleNetwork(cidr) == nil {
+			return fmt.Errorf("网段格式错误: %s", cidr)
+		}
+	}
+	return nil
+}
+
+// Matches 设备是否满足规则的全部条件
+func (r *GroupRule) Matches(instance *Instance) bool {
+	if r.HostnamePattern != "" {
+		re, err := regexp.Compile(r.HostnamePattern)
+		if err != nil || !re.MatchString(instance.Hostname) {
+			return false
+		}
+	}
+	if len(r.LanCIDRs) > 0 {
+		ip := net.ParseIP(instance.Lan)
+		if ip == nil {
+			return false
+		}
+		matched := false
+		for _, cidr := range r.LanCIDRs {
+			if network := parseRuleNetwork(cidr); network != nil && network.Contains(ip) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(r.OS) > 0 && !containsFold(r.OS, instance.OS) {
+		return false
+	}
+	if len(r.Usernames) > 0 && !containsFold(r.Usernames, instance.Username) {
+		return false
+	}
+	if len(r.Uuids) > 0 && !containsFold(r.Uuids, instance.Uuid) {
+		return false
+	}
+	return true
+}
+
+// parseRuleNetwork 解析网段，单个IP视为只包含该地址的网段
+func parseRuleNetwork(cidr string) *net.IPNet {
+	cidr = strings.TrimSpace(cidr)
+	if _, network, err := net.ParseCIDR(cidr); err == nil {
+		return network
+	}
+	ip := net.ParseIP(cidr)
+	if ip == nil {
+		return nil
+	}
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+}
+
+// containsFold 不区分大小写判断列表是否包含value
+func containsFold(list []string, value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, item := range list {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateGroupRule 创建自动分组规则
+func CreateGroupRule(rule *GroupRule) error {
+	if err := DB.Create(rule).Error; err != nil {
+		logger.Errorf("创建自动分组规则失败: 名称=%s, 错误=%v", rule.Name, err)
+		return err
+	}
+
+	logger.Infof("创建自动分组规则成功: ID=%d, 名称=%s, 分组=%d", rule.ID, rule.Name, rule.GroupID)
+
+	return nil
+}
+
+// GetGroupRule 获取自动分组规则
+func GetGroupRule(id int) (*GroupRule, error) {
+	var rule GroupRule
+	if err := DB.First(&rule, id).Error; err != nil {
+		logger.Errorf("获取自动分组规则失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+// ListGroupRules 按匹配顺序获取自动分组规则列表
+func ListGroupRules(enabledOnly bool) ([]GroupRule, error) {
+	var rules []GroupRule
+	query := DB.Order("priority, id")
+	if enabledOnly {
+		query = query.Where("enabled = ?", true)
+	}
+	if err := query.Find(&rules).Error; err != nil {
+		logger.Errorf("获取自动分组规则列表失败: %v", err)
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+// SaveGroupRule 更新自动分组规则
+func SaveGroupRule(rule *GroupRule) error {
+	if err := DB.Save(rule).Error; err != nil {
+		logger.Errorf("更新自动分组规则失败: ID=%d, 错误=%v", rule.ID, err)
+		return err
+	}
+
+	logger.Infof("更新自动分组规则成功: ID=%d, 名称=%s", rule.ID, rule.Name)
+
+	return nil
+}
+
+// DeleteGroupRule 删除自动分组规则
+func DeleteGroupRule(id int) error {
+	if err := DB.Delete(&GroupRule{}, id).Error; err != nil {
+		logger.Errorf("删除自动分组规则失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+
+	logger.Infof("删除自动分组规则成功: ID=%d", id)
+
+	return nil
+}
+
+// MatchGroupRule 按顺序返回设备匹配的第一条规则，规则的分组已不存在时跳过，没有匹配时返回nil
+func MatchGroupRule(rules []GroupRule, instance *Instance) *GroupRule {
+	for i := range rules {
+		if !rules[i].Matches(instance) {
+			continue
+		}
+		if _, err := GetGroup(rules[i].GroupID); err != nil {
+			logger.Warnf("自动分组规则的分组不存在，跳过: 规则=%d, 分组=%d", rules[i].ID, rules[i].GroupID)
+			continue
+		}
+		return &rules[i]
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 	"winmanager-backend/internal/logger"
 
@@ -27,6 +28,34 @@ type Instance struct {
 	WatchdogVersion string     `json:"watchdog_version" gorm:"comment:Watchdog版本"`
 	LastHeartbeatAt *time.Time `json:"last_heartbeat_at" gorm:"comment:最后心跳时间"`
 
+	// Agent当前连接的后端，配置了多个后端时可能切换到其他后端
+	ServerURL  string     `json:"server_url" gorm:"comment:Agent当前连接的后端地址"`
+	AttachedAt *time.Time `json:"attached_at" gorm:"comment:连接到该后端的时间"`
+
+	// 注册准入：后端签发给Agent的密钥（仅保存哈希），重新注册时凭它证明是同一个Agent
+	AgentSecretHash   string     `json:"-" gorm:"comment:Agent密钥哈希"`
+	EnrollmentTokenID *uint      `json:"enrollment_token_id" gorm:"comment:首次注册使用的注册令牌"`
+	EnrolledAt        *time.Time `json:"enrolled_at" gorm:"comment:通过令牌或审批完成注册的时间"`
+
+	// 最近一次自动更新的结果，由Agent在心跳中上报
+	UpdateVersion string `json:"update_version" gorm:"comment:最近更新的目标版本"`
+	UpdateStatus  string `json:"update_status" gorm:"comment:最近更新的状态"`
+	UpdateError   string `json:"update_error" gorm:"comment:最近更新的错误信息"`
+
+	// Agent已应用的集中配置版本，与生效配置的版本不一致时表示配置漂移
+	ConfigVersion   string     `json:"config_version" gorm:"comment:已应用的集中配置版本"`
+	ConfigError     string     `json:"config_error" gorm:"comment:应用集中配置的错误信息"`
+	ConfigAppliedAt *time.Time `json:"config_applied_at" gorm:"comment:集中配置应用时间"`
+
+	// 当前使用的代理及最近一次连通性检查结果，由Agent上报
+	ProxyEnabled   bool       `json:"proxy_enabled" gorm:"comment:是否使用代理"`
+	ProxyURL       string     `json:"proxy_url" gorm:"comment:代理地址(隐藏密码)"`
+	ProxyOK        bool       `json:"proxy_ok" gorm:"comment:代理是否可用"`
+	ProxyLatency   int64      `json:"proxy_latency" gorm:"comment:代理延迟(毫秒)"`
+	ProxyExitIP    string     `json:"proxy_exit_ip" gorm:"comment:代理出口IP"`
+	ProxyError     string     `json:"proxy_error" gorm:"comment:代理检查错误信息"`
+	ProxyCheckedAt *time.Time `json:"proxy_checked_at" gorm:"comment:代理检查时间"`
+
 	// 物理机地址
 	BmIp string `json:"bm_ip" gorm:"comment:物理机地址"`
 
@@ -38,7 +67,12 @@ type Instance struct {
 
 // CreateOrUpdateInstance 创建或更新实例
 func CreateOrUpdateInstance(instance Instance) (uint, error) {
-	result := DB.Where(Instance{Lan: instance.Lan}).Assign(instance).FirstOrCreate(&instance)
+	return createOrUpdateInstance(DB, instance)
+}
+
+// createOrUpdateInstance 在tx中按LAN地址创建或更新实例
+func createOrUpdateInstance(tx *gorm.DB, instance Instance) (uint, error) {
+	result := tx.Where(Instance{Lan: instance.Lan}).Assign(instance).FirstOrCreate(&instance)
 	if result.Error != nil {
 		logger.Errorf("创建或更新实例失败: %v", result.Error)
 		return 0, result.Error
@@ -49,6 +83,67 @@ func CreateOrUpdateInstance(instance Instance) (uint, error) {
 	return instance.ID, nil
 }
 
+// ErrInstanceProtected LAN地址相同的设备已绑定Agent密钥，未证明身份的Agent不能覆盖它
+var ErrInstanceProtected = errors.New("该LAN地址的设备已绑定Agent密钥")
+
+// RegisterInstance 注册设备：Agent沿用本地保存的实例ID且设备UUID一致时更新该实例，
+// 否则按LAN地址创建或更新，LAN地址相同的设备已绑定Agent密钥时返回ErrInstanceProtected。
+// 使用注册令牌时在同一事务中使用一次令牌，注册失败不消耗令牌次数
+func RegisterInstance(instance Instance, knownID uint) (uint, error) {
+	var id uint
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if instance.EnrollmentTokenID != nil {
+			if err := useEnrollmentToken(tx, *instance.EnrollmentTokenID); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		id, err = registerInstance(tx, instance, knownID)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// registerInstance 在tx中按实例ID或LAN地址注册设备
+func registerInstance(tx *gorm.DB, instance Instance, knownID uint) (uint, error) {
+	if knownID > 0 {
+		var existing Instance
+		err := tx.First(&existing, knownID).Error
+		switch {
+		case err == nil && (existing.Uuid == "" || instance.Uuid == "" || existing.Uuid == instance.Uuid):
+			if err := tx.Model(&existing).Updates(instance).Error; err != nil {
+				logger.Errorf("更新实例失败: ID=%d, 错误=%v", knownID, err)
+				return 0, err
+			}
+			logger.Infof("实例重新注册成功: ID=%d, LAN=%s", existing.ID, instance.Lan)
+			return existing.ID, nil
+		case err == nil:
+			logger.Warnf("实例ID与设备UUID不一致，按LAN地址注册: ID=%d, UUID=%s", knownID, instance.Uuid)
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			logger.Warnf("Agent保存的实例已不存在，按LAN地址注册: ID=%d", knownID)
+		default:
+			logger.Errorf("查找实例失败: ID=%d, 错误=%v", knownID, err)
+			return 0, err
+		}
+	}
+
+	var existing Instance
+	err := tx.Where("lan = ?", instance.Lan).First(&existing).Error
+	switch {
+	case err == nil && existing.AgentSecretHash != "":
+		logger.Warnf("LAN地址相同的设备已绑定Agent密钥，拒绝覆盖: ID=%d, LAN=%s, UUID=%s", existing.ID, instance.Lan, instance.Uuid)
+		return 0, ErrInstanceProtected
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+		logger.Errorf("查找实例失败: LAN=%s, 错误=%v", instance.Lan, err)
+		return 0, err
+	}
+	return createOrUpdateInstance(tx, instance)
+}
+
 // InstanceListParams 实例列表查询参数
 type InstanceListParams struct {
 	Page    int    `json:"page" form:"page"`         // 页码
@@ -183,6 +278,13 @@ func GetInstanceByLan(lan string) (*Instance, error) {
 	return &item, nil
 }
 
+// InstanceExistsByLan 是否已有该LAN IP的实例
+func InstanceExistsByLan(lan string) bool {
+	var count int64
+	DB.Model(&Instance{}).Where("lan = ?", lan).Count(&count)
+	return count > 0
+}
+
 // PatchInstance 更新实例
 func PatchInstance(id int, data map[string]interface{}) error {
 	var item Instance
@@ -227,6 +329,18 @@ func ListInstancesByGroupId(gid int) ([]Instance, error) {
 	return items, nil
 }
 
+// ListOnlineInstances 获取所有在线实例
+func ListOnlineInstances() ([]Instance, error) {
+	var items []Instance
+
+	if err := DB.Where("status = ?", 1).Find(&items).Error; err != nil {
+		logger.Errorf("获取在线实例失败: %v", err)
+		return nil, err
+	}
+
+	return items, nil
+}
+
 // CountInstanceByGroup 统计分组中的实例数量
 func CountInstanceByGroup(id int) (int, error) {
 	var count int64
@@ -0,0 +1,309 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// 完整性核对任务状态
+const (
+	IntegrityStatusRunning   = "running"   // 核对中
+	IntegrityStatusCompleted = "completed" // 已完成
+	IntegrityStatusCancelled = "cancelled" // 已取消
+)
+
+// 单台设备的核对结果状态
+const (
+	IntegrityResultPending   = "pending"   // 等待核对
+	IntegrityResultRunning   = "running"   // 正在计算哈希
+	IntegrityResultMatch     = "match"     // 与基线一致
+	IntegrityResultMismatch  = "mismatch"  // 存在差异
+	IntegrityResultFailed    = "failed"    // 失败
+	IntegrityResultCancelled = "cancelled" // 任务取消，未执行
+)
+
+// IntegrityCheck 基线完整性核对任务
+type IntegrityCheck struct {
+	gorm.Model
+	BaselineID   uint       `json:"baseline_id" gorm:"index;comment:基线ID"`
+	BaselineName string     `json:"baseline_name" gorm:"comment:基线名称"`
+	GroupID      int        `json:"group_id" gorm:"comment:分组ID"`
+	Root         string     `json:"root" gorm:"comment:核对的路径"`
+	Concurrency  int        `json:"concurrency" gorm:"comment:并发设备数"`
+	Status       string     `json:"status" gorm:"index;comment:任务状态"`
+	Total        int        `json:"total" gorm:"comment:设备总数"`
+	Matched      int        `json:"matched" gorm:"comment:一致的设备数"`
+	Mismatched   int        `json:"mismatched" gorm:"comment:存在差异的设备数"`
+	Failed       int        `json:"failed" gorm:"comment:失败数"`
+	StartedAt    time.Time  `json:"started_at" gorm:"comment:开始时间"`
+	FinishedAt   *time.Time `json:"finished_at" gorm:"comment:结束时间"`
+}
+
+// IntegrityChange 内容被修改的文件
+type IntegrityChange struct {
+	Path           string `json:"path"`
+	ExpectedSize   int64  `json:"expected_size"`
+	ActualSize     int64  `json:"actual_size"`
+	ExpectedSHA256 string `json:"expected_sha256"`
+	ActualSHA256   string `json:"actual_sha256"`
+}
+
+// IntegrityDiff 设备与基线的差异明细，各列表超过上限时截断
+type IntegrityDiff struct {
+	Added      []string          `json:"added"`
+	Removed    []string          `json:"removed"`
+	Modified   []IntegrityChange `json:"modified"`
+	Unreadable []string          `json:"unreadable"` // 设备上存在但无法读取的文件
+	Truncated  bool              `json:"truncated"`
+}
+
+// Value 以JSON保存差异明细
+func (d IntegrityDiff) Value() (driver.Value, error) {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan 读取JSON格式的差异明细
+func (d *IntegrityDiff) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(data), d)
+	case []byte:
+		return json.Unmarshal(data, d)
+	}
+	return errors.New("差异明细格式错误")
+}
+
+// IntegrityResult 单台设备的核对结果
+type IntegrityResult struct {
+	ID         uint           `json:"id" gorm:"primarykey"`
+	CheckID    uint           `json:"check_id" gorm:"index;comment:核对任务ID"`
+	InstanceID int            `json:"instance_id" gorm:"index;comment:设备ID"`
+	Hostname   string         `json:"hostname" gorm:"comment:设备主机名"`
+	Lan        string         `json:"lan" gorm:"comment:设备内网IP"`
+	Status     string         `json:"status" gorm:"comment:核对状态"`
+	Files      int            `json:"files" gorm:"comment:设备上的文件数"`
+	Added      int            `json:"added" gorm:"comment:新增文件数"`
+	Removed    int            `json:"removed" gorm:"comment:缺失文件数"`
+	Modified   int            `json:"modified" gorm:"comment:修改文件数"`
+	Unreadable int            `json:"unreadable" gorm:"comment:无法读取的文件数"`
+	Diff       *IntegrityDiff `json:"diff,omitempty" gorm:"type:text;comment:差异明细"`
+	Error      string         `json:"error" gorm:"comment:错误信息"`
+	StartedAt  *time.Time     `json:"started_at" gorm:"comment:开始时间"`
+	FinishedAt *time.Time     `json:"finished_at" gorm:"comment:结束时间"`
+	DurationMs int64          `json:"duration_ms" gorm:"comment:耗时(毫秒)"`
+}
+
+// IntegrityListParams 核对任务列表查询参数
+type IntegrityListParams struct {
+	BaselineID int    `json:"baseline_id" form:"baseline_id"`
+	GroupID    int    `json:"group_id" form:"group_id"`
+	Status     string `json:"status" form:"status"`
+	Page       int    `json:"page" form:"page"`
+	Size       int    `json:"size" form:"size"`
+}
+
+// IntegrityListResult 核对任务列表返回结果
+type IntegrityListResult struct {
+	Checks []IntegrityCheck `json:"checks"`
+	Total  int64            `json:"total"`
+	Page   int              `json:"page"`
+	Size   int              `json:"size"`
+}
+
+// CreateIntegrityCheck 创建核对任务及每台设备的待核对记录
+func CreateIntegrityCheck(check *IntegrityCheck, instances []Instance) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(check).Error; err != nil {
+			logger.Errorf("创建核对任务失败: %v", err)
+			return err
+		}
+
+		results := make([]IntegrityResult, 0, len(instances))
+		for _, instance := range instances {
+			results = append(results, IntegrityResult{
+				CheckID:    check.ID,
+				InstanceID: int(instance.ID),
+				Hostname:   instance.Hostname,
+				Lan:        instance.Lan,
+				Status:     IntegrityResultPending,
+			})
+		}
+		if len(results) > 0 {
+			if err := tx.CreateInBatches(results, 100).Error; err != nil {
+				logger.Errorf("创建核对记录失败: 任务=%d, 错误=%v", check.ID, err)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetIntegrityCheck 获取核对任务
+func GetIntegrityCheck(id int) (*IntegrityCheck, error) {
+	var item IntegrityCheck
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取核对任务失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetIntegrityCheckList 获取核对任务列表
+func GetIntegrityCheckList(params *IntegrityListParams) (*IntegrityListResult, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 {
+		params.Size = 20
+	}
+
+	query := DB.Model(&IntegrityCheck{})
+	if params.BaselineID > 0 {
+		query = query.Where("baseline_id = ?", params.BaselineID)
+	}
+	if params.GroupID > 0 {
+		query = query.Where("group_id = ?", params.GroupID)
+	}
+	if params.Status != "" {
+		query = query.Where("status = ?", params.Status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("获取核对任务总数失败: %v", err)
+		return nil, err
+	}
+
+	var items []IntegrityCheck
+	offset := (params.Page - 1) * params.Size
+	if err := query.Order("id DESC").Offset(offset).Limit(params.Size).Find(&items).Error; err != nil {
+		logger.Errorf("获取核对任务列表失败: %v", err)
+		return nil, err
+	}
+
+	return &IntegrityListResult{
+		Checks: items,
+		Total:  total,
+		Page:   params.Page,
+		Size:   params.Size,
+	}, nil
+}
+
+// ListRunningIntegrityChecks 获取进行中的核对任务
+func ListRunningIntegrityChecks() ([]IntegrityCheck, error) {
+	var items []IntegrityCheck
+	if err := DB.Where("status = ?", IntegrityStatusRunning).Find(&items).Error; err != nil {
+		logger.Errorf("获取进行中的核对任务失败: %v", err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// CountRunningIntegrityChecksByBaseline 统计使用指定基线且进行中的核对任务数
+func CountRunningIntegrityChecksByBaseline(baselineID uint) (int64, error) {
+	var count int64
+	err := DB.Model(&IntegrityCheck{}).
+		Where("baseline_id = ? AND status = ?", baselineID, IntegrityStatusRunning).
+		Count(&count).Error
+	if err != nil {
+		logger.Errorf("统计核对任务失败: 基线=%d, 错误=%v", baselineID, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// UpdateIntegrityCheck 更新核对任务
+func UpdateIntegrityCheck(id uint, data map[string]interface{}) error {
+	if err := DB.Model(&IntegrityCheck{}).Where("id = ?", id).Updates(data).Error; err != nil {
+		logger.Errorf("更新核对任务失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+	return nil
+}
+
+// ListIntegrityResults 获取核对任务的设备结果，status为空时返回全部
+func ListIntegrityResults(checkID uint, status string) ([]IntegrityResult, error) {
+	var items []IntegrityResult
+	query := DB.Where("check_id = ?", checkID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("id").Find(&items).Error; err != nil {
+		logger.Errorf("获取核对结果失败: 任务=%d, 错误=%v", checkID, err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// GetIntegrityResult 获取核对任务中指定设备的结果
+func GetIntegrityResult(checkID uint, instanceID int) (*IntegrityResult, error) {
+	var item IntegrityResult
+	if err := DB.Where("check_id = ? AND instance_id = ?", checkID, instanceID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// UpdateIntegrityResult 更新单台设备的核对结果
+func UpdateIntegrityResult(id uint, data map[string]interface{}) error {
+	if err := DB.Model(&IntegrityResult{}).Where("id = ?", id).Updates(data).Error; err != nil {
+		logger.Errorf("更新核对结果失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+	return nil
+}
+
+// ResetIntegrityResults 将指定状态的设备结果重置为待核对，返回重置的数量
+func ResetIntegrityResults(checkID uint, statuses []string) (int64, error) {
+	result := DB.Model(&IntegrityResult{}).
+		Where("check_id = ? AND status IN ?", checkID, statuses).
+		Updates(map[string]interface{}{
+			"status":      IntegrityResultPending,
+			"files":       0,
+			"added":       0,
+			"removed":     0,
+			"modified":    0,
+			"unreadable":  0,
+			"diff":        nil,
+			"error":       "",
+			"started_at":  nil,
+			"finished_at": nil,
+			"duration_ms": 0,
+		})
+	if result.Error != nil {
+		logger.Errorf("重置核对结果失败: 任务=%d, 错误=%v", checkID, result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// CountIntegrityResults 按状态统计核对任务的设备结果
+func CountIntegrityResults(checkID uint) (map[string]int, error) {
+	var rows []struct {
+		Status string
+		Count  int
+	}
+	err := DB.Model(&IntegrityResult{}).Select("status, COUNT(*) AS count").
+		Where("check_id = ?", checkID).Group("status").Scan(&rows).Error
+	if err != nil {
+		logger.Errorf("统计核对结果失败: 任务=%d, 错误=%v", checkID, err)
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
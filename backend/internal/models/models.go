@@ -65,6 +65,76 @@ func autoMigrate() error {
 		return fmt.Errorf("迁移分组表失败: %v", err)
 	}
 
+	// 迁移分享链接表
+	if err := DB.AutoMigrate(&ShareLink{}); err != nil {
+		return fmt.Errorf("迁移分享链接表失败: %v", err)
+	}
+
+	// 迁移会话策略表
+	if err := DB.AutoMigrate(&SessionPolicy{}); err != nil {
+		return fmt.Errorf("迁移会话策略表失败: %v", err)
+	}
+
+	// 迁移控制会话记录表
+	if err := DB.AutoMigrate(&ControlSession{}); err != nil {
+		return fmt.Errorf("迁移控制会话记录表失败: %v", err)
+	}
+
+	// 迁移会话录制表
+	if err := DB.AutoMigrate(&Recording{}); err != nil {
+		return fmt.Errorf("迁移会话录制表失败: %v", err)
+	}
+
+	// 迁移截图归档策略表
+	if err := DB.AutoMigrate(&TimelapsePolicy{}); err != nil {
+		return fmt.Errorf("迁移截图归档策略表失败: %v", err)
+	}
+
+	// 迁移截图归档表
+	if err := DB.AutoMigrate(&Snapshot{}); err != nil {
+		return fmt.Errorf("迁移截图归档表失败: %v", err)
+	}
+
+	// 迁移分发文件表
+	if err := DB.AutoMigrate(&Artifact{}); err != nil {
+		return fmt.Errorf("迁移分发文件表失败: %v", err)
+	}
+
+	// 迁移分发任务表
+	if err := DB.AutoMigrate(&DistributionJob{}, &DistributionResult{}); err != nil {
+		return fmt.Errorf("迁移分发任务表失败: %v", err)
+	}
+
+	// 迁移文件基线表
+	if err := DB.AutoMigrate(&Baseline{}, &BaselineFile{}); err != nil {
+		return fmt.Errorf("迁移文件基线表失败: %v", err)
+	}
+
+	// 迁移完整性核对任务表
+	if err := DB.AutoMigrate(&IntegrityCheck{}, &IntegrityResult{}); err != nil {
+		return fmt.Errorf("迁移完整性核对任务表失败: %v", err)
+	}
+
+	// 迁移Agent版本和灰度发布表
+	if err := DB.AutoMigrate(&AgentRelease{}, &AgentRollout{}); err != nil {
+		return fmt.Errorf("迁移Agent版本表失败: %v", err)
+	}
+
+	// 迁移Agent集中配置表
+	if err := DB.AutoMigrate(&ConfigProfile{}, &GroupConfigProfile{}, &InstanceConfigOverride{}); err != nil {
+		return fmt.Errorf("迁移Agent集中配置表失败: %v", err)
+	}
+
+	// 迁移Agent注册令牌和注册申请表
+	if err := DB.AutoMigrate(&EnrollmentToken{}, &EnrollmentRequest{}); err != nil {
+		return fmt.Errorf("迁移Agent注册准入表失败: %v", err)
+	}
+
+	// 迁移自动分组规则表
+	if err := DB.AutoMigrate(&GroupRule{}); err != nil {
+		return fmt.Errorf("迁移自动分组规则表失败: %v", err)
+	}
+
 	logger.Infof("数据表迁移完成")
 	return nil
 }
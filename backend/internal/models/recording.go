@@ -0,0 +1,166 @@
+package models
+
+import (
+	"time"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// 录制状态
+const (
+	RecordingStatusRecording = "recording" // 录制中
+	RecordingStatusCompleted = "completed" // 已完成
+	RecordingStatusFailed    = "failed"    // 录制失败
+)
+
+// Recording 控制会话录制记录
+type Recording struct {
+	gorm.Model
+	InstanceID       int        `json:"instance_id" gorm:"index;comment:设备ID"`
+	ControlSessionID uint       `json:"control_session_id" gorm:"index;comment:控制会话ID"`
+	Path             string     `json:"-" gorm:"comment:录制文件目录"`
+	Status           string     `json:"status" gorm:"comment:录制状态"`
+	StartedAt        time.Time  `json:"started_at" gorm:"index;comment:开始时间"`
+	EndedAt          *time.Time `json:"ended_at" gorm:"comment:结束时间"`
+	DurationMs       int64      `json:"duration_ms" gorm:"comment:录制时长(毫秒)"`
+	Frames           int        `json:"frames" gorm:"comment:视频帧数"`
+	Events           int        `json:"events" gorm:"comment:输入事件数"`
+	Bytes            int64      `json:"bytes" gorm:"comment:占用空间(字节)"`
+	Error            string     `json:"error" gorm:"comment:错误信息"`
+}
+
+// RecordingListParams 录制列表查询参数
+type RecordingListParams struct {
+	InstanceID int `json:"instance_id" form:"instance_id"`
+	Page       int `json:"page" form:"page"`
+	Size       int `json:"size" form:"size"`
+}
+
+// RecordingListResult 录制列表返回结果
+type RecordingListResult struct {
+	Recordings []Recording `json:"recordings"`
+	Total      int64       `json:"total"`
+	Page       int         `json:"page"`
+	Size       int         `json:"size"`
+}
+
+// CreateRecording 创建录制记录
+func CreateRecording(item *Recording) error {
+	if err := DB.Create(item).Error; err != nil {
+		logger.Errorf("创建录制记录失败: 实例=%d, 错误=%v", item.InstanceID, err)
+		return err
+	}
+	return nil
+}
+
+// UpdateRecording 更新录制记录
+func UpdateRecording(id uint, data map[string]interface{}) error {
+	if err := DB.Model(&Recording{}).Where("id = ?", id).Updates(data).Error; err != nil {
+		logger.Errorf("更新录制记录失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+	return nil
+}
+
+// GetRecording 获取录制记录
+func GetRecording(id int) (*Recording, error) {
+	var item Recording
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取录制记录失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetRecordingList 获取录制列表（支持分页和按设备筛选）
+func GetRecordingList(params *RecordingListParams) (*RecordingListResult, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 {
+		params.Size = 20
+	}
+
+	query := DB.Model(&Recording{})
+	if params.InstanceID > 0 {
+		query = query.Where("instance_id = ?", params.InstanceID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("获取录制总数失败: %v", err)
+		return nil, err
+	}
+
+	var items []Recording
+	offset := (params.Page - 1) * params.Size
+	if err := query.Order("started_at DESC").Offset(offset).Limit(params.Size).Find(&items).Error; err != nil {
+		logger.Errorf("获取录制列表失败: %v", err)
+		return nil, err
+	}
+
+	return &RecordingListResult{
+		Recordings: items,
+		Total:      total,
+		Page:       params.Page,
+		Size:       params.Size,
+	}, nil
+}
+
+// ListRecordingsStartedBefore 获取指定时间之前开始且已结束的录制
+func ListRecordingsStartedBefore(before time.Time) ([]Recording, error) {
+	var items []Recording
+	err := DB.Where("started_at < ? AND status <> ?", before, RecordingStatusRecording).
+		Order("started_at").Find(&items).Error
+	if err != nil {
+		logger.Errorf("获取过期录制失败: %v", err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListFinishedRecordingsOldestFirst 按开始时间从旧到新获取已结束的录制
+func ListFinishedRecordingsOldestFirst() ([]Recording, error) {
+	var items []Recording
+	if err := DB.Where("status <> ?", RecordingStatusRecording).Order("started_at").Find(&items).Error; err != nil {
+		logger.Errorf("获取录制列表失败: %v", err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// SumRecordingBytes 统计所有录制占用的空间
+func SumRecordingBytes() (int64, error) {
+	var total int64
+	if err := DB.Model(&Recording{}).Select("COALESCE(SUM(bytes), 0)").Scan(&total).Error; err != nil {
+		logger.Errorf("统计录制空间失败: %v", err)
+		return 0, err
+	}
+	return total, nil
+}
+
+// MarkInterruptedRecordings 将服务重启前未正常结束的录制标记为失败
+func MarkInterruptedRecordings() (int64, error) {
+	result := DB.Model(&Recording{}).Where("status = ?", RecordingStatusRecording).Updates(map[string]interface{}{
+		"status": RecordingStatusFailed,
+		"error":  "服务重启导致录制中断",
+	})
+	if result.Error != nil {
+		logger.Errorf("标记中断录制失败: %v", result.Error)
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// DeleteRecording 删除录制记录
+func DeleteRecording(id uint) error {
+	if err := DB.Unscoped().Delete(&Recording{}, id).Error; err != nil {
+		logger.Errorf("删除录制记录失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+
+	logger.Infof("删除录制记录成功: ID=%d", id)
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"errors"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// 会话策略来源
+const (
+	PolicySourceGroup   = "group"   // 分组策略
+	PolicySourceDefault = "default" // 全局默认配置
+)
+
+// SessionPolicy 分组的控制会话策略
+type SessionPolicy struct {
+	gorm.Model
+	GroupID            int    `json:"group_id" gorm:"uniqueIndex;comment:分组ID"`
+	IdleTimeoutMinutes int    `json:"idle_timeout_minutes" gorm:"comment:无输入超时(分钟)，0表示不限制"`
+	MaxDurationMinutes int    `json:"max_duration_minutes" gorm:"comment:最长会话时长(分钟)，0表示不限制"`
+	WarningSeconds     int    `json:"warning_seconds" gorm:"comment:断开前提前警告(秒)"`
+	RecordSessions     bool   `json:"record_sessions" gorm:"comment:是否录制控制会话"`
+	Source             string `json:"source" gorm:"-"` // 策略来源，不存储到数据库
+}
+
+// GetSessionPolicyByGroup 获取分组的会话策略，未设置时返回gorm.ErrRecordNotFound
+func GetSessionPolicyByGroup(groupID int) (*SessionPolicy, error) {
+	var item SessionPolicy
+	if err := DB.Where("group_id = ?", groupID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	item.Source = PolicySourceGroup
+	return &item, nil
+}
+
+// SaveSessionPolicy 创建或更新分组的会话策略
+func SaveSessionPolicy(policy SessionPolicy) (*SessionPolicy, error) {
+	var item SessionPolicy
+	err := DB.Where(SessionPolicy{GroupID: policy.GroupID}).
+		Assign(map[string]interface{}{
+			"idle_timeout_minutes": policy.IdleTimeoutMinutes,
+			"max_duration_minutes": policy.MaxDurationMinutes,
+			"warning_seconds":      policy.WarningSeconds,
+			"record_sessions":      policy.RecordSessions,
+		}).
+		FirstOrCreate(&item).Error
+	if err != nil {
+		logger.Errorf("保存会话策略失败: 分组=%d, 错误=%v", policy.GroupID, err)
+		return nil, err
+	}
+
+	logger.Infof("保存会话策略成功: 分组=%d, 空闲超时=%d分钟, 最长时长=%d分钟, 警告=%d秒, 录制=%v",
+		item.GroupID, item.IdleTimeoutMinutes, item.MaxDurationMinutes, item.WarningSeconds, item.RecordSessions)
+
+	item.Source = PolicySourceGroup
+	return &item, nil
+}
+
+// DeleteSessionPolicy 删除分组的会话策略，恢复使用全局默认配置
+func DeleteSessionPolicy(groupID int) error {
+	if err := DB.Unscoped().Where("group_id = ?", groupID).Delete(&SessionPolicy{}).Error; err != nil {
+		logger.Errorf("删除会话策略失败: 分组=%d, 错误=%v", groupID, err)
+		return err
+	}
+
+	logger.Infof("删除会话策略成功: 分组=%d", groupID)
+
+	return nil
+}
+
+// DefaultSessionPolicy 全局默认会话策略
+func DefaultSessionPolicy() SessionPolicy {
+	session := config.GetSessionConfig()
+	return SessionPolicy{
+		IdleTimeoutMinutes: session.IdleTimeoutMinutes,
+		MaxDurationMinutes: session.MaxDurationMinutes,
+		WarningSeconds:     session.WarningSeconds,
+		RecordSessions:     session.RecordSessions,
+		Source:             PolicySourceDefault,
+	}
+}
+
+// ResolveSessionPolicy 获取设备生效的会话策略：优先使用分组策略，否则使用全局默认配置
+func ResolveSessionPolicy(groupID *int) SessionPolicy {
+	if groupID != nil {
+		policy, err := GetSessionPolicyByGroup(*groupID)
+		if err == nil {
+			return *policy
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			logger.Errorf("获取分组会话策略失败，使用默认策略: 分组=%d, 错误=%v", *groupID, err)
+		}
+	}
+	return DefaultSessionPolicy()
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// 分享链接权限范围
+const (
+	ShareScopeStream  = "stream"  // 仅观看视频流
+	ShareScopeControl = "control" // 观看并可申请控制
+)
+
+// ShareLink 设备分享链接模型，令牌本身不落库，仅保存用于校验和撤销的记录
+type ShareLink struct {
+	gorm.Model
+	InstanceID   int        `json:"instance_id" gorm:"index;comment:设备ID"`
+	Scope        string     `json:"scope" gorm:"comment:权限范围(stream/control)"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"comment:过期时间"`
+	MaxViewers   int        `json:"max_viewers" gorm:"comment:最大同时观看人数，0表示不限制"`
+	PasswordHash string     `json:"-" gorm:"comment:访问密码哈希"`
+	HasPassword  bool       `json:"has_password" gorm:"comment:是否需要密码"`
+	Note         string     `json:"note" gorm:"comment:备注"`
+	RevokedAt    *time.Time `json:"revoked_at" gorm:"comment:撤销时间"`
+}
+
+// IsActive 分享链接是否仍然有效
+func (s *ShareLink) IsActive() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// CreateShareLink 创建分享链接
+func CreateShareLink(item *ShareLink) error {
+	if err := DB.Create(item).Error; err != nil {
+		logger.Errorf("创建分享链接失败: 实例=%d, 错误=%v", item.InstanceID, err)
+		return err
+	}
+
+	logger.Infof("创建分享链接成功: ID=%d, 实例=%d, 范围=%s, 过期=%s",
+		item.ID, item.InstanceID, item.Scope, item.ExpiresAt.Format(time.RFC3339))
+
+	return nil
+}
+
+// GetShareLink 获取分享链接
+func GetShareLink(id uint) (*ShareLink, error) {
+	var item ShareLink
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取分享链接失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+
+	return &item, nil
+}
+
+// ListShareLinks 获取设备的分享链接列表
+func ListShareLinks(instanceID int) ([]ShareLink, error) {
+	var items []ShareLink
+	if err := DB.Where("instance_id = ?", instanceID).Order("created_at DESC").Find(&items).Error; err != nil {
+		logger.Errorf("获取分享链接列表失败: 实例=%d, 错误=%v", instanceID, err)
+		return nil, err
+	}
+
+	logger.Infof("获取分享链接列表成功: 实例=%d, 数量=%d", instanceID, len(items))
+
+	return items, nil
+}
+
+// RevokeShareLink 撤销分享链接
+func RevokeShareLink(id uint) error {
+	now := time.Now()
+	if err := DB.Model(&ShareLink{}).Where("id = ? AND revoked_at IS NULL", id).Update("revoked_at", &now).Error; err != nil {
+		logger.Errorf("撤销分享链接失败: ID=%d, 错误=%v", id, err)
+		return err
+	}
+
+	logger.Infof("撤销分享链接成功: ID=%d", id)
+
+	return nil
+}
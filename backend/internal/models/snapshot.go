@@ -0,0 +1,162 @@
+package models
+
+import (
+	"time"
+	"winmanager-backend/internal/logger"
+)
+
+// Snapshot 归档的设备截图
+type Snapshot struct {
+	ID         uint      `json:"id" gorm:"primarykey"`
+	InstanceID int       `json:"instance_id" gorm:"index:idx_snapshot_instance_time;comment:设备ID"`
+	CapturedAt time.Time `json:"captured_at" gorm:"index:idx_snapshot_instance_time;index;comment:截图时间"`
+	Path       string    `json:"-" gorm:"comment:图片文件路径"`
+	Size       int64     `json:"size" gorm:"comment:文件大小(字节)"`
+	Width      int       `json:"width" gorm:"comment:图片宽度"`
+	Height     int       `json:"height" gorm:"comment:图片高度"`
+}
+
+// SnapshotListParams 截图归档查询参数
+type SnapshotListParams struct {
+	From *time.Time `json:"from" form:"-"` // 开始时间(含)
+	To   *time.Time `json:"to" form:"-"`   // 结束时间(含)
+	Page int        `json:"page" form:"page"`
+	Size int        `json:"size" form:"size"`
+}
+
+// SnapshotListResult 截图归档查询结果
+type SnapshotListResult struct {
+	Snapshots []Snapshot `json:"snapshots"`
+	Total     int64      `json:"total"`
+	Page      int        `json:"page"`
+	Size      int        `json:"size"`
+}
+
+// CreateSnapshot 创建截图归档记录
+func CreateSnapshot(item *Snapshot) error {
+	if err := DB.Create(item).Error; err != nil {
+		logger.Errorf("创建截图归档记录失败: 实例=%d, 错误=%v", item.InstanceID, err)
+		return err
+	}
+	return nil
+}
+
+// GetSnapshot 获取截图归档记录
+func GetSnapshot(id int) (*Snapshot, error) {
+	var item Snapshot
+	if err := DB.First(&item, id).Error; err != nil {
+		logger.Errorf("获取截图归档记录失败: ID=%d, 错误=%v", id, err)
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetSnapshotList 按时间范围分页获取设备的截图归档，按时间顺序排列
+func GetSnapshotList(instanceID int, params *SnapshotListParams) (*SnapshotListResult, error) {
+	if params.Page <= 0 {
+		params.Page = 1
+	}
+	if params.Size <= 0 {
+		params.Size = 100
+	}
+
+	query := DB.Model(&Snapshot{}).Where("instance_id = ?", instanceID)
+	if params.From != nil {
+		query = query.Where("captured_at >= ?", *params.From)
+	}
+	if params.To != nil {
+		query = query.Where("captured_at <= ?", *params.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logger.Errorf("获取截图归档总数失败: 实例=%d, 错误=%v", instanceID, err)
+		return nil, err
+	}
+
+	var items []Snapshot
+	offset := (params.Page - 1) * params.Size
+	if err := query.Order("captured_at").Offset(offset).Limit(params.Size).Find(&items).Error; err != nil {
+		logger.Errorf("获取截图归档列表失败: 实例=%d, 错误=%v", instanceID, err)
+		return nil, err
+	}
+
+	return &SnapshotListResult{
+		Snapshots: items,
+		Total:     total,
+		Page:      params.Page,
+		Size:      params.Size,
+	}, nil
+}
+
+// ListSnapshotsInRange 获取设备在时间范围内的截图，按时间顺序排列，最多返回limit条
+func ListSnapshotsInRange(instanceID int, from, to time.Time, limit int) ([]Snapshot, error) {
+	var items []Snapshot
+	err := DB.Where("instance_id = ? AND captured_at >= ? AND captured_at <= ?", instanceID, from, to).
+		Order("captured_at").Limit(limit).Find(&items).Error
+	if err != nil {
+		logger.Errorf("获取时间范围内的截图失败: 实例=%d, 错误=%v", instanceID, err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListSnapshotsBefore 获取设备在指定时间之前的截图
+func ListSnapshotsBefore(instanceID int, before time.Time) ([]Snapshot, error) {
+	var items []Snapshot
+	if err := DB.Where("instance_id = ? AND captured_at < ?", instanceID, before).Find(&items).Error; err != nil {
+		logger.Errorf("获取过期截图失败: 实例=%d, 错误=%v", instanceID, err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// ListOldestSnapshots 获取最旧的截图，instanceID为0时不限设备
+func ListOldestSnapshots(instanceID int, limit int) ([]Snapshot, error) {
+	var items []Snapshot
+	query := DB.Order("captured_at").Limit(limit)
+	if instanceID > 0 {
+		query = query.Where("instance_id = ?", instanceID)
+	}
+	if err := query.Find(&items).Error; err != nil {
+		logger.Errorf("获取最旧截图失败: 实例=%d, 错误=%v", instanceID, err)
+		return nil, err
+	}
+	return items, nil
+}
+
+// SumSnapshotBytes 统计截图占用的空间，instanceID为0时统计全部设备
+func SumSnapshotBytes(instanceID int) (int64, error) {
+	var total int64
+	query := DB.Model(&Snapshot{})
+	if instanceID > 0 {
+		query = query.Where("instance_id = ?", instanceID)
+	}
+	if err := query.Select("COALESCE(SUM(size), 0)").Scan(&total).Error; err != nil {
+		logger.Errorf("统计截图空间失败: 实例=%d, 错误=%v", instanceID, err)
+		return 0, err
+	}
+	return total, nil
+}
+
+// ListSnapshotInstanceIDs 获取有截图归档的设备ID
+func ListSnapshotInstanceIDs() ([]int, error) {
+	var ids []int
+	if err := DB.Model(&Snapshot{}).Distinct("instance_id").Pluck("instance_id", &ids).Error; err != nil {
+		logger.Errorf("获取截图归档设备失败: %v", err)
+		return nil, err
+	}
+	return ids, nil
+}
+
+// DeleteSnapshots 删除截图归档记录
+func DeleteSnapshots(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := DB.Delete(&Snapshot{}, ids).Error; err != nil {
+		logger.Errorf("删除截图归档记录失败: 数量=%d, 错误=%v", len(ids), err)
+		return err
+	}
+	return nil
+}
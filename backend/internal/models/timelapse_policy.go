@@ -0,0 +1,142 @@
+package models
+
+import (
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+
+	"gorm.io/gorm"
+)
+
+// 截图归档策略作用范围
+const (
+	TimelapseScopeGroup    = "group"    // 分组策略
+	TimelapseScopeInstance = "instance" // 单台设备策略，优先于分组策略
+)
+
+// TimelapsePolicy 定时截图归档策略，可按分组或单台设备设置
+type TimelapsePolicy struct {
+	gorm.Model
+	Scope           string `json:"scope" gorm:"uniqueIndex:idx_timelapse_target;comment:作用范围(group/instance)"`
+	TargetID        int    `json:"target_id" gorm:"uniqueIndex:idx_timelapse_target;comment:分组ID或设备ID"`
+	Enabled         bool   `json:"enabled" gorm:"comment:是否启用归档"`
+	IntervalSeconds int    `json:"interval_seconds" gorm:"comment:截图间隔(秒)"`
+	RetentionDays   int    `json:"retention_days" gorm:"comment:保留天数，0表示不按时间清理"`
+	MaxTotalMB      int64  `json:"max_total_mb" gorm:"comment:每台设备的存储上限(MB)，0表示不限制"`
+	MaxWidth        int    `json:"max_width" gorm:"comment:截图最大宽度，0表示原始分辨率"`
+	Quality         int    `json:"quality" gorm:"comment:JPEG质量(1-100)"`
+	Source          string `json:"source" gorm:"-"` // 策略来源，不存储到数据库
+}
+
+// GetTimelapsePolicy 获取分组或设备的归档策略，未设置时返回gorm.ErrRecordNotFound
+func GetTimelapsePolicy(scope string, targetID int) (*TimelapsePolicy, error) {
+	var item TimelapsePolicy
+	if err := DB.Where("scope = ? AND target_id = ?", scope, targetID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	item.Source = item.Scope
+	return &item, nil
+}
+
+// ListTimelapsePolicies 获取所有归档策略
+func ListTimelapsePolicies() ([]TimelapsePolicy, error) {
+	var items []TimelapsePolicy
+	if err := DB.Find(&items).Error; err != nil {
+		logger.Errorf("获取归档策略列表失败: %v", err)
+		return nil, err
+	}
+	for i := range items {
+		items[i].Source = items[i].Scope
+	}
+	return items, nil
+}
+
+// SaveTimelapsePolicy 创建或更新归档策略
+func SaveTimelapsePolicy(policy TimelapsePolicy) (*TimelapsePolicy, error) {
+	var item TimelapsePolicy
+	err := DB.Where(TimelapsePolicy{Scope: policy.Scope, TargetID: policy.TargetID}).
+		Assign(map[string]interface{}{
+			"enabled":          policy.Enabled,
+			"interval_seconds": policy.IntervalSeconds,
+			"retention_days":   policy.RetentionDays,
+			"max_total_mb":     policy.MaxTotalMB,
+			"max_width":        policy.MaxWidth,
+			"quality":          policy.Quality,
+		}).
+		FirstOrCreate(&item).Error
+	if err != nil {
+		logger.Errorf("保存归档策略失败: 范围=%s, 目标=%d, 错误=%v", policy.Scope, policy.TargetID, err)
+		return nil, err
+	}
+
+	logger.Infof("保存归档策略成功: 范围=%s, 目标=%d, 启用=%v, 间隔=%d秒, 保留=%d天, 上限=%dMB",
+		item.Scope, item.TargetID, item.Enabled, item.IntervalSeconds, item.RetentionDays, item.MaxTotalMB)
+
+	item.Source = item.Scope
+	return &item, nil
+}
+
+// DeleteTimelapsePolicy 删除分组或设备的归档策略
+func DeleteTimelapsePolicy(scope string, targetID int) error {
+	if err := DB.Unscoped().Where("scope = ? AND target_id = ?", scope, targetID).Delete(&TimelapsePolicy{}).Error; err != nil {
+		logger.Errorf("删除归档策略失败: 范围=%s, 目标=%d, 错误=%v", scope, targetID, err)
+		return err
+	}
+
+	logger.Infof("删除归档策略成功: 范围=%s, 目标=%d", scope, targetID)
+
+	return nil
+}
+
+// DefaultTimelapsePolicy 全局默认归档策略，默认不启用
+func DefaultTimelapsePolicy() TimelapsePolicy {
+	cfg := config.GetTimelapseConfig()
+	return TimelapsePolicy{
+		Enabled:         false,
+		IntervalSeconds: cfg.DefaultIntervalSeconds,
+		RetentionDays:   cfg.DefaultRetentionDays,
+		MaxTotalMB:      cfg.DefaultMaxTotalMB,
+		MaxWidth:        cfg.DefaultMaxWidth,
+		Quality:         cfg.DefaultQuality,
+		Source:          PolicySourceDefault,
+	}
+}
+
+// TimelapsePolicySet 已加载的全部归档策略，用于批量解析设备生效的策略
+type TimelapsePolicySet struct {
+	groups    map[int]TimelapsePolicy
+	instances map[int]TimelapsePolicy
+}
+
+// LoadTimelapsePolicySet 加载全部归档策略
+func LoadTimelapsePolicySet() (*TimelapsePolicySet, error) {
+	policies, err := ListTimelapsePolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	set := &TimelapsePolicySet{
+		groups:    make(map[int]TimelapsePolicy),
+		instances: make(map[int]TimelapsePolicy),
+	}
+	for _, policy := range policies {
+		if policy.Scope == TimelapseScopeInstance {
+			set.instances[policy.TargetID] = policy
+		} else {
+			set.groups[policy.TargetID] = policy
+		}
+	}
+	return set, nil
+}
+
+// Resolve 获取设备生效的归档策略：设备策略优先，其次分组策略，否则使用全局默认配置
+func (s *TimelapsePolicySet) Resolve(instanceID int, groupID *int) TimelapsePolicy {
+	if policy, ok := s.instances[instanceID]; ok {
+		return policy
+	}
+	if groupID != nil {
+		if policy, ok := s.groups[*groupID]; ok {
+			return policy
+		}
+	}
+	return DefaultTimelapsePolicy()
+}
@@ -0,0 +1,216 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// AVI标志
+const (
+	aviFlagHasIndex = 0x10 // AVIF_HASINDEX
+	aviFlagKeyFrame = 0x10 // AVIIF_KEYFRAME
+)
+
+// AVI RIFF文件大小上限（不使用OpenDML扩展）
+const maxAVISize = 1<<32 - 1
+
+// MJPEGAVI 流式输出Motion-JPEG AVI文件
+// 需要预先知道每一帧的大小，以便先写出文件头再逐帧写入，不必在内存中缓存整个文件
+type MJPEGAVI struct {
+	Width      int
+	Height     int
+	FPS        int
+	FrameSizes []int
+
+	written int
+}
+
+// NewMJPEGAVI 创建MJPEG AVI输出器
+func NewMJPEGAVI(width, height, fps int, frameSizes []int) (*MJPEGAVI, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("无效的视频尺寸: %dx%d", width, height)
+	}
+	if fps <= 0 {
+		return nil, fmt.Errorf("无效的帧率: %d", fps)
+	}
+	if len(frameSizes) == 0 {
+		return nil, errors.New("没有可用的视频帧")
+	}
+
+	a := &MJPEGAVI{Width: width, Height: height, FPS: fps, FrameSizes: frameSizes}
+	if a.Size() > maxAVISize {
+		return nil, errors.New("视频超过4GB，请缩小时间范围")
+	}
+	return a, nil
+}
+
+// padded 帧数据按2字节对齐后的大小
+func padded(size int) int {
+	return size + size&1
+}
+
+// moviSize movi列表中的数据大小（不含LIST头）
+func (a *MJPEGAVI) moviSize() int64 {
+	size := int64(4) // 'movi'
+	for _, s := range a.FrameSizes {
+		size += 8 + int64(padded(s))
+	}
+	return size
+}
+
+// headerSize 文件头大小（到第一帧数据为止）
+func (a *MJPEGAVI) headerSize() int64 {
+	// RIFF头(12) + hdrl列表(12 + avih 64 + strl列表(12 + strh 64 + strf 48)) + movi列表头(12)
+	return 12 + 12 + 64 + 12 + 64 + 48 + 12
+}
+
+// Size 输出文件的总大小
+func (a *MJPEGAVI) Size() int64 {
+	// movi列表头中的'movi'标识已计入headerSize
+	return a.headerSize() + a.moviSize() - 4 + 8 + int64(16*len(a.FrameSizes))
+}
+
+// maxFrameSize 最大的一帧
+func (a *MJPEGAVI) maxFrameSize() int {
+	max := 0
+	for _, s := range a.FrameSizes {
+		if s > max {
+			max = s
+		}
+	}
+	return max
+}
+
+// WriteHeader 写入文件头
+func (a *MJPEGAVI) WriteHeader(w io.Writer) error {
+	frames := uint32(len(a.FrameSizes))
+	maxFrame := uint32(a.maxFrameSize())
+
+	buf := make([]byte, 0, a.headerSize())
+	le := binary.LittleEndian
+
+	buf = append(buf, "RIFF"...)
+	buf = le.AppendUint32(buf, uint32(a.Size()-8))
+	buf = append(buf, "AVI "...)
+
+	// hdrl
+	buf = append(buf, "LIST"...)
+	buf = le.AppendUint32(buf, 4+64+12+64+48)
+	buf = append(buf, "hdrl"...)
+
+	// avih
+	buf = append(buf, "avih"...)
+	buf = le.AppendUint32(buf, 56)
+	buf = le.AppendUint32(buf, uint32(1000000/a.FPS))  // dwMicroSecPerFrame
+	buf = le.AppendUint32(buf, maxFrame*uint32(a.FPS)) // dwMaxBytesPerSec
+	buf = le.AppendUint32(buf, 0)                      // dwPaddingGranularity
+	buf = le.AppendUint32(buf, aviFlagHasIndex)        // dwFlags
+	buf = le.AppendUint32(buf, frames)                 // dwTotalFrames
+	buf = le.AppendUint32(buf, 0)                      // dwInitialFrames
+	buf = le.AppendUint32(buf, 1)                      // dwStreams
+	buf = le.AppendUint32(buf, maxFrame)               // dwSuggestedBufferSize
+	buf = le.AppendUint32(buf, uint32(a.Width))
+	buf = le.AppendUint32(buf, uint32(a.Height))
+	buf = append(buf, make([]byte, 16)...) // dwReserved
+
+	// strl
+	buf = append(buf, "LIST"...)
+	buf = le.AppendUint32(buf, 4+64+48)
+	buf = append(buf, "strl"...)
+
+	// strh
+	buf = append(buf, "strh"...)
+	buf = le.AppendUint32(buf, 56)
+	buf = append(buf, "vids"...)
+	buf = append(buf, "MJPG"...)
+	buf = le.AppendUint32(buf, 0)             // dwFlags
+	buf = le.AppendUint16(buf, 0)             // wPriority
+	buf = le.AppendUint16(buf, 0)             // wLanguage
+	buf = le.AppendUint32(buf, 0)             // dwInitialFrames
+	buf = le.AppendUint32(buf, 1)             // dwScale
+	buf = le.AppendUint32(buf, uint32(a.FPS)) // dwRate
+	buf = le.AppendUint32(buf, 0)             // dwStart
+	buf = le.AppendUint32(buf, frames)        // dwLength
+	buf = le.AppendUint32(buf, maxFrame)      // dwSuggestedBufferSize
+	buf = le.AppendUint32(buf, 0xFFFFFFFF)    // dwQuality
+	buf = le.AppendUint32(buf, 0)             // dwSampleSize
+	buf = le.AppendUint16(buf, 0)             // rcFrame
+	buf = le.AppendUint16(buf, 0)
+	buf = le.AppendUint16(buf, uint16(a.Width))
+	buf = le.AppendUint16(buf, uint16(a.Height))
+
+	// strf (BITMAPINFOHEADER)
+	buf = append(buf, "strf"...)
+	buf = le.AppendUint32(buf, 40)
+	buf = le.AppendUint32(buf, 40)
+	buf = le.AppendUint32(buf, uint32(a.Width))
+	buf = le.AppendUint32(buf, uint32(a.Height))
+	buf = le.AppendUint16(buf, 1)  // biPlanes
+	buf = le.AppendUint16(buf, 24) // biBitCount
+	buf = append(buf, "MJPG"...)
+	buf = le.AppendUint32(buf, uint32(a.Width*a.Height*3))
+	buf = append(buf, make([]byte, 16)...)
+
+	// movi
+	buf = append(buf, "LIST"...)
+	buf = le.AppendUint32(buf, uint32(a.moviSize()))
+	buf = append(buf, "movi"...)
+
+	_, err := w.Write(buf)
+	return err
+}
+
+// WriteFrame 按顺序写入一帧JPEG数据，大小必须与预先提供的一致
+func (a *MJPEGAVI) WriteFrame(w io.Writer, jpeg []byte) error {
+	if a.written >= len(a.FrameSizes) {
+		return errors.New("写入的帧数超过预期")
+	}
+	if len(jpeg) != a.FrameSizes[a.written] {
+		return fmt.Errorf("第%d帧大小与预期不一致: %d != %d", a.written, len(jpeg), a.FrameSizes[a.written])
+	}
+
+	var header [8]byte
+	copy(header[0:4], "00dc")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(len(jpeg)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(jpeg); err != nil {
+		return err
+	}
+	if len(jpeg)&1 == 1 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+
+	a.written++
+	return nil
+}
+
+// WriteIndex 写入idx1索引，所有帧写完后调用
+func (a *MJPEGAVI) WriteIndex(w io.Writer) error {
+	if a.written != len(a.FrameSizes) {
+		return fmt.Errorf("帧数不完整: %d/%d", a.written, len(a.FrameSizes))
+	}
+
+	le := binary.LittleEndian
+	buf := make([]byte, 0, 8+16*len(a.FrameSizes))
+	buf = append(buf, "idx1"...)
+	buf = le.AppendUint32(buf, uint32(16*len(a.FrameSizes)))
+
+	// 偏移量相对于'movi'标识的位置
+	offset := uint32(4)
+	for _, size := range a.FrameSizes {
+		buf = append(buf, "00dc"...)
+		buf = le.AppendUint32(buf, aviFlagKeyFrame)
+		buf = le.AppendUint32(buf, offset)
+		buf = le.AppendUint32(buf, uint32(size))
+		offset += 8 + uint32(padded(size))
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
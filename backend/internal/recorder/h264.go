@@ -0,0 +1,318 @@
+package recorder
+
+import (
+	"errors"
+)
+
+// H.264 NAL单元类型
+const (
+	nalTypeSPS = 7
+	nalTypePPS = 8
+	nalTypeAUD = 9
+)
+
+// splitNALUnits 按起始码(0x000001/0x00000001)拆分Annex-B格式的数据，返回不含起始码的NAL单元
+func splitNALUnits(payload []byte) [][]byte {
+	var units [][]byte
+	start := -1
+
+	for i := 0; i+2 < len(payload); i++ {
+		if payload[i] != 0x00 || payload[i+1] != 0x00 || payload[i+2] != 0x01 {
+			continue
+		}
+		if start >= 0 {
+			end := i
+			// 4字节起始码前面多出的0x00属于起始码
+			if end > start && payload[end-1] == 0x00 {
+				end--
+			}
+			if end > start {
+				units = append(units, payload[start:end])
+			}
+		}
+		start = i + 3
+		i += 2
+	}
+
+	if start >= 0 && start < len(payload) {
+		units = append(units, payload[start:])
+	}
+	return units
+}
+
+// nalType 获取NAL单元类型
+func nalType(unit []byte) byte {
+	if len(unit) == 0 {
+		return 0
+	}
+	return unit[0] & 0x1F
+}
+
+// spsInfo SPS中解析出的视频参数
+type spsInfo struct {
+	profileIdc           byte
+	chromaFormatIdc      uint
+	bitDepthLumaMinus8   uint
+	bitDepthChromaMinus8 uint
+	width                int
+	height               int
+}
+
+// bitReader 按位读取RBSP数据
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+var errBitReaderEOF = errors.New("SPS数据不完整")
+
+func (r *bitReader) readBit() (uint, error) {
+	if r.pos >= len(r.data)*8 {
+		return 0, errBitReaderEOF
+	}
+	bit := (r.data[r.pos/8] >> (7 - uint(r.pos%8))) & 1
+	r.pos++
+	return uint(bit), nil
+}
+
+func (r *bitReader) readBits(n int) (uint, error) {
+	var v uint
+	for i := 0; i < n; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | bit
+	}
+	return v, nil
+}
+
+// readUE 读取无符号指数哥伦布编码
+func (r *bitReader) readUE() (uint, error) {
+	zeros := 0
+	for {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			break
+		}
+		zeros++
+		if zeros > 31 {
+			return 0, errors.New("指数哥伦布编码过长")
+		}
+	}
+	rest, err := r.readBits(zeros)
+	if err != nil {
+		return 0, err
+	}
+	return (1 << uint(zeros)) - 1 + rest, nil
+}
+
+// readSE 读取有符号指数哥伦布编码
+func (r *bitReader) readSE() (int, error) {
+	v, err := r.readUE()
+	if err != nil {
+		return 0, err
+	}
+	if v%2 == 0 {
+		return -int(v / 2), nil
+	}
+	return int(v+1) / 2, nil
+}
+
+// unescapeRBSP 去除防竞争字节(0x000003)
+func unescapeRBSP(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	zeros := 0
+	for _, b := range data {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+		if b == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+// skipScalingList 跳过SPS中的缩放矩阵
+func skipScalingList(r *bitReader, size int) error {
+	last, next := 8, 8
+	for i := 0; i < size; i++ {
+		if next != 0 {
+			delta, err := r.readSE()
+			if err != nil {
+				return err
+			}
+			next = (last + delta + 256) % 256
+		}
+		if next != 0 {
+			last = next
+		}
+	}
+	return nil
+}
+
+// parseSPS 解析SPS获取分辨率等参数
+func parseSPS(sps []byte) (*spsInfo, error) {
+	if len(sps) < 4 {
+		return nil, errors.New("SPS长度不足")
+	}
+
+	info := &spsInfo{profileIdc: sps[1], chromaFormatIdc: 1}
+	r := &bitReader{data: unescapeRBSP(sps[4:])}
+
+	// seq_parameter_set_id
+	if _, err := r.readUE(); err != nil {
+		return nil, err
+	}
+
+	switch info.profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		var err error
+		if info.chromaFormatIdc, err = r.readUE(); err != nil {
+			return nil, err
+		}
+		if info.chromaFormatIdc == 3 {
+			// separate_colour_plane_flag
+			if _, err := r.readBit(); err != nil {
+				return nil, err
+			}
+		}
+		if info.bitDepthLumaMinus8, err = r.readUE(); err != nil {
+			return nil, err
+		}
+		if info.bitDepthChromaMinus8, err = r.readUE(); err != nil {
+			return nil, err
+		}
+		// qpprime_y_zero_transform_bypass_flag
+		if _, err := r.readBit(); err != nil {
+			return nil, err
+		}
+		present, err := r.readBit()
+		if err != nil {
+			return nil, err
+		}
+		if present == 1 {
+			count := 8
+			if info.chromaFormatIdc == 3 {
+				count = 12
+			}
+			for i := 0; i < count; i++ {
+				listPresent, err := r.readBit()
+				if err != nil {
+					return nil, err
+				}
+				if listPresent == 1 {
+					size := 16
+					if i >= 6 {
+						size = 64
+					}
+					if err := skipScalingList(r, size); err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+	}
+
+	// log2_max_frame_num_minus4
+	if _, err := r.readUE(); err != nil {
+		return nil, err
+	}
+	pocType, err := r.readUE()
+	if err != nil {
+		return nil, err
+	}
+	switch pocType {
+	case 0:
+		if _, err := r.readUE(); err != nil {
+			return nil, err
+		}
+	case 1:
+		if _, err := r.readBit(); err != nil {
+			return nil, err
+		}
+		if _, err := r.readSE(); err != nil {
+			return nil, err
+		}
+		if _, err := r.readSE(); err != nil {
+			return nil, err
+		}
+		cycle, err := r.readUE()
+		if err != nil {
+			return nil, err
+		}
+		for i := uint(0); i < cycle; i++ {
+			if _, err := r.readSE(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// max_num_ref_frames
+	if _, err := r.readUE(); err != nil {
+		return nil, err
+	}
+	// gaps_in_frame_num_value_allowed_flag
+	if _, err := r.readBit(); err != nil {
+		return nil, err
+	}
+
+	widthInMbsMinus1, err := r.readUE()
+	if err != nil {
+		return nil, err
+	}
+	heightInMapUnitsMinus1, err := r.readUE()
+	if err != nil {
+		return nil, err
+	}
+	frameMbsOnly, err := r.readBit()
+	if err != nil {
+		return nil, err
+	}
+	if frameMbsOnly == 0 {
+		// mb_adaptive_frame_field_flag
+		if _, err := r.readBit(); err != nil {
+			return nil, err
+		}
+	}
+	// direct_8x8_inference_flag
+	if _, err := r.readBit(); err != nil {
+		return nil, err
+	}
+
+	width := int(widthInMbsMinus1+1) * 16
+	height := int(2-frameMbsOnly) * int(heightInMapUnitsMinus1+1) * 16
+
+	cropping, err := r.readBit()
+	if err != nil {
+		return nil, err
+	}
+	if cropping == 1 {
+		var crop [4]uint
+		for i := range crop {
+			if crop[i], err = r.readUE(); err != nil {
+				return nil, err
+			}
+		}
+		cropUnitX, cropUnitY := 1, int(2-frameMbsOnly)
+		if info.chromaFormatIdc == 1 {
+			cropUnitX, cropUnitY = 2, 2*int(2-frameMbsOnly)
+		} else if info.chromaFormatIdc == 2 {
+			cropUnitX = 2
+		}
+		width -= int(crop[0]+crop[1]) * cropUnitX
+		height -= int(crop[2]+crop[3]) * cropUnitY
+	}
+
+	info.width = width
+	info.height = height
+	return info, nil
+}
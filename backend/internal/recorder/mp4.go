@@ -0,0 +1,662 @@
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 视频轨道时间刻度（90kHz）
+const mp4Timescale = 90000
+
+// 未知帧间隔时使用的默认时长（约30fps）
+const defaultSampleDuration = mp4Timescale / 30
+
+// 单个分片最多包含的帧数，避免关键帧间隔过长时分片过大
+const maxFragmentSamples = 120
+
+// mp4Sample 一个视频采样（一帧）
+type mp4Sample struct {
+	duration uint32 // 时长(90kHz)
+	size     uint32 // AVCC格式数据长度
+	key      bool
+	decodeTs uint64 // 解码时间(90kHz)
+}
+
+// Movie 从录制文件中解析出的视频信息，用于封装MP4
+type Movie struct {
+	dir       string
+	sps       []byte
+	pps       []byte
+	info      *spsInfo
+	samples   []mp4Sample
+	mdatBytes int64
+	keyframes []time.Duration
+}
+
+// LoadMovie 扫描录制文件，收集参数集和采样表
+func LoadMovie(dir string) (*Movie, error) {
+	reader, err := OpenFrames(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	m := &Movie{dir: dir}
+	var timestamps []time.Duration
+	started := false
+
+	for {
+		frame, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		units := splitNALUnits(frame.Payload)
+		for _, unit := range units {
+			switch nalType(unit) {
+			case nalTypeSPS:
+				if m.sps == nil {
+					m.sps = append([]byte(nil), unit...)
+				}
+			case nalTypePPS:
+				if m.pps == nil {
+					m.pps = append([]byte(nil), unit...)
+				}
+			}
+		}
+
+		// 从第一个关键帧开始，之前的帧无法解码
+		if !started {
+			if !frame.Key || m.sps == nil || m.pps == nil {
+				continue
+			}
+			started = true
+		}
+
+		size := avccSize(units)
+		if size == 0 {
+			continue
+		}
+		m.samples = append(m.samples, mp4Sample{size: uint32(size), key: frame.Key})
+		m.mdatBytes += int64(size)
+		timestamps = append(timestamps, frame.Timestamp)
+		if frame.Key {
+			m.keyframes = append(m.keyframes, frame.Timestamp)
+		}
+	}
+
+	if len(m.samples) == 0 {
+		return nil, errors.New("录制中没有可播放的H.264视频帧")
+	}
+
+	m.info, err = parseSPS(m.sps)
+	if err != nil {
+		return nil, err
+	}
+
+	// 根据相邻帧的时间差计算每帧时长
+	base := timestamps[0]
+	var decodeTs uint64
+	for i := range m.samples {
+		duration := uint32(defaultSampleDuration)
+		if i+1 < len(timestamps) {
+			delta := toTimescale(timestamps[i+1]-base) - toTimescale(timestamps[i]-base)
+			if delta > 0 {
+				duration = uint32(delta)
+			} else {
+				duration = 1
+			}
+		} else if i > 0 {
+			duration = m.samples[i-1].duration
+		}
+		m.samples[i].duration = duration
+		m.samples[i].decodeTs = decodeTs
+		decodeTs += uint64(duration)
+	}
+
+	return m, nil
+}
+
+// Duration 视频总时长
+func (m *Movie) Duration() time.Duration {
+	return time.Duration(m.totalDuration()) * time.Second / mp4Timescale
+}
+
+// Keyframes 关键帧相对录制开始的时间，用于定位
+func (m *Movie) Keyframes() []time.Duration {
+	return m.keyframes
+}
+
+// Resolution 视频分辨率
+func (m *Movie) Resolution() (int, int) {
+	return m.info.width, m.info.height
+}
+
+func (m *Movie) totalDuration() uint64 {
+	last := m.samples[len(m.samples)-1]
+	return last.decodeTs + uint64(last.duration)
+}
+
+func toTimescale(d time.Duration) int64 {
+	return int64(d) * mp4Timescale / int64(time.Second)
+}
+
+// avccSize 计算转换为AVCC格式（4字节长度前缀）后的数据长度
+func avccSize(units [][]byte) int {
+	size := 0
+	for _, unit := range units {
+		if keepInSample(unit) {
+			size += 4 + len(unit)
+		}
+	}
+	return size
+}
+
+// keepInSample 参数集写入avcC，AUD不需要，其余NAL单元保留在采样中
+func keepInSample(unit []byte) bool {
+	switch nalType(unit) {
+	case nalTypeSPS, nalTypePPS, nalTypeAUD:
+		return false
+	}
+	return len(unit) > 0
+}
+
+// appendAVCC 将NAL单元以AVCC格式追加到buf
+func appendAVCC(buf []byte, units [][]byte) []byte {
+	for _, unit := range units {
+		if !keepInSample(unit) {
+			continue
+		}
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(unit)))
+		buf = append(buf, unit...)
+	}
+	return buf
+}
+
+// sampleReader 按LoadMovie的规则依次读取采样数据
+type sampleReader struct {
+	frames  *FrameReader
+	hasSPS  bool
+	hasPPS  bool
+	started bool
+}
+
+func (m *Movie) openSamples() (*sampleReader, error) {
+	frames, err := OpenFrames(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	return &sampleReader{frames: frames}, nil
+}
+
+func (r *sampleReader) next(buf []byte) ([]byte, error) {
+	for {
+		frame, err := r.frames.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		units := splitNALUnits(frame.Payload)
+		if !r.started {
+			// 与LoadMovie保持一致：参数集可能出现在关键帧之前的帧中
+			for _, unit := range units {
+				switch nalType(unit) {
+				case nalTypeSPS:
+					r.hasSPS = true
+				case nalTypePPS:
+					r.hasPPS = true
+				}
+			}
+			if !frame.Key || !r.hasSPS || !r.hasPPS {
+				continue
+			}
+			r.started = true
+		}
+
+		if avccSize(units) == 0 {
+			continue
+		}
+		return appendAVCC(buf[:0], units), nil
+	}
+}
+
+func (r *sampleReader) close() {
+	r.frames.Close()
+}
+
+// ---- MP4 box 构建 ----
+
+func box(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+	buf := make([]byte, 0, size)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(size))
+	buf = append(buf, typ...)
+	for _, p := range payload {
+		buf = append(buf, p...)
+	}
+	return buf
+}
+
+func fullBox(typ string, version byte, flags uint32, payload ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+	return box(typ, append([][]byte{header}, payload...)...)
+}
+
+type byteWriter struct {
+	bytes.Buffer
+}
+
+func (w *byteWriter) u8(v uint8)   { w.WriteByte(v) }
+func (w *byteWriter) u16(v uint16) { binary.Write(&w.Buffer, binary.BigEndian, v) }
+func (w *byteWriter) u32(v uint32) { binary.Write(&w.Buffer, binary.BigEndian, v) }
+func (w *byteWriter) u64(v uint64) { binary.Write(&w.Buffer, binary.BigEndian, v) }
+func (w *byteWriter) zeros(n int)  { w.Write(make([]byte, n)) }
+
+// 单位矩阵
+func matrix() []byte {
+	w := &byteWriter{}
+	for _, v := range []uint32{0x00010000, 0, 0, 0, 0x00010000, 0, 0, 0, 0x40000000} {
+		w.u32(v)
+	}
+	return w.Bytes()
+}
+
+func ftyp() []byte {
+	return box("ftyp", []byte("isom"), []byte{0, 0, 0x02, 0}, []byte("isomiso2iso6avc1mp41"))
+}
+
+func (m *Movie) mvhd(duration uint64) []byte {
+	w := &byteWriter{}
+	w.u32(0) // creation_time
+	w.u32(0) // modification_time
+	w.u32(1000)
+	w.u32(uint32(duration * 1000 / mp4Timescale))
+	w.u32(0x00010000) // rate
+	w.u16(0x0100)     // volume
+	w.zeros(10)
+	w.Write(matrix())
+	w.zeros(24)
+	w.u32(2) // next_track_ID
+	return fullBox("mvhd", 0, 0, w.Bytes())
+}
+
+func (m *Movie) tkhd(duration uint64) []byte {
+	w := &byteWriter{}
+	w.u32(0)
+	w.u32(0)
+	w.u32(1) // track_ID
+	w.u32(0)
+	w.u32(uint32(duration * 1000 / mp4Timescale))
+	w.zeros(8)
+	w.u16(0) // layer
+	w.u16(0) // alternate_group
+	w.u16(0) // volume
+	w.u16(0)
+	w.Write(matrix())
+	w.u32(uint32(m.info.width) << 16)
+	w.u32(uint32(m.info.height) << 16)
+	return fullBox("tkhd", 0, 0x000003, w.Bytes())
+}
+
+func (m *Movie) mdhd(duration uint64) []byte {
+	w := &byteWriter{}
+	version := byte(0)
+	if duration > 0xFFFFFFFF {
+		// 超过32位范围（约13小时）时使用64位时间字段
+		version = 1
+		w.u64(0)
+		w.u64(0)
+		w.u32(mp4Timescale)
+		w.u64(duration)
+	} else {
+		w.u32(0)
+		w.u32(0)
+		w.u32(mp4Timescale)
+		w.u32(uint32(duration))
+	}
+	w.u16(0x55C4) // und
+	w.u16(0)
+	return fullBox("mdhd", version, 0, w.Bytes())
+}
+
+func hdlr() []byte {
+	w := &byteWriter{}
+	w.u32(0)
+	w.WriteString("vide")
+	w.zeros(12)
+	w.WriteString("VideoHandler\x00")
+	return fullBox("hdlr", 0, 0, w.Bytes())
+}
+
+func (m *Movie) avcC() []byte {
+	w := &byteWriter{}
+	w.u8(1)
+	w.u8(m.sps[1])
+	w.u8(m.sps[2])
+	w.u8(m.sps[3])
+	w.u8(0xFF) // lengthSizeMinusOne = 3
+	w.u8(0xE1) // 1个SPS
+	w.u16(uint16(len(m.sps)))
+	w.Write(m.sps)
+	w.u8(1)
+	w.u16(uint16(len(m.pps)))
+	w.Write(m.pps)
+	switch m.info.profileIdc {
+	case 100, 110, 122, 244:
+		w.u8(0xFC | byte(m.info.chromaFormatIdc))
+		w.u8(0xF8 | byte(m.info.bitDepthLumaMinus8))
+		w.u8(0xF8 | byte(m.info.bitDepthChromaMinus8))
+		w.u8(0)
+	}
+	return box("avcC", w.Bytes())
+}
+
+func (m *Movie) stsd() []byte {
+	w := &byteWriter{}
+	w.zeros(6)
+	w.u16(1) // data_reference_index
+	w.zeros(16)
+	w.u16(uint16(m.info.width))
+	w.u16(uint16(m.info.height))
+	w.u32(0x00480000)
+	w.u32(0x00480000)
+	w.u32(0)
+	w.u16(1) // frame_count
+	w.zeros(32)
+	w.u16(0x0018)
+	w.u16(0xFFFF)
+	w.Write(m.avcC())
+	avc1 := box("avc1", w.Bytes())
+	return fullBox("stsd", 0, 0, []byte{0, 0, 0, 1}, avc1)
+}
+
+// stbl 采样表；fragmented为true时为空表，采样信息写在moof中
+func (m *Movie) stbl(fragmented bool, mdatOffset uint64) []byte {
+	if fragmented {
+		return box("stbl",
+			m.stsd(),
+			fullBox("stts", 0, 0, []byte{0, 0, 0, 0}),
+			fullBox("stsc", 0, 0, []byte{0, 0, 0, 0}),
+			fullBox("stsz", 0, 0, make([]byte, 8)),
+			fullBox("stco", 0, 0, []byte{0, 0, 0, 0}),
+		)
+	}
+
+	stts := &byteWriter{}
+	var runs [][2]uint32
+	for _, s := range m.samples {
+		if n := len(runs); n > 0 && runs[n-1][1] == s.duration {
+			runs[n-1][0]++
+		} else {
+			runs = append(runs, [2]uint32{1, s.duration})
+		}
+	}
+	stts.u32(uint32(len(runs)))
+	for _, run := range runs {
+		stts.u32(run[0])
+		stts.u32(run[1])
+	}
+
+	stss := &byteWriter{}
+	var keys []uint32
+	for i, s := range m.samples {
+		if s.key {
+			keys = append(keys, uint32(i+1))
+		}
+	}
+	stss.u32(uint32(len(keys)))
+	for _, k := range keys {
+		stss.u32(k)
+	}
+
+	// 所有采样放在同一个chunk中
+	stsc := &byteWriter{}
+	stsc.u32(1)
+	stsc.u32(1)
+	stsc.u32(uint32(len(m.samples)))
+	stsc.u32(1)
+
+	stsz := &byteWriter{}
+	stsz.u32(0)
+	stsz.u32(uint32(len(m.samples)))
+	for _, s := range m.samples {
+		stsz.u32(s.size)
+	}
+
+	co64 := &byteWriter{}
+	co64.u32(1)
+	co64.u64(mdatOffset)
+
+	return box("stbl",
+		m.stsd(),
+		fullBox("stts", 0, 0, stts.Bytes()),
+		fullBox("stss", 0, 0, stss.Bytes()),
+		fullBox("stsc", 0, 0, stsc.Bytes()),
+		fullBox("stsz", 0, 0, stsz.Bytes()),
+		fullBox("co64", 0, 0, co64.Bytes()),
+	)
+}
+
+func (m *Movie) moov(fragmented bool, mdatOffset uint64) []byte {
+	duration := m.totalDuration()
+	if fragmented {
+		duration = 0
+	}
+
+	vmhd := fullBox("vmhd", 0, 1, make([]byte, 8))
+	dinf := box("dinf", fullBox("dref", 0, 0, []byte{0, 0, 0, 1}, fullBox("url ", 0, 1)))
+	minf := box("minf", vmhd, dinf, m.stbl(fragmented, mdatOffset))
+	mdia := box("mdia", m.mdhd(duration), hdlr(), minf)
+	trak := box("trak", m.tkhd(duration), mdia)
+
+	if !fragmented {
+		return box("moov", m.mvhd(duration), trak)
+	}
+
+	trex := &byteWriter{}
+	trex.u32(1) // track_ID
+	trex.u32(1) // default_sample_description_index
+	trex.u32(0)
+	trex.u32(0)
+	trex.u32(0)
+	mvex := box("mvex", fullBox("trex", 0, 0, trex.Bytes()))
+	return box("moov", m.mvhd(duration), trak, mvex)
+}
+
+// mdatHeader 超过4GB时使用64位长度
+func mdatHeader(payloadSize int64) []byte {
+	w := &byteWriter{}
+	if payloadSize+8 > 0xFFFFFFFF {
+		w.u32(1)
+		w.WriteString("mdat")
+		w.u64(uint64(payloadSize + 16))
+	} else {
+		w.u32(uint32(payloadSize + 8))
+		w.WriteString("mdat")
+	}
+	return w.Bytes()
+}
+
+// progressiveHeader 生成普通MP4的文件头（ftyp + moov + mdat头，moov前置便于边下边播）
+func (m *Movie) progressiveHeader() []byte {
+	head := ftyp()
+	mdat := mdatHeader(m.mdatBytes)
+	// moov大小与chunk偏移值无关，先计算大小再生成最终内容
+	moovSize := len(m.moov(false, 0))
+	offset := uint64(len(head) + moovSize + len(mdat))
+	head = append(head, m.moov(false, offset)...)
+	return append(head, mdat...)
+}
+
+// MP4Size 普通MP4输出的总字节数
+func (m *Movie) MP4Size() int64 {
+	return int64(len(m.progressiveHeader())) + m.mdatBytes
+}
+
+// WriteMP4 输出普通MP4
+func (m *Movie) WriteMP4(w io.Writer) error {
+	if _, err := w.Write(m.progressiveHeader()); err != nil {
+		return err
+	}
+
+	reader, err := m.openSamples()
+	if err != nil {
+		return err
+	}
+	defer reader.close()
+
+	var buf []byte
+	for range m.samples {
+		buf, err = reader.next(buf)
+		if err != nil {
+			return errors.New("录制文件在封装过程中发生变化")
+		}
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportMP4 将录制导出为录制目录中的普通MP4文件并返回路径，
+// 已导出且视频帧文件没有更新时直接复用，便于按Range请求读取
+func ExportMP4(dir string) (string, error) {
+	path := filepath.Join(dir, ExportFile)
+	frames, err := os.Stat(filepath.Join(dir, FramesFile))
+	if err != nil {
+		return "", err
+	}
+	if export, err := os.Stat(path); err == nil && !export.ModTime().Before(frames.ModTime()) {
+		return path, nil
+	}
+
+	movie, err := LoadMovie(dir)
+	if err != nil {
+		return "", err
+	}
+
+	// 先写入临时文件再重命名，并发导出时不会读到不完整的文件
+	tmp, err := os.CreateTemp(dir, ExportFile+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	writer := bufio.NewWriter(tmp)
+	if err := movie.WriteMP4(writer); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// WriteFragmentedMP4 输出分片MP4（fMP4），每个关键帧开始一个新分片
+func (m *Movie) WriteFragmentedMP4(w io.Writer) error {
+	if _, err := w.Write(append(ftyp(), m.moov(true, 0)...)); err != nil {
+		return err
+	}
+
+	reader, err := m.openSamples()
+	if err != nil {
+		return err
+	}
+	defer reader.close()
+
+	sequence := uint32(1)
+	var data []byte
+	var buf []byte
+	start := 0
+
+	for i := range m.samples {
+		if i > start && (m.samples[i].key || i-start >= maxFragmentSamples) {
+			if err := m.writeFragment(w, sequence, m.samples[start:i], data); err != nil {
+				return err
+			}
+			sequence++
+			start = i
+			data = data[:0]
+		}
+
+		buf, err = reader.next(buf)
+		if err != nil {
+			return errors.New("录制文件在封装过程中发生变化")
+		}
+		data = append(data, buf...)
+	}
+
+	return m.writeFragment(w, sequence, m.samples[start:], data)
+}
+
+// writeFragment 输出一个 moof + mdat 分片
+func (m *Movie) writeFragment(w io.Writer, sequence uint32, samples []mp4Sample, data []byte) error {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	mfhd := &byteWriter{}
+	mfhd.u32(sequence)
+
+	tfhd := &byteWriter{}
+	tfhd.u32(1) // track_ID
+
+	tfdt := &byteWriter{}
+	tfdt.u64(samples[0].decodeTs)
+
+	buildTrun := func(dataOffset uint32) []byte {
+		trun := &byteWriter{}
+		trun.u32(uint32(len(samples)))
+		trun.u32(dataOffset)
+		for _, s := range samples {
+			trun.u32(s.duration)
+			trun.u32(s.size)
+			if s.key {
+				trun.u32(0x02000000)
+			} else {
+				trun.u32(0x01010000)
+			}
+		}
+		// data-offset | sample-duration | sample-size | sample-flags
+		return fullBox("trun", 0, 0x000701, trun.Bytes())
+	}
+
+	buildMoof := func(dataOffset uint32) []byte {
+		traf := box("traf",
+			fullBox("tfhd", 0, 0x020000, tfhd.Bytes()), // default-base-is-moof
+			fullBox("tfdt", 1, 0, tfdt.Bytes()),
+			buildTrun(dataOffset),
+		)
+		return box("moof", fullBox("mfhd", 0, 0, mfhd.Bytes()), traf)
+	}
+
+	moofSize := len(buildMoof(0))
+	mdat := mdatHeader(int64(len(data)))
+	moof := buildMoof(uint32(moofSize + len(mdat)))
+
+	if _, err := w.Write(moof); err != nil {
+		return err
+	}
+	if _, err := w.Write(mdat); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
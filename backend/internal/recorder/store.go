@@ -0,0 +1,244 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 录制目录中的文件
+const (
+	FramesFile = "video.frames" // 视频帧（H.264 Annex-B 原始数据 + 时间戳）
+	EventsFile = "events.jsonl" // 输入事件，每行一个JSON
+	ExportFile = "export.mp4"   // 导出的普通MP4，视频帧文件更新后重新生成
+)
+
+// 视频帧文件头，用于识别文件格式
+var framesMagic = []byte("WMREC001")
+
+// 帧记录头：时间戳(微秒, 8字节) + 标志(1字节) + 长度(4字节)
+const frameHeaderSize = 13
+
+const frameFlagKey = 0x01
+
+// Frame 录制的一帧视频
+type Frame struct {
+	Timestamp time.Duration // 相对录制开始的时间
+	Key       bool
+	Payload   []byte
+}
+
+// Event 录制的一条输入事件
+type Event struct {
+	TimeMs int64           `json:"t"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+// Writer 会话录制写入器，视频帧和输入事件可并发写入
+type Writer struct {
+	dir       string
+	mutex     sync.Mutex
+	frames    *os.File
+	framesBuf *bufio.Writer
+	events    *os.File
+
+	frameCount int
+	eventCount int
+	bytes      int64
+	lastTs     time.Duration
+	closed     bool
+}
+
+// Create 在目录中创建新的录制文件
+func Create(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建录制目录失败: %w", err)
+	}
+
+	frames, err := os.Create(filepath.Join(dir, FramesFile))
+	if err != nil {
+		return nil, fmt.Errorf("创建视频帧文件失败: %w", err)
+	}
+	events, err := os.Create(filepath.Join(dir, EventsFile))
+	if err != nil {
+		frames.Close()
+		return nil, fmt.Errorf("创建输入事件文件失败: %w", err)
+	}
+
+	w := &Writer{
+		dir:       dir,
+		frames:    frames,
+		framesBuf: bufio.NewWriterSize(frames, 256*1024),
+		events:    events,
+	}
+	if _, err := w.framesBuf.Write(framesMagic); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// WriteFrame 写入一帧视频
+func (w *Writer) WriteFrame(ts time.Duration, key bool, payload []byte) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errors.New("录制已结束")
+	}
+
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint64(header[0:8], uint64(ts/time.Microsecond))
+	if key {
+		header[8] = frameFlagKey
+	}
+	binary.BigEndian.PutUint32(header[9:13], uint32(len(payload)))
+
+	if _, err := w.framesBuf.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.framesBuf.Write(payload); err != nil {
+		return err
+	}
+
+	w.frameCount++
+	w.bytes += int64(frameHeaderSize + len(payload))
+	w.lastTs = ts
+	return nil
+}
+
+// WriteEvent 写入一条输入事件
+func (w *Writer) WriteEvent(ts time.Duration, msgType string, data json.RawMessage) error {
+	line, err := json.Marshal(Event{
+		TimeMs: int64(ts / time.Millisecond),
+		Type:   msgType,
+		Data:   data,
+	})
+	if err != nil {
+		return err
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return errors.New("录制已结束")
+	}
+	if _, err := w.events.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	w.eventCount++
+	w.bytes += int64(len(line) + 1)
+	return nil
+}
+
+// Stats 获取已写入的帧数、事件数、字节数和时长
+func (w *Writer) Stats() (frames int, events int, bytes int64, duration time.Duration) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.frameCount, w.eventCount, w.bytes, w.lastTs
+}
+
+// Close 刷新并关闭录制文件
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	var firstErr error
+	if err := w.framesBuf.Flush(); err != nil {
+		firstErr = err
+	}
+	if err := w.frames.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	if err := w.events.Close(); err != nil && firstErr == nil {
+		firstErr = err
+	}
+	return firstErr
+}
+
+// FrameReader 顺序读取录制的视频帧
+type FrameReader struct {
+	file   *os.File
+	reader *bufio.Reader
+}
+
+// OpenFrames 打开录制目录中的视频帧文件
+func OpenFrames(dir string) (*FrameReader, error) {
+	file, err := os.Open(filepath.Join(dir, FramesFile))
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReaderSize(file, 256*1024)
+	magic := make([]byte, len(framesMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != string(framesMagic) {
+		file.Close()
+		return nil, errors.New("不是有效的录制文件")
+	}
+
+	return &FrameReader{file: file, reader: reader}, nil
+}
+
+// Next 读取下一帧，读完时返回io.EOF；录制中断导致的不完整帧同样视为结束
+func (r *FrameReader) Next() (*Frame, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r.reader, header[:]); err != nil {
+		return nil, io.EOF
+	}
+
+	size := binary.BigEndian.Uint32(header[9:13])
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r.reader, payload); err != nil {
+		return nil, io.EOF
+	}
+
+	return &Frame{
+		Timestamp: time.Duration(binary.BigEndian.Uint64(header[0:8])) * time.Microsecond,
+		Key:       header[8]&frameFlagKey != 0,
+		Payload:   payload,
+	}, nil
+}
+
+// Close 关闭文件
+func (r *FrameReader) Close() error {
+	return r.file.Close()
+}
+
+// ReadEvents 读取录制目录中的全部输入事件
+func ReadEvents(dir string) ([]Event, error) {
+	file, err := os.Open(filepath.Join(dir, EventsFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []Event{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	events := []Event{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// 跳过录制中断时写了一半的行
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
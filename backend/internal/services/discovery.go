@@ -0,0 +1,265 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+)
+
+// 发现协议的消息类型，与Agent的pkg/discovery一致
+const (
+	discoveryQueryType = "winmanager.discover"
+	discoveryReplyType = "winmanager.server"
+)
+
+// 查询报文的最大长度
+const discoveryMaxPacket = 2048
+
+// discoveryQuery Agent广播的查询
+type discoveryQuery struct {
+	Type     string `json:"type"`
+	Hostname string `json:"hostname"`
+}
+
+// discoveryReply 回复给Agent的后端信息
+type discoveryReply struct {
+	Type           string `json:"type"`
+	URL            string `json:"url"`
+	Name           string `json:"name,omitempty"`
+	EnrollmentHint string `json:"enrollment_hint,omitempty"`
+}
+
+// DiscoveryService 局域网发现服务，响应未配置后端地址的Agent广播或组播的查询
+type DiscoveryService struct {
+	httpAddr  string // HTTP服务的监听地址，用于生成回复的后端地址
+	conn      *net.UDPConn
+	running   bool
+	mutex     sync.Mutex
+	queries   int
+	lastQuery time.Time
+	lastAgent string
+}
+
+// NewDiscoveryService 创建局域网发现服务实例
+func NewDiscoveryService(httpAddr string) *DiscoveryService {
+	return &DiscoveryService{httpAddr: httpAddr}
+}
+
+// Start 启动局域网发现服务
+func (ds *DiscoveryService) Start() error {
+	if ds.running {
+		logger.Warn("局域网发现服务已经在运行中")
+		return nil
+	}
+
+	cfg := config.GetDiscoveryConfig()
+	if cfg.Port <= 0 || cfg.Port > 65535 {
+		return fmt.Errorf("发现端口配置无效: %d", cfg.Port)
+	}
+
+	var conn *net.UDPConn
+	var err error
+	if cfg.Multicast != "" {
+		group := net.ParseIP(cfg.Multicast)
+		if group == nil || !group.IsMulticast() {
+			return fmt.Errorf("组播地址配置无效: %s", cfg.Multicast)
+		}
+		// 加入组播组后同时接收发往该端口的广播
+		conn, err = net.ListenMulticastUDP("udp4", nil, &net.UDPAddr{IP: group, Port: cfg.Port})
+	} else {
+		conn, err = net.ListenUDP("udp4", &net.UDPAddr{Port: cfg.Port})
+	}
+	if err != nil {
+		return fmt.Errorf("监听发现端口失败: %v", err)
+	}
+
+	ds.conn = conn
+	ds.running = true
+	go ds.serve()
+
+	logger.Infof("局域网发现服务启动成功，端口: %d, 组播: %s, 回复地址: %s", cfg.Port, cfg.Multicast, ds.advertisedURL(nil))
+	return nil
+}
+
+// Stop 停止局域网发现服务
+func (ds *DiscoveryService) Stop() {
+	if !ds.running {
+		logger.Warn("局域网发现服务未在运行")
+		return
+	}
+
+	logger.Info("正在停止局域网发现服务...")
+	ds.running = false
+	ds.conn.Close()
+}
+
+// serve 接收查询并回复，连接关闭后退出
+func (ds *DiscoveryService) serve() {
+	buf := make([]byte, discoveryMaxPacket)
+	for {
+		n, remote, err := ds.conn.ReadFromUDP(buf)
+		if err != nil {
+			if ds.running {
+				logger.Errorf("接收发现查询失败: %v", err)
+			}
+			logger.Info("局域网发现服务已停止")
+			return
+		}
+
+		var query discoveryQuery
+		if err := json.Unmarshal(buf[:n], &query); err != nil || query.Type != discoveryQueryType {
+			continue
+		}
+		ds.reply(query, remote)
+	}
+}
+
+// reply 回复后端地址和注册提示
+func (ds *DiscoveryService) reply(query discoveryQuery, remote *net.UDPAddr) {
+	cfg := config.GetDiscoveryConfig()
+	url := ds.advertisedURL(remote)
+	if url == "" {
+		logger.Warnf("无法确定回复给Agent的后端地址: Agent=%s", remote)
+		return
+	}
+
+	data, err := json.Marshal(discoveryReply{
+		Type:           discoveryReplyType,
+		URL:            url,
+		Name:           cfg.Name,
+		EnrollmentHint: enrollmentHint(cfg),
+	})
+	if err != nil {
+		return
+	}
+	if _, err := ds.conn.WriteToUDP(data, remote); err != nil {
+		logger.Errorf("回复发现查询失败: Agent=%s, 错误=%v", remote, err)
+		return
+	}
+
+	ds.mutex.Lock()
+	ds.queries++
+	ds.lastQuery = time.Now()
+	ds.lastAgent = remote.IP.String()
+	ds.mutex.Unlock()
+
+	logger.Infof("回复Agent发现查询: 主机名=%s, 地址=%s, 后端地址=%s", query.Hostname, remote, url)
+}
+
+// enrollmentHint 回复给Agent的注册提示，未配置时按注册准入配置生成
+func enrollmentHint(cfg config.DiscoveryConfig) string {
+	if cfg.EnrollmentHint != "" {
+		return cfg.EnrollmentHint
+	}
+	enrollment := config.GetEnrollmentConfig()
+	switch {
+	case !enrollment.Required:
+		return ""
+	case enrollment.PendingApproval:
+		return "首次注册需要注册令牌，没有令牌时等待管理员审批"
+	default:
+		return "首次注册需要注册令牌"
+	}
+}
+
+// advertisedURL 回复给Agent的后端地址：优先使用配置的地址，
+// 否则使用与Agent通信的本机网卡地址和HTTP服务端口
+func (ds *DiscoveryService) advertisedURL(remote *net.UDPAddr) string {
+	if url := config.GetDiscoveryConfig().URL; url != "" {
+		return url
+	}
+	if url := config.GetArtifactConfig().PublicURL; url != "" {
+		return url
+	}
+
+	host, port, err := net.SplitHostPort(ds.httpAddr)
+	if err != nil {
+		return ""
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		if remote == nil {
+			return ""
+		}
+		host = localIPFor(remote)
+		if host == "" {
+			return ""
+		}
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// localIPFor 返回访问remote时使用的本机地址（UDP连接不会发送数据）
+func localIPFor(remote *net.UDPAddr) string {
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: remote.IP, Port: remote.Port})
+	if err != nil {
+		return ""
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// GetStatus 获取服务状态信息
+func (ds *DiscoveryService) GetStatus() map[string]interface{} {
+	cfg := config.GetDiscoveryConfig()
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	status := map[string]interface{}{
+		"running":   ds.running,
+		"port":      cfg.Port,
+		"multicast": cfg.Multicast,
+		"url":       ds.advertisedURL(nil),
+		"queries":   ds.queries,
+	}
+	if !ds.lastQuery.IsZero() {
+		status["last_query"] = ds.lastQuery
+		status["last_agent"] = ds.lastAgent
+	}
+	return status
+}
+
+// 全局局域网发现服务实例
+var globalDiscoveryService *DiscoveryService
+
+// InitDiscoveryService 初始化全局局域网发现服务，httpAddr为HTTP服务的监听地址
+func InitDiscoveryService(httpAddr string) {
+	if globalDiscoveryService != nil {
+		logger.Warn("局域网发现服务已经初始化")
+		return
+	}
+
+	if !config.GetDiscoveryConfig().Enabled {
+		logger.Info("局域网发现服务未启用")
+		return
+	}
+
+	globalDiscoveryService = NewDiscoveryService(httpAddr)
+	if err := globalDiscoveryService.Start(); err != nil {
+		logger.Errorf("启动局域网发现服务失败: %v", err)
+		globalDiscoveryService = nil
+	}
+}
+
+// StopDiscoveryService 停止全局局域网发现服务
+func StopDiscoveryService() {
+	if globalDiscoveryService != nil {
+		globalDiscoveryService.Stop()
+		globalDiscoveryService = nil
+	}
+}
+
+// GetDiscoveryServiceStatus 获取全局局域网发现服务状态
+func GetDiscoveryServiceStatus() map[string]interface{} {
+	if globalDiscoveryService == nil {
+		return map[string]interface{}{
+			"running": false,
+			"enabled": config.GetDiscoveryConfig().Enabled,
+			"error":   "service not initialized",
+		}
+	}
+	return globalDiscoveryService.GetStatus()
+}
@@ -0,0 +1,443 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+)
+
+// ErrDistributionRunning 分发任务正在进行中
+var ErrDistributionRunning = errors.New("分发任务正在进行中")
+
+// agentFetchRequest Agent拉取文件请求参数
+type agentFetchRequest struct {
+	URL       string `json:"url"`
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	Overwrite string `json:"overwrite"`
+}
+
+// agentFetchResponse Agent拉取文件响应
+type agentFetchResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Error   string `json:"error"`
+	Data    struct {
+		Status string `json:"status"`
+		Path   string `json:"path"`
+		Bytes  int64  `json:"bytes"`
+	} `json:"data"`
+}
+
+// distributionRun 正在执行的分发任务
+type distributionRun struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// DistributionService 文件分发服务，按任务的并发上限让设备从后端拉取文件并记录每台设备的结果
+type DistributionService struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex      sync.Mutex
+	runs       map[uint]*distributionRun
+	delivering int
+	delivered  int64
+	failed     int64
+}
+
+// NewDistributionService 创建文件分发服务实例
+func NewDistributionService() *DistributionService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DistributionService{
+		ctx:    ctx,
+		cancel: cancel,
+		runs:   make(map[uint]*distributionRun),
+	}
+}
+
+// Start 启动文件分发服务，继续执行后端重启前未完成的任务
+func (ds *DistributionService) Start() {
+	jobs, err := models.ListRunningDistributionJobs()
+	if err != nil {
+		return
+	}
+
+	for i := range jobs {
+		// 重启前正在拉取的设备结果未知，重新分发（Agent会续传或识别出内容相同）
+		models.ResetDistributionResults(jobs[i].ID, []string{models.DistributionResultRunning})
+		logger.Infof("继续执行未完成的分发任务: ID=%d", jobs[i].ID)
+		ds.Run(&jobs[i])
+	}
+}
+
+// Stop 停止文件分发服务，进行中的任务保持运行状态，下次启动时继续
+func (ds *DistributionService) Stop() {
+	logger.Info("正在停止文件分发服务...")
+	ds.cancel()
+}
+
+// Run 开始执行分发任务
+func (ds *DistributionService) Run(job *models.DistributionJob) error {
+	ds.mutex.Lock()
+	if _, ok := ds.runs[job.ID]; ok {
+		ds.mutex.Unlock()
+		return ErrDistributionRunning
+	}
+	ctx, cancel := context.WithCancel(ds.ctx)
+	run := &distributionRun{ctx: ctx, cancel: cancel}
+	ds.runs[job.ID] = run
+	ds.mutex.Unlock()
+
+	go ds.execute(job, run)
+	return nil
+}
+
+// Cancel 取消分发任务，正在拉取的设备会中断，未开始的设备标记为已取消
+func (ds *DistributionService) Cancel(jobID uint) bool {
+	ds.mutex.Lock()
+	run, ok := ds.runs[jobID]
+	ds.mutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	if err := models.UpdateDistributionJob(jobID, map[string]interface{}{"status": models.DistributionStatusCancelled}); err != nil {
+		return false
+	}
+	run.cancel()
+	return true
+}
+
+// IsRunning 判断分发任务是否正在执行
+func (ds *DistributionService) IsRunning(jobID uint) bool {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+	_, ok := ds.runs[jobID]
+	return ok
+}
+
+// execute 按并发上限依次分发给各设备，全部结束后汇总任务结果
+func (ds *DistributionService) execute(job *models.DistributionJob, run *distributionRun) {
+	defer func() {
+		ds.mutex.Lock()
+		delete(ds.runs, job.ID)
+		ds.mutex.Unlock()
+		run.cancel()
+	}()
+
+	artifact, err := models.GetArtifact(int(job.ArtifactID))
+	results, listErr := models.ListDistributionResults(job.ID, models.DistributionResultPending)
+	if listErr != nil {
+		return
+	}
+
+	concurrency := job.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := range results {
+		if err != nil {
+			// 分发文件已被删除
+			ds.finishResult(&results[i], time.Now(), nil, fmt.Errorf("分发文件不存在"))
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-run.ctx.Done():
+		}
+		if run.ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(result *models.DistributionResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			ds.deliver(run.ctx, job, artifact, result)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	if ds.ctx.Err() != nil {
+		// 后端正在停止，任务保持运行状态，下次启动时继续
+		return
+	}
+
+	// 取消后未执行的设备
+	if run.ctx.Err() != nil {
+		pending, _ := models.ListDistributionResults(job.ID, models.DistributionResultPending)
+		for i := range pending {
+			models.UpdateDistributionResult(pending[i].ID, map[string]interface{}{"status": models.DistributionResultCancelled})
+		}
+	}
+
+	status := models.DistributionStatusCompleted
+	if current, err := models.GetDistributionJob(int(job.ID)); err == nil && current.Status == models.DistributionStatusCancelled {
+		status = models.DistributionStatusCancelled
+	}
+	now := time.Now()
+	data := ds.summarize(job.ID)
+	data["status"] = status
+	data["finished_at"] = &now
+	models.UpdateDistributionJob(job.ID, data)
+
+	logger.Infof("分发任务结束: ID=%d, 文件=%s, 状态=%s, 成功=%v, 跳过=%v, 失败=%v",
+		job.ID, job.ArtifactName, status, data["succeeded"], data["skipped"], data["failed"])
+}
+
+// deliver 让单台设备从后端拉取文件
+func (ds *DistributionService) deliver(ctx context.Context, job *models.DistributionJob, artifact *models.Artifact, result *models.DistributionResult) {
+	started := time.Now()
+	path := distributionTargetPath(job.TargetDir, job.Filename)
+
+	instance, err := models.GetInstance(result.InstanceID)
+	if err != nil {
+		ds.finishResult(result, started, nil, fmt.Errorf("设备不存在"))
+		return
+	}
+	if instance.Status != 1 {
+		ds.finishResult(result, started, nil, fmt.Errorf("设备离线"))
+		return
+	}
+
+	models.UpdateDistributionResult(result.ID, map[string]interface{}{
+		"status":     models.DistributionResultRunning,
+		"path":       path,
+		"lan":        instance.Lan,
+		"started_at": &started,
+	})
+
+	ds.mutex.Lock()
+	ds.delivering++
+	ds.mutex.Unlock()
+
+	resp, err := requestAgentFetch(ctx, instance, agentFetchRequest{
+		URL:       artifactDownloadURL(artifact.ID),
+		Path:      path,
+		SHA256:    artifact.SHA256,
+		Size:      artifact.Size,
+		Overwrite: job.Overwrite,
+	})
+
+	ds.mutex.Lock()
+	ds.delivering--
+	ds.mutex.Unlock()
+
+	if err != nil && ctx.Err() != nil && ds.ctx.Err() == nil {
+		// 任务被取消
+		finished := time.Now()
+		models.UpdateDistributionResult(result.ID, map[string]interface{}{
+			"status":      models.DistributionResultCancelled,
+			"error":       "任务已取消",
+			"finished_at": &finished,
+			"duration_ms": finished.Sub(started).Milliseconds(),
+		})
+		return
+	}
+	if err != nil && ds.ctx.Err() != nil {
+		// 后端正在停止，保持running状态，下次启动时重新分发
+		return
+	}
+
+	ds.finishResult(result, started, resp, err)
+	ds.refresh(job.ID)
+}
+
+// finishResult 记录单台设备的最终结果
+func (ds *DistributionService) finishResult(result *models.DistributionResult, started time.Time, resp *agentFetchResponse, err error) {
+	finished := time.Now()
+	data := map[string]interface{}{
+		"finished_at": &finished,
+		"duration_ms": finished.Sub(started).Milliseconds(),
+	}
+
+	if err != nil {
+		data["status"] = models.DistributionResultFailed
+		data["error"] = err.Error()
+		ds.mutex.Lock()
+		ds.failed++
+		ds.mutex.Unlock()
+	} else {
+		switch resp.Data.Status {
+		case "unchanged":
+			data["status"] = models.DistributionResultUnchanged
+		case "skipped":
+			data["status"] = models.DistributionResultSkipped
+		default:
+			data["status"] = models.DistributionResultSuccess
+		}
+		data["error"] = ""
+		data["bytes"] = resp.Data.Bytes
+		if resp.Data.Path != "" {
+			data["path"] = resp.Data.Path
+		}
+		ds.mutex.Lock()
+		ds.delivered++
+		ds.mutex.Unlock()
+	}
+
+	models.UpdateDistributionResult(result.ID, data)
+}
+
+// summarize 统计任务各状态的设备数
+func (ds *DistributionService) summarize(jobID uint) map[string]interface{} {
+	counts, err := models.CountDistributionResults(jobID)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"succeeded": counts[models.DistributionResultSuccess] + counts[models.DistributionResultUnchanged],
+		"skipped":   counts[models.DistributionResultSkipped],
+		"failed":    counts[models.DistributionResultFailed],
+	}
+}
+
+// refresh 更新任务的进度统计
+func (ds *DistributionService) refresh(jobID uint) {
+	if data := ds.summarize(jobID); len(data) > 0 {
+		models.UpdateDistributionJob(jobID, data)
+	}
+}
+
+// GetStatus 获取服务状态信息
+func (ds *DistributionService) GetStatus() map[string]interface{} {
+	cfg := config.GetArtifactConfig()
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	jobs := make([]uint, 0, len(ds.runs))
+	for id := range ds.runs {
+		jobs = append(jobs, id)
+	}
+	return map[string]interface{}{
+		"running":         ds.ctx.Err() == nil,
+		"dir":             cfg.Dir,
+		"public_url":      cfg.PublicURL,
+		"timeout_minutes": cfg.TimeoutMinutes,
+		"running_jobs":    jobs,
+		"delivering":      ds.delivering,
+		"delivered":       ds.delivered,
+		"failed":          ds.failed,
+	}
+}
+
+// distributionTargetPath 拼接设备上的目标路径，目标目录按设备的路径风格原样保留
+func distributionTargetPath(dir, filename string) string {
+	if dir == "" {
+		return filename
+	}
+	separator := "/"
+	if strings.Contains(dir, "\\") {
+		separator = "\\"
+	}
+	return strings.TrimRight(dir, "/\\") + separator + filename
+}
+
+// artifactDownloadURL Agent下载分发文件的地址，未配置公开地址时使用相对路径，由Agent基于自身的服务器地址解析
+func artifactDownloadURL(id uint) string {
+	path := fmt.Sprintf("/api/artifacts/%d/download", id)
+	if publicURL := config.GetArtifactConfig().PublicURL; publicURL != "" {
+		return strings.TrimRight(publicURL, "/") + path
+	}
+	return path
+}
+
+// requestAgentFetch 请求Agent从后端拉取文件，Agent下载并校验完成后才返回
+func requestAgentFetch(ctx context.Context, instance *models.Instance, params agentFetchRequest) (*agentFetchResponse, error) {
+	timeout := config.GetArtifactConfig().TimeoutMinutes
+	if timeout <= 0 {
+		timeout = 30
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Minute)
+	defer cancel()
+
+	body, _ := json.Marshal(params)
+	url := fmt.Sprintf("http://%s:%d/api/fetch", instance.Lan, config.GetAgentHTTPPort())
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var result agentFetchResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("Agent返回状态码 %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || result.Code != 0 {
+		message := result.Error
+		if message == "" {
+			message = result.Message
+		}
+		return nil, fmt.Errorf("Agent返回状态码 %d: %s", resp.StatusCode, message)
+	}
+	return &result, nil
+}
+
+// 全局文件分发服务实例
+var globalDistributionService *DistributionService
+
+// InitDistributionService 初始化全局文件分发服务
+func InitDistributionService() {
+	if globalDistributionService != nil {
+		logger.Warn("文件分发服务已经初始化")
+		return
+	}
+
+	globalDistributionService = NewDistributionService()
+	globalDistributionService.Start()
+}
+
+// StopDistributionService 停止全局文件分发服务
+func StopDistributionService() {
+	if globalDistributionService != nil {
+		globalDistributionService.Stop()
+		globalDistributionService = nil
+	}
+}
+
+// GetDistributionService 获取全局文件分发服务
+func GetDistributionService() *DistributionService {
+	return globalDistributionService
+}
+
+// GetDistributionServiceStatus 获取全局文件分发服务状态
+func GetDistributionServiceStatus() map[string]interface{} {
+	if globalDistributionService == nil {
+		return map[string]interface{}{
+			"running": false,
+			"error":   "service not initialized",
+		}
+	}
+	return globalDistributionService.GetStatus()
+}
@@ -0,0 +1,538 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+)
+
+// ErrIntegrityRunning 核对任务正在进行中
+var ErrIntegrityRunning = errors.New("核对任务正在进行中")
+
+// AgentHashManifest Agent返回的文件哈希清单
+type AgentHashManifest struct {
+	Root       string                `json:"root"`
+	IsDir      bool                  `json:"is_dir"`
+	Files      []models.BaselineFile `json:"files"`
+	Errors     []AgentHashError      `json:"errors"`
+	TotalBytes int64                 `json:"total_bytes"`
+	Elapsed    int64                 `json:"elapsed_ms"`
+}
+
+// AgentHashError Agent无法读取的文件
+type AgentHashError struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+}
+
+// agentHashResponse Agent计算哈希响应
+type agentHashResponse struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Error   string            `json:"error"`
+	Data    AgentHashManifest `json:"data"`
+}
+
+// integrityRun 正在执行的核对任务
+type integrityRun struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// IntegrityService 文件完整性核对服务，按任务的并发上限让设备计算哈希清单并与基线比较
+type IntegrityService struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mutex      sync.Mutex
+	runs       map[uint]*integrityRun
+	checking   int
+	matched    int64
+	mismatched int64
+	failed     int64
+}
+
+// NewIntegrityService 创建完整性核对服务实例
+func NewIntegrityService() *IntegrityService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &IntegrityService{
+		ctx:    ctx,
+		cancel: cancel,
+		runs:   make(map[uint]*integrityRun),
+	}
+}
+
+// Start 启动完整性核对服务，继续执行后端重启前未完成的任务
+func (is *IntegrityService) Start() {
+	checks, err := models.ListRunningIntegrityChecks()
+	if err != nil {
+		return
+	}
+
+	for i := range checks {
+		// 重启前正在核对的设备结果未知，重新核对
+		models.ResetIntegrityResults(checks[i].ID, []string{models.IntegrityResultRunning})
+		logger.Infof("继续执行未完成的核对任务: ID=%d", checks[i].ID)
+		is.Run(&checks[i])
+	}
+}
+
+// Stop 停止完整性核对服务，进行中的任务保持运行状态，下次启动时继续
+func (is *IntegrityService) Stop() {
+	logger.Info("正在停止完整性核对服务...")
+	is.cancel()
+}
+
+// Run 开始执行核对任务
+func (is *IntegrityService) Run(check *models.IntegrityCheck) error {
+	is.mutex.Lock()
+	if _, ok := is.runs[check.ID]; ok {
+		is.mutex.Unlock()
+		return ErrIntegrityRunning
+	}
+	ctx, cancel := context.WithCancel(is.ctx)
+	run := &integrityRun{ctx: ctx, cancel: cancel}
+	is.runs[check.ID] = run
+	is.mutex.Unlock()
+
+	go is.execute(check, run)
+	return nil
+}
+
+// Cancel 取消核对任务，正在核对的设备会中断，未开始的设备标记为已取消
+func (is *IntegrityService) Cancel(checkID uint) bool {
+	is.mutex.Lock()
+	run, ok := is.runs[checkID]
+	is.mutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	if err := models.UpdateIntegrityCheck(checkID, map[string]interface{}{"status": models.IntegrityStatusCancelled}); err != nil {
+		return false
+	}
+	run.cancel()
+	return true
+}
+
+// IsRunning 判断核对任务是否正在执行
+func (is *IntegrityService) IsRunning(checkID uint) bool {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+	_, ok := is.runs[checkID]
+	return ok
+}
+
+// execute 加载基线清单后按并发上限依次核对各设备，全部结束后汇总任务结果
+func (is *IntegrityService) execute(check *models.IntegrityCheck, run *integrityRun) {
+	defer func() {
+		is.mutex.Lock()
+		delete(is.runs, check.ID)
+		is.mutex.Unlock()
+		run.cancel()
+	}()
+
+	results, err := models.ListIntegrityResults(check.ID, models.IntegrityResultPending)
+	if err != nil {
+		return
+	}
+
+	baseline, err := models.GetBaseline(int(check.BaselineID))
+	var files []models.BaselineFile
+	if err == nil {
+		files, err = models.ListBaselineFiles(baseline.ID)
+	}
+
+	concurrency := check.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+
+	for i := range results {
+		if err != nil {
+			// 基线已被删除
+			is.finishResult(&results[i], time.Now(), nil, fmt.Errorf("基线不存在"))
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-run.ctx.Done():
+		}
+		if run.ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(result *models.IntegrityResult) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			is.verify(run.ctx, check, baseline, files, result)
+		}(&results[i])
+	}
+	wg.Wait()
+
+	if is.ctx.Err() != nil {
+		// 后端正在停止，任务保持运行状态，下次启动时继续
+		return
+	}
+
+	// 取消后未执行的设备
+	if run.ctx.Err() != nil {
+		pending, _ := models.ListIntegrityResults(check.ID, models.IntegrityResultPending)
+		for i := range pending {
+			models.UpdateIntegrityResult(pending[i].ID, map[string]interface{}{"status": models.IntegrityResultCancelled})
+		}
+	}
+
+	status := models.IntegrityStatusCompleted
+	if current, err := models.GetIntegrityCheck(int(check.ID)); err == nil && current.Status == models.IntegrityStatusCancelled {
+		status = models.IntegrityStatusCancelled
+	}
+	now := time.Now()
+	data := is.summarize(check.ID)
+	data["status"] = status
+	data["finished_at"] = &now
+	models.UpdateIntegrityCheck(check.ID, data)
+
+	logger.Infof("核对任务结束: ID=%d, 基线=%s, 状态=%s, 一致=%v, 差异=%v, 失败=%v",
+		check.ID, check.BaselineName, status, data["matched"], data["mismatched"], data["failed"])
+}
+
+// verify 让单台设备计算哈希清单并与基线比较
+func (is *IntegrityService) verify(ctx context.Context, check *models.IntegrityCheck, baseline *models.Baseline, files []models.BaselineFile, result *models.IntegrityResult) {
+	started := time.Now()
+
+	instance, err := models.GetInstance(result.InstanceID)
+	if err != nil {
+		is.finishResult(result, started, nil, fmt.Errorf("设备不存在"))
+		return
+	}
+	if instance.Status != 1 {
+		is.finishResult(result, started, nil, fmt.Errorf("设备离线"))
+		return
+	}
+
+	models.UpdateIntegrityResult(result.ID, map[string]interface{}{
+		"status":     models.IntegrityResultRunning,
+		"lan":        instance.Lan,
+		"started_at": &started,
+	})
+
+	is.mutex.Lock()
+	is.checking++
+	is.mutex.Unlock()
+
+	manifest, err := RequestAgentHash(ctx, instance, baseline.Root, baseline.MD5, baseline.Exclude)
+
+	is.mutex.Lock()
+	is.checking--
+	is.mutex.Unlock()
+
+	if err != nil && ctx.Err() != nil && is.ctx.Err() == nil {
+		// 任务被取消
+		finished := time.Now()
+		models.UpdateIntegrityResult(result.ID, map[string]interface{}{
+			"status":      models.IntegrityResultCancelled,
+			"error":       "任务已取消",
+			"finished_at": &finished,
+			"duration_ms": finished.Sub(started).Milliseconds(),
+		})
+		return
+	}
+	if err != nil && is.ctx.Err() != nil {
+		// 后端正在停止，保持running状态，下次启动时重新核对
+		return
+	}
+
+	var diff *ManifestDiff
+	if err == nil {
+		diff = CompareManifest(files, manifest, baseline.MD5, config.GetIntegrityConfig().MaxDiffItems)
+	}
+	is.finishResult(result, started, diff, err)
+	is.refresh(check.ID)
+}
+
+// finishResult 记录单台设备的最终结果
+func (is *IntegrityService) finishResult(result *models.IntegrityResult, started time.Time, diff *ManifestDiff, err error) {
+	finished := time.Now()
+	data := map[string]interface{}{
+		"finished_at": &finished,
+		"duration_ms": finished.Sub(started).Milliseconds(),
+	}
+
+	if err != nil {
+		data["status"] = models.IntegrityResultFailed
+		data["error"] = err.Error()
+		is.mutex.Lock()
+		is.failed++
+		is.mutex.Unlock()
+	} else {
+		data["error"] = ""
+		data["files"] = diff.Files
+		data["added"] = diff.AddedCount
+		data["removed"] = diff.RemovedCount
+		data["modified"] = diff.ModifiedCount
+		data["unreadable"] = diff.UnreadableCount
+		data["diff"] = &diff.IntegrityDiff
+		data["status"] = models.IntegrityResultMatch
+		if diff.Changed() {
+			data["status"] = models.IntegrityResultMismatch
+		}
+		is.mutex.Lock()
+		if diff.Changed() {
+			is.mismatched++
+		} else {
+			is.matched++
+		}
+		is.mutex.Unlock()
+	}
+
+	models.UpdateIntegrityResult(result.ID, data)
+}
+
+// summarize 统计任务各状态的设备数
+func (is *IntegrityService) summarize(checkID uint) map[string]interface{} {
+	counts, err := models.CountIntegrityResults(checkID)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{
+		"matched":    counts[models.IntegrityResultMatch],
+		"mismatched": counts[models.IntegrityResultMismatch],
+		"failed":     counts[models.IntegrityResultFailed],
+	}
+}
+
+// refresh 更新任务的进度统计
+func (is *IntegrityService) refresh(checkID uint) {
+	if data := is.summarize(checkID); len(data) > 0 {
+		models.UpdateIntegrityCheck(checkID, data)
+	}
+}
+
+// GetStatus 获取服务状态信息
+func (is *IntegrityService) GetStatus() map[string]interface{} {
+	cfg := config.GetIntegrityConfig()
+
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	checks := make([]uint, 0, len(is.runs))
+	for id := range is.runs {
+		checks = append(checks, id)
+	}
+	return map[string]interface{}{
+		"running":         is.ctx.Err() == nil,
+		"timeout_minutes": cfg.TimeoutMinutes,
+		"running_checks":  checks,
+		"checking":        is.checking,
+		"matched":         is.matched,
+		"mismatched":      is.mismatched,
+		"failed":          is.failed,
+	}
+}
+
+// ManifestDiff 比较结果，包含截断前的完整计数
+type ManifestDiff struct {
+	models.IntegrityDiff
+	Files           int
+	AddedCount      int
+	RemovedCount    int
+	ModifiedCount   int
+	UnreadableCount int
+}
+
+// Changed 设备文件是否与基线不一致（包括无法读取而无法确认的文件）
+func (d *ManifestDiff) Changed() bool {
+	return d.AddedCount+d.RemovedCount+d.ModifiedCount+d.UnreadableCount > 0
+}
+
+// CompareManifest 比较基线清单与设备清单，limit限制每类差异记录的条数（计数不受限制）
+// 位于设备无法读取的目录下的基线文件计为无法读取，不计为缺失
+func CompareManifest(expected []models.BaselineFile, actual *AgentHashManifest, checkMD5 bool, limit int) *ManifestDiff {
+	diff := &ManifestDiff{
+		IntegrityDiff: models.IntegrityDiff{
+			Added:      []string{},
+			Removed:    []string{},
+			Modified:   []models.IntegrityChange{},
+			Unreadable: []string{},
+		},
+		Files: len(actual.Files),
+	}
+	within := func(count int) bool {
+		if limit > 0 && count >= limit {
+			diff.Truncated = true
+			return false
+		}
+		return true
+	}
+
+	current := make(map[string]*models.BaselineFile, len(actual.Files))
+	for i := range actual.Files {
+		current[actual.Files[i].Path] = &actual.Files[i]
+	}
+	baseline := make(map[string]bool, len(expected))
+
+	unreadable := func(path string) bool {
+		for _, item := range actual.Errors {
+			if path == item.Path || strings.HasPrefix(path, item.Path+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := range expected {
+		want := &expected[i]
+		baseline[want.Path] = true
+
+		got, ok := current[want.Path]
+		if !ok {
+			if unreadable(want.Path) {
+				continue
+			}
+			diff.RemovedCount++
+			if within(len(diff.Removed)) {
+				diff.Removed = append(diff.Removed, want.Path)
+			}
+			continue
+		}
+
+		changed := got.Size != want.Size || !strings.EqualFold(got.SHA256, want.SHA256)
+		if checkMD5 && want.MD5 != "" && got.MD5 != "" && !strings.EqualFold(got.MD5, want.MD5) {
+			changed = true
+		}
+		if changed {
+			diff.ModifiedCount++
+			if within(len(diff.Modified)) {
+				diff.Modified = append(diff.Modified, models.IntegrityChange{
+					Path:           want.Path,
+					ExpectedSize:   want.Size,
+					ActualSize:     got.Size,
+					ExpectedSHA256: want.SHA256,
+					ActualSHA256:   got.SHA256,
+				})
+			}
+		}
+	}
+
+	for i := range actual.Files {
+		if path := actual.Files[i].Path; !baseline[path] {
+			diff.AddedCount++
+			if within(len(diff.Added)) {
+				diff.Added = append(diff.Added, path)
+			}
+		}
+	}
+	sort.Strings(diff.Added)
+
+	for _, item := range actual.Errors {
+		diff.UnreadableCount++
+		if within(len(diff.Unreadable)) {
+			diff.Unreadable = append(diff.Unreadable, item.Path)
+		}
+	}
+	return diff
+}
+
+// RequestAgentHash 请求Agent计算文件或目录树的哈希清单
+func RequestAgentHash(ctx context.Context, instance *models.Instance, root string, withMD5 bool, exclude []string) (*AgentHashManifest, error) {
+	timeout := config.GetIntegrityConfig().TimeoutMinutes
+	if timeout <= 0 {
+		timeout = 30
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(timeout)*time.Minute)
+	defer cancel()
+
+	query := url.Values{}
+	query.Set("path", root)
+	if withMD5 {
+		query.Set("md5", "true")
+	}
+	for _, pattern := range exclude {
+		query.Add("exclude", pattern)
+	}
+	target := fmt.Sprintf("http://%s:%d/api/files/hash?%s", instance.Lan, config.GetAgentHTTPPort(), query.Encode())
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result agentHashResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("Agent返回状态码 %d", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || result.Code != 0 {
+		message := result.Error
+		if message == "" {
+			message = result.Message
+		}
+		return nil, fmt.Errorf("Agent返回状态码 %d: %s", resp.StatusCode, message)
+	}
+	return &result.Data, nil
+}
+
+// 全局完整性核对服务实例
+var globalIntegrityService *IntegrityService
+
+// InitIntegrityService 初始化全局完整性核对服务
+func InitIntegrityService() {
+	if globalIntegrityService != nil {
+		logger.Warn("完整性核对服务已经初始化")
+		return
+	}
+
+	globalIntegrityService = NewIntegrityService()
+	globalIntegrityService.Start()
+}
+
+// StopIntegrityService 停止全局完整性核对服务
+func StopIntegrityService() {
+	if globalIntegrityService != nil {
+		globalIntegrityService.Stop()
+		globalIntegrityService = nil
+	}
+}
+
+// GetIntegrityService 获取全局完整性核对服务
+func GetIntegrityService() *IntegrityService {
+	return globalIntegrityService
+}
+
+// GetIntegrityServiceStatus 获取全局完整性核对服务状态
+func GetIntegrityServiceStatus() map[string]interface{} {
+	if globalIntegrityService == nil {
+		return map[string]interface{}{
+			"running": false,
+			"error":   "service not initialized",
+		}
+	}
+	return globalIntegrityService.GetStatus()
+}
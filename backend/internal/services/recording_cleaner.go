@@ -0,0 +1,204 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+)
+
+// RecordingCleaner 会话录制清理服务，按保留天数和总空间上限删除旧录制
+type RecordingCleaner struct {
+	ticker      *time.Ticker
+	stopChan    chan struct{}
+	running     bool
+	lastCleanup time.Time
+	lastRemoved int
+}
+
+// NewRecordingCleaner 创建录制清理服务实例
+func NewRecordingCleaner() *RecordingCleaner {
+	return &RecordingCleaner{
+		stopChan: make(chan struct{}),
+		running:  false,
+	}
+}
+
+// Start 启动录制清理服务
+func (rc *RecordingCleaner) Start() {
+	if rc.running {
+		logger.Warn("录制清理服务已经在运行中")
+		return
+	}
+
+	interval := config.GetRecordingConfig().CleanupIntervalMinutes
+	if interval <= 0 {
+		logger.Warn("录制清理间隔配置无效，使用默认值60分钟")
+		interval = 60
+	}
+
+	logger.Infof("启动录制清理服务，检查间隔: %d分钟", interval)
+
+	// 服务重启前仍在录制中的记录已无法继续
+	if count, err := models.MarkInterruptedRecordings(); err == nil && count > 0 {
+		logger.Warnf("检测到 %d 个因服务重启中断的录制", count)
+	}
+
+	rc.ticker = time.NewTicker(time.Duration(interval) * time.Minute)
+	rc.running = true
+
+	go func() {
+		defer func() {
+			rc.ticker.Stop()
+			rc.running = false
+			logger.Info("录制清理服务已停止")
+		}()
+
+		rc.cleanup()
+
+		for {
+			select {
+			case <-rc.ticker.C:
+				rc.cleanup()
+			case <-rc.stopChan:
+				return
+			}
+		}
+	}()
+
+	logger.Info("录制清理服务启动成功")
+}
+
+// Stop 停止录制清理服务
+func (rc *RecordingCleaner) Stop() {
+	if !rc.running {
+		logger.Warn("录制清理服务未在运行")
+		return
+	}
+
+	logger.Info("正在停止录制清理服务...")
+	close(rc.stopChan)
+}
+
+// cleanup 删除超过保留天数的录制，并在超出总空间上限时从最旧的开始删除
+func (rc *RecordingCleaner) cleanup() {
+	cfg := config.GetRecordingConfig()
+	removed := 0
+
+	if cfg.RetentionDays > 0 {
+		before := time.Now().AddDate(0, 0, -cfg.RetentionDays)
+		expired, err := models.ListRecordingsStartedBefore(before)
+		if err != nil {
+			logger.Errorf("查询过期录制失败: %v", err)
+		}
+		for i := range expired {
+			if err := RemoveRecording(&expired[i]); err != nil {
+				logger.Errorf("删除过期录制失败: ID=%d, 错误=%v", expired[i].ID, err)
+				continue
+			}
+			removed++
+		}
+	}
+
+	if cfg.MaxTotalMB > 0 {
+		limit := cfg.MaxTotalMB * 1024 * 1024
+		total, err := models.SumRecordingBytes()
+		if err == nil && total > limit {
+			recordings, err := models.ListFinishedRecordingsOldestFirst()
+			if err != nil {
+				logger.Errorf("查询录制列表失败: %v", err)
+			}
+			for i := range recordings {
+				if total <= limit {
+					break
+				}
+				if err := RemoveRecording(&recordings[i]); err != nil {
+					logger.Errorf("删除录制失败: ID=%d, 错误=%v", recordings[i].ID, err)
+					continue
+				}
+				total -= recordings[i].Bytes
+				removed++
+			}
+		}
+	}
+
+	rc.lastCleanup = time.Now()
+	rc.lastRemoved = removed
+	if removed > 0 {
+		logger.Infof("录制清理完成，删除 %d 个录制", removed)
+	} else {
+		logger.Debugf("录制清理完成，无需删除")
+	}
+}
+
+// GetStatus 获取服务状态信息
+func (rc *RecordingCleaner) GetStatus() map[string]interface{} {
+	cfg := config.GetRecordingConfig()
+	status := map[string]interface{}{
+		"running":                  rc.running,
+		"dir":                      cfg.Dir,
+		"retention_days":           cfg.RetentionDays,
+		"max_total_mb":             cfg.MaxTotalMB,
+		"cleanup_interval_minutes": cfg.CleanupIntervalMinutes,
+		"last_removed":             rc.lastRemoved,
+	}
+
+	if !rc.lastCleanup.IsZero() {
+		status["last_cleanup"] = rc.lastCleanup
+	}
+	if total, err := models.SumRecordingBytes(); err == nil {
+		status["total_bytes"] = total
+	}
+
+	return status
+}
+
+// RemoveRecording 删除录制文件和记录，录制中的会话不能删除
+func RemoveRecording(recording *models.Recording) error {
+	if recording.Status == models.RecordingStatusRecording {
+		return fmt.Errorf("录制进行中，无法删除")
+	}
+
+	if recording.Path != "" {
+		if err := os.RemoveAll(recording.Path); err != nil {
+			return fmt.Errorf("删除录制文件失败: %v", err)
+		}
+	}
+
+	return models.DeleteRecording(recording.ID)
+}
+
+// 全局录制清理服务实例
+var globalRecordingCleaner *RecordingCleaner
+
+// InitRecordingCleaner 初始化全局录制清理服务
+func InitRecordingCleaner() {
+	if globalRecordingCleaner != nil {
+		logger.Warn("录制清理服务已经初始化")
+		return
+	}
+
+	globalRecordingCleaner = NewRecordingCleaner()
+	globalRecordingCleaner.Start()
+}
+
+// StopRecordingCleaner 停止全局录制清理服务
+func StopRecordingCleaner() {
+	if globalRecordingCleaner != nil {
+		globalRecordingCleaner.Stop()
+		globalRecordingCleaner = nil
+	}
+}
+
+// GetRecordingCleanerStatus 获取全局录制清理服务状态
+func GetRecordingCleanerStatus() map[string]interface{} {
+	if globalRecordingCleaner == nil {
+		return map[string]interface{}{
+			"running": false,
+			"error":   "service not initialized",
+		}
+	}
+	return globalRecordingCleaner.GetStatus()
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+)
+
+// Thumbnail 设备最新的缩略图
+type Thumbnail struct {
+	InstanceID  uint      `json:"instance_id"`
+	Data        []byte    `json:"-"`
+	ContentType string    `json:"content_type"`
+	ETag        string    `json:"etag"`
+	CapturedAt  time.Time `json:"captured_at"`
+	Size        int       `json:"size"`
+	Error       string    `json:"error,omitempty"` // 最近一次采集失败的原因，成功后清空
+	ErrorAt     time.Time `json:"error_at,omitempty"`
+}
+
+// ThumbnailService 缩略图采集服务，定时从在线设备获取缩小后的截图并缓存
+type ThumbnailService struct {
+	ticker   *time.Ticker
+	stopChan chan struct{}
+	running  bool
+
+	mutex      sync.RWMutex
+	thumbnails map[uint]*Thumbnail
+	lastRound  time.Time
+	lastCost   time.Duration
+	lastOK     int
+	lastFailed int
+}
+
+// NewThumbnailService 创建缩略图采集服务实例
+func NewThumbnailService() *ThumbnailService {
+	return &ThumbnailService{
+		stopChan:   make(chan struct{}),
+		running:    false,
+		thumbnails: make(map[uint]*Thumbnail),
+	}
+}
+
+// Start 启动缩略图采集服务
+func (ts *ThumbnailService) Start() {
+	if ts.running {
+		logger.Warn("缩略图采集服务已经在运行中")
+		return
+	}
+
+	interval := config.GetThumbnailConfig().IntervalSeconds
+	if interval <= 0 {
+		logger.Warn("缩略图采集间隔配置无效，使用默认值30秒")
+		interval = 30
+	}
+
+	logger.Infof("启动缩略图采集服务，采集间隔: %d秒", interval)
+
+	ts.ticker = time.NewTicker(time.Duration(interval) * time.Second)
+	ts.running = true
+
+	go func() {
+		defer func() {
+			ts.ticker.Stop()
+			ts.running = false
+			logger.Info("缩略图采集服务已停止")
+		}()
+
+		ts.collect()
+
+		for {
+			select {
+			case <-ts.ticker.C:
+				// 采集耗时超过间隔时，期间的tick会被丢弃，不会重叠执行
+				ts.collect()
+			case <-ts.stopChan:
+				return
+			}
+		}
+	}()
+
+	logger.Info("缩略图采集服务启动成功")
+}
+
+// Stop 停止缩略图采集服务
+func (ts *ThumbnailService) Stop() {
+	if !ts.running {
+		logger.Warn("缩略图采集服务未在运行")
+		return
+	}
+
+	logger.Info("正在停止缩略图采集服务...")
+	close(ts.stopChan)
+}
+
+// collect 并发采集所有在线设备的缩略图
+func (ts *ThumbnailService) collect() {
+	instances, err := models.ListOnlineInstances()
+	if err != nil {
+		logger.Errorf("缩略图采集获取在线设备失败: %v", err)
+		return
+	}
+
+	concurrency := config.GetThumbnailConfig().Concurrency
+	if concurrency <= 0 {
+		concurrency = 8
+	}
+
+	start := time.Now()
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	var countMutex sync.Mutex
+	ok, failed := 0, 0
+
+	for i := range instances {
+		select {
+		case <-ts.stopChan:
+			wg.Wait()
+			return
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(instance *models.Instance) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			_, err := ts.Refresh(instance)
+			countMutex.Lock()
+			if err != nil {
+				failed++
+			} else {
+				ok++
+			}
+			countMutex.Unlock()
+		}(&instances[i])
+	}
+	wg.Wait()
+
+	ts.mutex.Lock()
+	ts.lastRound = start
+	ts.lastCost = time.Since(start)
+	ts.lastOK = ok
+	ts.lastFailed = failed
+	ts.mutex.Unlock()
+
+	logger.Debugf("缩略图采集完成: 成功=%d, 失败=%d, 耗时=%v", ok, failed, time.Since(start))
+}
+
+// Refresh 立即采集指定设备的缩略图并更新缓存
+// 采集失败时保留上一张缩略图，只记录错误
+func (ts *ThumbnailService) Refresh(instance *models.Instance) (*Thumbnail, error) {
+	data, contentType, err := fetchThumbnail(instance)
+
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	thumb := ts.thumbnails[instance.ID]
+	if thumb == nil {
+		thumb = &Thumbnail{InstanceID: instance.ID}
+		ts.thumbnails[instance.ID] = thumb
+	}
+
+	if err != nil {
+		logger.Debugf("采集缩略图失败: ID=%d, LAN=%s, 错误=%v", instance.ID, instance.Lan, err)
+		updated := *thumb
+		updated.Error = err.Error()
+		updated.ErrorAt = time.Now()
+		ts.thumbnails[instance.ID] = &updated
+		return nil, err
+	}
+
+	sum := sha1.Sum(data)
+	// 缓存中的条目只整体替换不原地修改，读取方拿到的指针可以安全使用
+	updated := &Thumbnail{
+		InstanceID:  instance.ID,
+		Data:        data,
+		ContentType: contentType,
+		ETag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+		CapturedAt:  time.Now(),
+		Size:        len(data),
+	}
+	ts.thumbnails[instance.ID] = updated
+	return updated, nil
+}
+
+// Get 获取设备缓存的缩略图
+func (ts *ThumbnailService) Get(instanceID uint) *Thumbnail {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+	return ts.thumbnails[instanceID]
+}
+
+// Remove 删除设备缓存的缩略图
+func (ts *ThumbnailService) Remove(instanceID uint) {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	delete(ts.thumbnails, instanceID)
+}
+
+// GetStatus 获取服务状态信息
+func (ts *ThumbnailService) GetStatus() map[string]interface{} {
+	cfg := config.GetThumbnailConfig()
+
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	var total int
+	for _, thumb := range ts.thumbnails {
+		total += thumb.Size
+	}
+
+	status := map[string]interface{}{
+		"running":          ts.running,
+		"interval_seconds": cfg.IntervalSeconds,
+		"concurrency":      cfg.Concurrency,
+		"max_width":        cfg.MaxWidth,
+		"max_height":       cfg.MaxHeight,
+		"cached":           len(ts.thumbnails),
+		"cached_bytes":     total,
+		"last_ok":          ts.lastOK,
+		"last_failed":      ts.lastFailed,
+		"last_cost_ms":     ts.lastCost.Milliseconds(),
+	}
+	if !ts.lastRound.IsZero() {
+		status["last_round"] = ts.lastRound
+	}
+
+	return status
+}
+
+// agentScreenshotRequest 发送给Agent的截图参数
+type agentScreenshotRequest struct {
+	Format    string `json:"format"`
+	Quality   int    `json:"quality"`
+	MaxWidth  int    `json:"max_width"`
+	MaxHeight int    `json:"max_height"`
+}
+
+// fetchThumbnail 请求Agent截取缩小后的屏幕截图
+func fetchThumbnail(instance *models.Instance) ([]byte, string, error) {
+	cfg := config.GetThumbnailConfig()
+	return fetchScreenshot(instance, agentScreenshotRequest{
+		Format:    "jpeg",
+		Quality:   cfg.Quality,
+		MaxWidth:  cfg.MaxWidth,
+		MaxHeight: cfg.MaxHeight,
+	}, cfg.TimeoutSeconds)
+}
+
+// fetchScreenshot 请求Agent截图，返回图片数据和Content-Type
+func fetchScreenshot(instance *models.Instance, params agentScreenshotRequest, timeout int) ([]byte, string, error) {
+	if timeout <= 0 {
+		timeout = 10
+	}
+
+	body, _ := json.Marshal(params)
+
+	url := fmt.Sprintf("http://%s:%d/api/screenshot", instance.Lan, config.GetAgentHTTPPort())
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		io.Copy(io.Discard, resp.Body)
+		return nil, "", fmt.Errorf("Agent返回状态码 %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(data) == 0 {
+		return nil, "", fmt.Errorf("Agent返回空截图")
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "image/jpeg"
+	}
+	return data, contentType, nil
+}
+
+// 全局缩略图采集服务实例
+var globalThumbnailService *ThumbnailService
+
+// InitThumbnailService 初始化全局缩略图采集服务
+// 未启用定时采集时仍创建缓存，按需刷新仍可使用
+func InitThumbnailService() {
+	if globalThumbnailService != nil {
+		logger.Warn("缩略图采集服务已经初始化")
+		return
+	}
+
+	globalThumbnailService = NewThumbnailService()
+	if config.GetThumbnailConfig().Enabled {
+		globalThumbnailService.Start()
+	} else {
+		logger.Info("缩略图定时采集未启用")
+	}
+}
+
+// StopThumbnailService 停止全局缩略图采集服务
+func StopThumbnailService() {
+	if globalThumbnailService != nil {
+		if globalThumbnailService.running {
+			globalThumbnailService.Stop()
+		}
+		globalThumbnailService = nil
+	}
+}
+
+// GetThumbnailService 获取全局缩略图采集服务
+func GetThumbnailService() *ThumbnailService {
+	return globalThumbnailService
+}
+
+// GetThumbnailServiceStatus 获取全局缩略图采集服务状态
+func GetThumbnailServiceStatus() map[string]interface{} {
+	if globalThumbnailService == nil {
+		return map[string]interface{}{
+			"running": false,
+			"error":   "service not initialized",
+		}
+	}
+	return globalThumbnailService.GetStatus()
+}
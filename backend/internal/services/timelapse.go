@@ -0,0 +1,389 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+	"winmanager-backend/internal/config"
+	"winmanager-backend/internal/logger"
+	"winmanager-backend/internal/models"
+)
+
+// 每轮清理一次最多处理的截图数
+const snapshotCleanupBatch = 500
+
+// TimelapseService 定时截图归档服务，按分组或设备策略定时保存截图并清理过期数据
+type TimelapseService struct {
+	ticker   *time.Ticker
+	stopChan chan struct{}
+	running  bool
+
+	mutex       sync.Mutex
+	lastCapture map[uint]time.Time // 每台设备最近一次截图的时间
+	capturing   map[uint]bool      // 正在截图的设备，避免重叠
+	lastCleanup time.Time
+	captured    int64
+	failed      int64
+	removed     int64
+}
+
+// NewTimelapseService 创建定时截图归档服务实例
+func NewTimelapseService() *TimelapseService {
+	return &TimelapseService{
+		stopChan:    make(chan struct{}),
+		running:     false,
+		lastCapture: make(map[uint]time.Time),
+		capturing:   make(map[uint]bool),
+	}
+}
+
+// Start 启动定时截图归档服务
+func (ts *TimelapseService) Start() {
+	if ts.running {
+		logger.Warn("截图归档服务已经在运行中")
+		return
+	}
+
+	interval := config.GetTimelapseConfig().CheckIntervalSeconds
+	if interval <= 0 {
+		logger.Warn("截图归档检查间隔配置无效，使用默认值10秒")
+		interval = 10
+	}
+
+	logger.Infof("启动截图归档服务，检查间隔: %d秒", interval)
+
+	ts.ticker = time.NewTicker(time.Duration(interval) * time.Second)
+	ts.running = true
+
+	go func() {
+		defer func() {
+			ts.ticker.Stop()
+			ts.running = false
+			logger.Info("截图归档服务已停止")
+		}()
+
+		ts.cleanup()
+
+		for {
+			select {
+			case <-ts.ticker.C:
+				ts.schedule()
+				if time.Since(ts.lastCleanup) >= ts.cleanupInterval() {
+					ts.cleanup()
+				}
+			case <-ts.stopChan:
+				return
+			}
+		}
+	}()
+
+	logger.Info("截图归档服务启动成功")
+}
+
+// Stop 停止定时截图归档服务
+func (ts *TimelapseService) Stop() {
+	if !ts.running {
+		logger.Warn("截图归档服务未在运行")
+		return
+	}
+
+	logger.Info("正在停止截图归档服务...")
+	close(ts.stopChan)
+}
+
+// cleanupInterval 清理检查间隔
+func (ts *TimelapseService) cleanupInterval() time.Duration {
+	minutes := config.GetTimelapseConfig().CleanupIntervalMinutes
+	if minutes <= 0 {
+		minutes = 30
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// schedule 为到达截图间隔的在线设备启动截图
+func (ts *TimelapseService) schedule() {
+	policies, err := models.LoadTimelapsePolicySet()
+	if err != nil {
+		return
+	}
+
+	instances, err := models.ListOnlineInstances()
+	if err != nil {
+		logger.Errorf("截图归档获取在线设备失败: %v", err)
+		return
+	}
+
+	concurrency := config.GetTimelapseConfig().Concurrency
+	if concurrency <= 0 {
+		concurrency = 4
+	}
+
+	now := time.Now()
+	ts.mutex.Lock()
+	running := len(ts.capturing)
+	var due []models.Instance
+	var duePolicies []models.TimelapsePolicy
+	for _, instance := range instances {
+		policy := policies.Resolve(int(instance.ID), instance.GroupID)
+		if !policy.Enabled || ts.capturing[instance.ID] {
+			continue
+		}
+		interval := time.Duration(policy.IntervalSeconds) * time.Second
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		if now.Sub(ts.lastCapture[instance.ID]) < interval {
+			continue
+		}
+		if running+len(due) >= concurrency {
+			// 超出并发上限的设备留到下一轮
+			break
+		}
+		ts.capturing[instance.ID] = true
+		due = append(due, instance)
+		duePolicies = append(duePolicies, policy)
+	}
+	ts.mutex.Unlock()
+
+	for i := range due {
+		go ts.capture(&due[i], duePolicies[i])
+	}
+}
+
+// capture 截取一张截图并归档
+func (ts *TimelapseService) capture(instance *models.Instance, policy models.TimelapsePolicy) {
+	started := time.Now()
+	_, err := ts.Capture(instance, policy)
+
+	ts.mutex.Lock()
+	delete(ts.capturing, instance.ID)
+	// 失败时同样按间隔重试，避免持续请求无响应的设备
+	ts.lastCapture[instance.ID] = started
+	ts.mutex.Unlock()
+
+	if err != nil {
+		logger.Debugf("截图归档失败: ID=%d, LAN=%s, 错误=%v", instance.ID, instance.Lan, err)
+	}
+}
+
+// Capture 按策略截取设备截图并保存到归档目录
+func (ts *TimelapseService) Capture(instance *models.Instance, policy models.TimelapsePolicy) (*models.Snapshot, error) {
+	cfg := config.GetTimelapseConfig()
+
+	data, _, err := fetchScreenshot(instance, agentScreenshotRequest{
+		Format:   "jpeg",
+		Quality:  policy.Quality,
+		MaxWidth: policy.MaxWidth,
+	}, 30)
+	if err != nil {
+		ts.mutex.Lock()
+		ts.failed++
+		ts.mutex.Unlock()
+		return nil, err
+	}
+
+	imgConfig, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format != "jpeg" {
+		ts.mutex.Lock()
+		ts.failed++
+		ts.mutex.Unlock()
+		return nil, fmt.Errorf("Agent返回的不是有效的JPEG图片")
+	}
+
+	now := time.Now()
+	dir := filepath.Join(cfg.Dir, strconv.Itoa(int(instance.ID)), now.Format("20060102"))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建截图归档目录失败: %v", err)
+	}
+	path := filepath.Join(dir, now.Format("150405.000")+".jpg")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("保存截图失败: %v", err)
+	}
+
+	snapshot := &models.Snapshot{
+		InstanceID: int(instance.ID),
+		CapturedAt: now,
+		Path:       path,
+		Size:       int64(len(data)),
+		Width:      imgConfig.Width,
+		Height:     imgConfig.Height,
+	}
+	if err := models.CreateSnapshot(snapshot); err != nil {
+		os.Remove(path)
+		return nil, err
+	}
+
+	ts.mutex.Lock()
+	ts.captured++
+	ts.mutex.Unlock()
+
+	return snapshot, nil
+}
+
+// cleanup 按策略保留天数和每台设备的空间上限清理截图，最后检查全局空间上限
+func (ts *TimelapseService) cleanup() {
+	ts.lastCleanup = time.Now()
+
+	policies, err := models.LoadTimelapsePolicySet()
+	if err != nil {
+		return
+	}
+	ids, err := models.ListSnapshotInstanceIDs()
+	if err != nil {
+		return
+	}
+
+	removed := 0
+	for _, id := range ids {
+		var groupID *int
+		if instance, err := models.GetInstance(id); err == nil {
+			groupID = instance.GroupID
+		}
+		policy := policies.Resolve(id, groupID)
+
+		if policy.RetentionDays > 0 {
+			before := time.Now().AddDate(0, 0, -policy.RetentionDays)
+			expired, err := models.ListSnapshotsBefore(id, before)
+			if err == nil {
+				removed += removeSnapshots(expired)
+			}
+		}
+
+		if policy.MaxTotalMB > 0 {
+			removed += trimSnapshots(id, policy.MaxTotalMB*1024*1024)
+		}
+	}
+
+	if maxTotal := config.GetTimelapseConfig().MaxTotalMB; maxTotal > 0 {
+		removed += trimSnapshots(0, maxTotal*1024*1024)
+	}
+
+	ts.mutex.Lock()
+	ts.removed += int64(removed)
+	ts.mutex.Unlock()
+
+	if removed > 0 {
+		logger.Infof("截图归档清理完成，删除 %d 张截图", removed)
+	}
+}
+
+// trimSnapshots 从最旧的截图开始删除，直到占用空间不超过上限；instanceID为0时针对全部设备
+func trimSnapshots(instanceID int, limit int64) int {
+	total, err := models.SumSnapshotBytes(instanceID)
+	if err != nil {
+		return 0
+	}
+
+	removed := 0
+	for total > limit {
+		oldest, err := models.ListOldestSnapshots(instanceID, snapshotCleanupBatch)
+		if err != nil || len(oldest) == 0 {
+			break
+		}
+
+		var batch []models.Snapshot
+		for _, snapshot := range oldest {
+			if total <= limit {
+				break
+			}
+			batch = append(batch, snapshot)
+			total -= snapshot.Size
+		}
+		removed += removeSnapshots(batch)
+	}
+	return removed
+}
+
+// removeSnapshots 删除截图文件和记录，返回删除的数量
+func removeSnapshots(snapshots []models.Snapshot) int {
+	if len(snapshots) == 0 {
+		return 0
+	}
+
+	ids := make([]uint, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if err := os.Remove(snapshot.Path); err != nil && !os.IsNotExist(err) {
+			logger.Errorf("删除截图文件失败: %s, 错误=%v", snapshot.Path, err)
+		}
+		// 删除后目录为空时一并删除日期目录
+		os.Remove(filepath.Dir(snapshot.Path))
+		ids = append(ids, snapshot.ID)
+	}
+
+	if err := models.DeleteSnapshots(ids); err != nil {
+		return 0
+	}
+	return len(ids)
+}
+
+// GetStatus 获取服务状态信息
+func (ts *TimelapseService) GetStatus() map[string]interface{} {
+	cfg := config.GetTimelapseConfig()
+
+	ts.mutex.Lock()
+	status := map[string]interface{}{
+		"running":                ts.running,
+		"dir":                    cfg.Dir,
+		"check_interval_seconds": cfg.CheckIntervalSeconds,
+		"concurrency":            cfg.Concurrency,
+		"max_total_mb":           cfg.MaxTotalMB,
+		"capturing":              len(ts.capturing),
+		"captured":               ts.captured,
+		"failed":                 ts.failed,
+		"removed":                ts.removed,
+	}
+	if !ts.lastCleanup.IsZero() {
+		status["last_cleanup"] = ts.lastCleanup
+	}
+	ts.mutex.Unlock()
+
+	if total, err := models.SumSnapshotBytes(0); err == nil {
+		status["total_bytes"] = total
+	}
+
+	return status
+}
+
+// 全局截图归档服务实例
+var globalTimelapseService *TimelapseService
+
+// InitTimelapseService 初始化全局截图归档服务
+func InitTimelapseService() {
+	if globalTimelapseService != nil {
+		logger.Warn("截图归档服务已经初始化")
+		return
+	}
+
+	globalTimelapseService = NewTimelapseService()
+	globalTimelapseService.Start()
+}
+
+// StopTimelapseService 停止全局截图归档服务
+func StopTimelapseService() {
+	if globalTimelapseService != nil {
+		globalTimelapseService.Stop()
+		globalTimelapseService = nil
+	}
+}
+
+// GetTimelapseService 获取全局截图归档服务
+func GetTimelapseService() *TimelapseService {
+	return globalTimelapseService
+}
+
+// GetTimelapseServiceStatus 获取全局截图归档服务状态
+func GetTimelapseServiceStatus() map[string]interface{} {
+	if globalTimelapseService == nil {
+		return map[string]interface{}{
+			"running": false,
+			"error":   "service not initialized",
+		}
+	}
+	return globalTimelapseService.GetStatus()
+}
@@ -43,6 +43,21 @@ func init() {
 
 	// 初始化离线检测服务
 	services.InitOfflineDetector()
+
+	// 初始化会话录制清理服务
+	services.InitRecordingCleaner()
+
+	// 初始化缩略图采集服务
+	services.InitThumbnailService()
+
+	// 初始化截图归档服务
+	services.InitTimelapseService()
+
+	// 初始化文件分发服务
+	services.InitDistributionService()
+
+	// 初始化完整性核对服务
+	services.InitIntegrityService()
 }
 
 func customVersionPrinter(c *cli.Context) {
@@ -95,6 +110,9 @@ func run(c *cli.Context) error {
 		}
 	}()
 
+	// 启动局域网发现服务，回复的后端地址使用HTTP服务的端口
+	services.InitDiscoveryService(c.String("http"))
+
 	// 等待中断信号
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -104,6 +122,24 @@ func run(c *cli.Context) error {
 	// 停止离线检测服务
 	services.StopOfflineDetector()
 
+	// 停止会话录制清理服务
+	services.StopRecordingCleaner()
+
+	// 停止缩略图采集服务
+	services.StopThumbnailService()
+
+	// 停止截图归档服务
+	services.StopTimelapseService()
+
+	// 停止文件分发服务
+	services.StopDistributionService()
+
+	// 停止完整性核对服务
+	services.StopIntegrityService()
+
+	// 停止局域网发现服务
+	services.StopDiscoveryService()
+
 	// 优雅关闭
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()